@@ -86,12 +86,12 @@ export default function ExplorePage() {
           }
           
           const [resourcesRes, tagsRes, profsRes] = await Promise.all([
-            apiClient.get('/api/resources'),
+            apiClient.get('/api/resources', { params: { limit: 100 } }),
             apiClient.get('/api/data/tags'),
             apiClient.get('/api/data/professors'),
           ]);
 
-          setAllResources(resourcesRes.data || []);
+          setAllResources(resourcesRes.data?.items || []);
           setFilterOptions({
             tags: tagsRes.data || [],
             professors: (profsRes.data || []).map((prof: any) => prof.name),
@@ -21,7 +21,6 @@ interface FileData {
   title: string;
   type: string;
   tags?: string[];
-  fileUrl: string;
   likes: number;
   fileName: string;
   description?: string;
@@ -131,7 +130,7 @@ export default function FilePage() {
 
   // --- NOVA E ROBUSTA FUNÇÃO getLocalFileUri ---
   const getLocalFileUri = useCallback(async (fileToDownload: FileData): Promise<string | null> => {
-    if (!fileToDownload?.fileName || !fileToDownload?.fileUrl) {
+    if (!fileToDownload?.fileName || !fileToDownload?.id) {
       console.error("Dados do arquivo inválidos:", fileToDownload);
       return null;
     }
@@ -149,7 +148,7 @@ export default function FilePage() {
 
       console.log(`Arquivo não está no cache. Baixando via Axios...`);
 
-      const response = await apiClient.get(fileToDownload.fileUrl, {
+      const response = await apiClient.get(`/api/resource/${fileToDownload.id}/download`, {
         responseType: 'blob',
       });
 
@@ -11,7 +11,6 @@ interface FileData {
   id: string;
   title: string;
   fileName: string;
-  fileUrl: string;
 }
 interface FilePreviewerProps {
   file: FileData;
@@ -20,7 +19,7 @@ interface FilePreviewerProps {
 
 
 export const FilePreviewerMobile: FC<FilePreviewerProps> = ({ file, backendUrl }) => {
-  const fileFullUrl = `${backendUrl}${file.fileUrl}`;
+  const fileFullUrl = `${backendUrl}/api/resource/${file.id}/download?view=true`;
   const fileExtension = file.fileName.split('.').pop()?.toLowerCase() || '';
 
   // Estado para o modal de imagem (lightbox)
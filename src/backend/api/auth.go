@@ -0,0 +1,324 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"uspshare/models"
+	"uspshare/rbac"
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Validades padrão do token de acesso e da sessão (o refresh token). A sessão é
+// renovada a cada uso, então só expira depois de DefaultRefreshTTL parada.
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// SetJWTSecret define a chave que assina os tokens de acesso. Sem ela nenhum token é
+// emitido nem aceito.
+func (h *Handler) SetJWTSecret(secret []byte) {
+	h.jwtSecret = secret
+}
+
+// SetSessionTTLs troca as validades do token de acesso e da sessão.
+func (h *Handler) SetSessionTTLs(access, refresh time.Duration) {
+	h.accessTTL = access
+	h.refreshTTL = refresh
+}
+
+// tokenPair é o que login e renovação devolvem. "token" é o token de acesso, com o
+// nome de antes dos refresh tokens.
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+// issueToken assina o token de acesso do usuário na sessão. O papel e as
+// permissões vão junto, para os middlewares não consultarem o usuário no banco; por
+// isso uma troca de papel só vale na próxima renovação.
+func (h *Handler) issueToken(user *models.User, sessionID primitive.ObjectID) (string, error) {
+	if len(h.jwtSecret) == 0 {
+		return "", errors.New("chave do JWT não configurada")
+	}
+	principal := rbac.For(user)
+	perms := make([]string, len(principal.Permissions))
+	for i, p := range principal.Permissions {
+		perms[i] = string(p)
+	}
+	claims := jwt.MapClaims{
+		"userId": user.ID.Hex(),
+		"sid":    sessionID.Hex(),
+		"role":   principal.Role,
+		"perms":  perms,
+		"exp":    time.Now().Add(h.accessTTL).Unix(),
+	}
+	if len(principal.Courses) > 0 {
+		claims["courses"] = principal.Courses
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.jwtSecret)
+}
+
+// newSecretToken sorteia a parte secreta de um refresh token ou de um link mandado
+// por e-mail e devolve também o hash que vai para o banco.
+func newSecretToken() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecretToken(secret), nil
+}
+
+func hashSecretToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP é o endereço de quem fez a requisição, sem a porta.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession abre uma sessão para o usuário no dispositivo da requisição e
+// devolve o primeiro par de tokens.
+func (h *Handler) startSession(r *http.Request, user *models.User) (*tokenPair, error) {
+	secret, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		RefreshHash: hash,
+		UserAgent:   r.UserAgent(),
+		IP:          clientIP(r),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(h.refreshTTL),
+	}
+	if err := h.store.Sessions.CreateSession(&session); err != nil {
+		return nil, err
+	}
+	return h.tokenPair(user, session.ID, secret)
+}
+
+func (h *Handler) tokenPair(user *models.User, sessionID primitive.ObjectID, secret string) (*tokenPair, error) {
+	token, err := h.issueToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenPair{
+		Token:        token,
+		RefreshToken: sessionID.Hex() + "." + secret,
+		ExpiresIn:    int64(h.accessTTL / time.Second),
+	}, nil
+}
+
+// HandleRefreshToken troca um refresh token por um novo par. O refresh token usado
+// deixa de valer; se um token já trocado aparecer de novo, alguém o copiou, e a
+// sessão inteira é revogada. Um segredo que nunca foi da sessão só é recusado.
+func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	sid, secret, _ := strings.Cut(req.RefreshToken, ".")
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil || secret == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+		return
+	}
+
+	now := time.Now()
+	session, err := h.store.Sessions.GetSession(sessionID)
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch session"})
+		return
+	}
+	if err == store.ErrNotFound || !session.Active(now) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+		return
+	}
+	hash := hashSecretToken(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshHash)) != 1 {
+		// O id da sessão não é segredo: só um token que já foi dessa sessão revoga ela.
+		if rotatedHash(session, hash) {
+			log.Printf("Refresh token reutilizado na sessão %s; sessão revogada.", sessionID.Hex())
+			if err := h.store.Sessions.RevokeSession(sessionID, session.UserID, now); err != nil && err != store.ErrNotFound {
+				log.Printf("Erro ao revogar a sessão %s: %v", sessionID.Hex(), err)
+			}
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+		return
+	}
+
+	user, err := h.store.Users.GetUserByID(session.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Account suspended"})
+		return
+	}
+
+	newSecret, newHash, err := newSecretToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to refresh session"})
+		return
+	}
+	err = h.store.Sessions.RotateSession(sessionID, store.SessionRotation{
+		OldHash:   hash,
+		NewHash:   newHash,
+		IP:        clientIP(r),
+		At:        now,
+		ExpiresAt: now.Add(h.refreshTTL),
+	})
+	if err == store.ErrNotFound {
+		// Outra renovação com o mesmo token ganhou a corrida.
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to refresh session"})
+		return
+	}
+
+	pair, err := h.tokenPair(user, sessionID, newSecret)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to issue token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// rotatedHash informa se hash é de um refresh token já trocado da sessão.
+func rotatedHash(session *models.Session, hash string) bool {
+	for _, old := range session.RotatedHashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(old)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionFrom devolve a sessão do token da requisição.
+func sessionFrom(r *http.Request) primitive.ObjectID {
+	id, _ := r.Context().Value(sessionContextKey).(primitive.ObjectID)
+	return id
+}
+
+// HandleLogout encerra a sessão do token usado na requisição.
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	err := h.store.Sessions.RevokeSession(sessionFrom(r), userID, time.Now())
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// HandleLogoutAll encerra todas as sessões do usuário, inclusive a atual.
+func (h *Handler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	revoked, err := h.store.Sessions.RevokeUserSessions(userID, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"message": "Logged out from all devices", "revoked": revoked})
+}
+
+// sessionView é uma sessão na lista do perfil; Current marca a da requisição.
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// HandleListSessions lista as sessões ativas do usuário logado.
+func (h *Handler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	sessions, err := h.store.Sessions.ListUserSessions(userID, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch sessions"})
+		return
+	}
+	current := sessionFrom(r)
+	views := make([]sessionView, len(sessions))
+	for i, s := range sessions {
+		views[i] = sessionView{Session: s, Current: s.ID == current}
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// HandleRevokeSession encerra uma sessão do usuário logado, por exemplo a de um
+// computador esquecido logado.
+func (h *Handler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	sessionID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+		return
+	}
+	if err := h.store.Sessions.RevokeSession(sessionID, userID, time.Now()); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Session not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to revoke session"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// principalFromClaims lê de volta o que issueToken pôs no token.
+func principalFromClaims(claims jwt.MapClaims) rbac.Principal {
+	p := rbac.Principal{Role: models.RoleStudent, Permissions: []rbac.Permission{}}
+	p.UserID, _ = claims["userId"].(string)
+	if role, ok := claims["role"].(string); ok && role != "" {
+		p.Role = role
+	}
+	for _, perm := range claimStrings(claims, "perms") {
+		p.Permissions = append(p.Permissions, rbac.Permission(perm))
+	}
+	p.Courses = claimStrings(claims, "courses")
+	return p
+}
+
+// claimStrings lê uma lista de strings do token; o JSON decodificado chega como []any.
+func claimStrings(claims jwt.MapClaims, key string) []string {
+	values, _ := claims[key].([]any)
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
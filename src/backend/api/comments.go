@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"uspshare/models"
+	"uspshare/rbac"
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// visibleComment busca o comentário da URL e responde 404 se ele não existe ou se o
+// recurso dele não está visível.
+func (h *Handler) visibleComment(w http.ResponseWriter, r *http.Request) (*models.Comment, bool) {
+	commentID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid comment ID"})
+		return nil, false
+	}
+	comment, err := h.store.Comments.GetCommentByID(commentID)
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comment"})
+		return nil, false
+	}
+	if err == store.ErrNotFound {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+		return nil, false
+	}
+	resource, err := h.store.Resources.GetResourceByID(comment.ResourceID)
+	if err != nil || !resource.Visible() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+		return nil, false
+	}
+	return comment, true
+}
+
+// isStaff informa se o usuário é da moderação (pode suspender contas). Contas da
+// equipe não são suspensas pela fila de denúncias.
+func (h *Handler) isStaff(userID primitive.ObjectID) bool {
+	user, err := h.store.Users.GetUserByID(userID)
+	return err == nil && rbac.For(user).Can(rbac.SuspendUsers)
+}
+
+// canModerateComment informa se quem fez a requisição pode apagar o comentário de
+// outra pessoa: moderadores em qualquer recurso, monitores e curadores nos recursos
+// das suas disciplinas.
+func (h *Handler) canModerateComment(r *http.Request, comment *models.Comment) bool {
+	resource, err := h.store.Resources.GetResourceByID(comment.ResourceID)
+	return err == nil && principalFrom(r).CanInCourse(rbac.ModerateComments, resource.CourseCode)
+}
+
+// HandleEditComment troca o texto de um comentário do usuário logado. O texto anterior
+// vai para o histórico e o comentário passa a mostrar editedAt.
+func (h *Handler) HandleEditComment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	comment, ok := h.visibleComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.UserID != userID {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "You can only edit your own comments"})
+		return
+	}
+	if comment.DeletedAt != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Comment content is required"})
+		return
+	}
+	if req.Content == comment.Content {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Comment content is unchanged"})
+		return
+	}
+
+	if err := h.store.Comments.EditComment(comment.ID, userID, req.Content, time.Now()); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to edit comment"})
+		return
+	}
+
+	updated, err := h.store.Comments.GetCommentWithAuthorByID(comment.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Comment edited, but failed to retrieve it"})
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// HandleDeleteComment apaga um comentário a pedido do autor ou da moderação (ver
+// canModerateComment). O comentário continua na árvore como "[removed]", para as
+// respostas não ficarem soltas. O do autor vai para a lixeira dele e pode ser
+// restaurado até o prazo vencer. Quando é a moderação, o texto sai na hora, as
+// denúncias abertas do comentário são fechadas e a decisão vai para a auditoria.
+func (h *Handler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	comment, ok := h.visibleComment(w, r)
+	if !ok {
+		return
+	}
+	moderator := comment.UserID != userID && h.canModerateComment(r, comment)
+	if comment.UserID != userID && !moderator {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "You can only delete your own comments"})
+		return
+	}
+
+	var err error
+	if moderator {
+		err = h.store.Comments.RemoveComment(comment.ID, time.Now())
+	} else {
+		err = h.store.Comments.TrashComment(comment.ID, userID, time.Now())
+	}
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete comment"})
+		return
+	}
+	if moderator {
+		// Apagar o comentário de outra pessoa é uma decisão de moderação.
+		decision := models.ModerationAction{
+			AdminID:    userID,
+			Action:     models.ModerationDelete,
+			TargetType: models.ReportTargetComment,
+			TargetID:   comment.ID,
+		}
+		if _, err := h.recordModeration(decision); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Comment deleted, but failed to resolve its reports"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Comment deleted"})
+}
+
+// HandleCommentHistory devolve os textos anteriores de um comentário, do mais antigo
+// para o mais recente. Comentários apagados não têm histórico.
+func (h *Handler) HandleCommentHistory(w http.ResponseWriter, r *http.Request) {
+	comment, ok := h.visibleComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.DeletedAt != nil {
+		writeJSON(w, http.StatusOK, []models.CommentEdit{})
+		return
+	}
+	edits, err := h.store.Comments.ListCommentEdits(comment.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comment history"})
+		return
+	}
+	writeJSON(w, http.StatusOK, edits)
+}
+
+// HandleReportComment põe um comentário na fila de moderação.
+func (h *Handler) HandleReportComment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	comment, ok := h.visibleComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.DeletedAt != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+		return
+	}
+	if comment.UserID == userID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "You cannot report your own comment"})
+		return
+	}
+	h.fileReport(w, r, models.Report{
+		TargetType: models.ReportTargetComment,
+		TargetID:   comment.ID,
+		OwnerID:    comment.UserID,
+		ResourceID: &comment.ResourceID,
+		Content:    comment.Content,
+	})
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"uspshare/models"
+	"uspshare/realtime"
+	"uspshare/store"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// eventHeartbeat é o intervalo dos comentários (SSE) e pings (WebSocket) que mantêm
+// a conexão viva através de proxies. A cada um, o canal confere se a sessão
+// continua ativa e o token continua valendo; se não, a conexão é encerrada e o
+// cliente precisa abrir outra com um token novo.
+const eventHeartbeat = 25 * time.Second
+
+// streamTicketTTL é quanto tempo um tíquete do canal de eventos vale para abrir a
+// conexão.
+const streamTicketTTL = 30 * time.Second
+
+// streamTicketKey assina os tíquetes do canal de eventos. Ela sai da chave do JWT,
+// mas é outra, para um tíquete não valer como token de acesso.
+func (h *Handler) streamTicketKey() []byte {
+	mac := hmac.New(sha256.New, h.jwtSecret)
+	mac.Write([]byte("stream-ticket"))
+	return mac.Sum(nil)
+}
+
+// HandleStreamTicket troca o token de acesso do header por um tíquete de uso único
+// para abrir o canal de eventos. O EventSource e o WebSocket do navegador não mandam
+// o header Authorization, e o tíquete vai na URL (?ticket=) no lugar do token, que
+// apareceria nos logs de acesso, em proxies e no histórico. A conexão aberta com o
+// tíquete dura o mesmo que o token de acesso.
+func (h *Handler) HandleStreamTicket(w http.ResponseWriter, r *http.Request) {
+	sessionID, _ := r.Context().Value(sessionContextKey).(primitive.ObjectID)
+	accessExpires, _ := r.Context().Value(expiresContextKey).(time.Time)
+	principal := principalFrom(r)
+
+	expires := time.Now().Add(streamTicketTTL)
+	if accessExpires.Before(expires) {
+		expires = accessExpires
+	}
+	perms := make([]string, len(principal.Permissions))
+	for i, p := range principal.Permissions {
+		perms[i] = string(p)
+	}
+	claims := jwt.MapClaims{
+		"jti":       primitive.NewObjectID().Hex(),
+		"userId":    principal.UserID,
+		"sid":       sessionID.Hex(),
+		"role":      principal.Role,
+		"perms":     perms,
+		"exp":       expires.Unix(),
+		"accessExp": accessExpires.Unix(),
+	}
+	if len(principal.Courses) > 0 {
+		claims["courses"] = principal.Courses
+	}
+	ticket, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.streamTicketKey())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to issue stream ticket"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ticket": ticket, "expiresIn": int64(streamTicketTTL / time.Second)})
+}
+
+// StreamAuthMiddleware autentica o canal de eventos pelo tíquete de ?ticket= (ver
+// HandleStreamTicket) ou, sem ele, pelo header Authorization, como AuthMiddleware.
+// Cada tíquete abre uma conexão só.
+func (h *Handler) StreamAuthMiddleware(next http.Handler) http.Handler {
+	withHeader := h.AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			withHeader.ServeHTTP(w, r)
+			return
+		}
+		ctx, claims, msg := h.authenticate(r.Context(), ticket, h.streamTicketKey())
+		if msg != "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": msg})
+			return
+		}
+		jti, _ := claims["jti"].(string)
+		accessExp, _ := claims["accessExp"].(float64)
+		if jti == "" || accessExp == 0 || !h.redeemStreamTicket(jti) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired token"})
+			return
+		}
+		ctx = context.WithValue(ctx, expiresContextKey, time.Unix(int64(accessExp), 0))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// redeemStreamTicket marca o tíquete como usado no backend dos limites, que é
+// compartilhado entre as instâncias, e informa se esta é a primeira vez.
+func (h *Handler) redeemStreamTicket(jti string) bool {
+	now := time.Now()
+	s, err := h.streamTickets.Update("stream-ticket:"+jti, now, func(s *models.RateLimit) {
+		s.Failures++
+		s.UpdatedAt = now
+		s.ExpiresAt = now.Add(streamTicketTTL)
+	})
+	if err != nil {
+		log.Printf("Erro ao registrar o uso do tíquete do canal de eventos: %v", err)
+		return false
+	}
+	return s.Failures == 1
+}
+
+// openEventStream inscreve a conexão no hub, vendo o recurso de ?resource= se houver,
+// e devolve também a contagem de não lidas e os eventos perdidos desde o
+// Last-Event-ID (header ou ?lastEventId=). Responde o erro e devolve ok = false se o
+// recurso não existe.
+func (h *Handler) openEventStream(w http.ResponseWriter, r *http.Request) (*realtime.Subscription, []realtime.Event, bool) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	var resourceID primitive.ObjectID
+	if hex := r.URL.Query().Get("resource"); hex != "" {
+		id, status, err := h.watchableResource(hex)
+		if err != nil {
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return nil, nil, false
+		}
+		resourceID = id
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	// A contagem sai antes da inscrição: se uma notificação chegar no meio, o evento
+	// dela traz a contagem nova logo depois.
+	var first []realtime.Event
+	if ev, err := h.unreadEvent(userID); err == nil {
+		first = append(first, ev)
+	} else {
+		log.Printf("Erro ao contar as notificações não lidas de %s: %v", userID.Hex(), err)
+	}
+	sub, missed := h.events.Subscribe(userID, resourceID, lastEventID)
+	return sub, append(first, missed...), true
+}
+
+// watchableResource confere se o recurso pode ser acompanhado pelo canal.
+func (h *Handler) watchableResource(hex string) (primitive.ObjectID, int, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return id, http.StatusBadRequest, errors.New("Invalid resource ID")
+	}
+	resource, err := h.store.Resources.GetResourceByID(id)
+	if err == store.ErrNotFound || (err == nil && !resource.Visible()) {
+		return id, http.StatusNotFound, errors.New("Resource not found")
+	}
+	if err != nil {
+		return id, http.StatusInternalServerError, errors.New("Failed to fetch resource")
+	}
+	return id, http.StatusOK, nil
+}
+
+// unreadEvent monta o EventUnread com a contagem atual, sem passar pelo hub: é o
+// estado inicial de uma conexão nova.
+func (h *Handler) unreadEvent(userID primitive.ObjectID) (realtime.Event, error) {
+	count, err := h.store.Notifications.CountUnreadNotifications(userID)
+	if err != nil {
+		return realtime.Event{}, err
+	}
+	data, _ := json.Marshal(map[string]int64{"count": count})
+	return realtime.Event{Type: realtime.EventUnread, Data: data}, nil
+}
+
+// streamAlive informa se o token e a sessão da conexão ainda valem.
+func (h *Handler) streamAlive(r *http.Request) bool {
+	now := time.Now()
+	if expires, ok := r.Context().Value(expiresContextKey).(time.Time); ok && !now.Before(expires) {
+		return false
+	}
+	sessionID, _ := r.Context().Value(sessionContextKey).(primitive.ObjectID)
+	session, err := h.store.Sessions.GetSession(sessionID)
+	return err == nil && session.Active(now)
+}
+
+// HandleEventStream é o canal de eventos por Server-Sent Events: GET /api/events.
+func (h *Handler) HandleEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
+		return
+	}
+	sub, backlog, ok := h.openEventStream(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// O nginx guarda as respostas em buffer por padrão, o que atrasaria os eventos.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// O navegador espera 3 segundos antes de reconectar.
+	w.Write([]byte("retry: 3000\n\n"))
+	for _, ev := range backlog {
+		realtime.WriteSSE(w, ev)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, open := <-sub.Events():
+			if !open {
+				// Ficou para trás: o cliente reconecta com o Last-Event-ID e recebe o
+				// que perdeu pelo histórico.
+				return
+			}
+			if err := realtime.WriteSSE(w, ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if !h.streamAlive(r) {
+				return
+			}
+			if err := realtime.WriteSSEComment(w, "ping"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// HandleEventSocket é o canal de eventos por WebSocket: GET /api/ws. Os eventos vão
+// como mensagens JSON {"id", "type", "data"}. O cliente pode trocar o recurso
+// acompanhado mandando {"type": "watch", "resourceId": "..."} (vazio para nenhum); a
+// troca é confirmada com {"type": "watching"}.
+func (h *Handler) HandleEventSocket(w http.ResponseWriter, r *http.Request) {
+	if !realtime.IsWebSocketUpgrade(r) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Expected a WebSocket handshake"})
+		return
+	}
+	sub, backlog, ok := h.openEventStream(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := realtime.Upgrade(w, r)
+	if err != nil {
+		log.Printf("Erro no handshake do WebSocket: %v", err)
+		return
+	}
+
+	send := func(ev realtime.Event) error {
+		msg, _ := json.Marshal(ev)
+		return conn.WriteText(msg)
+	}
+	for _, ev := range backlog {
+		if err := send(ev); err != nil {
+			conn.Close(realtime.CloseGoingAway, "")
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			msg, err := conn.ReadText()
+			if err != nil {
+				return
+			}
+			h.handleSocketMessage(sub, msg, send)
+		}
+	}()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case ev, open := <-sub.Events():
+			if !open {
+				conn.Close(realtime.CloseGoingAway, "client too slow")
+				return
+			}
+			if err := send(ev); err != nil {
+				conn.Close(realtime.CloseGoingAway, "")
+				return
+			}
+		case <-heartbeat.C:
+			if !h.streamAlive(r) {
+				conn.Close(realtime.ClosePolicy, "session expired")
+				return
+			}
+			if err := conn.Ping(); err != nil {
+				conn.Close(realtime.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// handleSocketMessage trata um comando do cliente do WebSocket.
+func (h *Handler) handleSocketMessage(sub *realtime.Subscription, msg []byte, send func(realtime.Event) error) {
+	var cmd struct {
+		Type       string `json:"type"`
+		ResourceID string `json:"resourceId"`
+	}
+	if err := json.Unmarshal(msg, &cmd); err != nil || cmd.Type != "watch" {
+		sendSocketError(send, "Unknown command")
+		return
+	}
+	var id primitive.ObjectID
+	if cmd.ResourceID != "" {
+		var err error
+		if id, _, err = h.watchableResource(cmd.ResourceID); err != nil {
+			sendSocketError(send, err.Error())
+			return
+		}
+	}
+	sub.Watch(id)
+	data, _ := json.Marshal(map[string]string{"resourceId": cmd.ResourceID})
+	send(realtime.Event{Type: "watching", Data: data})
+}
+
+func sendSocketError(send func(realtime.Event) error, message string) {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	send(realtime.Event{Type: "error", Data: data})
+}
+
+// notify entrega a notificação pelos canais que o destinatário escolheu para o
+// tipo dela: grava na lista, publica em tempo real e manda por e-mail. Uma
+// notificação fora da lista só é entregue na hora.
+func (h *Handler) notify(notification *models.Notification) error {
+	prefs := h.notificationPreferences(notification.UserID)
+	if prefs.Channels(notification.Type).InApp {
+		if err := h.store.Notifications.CreateNotification(notification); err != nil {
+			return err
+		}
+	}
+	h.deliver(notification, prefs)
+	return nil
+}
+
+// deliver entrega uma notificação, já gravada se ela vai para a lista, em tempo real
+// e por e-mail. No horário de silêncio só a contagem de não lidas muda na hora: o
+// e-mail fica na fila até o silêncio acabar e nada sai em tempo real.
+func (h *Handler) deliver(notification *models.Notification, prefs *models.NotificationPreferences) {
+	channels := prefs.Channels(notification.Type)
+	now := time.Now()
+	quiet := prefs.QuietHours.Quiet(now)
+	if channels.Push && !quiet {
+		if err := h.events.Publish(notification.UserID, realtime.EventNotification, notification); err != nil {
+			log.Printf("Erro ao publicar a notificação %s: %v", notification.ID.Hex(), err)
+		}
+	}
+	if channels.InApp {
+		h.pushUnread(notification.UserID)
+	}
+	if channels.Email {
+		var at time.Time
+		if quiet {
+			at = prefs.QuietHours.QuietUntil(now)
+		}
+		if err := h.emailNotification(notification, at); err != nil {
+			log.Printf("Erro ao mandar a notificação %s por e-mail: %v", notification.ID.Hex(), err)
+		}
+	}
+}
+
+// pushUnread publica a contagem de não lidas do usuário, se ele estiver conectado.
+func (h *Handler) pushUnread(userID primitive.ObjectID) {
+	if h.events.Connections(userID) == 0 {
+		return
+	}
+	count, err := h.store.Notifications.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Printf("Erro ao contar as notificações não lidas de %s: %v", userID.Hex(), err)
+		return
+	}
+	h.events.Publish(userID, realtime.EventUnread, map[string]int64{"count": count})
+}
+
+// pushComment entrega um comentário novo a quem está vendo o recurso.
+func (h *Handler) pushComment(resourceID primitive.ObjectID, comment *models.CommentWithAuthor) {
+	err := h.events.PublishResource(resourceID, realtime.EventComment, map[string]any{
+		"resourceId": resourceID,
+		"comment":    comment,
+	})
+	if err != nil {
+		log.Printf("Erro ao publicar o comentário %s: %v", comment.ID.Hex(), err)
+	}
+}
@@ -1,40 +1,140 @@
 package api
 
 import (
-	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 	"uspshare/badge"
-	"uspshare/config"
-	"uspshare/database"
+	"uspshare/blob"
+	"uspshare/mail"
 	"uspshare/models"
+	"uspshare/processing"
+	"uspshare/ratelimit"
+	"uspshare/rbac"
+	"uspshare/realtime"
+	"uspshare/resumable"
+	"uspshare/scan"
+	"uspshare/search"
 	"uspshare/store"
-
-	"io"
-	"os"
-	"path/filepath"
+	"uspshare/trash"
+	"uspshare/validation"
 
 	"github.com/google/uuid"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/golang-jwt/jwt/v5"
 )
 
+// Handler reúne as dependências dos handlers HTTP. Os repositórios chegam
+// prontos de main (MongoDB) ou dos testes (memória).
+type Handler struct {
+	store    *store.Store
+	search   *search.Index
+	pipeline *processing.Pipeline
+	blobs    blob.Store
+	uploads  *resumable.Manager
+	scanner  scan.Scanner
+
+	uploadPolicy   validation.Policy
+	avatarPolicy   validation.Policy
+	trashRetention time.Duration
+	accessTTL      time.Duration
+	refreshTTL     time.Duration
+	jwtSecret      []byte
+
+	mailer          mail.Mailer
+	appURL          string
+	emailDomains    []string
+	verificationTTL time.Duration
+	resetTTL        time.Duration
+	// notificationMail manda as notificações por e-mail sem segurar a requisição.
+	notificationMail *mail.Queue
+
+	limiter    *ratelimit.Limiter
+	lockout    *ratelimit.Lockout
+	rateLimits RateLimits
+	// streamTickets registra os tíquetes do canal de eventos já usados.
+	streamTickets ratelimit.Backend
+
+	events *realtime.Hub
+}
+
+func NewHandler(s *store.Store, idx *search.Index, pipeline *processing.Pipeline, blobs blob.Store,
+	uploads *resumable.Manager, scanner scan.Scanner) *Handler {
+	limits := ratelimit.NewMemory()
+	return &Handler{
+		store:          s,
+		search:         idx,
+		pipeline:       pipeline,
+		blobs:          blobs,
+		uploads:        uploads,
+		scanner:        scanner,
+		uploadPolicy:   validation.DefaultPolicy(),
+		avatarPolicy:   validation.AvatarPolicy(),
+		trashRetention: trash.DefaultRetention,
+		accessTTL:      DefaultAccessTTL,
+		refreshTTL:     DefaultRefreshTTL,
+
+		mailer:          mail.LogMailer{},
+		appURL:          DefaultAppURL,
+		emailDomains:    DefaultEmailDomains,
+		verificationTTL: DefaultVerificationTTL,
+		resetTTL:        DefaultPasswordResetTTL,
+
+		notificationMail: mail.NewQueue(mail.LogMailer{}, mail.DefaultQueueWorkers),
+
+		limiter:    ratelimit.NewLimiter(limits),
+		lockout:    ratelimit.NewLockout(limits, ratelimit.DefaultLockout),
+		rateLimits: DefaultRateLimits,
+
+		streamTickets: limits,
+
+		events: realtime.NewHub(realtime.DefaultHistory),
+	}
+}
+
+// SetUploadPolicy troca os tipos e limites aceitos no upload de materiais.
+func (h *Handler) SetUploadPolicy(p validation.Policy) {
+	h.uploadPolicy = p
+}
+
+// SetTrashRetention informa o prazo de retenção da lixeira, mostrado em GET /api/my-trash.
+func (h *Handler) SetTrashRetention(d time.Duration) {
+	h.trashRetention = d
+}
+
+// multipartOverhead é a folga para os outros campos do formulário além do arquivo.
+const multipartOverhead = 1 << 20
+
+// downloadURLTTL é a validade das URLs assinadas entregues por HandleDownloadResource.
+const downloadURLTTL = 15 * time.Minute
+
+// indexResource (re)indexa um recurso depois de criado ou alterado. Falhas só são
+// logadas: o recurso já foi salvo e aparece de novo na próxima reconstrução do índice.
+func (h *Handler) indexResource(id primitive.ObjectID) {
+	if err := search.IndexResource(h.search, h.store.Resources, id); err != nil {
+		log.Printf("Erro ao indexar recurso %s: %v", id.Hex(), err)
+	}
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(v)
 }
 
-func HandleSignup(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
@@ -46,28 +146,44 @@ func HandleSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.Email = strings.TrimSpace(req.Email)
 	if req.Name == "" || req.Email == "" || req.Password == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Nome, e-mail e senha são obrigatórios."})
 		return
 	}
+	if !h.allowedEmail(req.Email) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "Use seu e-mail institucional (@" + strings.Join(h.emailDomains, ", @") + ").",
+		})
+		return
+	}
 
 	log.Printf("Cadastrando usuário '%s' com a senha de %d caracteres.", req.Email, len(req.Password))
 
+	// A conta fica pendente até o e-mail ser confirmado pelo link.
 	user := models.User{
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: req.Password,
+		Name:         req.Name,
+		Email:        req.Email,
+		Password:     req.Password,
+		EmailPending: true,
 	}
 
-	if err := store.CreateUser(&user); err != nil {
+	if err := h.store.Users.CreateUser(&user); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível criar o usuário"})
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]string{"message": "Usuário criado com sucesso"})
+	// Se o e-mail não sair, a conta já existe e o link pode ser pedido de novo.
+	if err := h.sendVerification(&user); err != nil {
+		log.Printf("Erro ao mandar a confirmação para '%s': %v", user.Email, err)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"message": "Usuário criado. Enviamos um link de confirmação para " + user.Email + ".",
+	})
 }
 
-func HandleLogin(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -80,10 +196,35 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Recebida tentativa de login para o email: '%s'", req.Email)
 
-	user, err := store.GetUserByEmail(req.Email)
+	// O bloqueio vale para o e-mail, exista a conta ou não, para não revelar quem tem
+	// cadastro; enquanto durar, nem a senha certa entra. A tentativa já conta como
+	// falha na mesma consulta, para tentativas simultâneas não furarem o limite; a
+	// senha certa zera a contagem.
+	lockKey := loginLockoutKey(req.Email)
+	wait, lock, err := h.lockout.Attempt(lockKey)
 	if err != nil {
-		log.Printf("ERRO: Usuário com email '%s' não foi encontrado no banco de dados.", req.Email)
+		log.Printf("Erro ao registrar a tentativa de login de '%s': %v", req.Email, err)
+	}
+	if wait > 0 {
+		log.Printf("Login recusado: '%s' está bloqueado por excesso de tentativas.", req.Email)
+		w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(wait)))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{
+			"error": "Muitas tentativas de login. Espere um pouco e tente de novo.",
+			"code":  "login_locked",
+		})
+		return
+	}
+	failed := func() {
+		if lock > 0 {
+			log.Printf("Login de '%s' bloqueado por %s depois de várias falhas.", req.Email, lock)
+		}
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Credenciais inválidas"})
+	}
+
+	user, err := h.store.Users.GetUserByEmail(req.Email)
+	if err != nil {
+		log.Printf("ERRO: Usuário com email '%s' não foi encontrado no banco de dados.", req.Email)
+		failed()
 		return
 	}
 
@@ -91,35 +232,54 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
 		log.Println("ERRO: A senha fornecida NÃO BATE com o hash salvo no banco.")
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Credenciais inválidas"})
+		failed()
 		return
 	}
+	if err := h.lockout.Reset(lockKey); err != nil {
+		log.Printf("Erro ao limpar as falhas de login de '%s': %v", req.Email, err)
+	}
 
-	log.Println("Senha correta! Gerando token JWT...")
+	if user.EmailPending {
+		log.Printf("Login recusado: a conta '%s' ainda não confirmou o e-mail.", req.Email)
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error": "Confirme seu e-mail antes de entrar. Se o link expirou, peça outro.",
+			"code":  "email_not_verified",
+		})
+		return
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": user.ID,
-		"exp":    time.Now().Add(time.Hour * 24).Unix(), // Token expira em 24 horas
-	})
+	if user.SuspendedAt != nil {
+		log.Printf("Login recusado: a conta '%s' está suspensa.", req.Email)
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Conta suspensa pela moderação"})
+		return
+	}
 
-	tokenString, err := token.SignedString(config.JWT_SECRET)
+	log.Println("Senha correta! Gerando token JWT...")
+
+	pair, err := h.startSession(r, user)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível gerar o token"})
 		return
 	}
 
+	principal := rbac.For(user)
 	writeJSON(w, http.StatusOK, map[string]any{
-		"token": tokenString,
+		"token":        pair.Token,
+		"refreshToken": pair.RefreshToken,
+		"expiresIn":    pair.ExpiresIn,
 		"user": map[string]any{
 			"name":    user.Name,
 			"email":   user.Email,
 			"initial": string(user.Name[0]),
+			"role":    principal.Role,
+			"perms":   principal.Permissions,
+			"courses": principal.Courses,
 		},
 	})
 }
 
-func HandleListResources(w http.ResponseWriter, r *http.Request) {
-	resources, err := store.ListResources()
+func (h *Handler) HandleListResources(w http.ResponseWriter, r *http.Request) {
+	resources, err := h.store.Resources.ListResources()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível buscar os recursos"})
 		return
@@ -127,7 +287,7 @@ func HandleListResources(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resources)
 }
 
-func HandleGetProfile(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 	userIDHex, ok := r.Context().Value(userContextKey).(string)
 	if !ok {
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
@@ -135,14 +295,14 @@ func HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
-	user, err := store.GetUserByID(userID)
+	user, err := h.store.Users.GetUserByID(userID)
 	if err != nil {
 		writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
 		return
 	}
 
-	uploadsCount, _ := store.CountUserUploads(userID)
-	commentsCount, _ := store.CountUserComments(userID)
+	uploadsCount, _ := h.store.Resources.CountUserUploads(userID)
+	commentsCount, _ := h.store.Comments.CountUserComments(userID)
 
 	user.Stats = models.UserStats{
 		Uploads:    int(uploadsCount),
@@ -161,7 +321,7 @@ func HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, user)
 }
 
-func HandleGetUserUploads(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetUserUploads(w http.ResponseWriter, r *http.Request) {
 	userIDHex, ok := r.Context().Value(userContextKey).(string)
 	if !ok {
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
@@ -169,7 +329,7 @@ func HandleGetUserUploads(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
-	resources, err := store.GetResourcesByUserID(userID)
+	resources, err := h.store.Resources.GetResourcesByUserID(userID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get user uploads"})
 		return
@@ -178,7 +338,7 @@ func HandleGetUserUploads(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resources)
 }
 
-func HandleUploadResource(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleUploadResource(w http.ResponseWriter, r *http.Request) {
 	userIDHex, ok := r.Context().Value(userContextKey).(string)
 	if !ok {
 		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
@@ -186,6 +346,7 @@ func HandleUploadResource(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
+	r.Body = http.MaxBytesReader(w, r.Body, h.uploadPolicy.MaxSize()+multipartOverhead)
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "File too large"})
 		return
@@ -198,22 +359,38 @@ func HandleUploadResource(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	uniqueFileName := uuid.New().String() + filepath.Ext(handler.Filename)
-	filePath := filepath.Join("uploads", uniqueFileName)
+	checked, ok := checkFile(w, h.uploadPolicy, handler.Filename, file, handler.Size)
+	if !ok {
+		return
+	}
+	h.createUploadedResource(w, userID, file, checked, handler.Filename, handler.Size, r.FormValue)
+}
+
+// uploadedFile é o arquivo já recebido por inteiro, venha do formulário multipart ou
+// de um upload retomável.
+type uploadedFile interface {
+	io.Reader
+	io.ReaderAt
+}
 
-	dst, err := os.Create(filePath)
+// createUploadedResource grava o arquivo (já validado) e cria o recurso com os campos
+// do formulário de upload, lidos por field. Responde 201 com o recurso criado, que fica
+// escondido até o pipeline passar o arquivo pelo antivírus.
+func (h *Handler) createUploadedResource(w http.ResponseWriter, userID primitive.ObjectID, file uploadedFile,
+	checked *validation.Result, fileName string, size int64, field func(string) string) bool {
+	fileKey, contentHash, err := h.storeUploadedFile(file, checked, size)
 	if err != nil {
+		log.Printf("Erro ao salvar arquivo %s: %v", fileName, err)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save file"})
-		return
+		return false
 	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to copy file content"})
-		return
+	// Procurado antes de criar o recurso, para não achar o próprio upload.
+	existing, err := h.store.Resources.FindResourceByContentHash(contentHash)
+	if err != nil && err != store.ErrNotFound {
+		log.Printf("Erro ao procurar duplicatas de %s: %v", contentHash, err)
 	}
 
-	tagsJSON := r.FormValue("tags")
+	tagsJSON := field("tags")
 	var tags []string
 	if err := json.Unmarshal([]byte(tagsJSON), &tags); err != nil {
 		log.Printf("Erro ao decodificar tags: %v", err)
@@ -222,20 +399,25 @@ func HandleUploadResource(w http.ResponseWriter, r *http.Request) {
 	resource := models.Resource{
 		ID:          primitive.NewObjectID(),
 		UserID:      userID,
-		Title:       r.FormValue("title"),
-		Description: r.FormValue("description"),
-		Course:      r.FormValue("course"),
-		CourseCode:  r.FormValue("courseCode"),
-		Type:        r.FormValue("fileType"),
-		Semester:    r.FormValue("semester"),
-		IsAnonymous: r.FormValue("isAnonymous") == "true",
+		Title:       field("title"),
+		Description: field("description"),
+		Course:      field("course"),
+		CourseCode:  field("courseCode"),
+		Type:        field("fileType"),
+		Semester:    field("semester"),
+		IsAnonymous: field("isAnonymous") == "true",
 		Tags:        tags,
-		FileName:    handler.Filename,
-		FileUrl:     "/" + filePath,
+		FileName:    fileName,
+		FileUrl:     blob.PublicURL(fileKey),
 		UploadDate:  time.Now(),
 		Likes:       0,
+		ContentHash: contentHash,
+		Version:     1,
+
+		ProcessingStatus: models.ProcessingPending,
+		ScanStatus:       models.ScanScanning,
 	}
-	professorIDHex := r.FormValue("professorId")
+	professorIDHex := field("professorId")
 	if professorIDHex != "" {
 		profID, err := primitive.ObjectIDFromHex(professorIDHex)
 		if err == nil {
@@ -243,25 +425,319 @@ func HandleUploadResource(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := store.CreateResource(&resource); err != nil {
+	if err := h.store.Resources.CreateResource(&resource); err != nil {
+		h.deleteBlobs(resource.FileUrl)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save resource metadata"})
+		return false
+	}
+	h.pipeline.Enqueue(resource.ID)
+
+	response := uploadResponse{Resource: resource}
+	if existing != nil {
+		response.Duplicate = &duplicateWarning{
+			ResourceID:  existing.ID,
+			Title:       existing.Title,
+			Link:        "/file/" + existing.ID.Hex(),
+			UseExisting: "/api/resource/" + resource.ID.Hex() + "/use-existing",
+			Message:     fmt.Sprintf("This file already exists as resource %q", existing.Title),
+		}
+	}
+	writeJSON(w, http.StatusCreated, response)
+	return true
+}
+
+// uploadResponse é o recurso criado, com um aviso quando o mesmo arquivo já tinha
+// sido enviado antes, para que o front ofereça usar o recurso existente.
+type uploadResponse struct {
+	models.Resource
+	Duplicate *duplicateWarning `json:"duplicate,omitempty"`
+}
+
+// duplicateWarning aponta o recurso que já tinha o arquivo. UseExisting é a rota de
+// HandleUseExistingResource para descartar o upload novo e ficar com ele.
+type duplicateWarning struct {
+	ResourceID  primitive.ObjectID `json:"resourceId"`
+	Title       string             `json:"title"`
+	Link        string             `json:"link"`
+	UseExisting string             `json:"useExisting"`
+	Message     string             `json:"message"`
+}
+
+// HandleUseExistingResource atende quem, avisado de que o arquivo já existia, prefere
+// o recurso existente: o upload novo é apagado de vez, sem passar pela lixeira, e a
+// resposta é o recurso existente. Enquanto o upload está no antivírus responde 409,
+// para não apagar o arquivo que o pipeline ainda está lendo.
+func (h *Handler) HandleUseExistingResource(w http.ResponseWriter, r *http.Request) {
+	resource, _ := h.ownedResource(w, r)
+	if resource == nil {
+		return
+	}
+	if resource.DeletedAt != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+		return
+	}
+	if resource.ScanStatus == models.ScanScanning {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Resource is still being scanned, try again"})
+		return
+	}
+	existing, err := h.store.Resources.FindResourceByContentHash(resource.ContentHash)
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return
+	}
+	if existing == nil || existing.ID == resource.ID {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "No other resource has this file"})
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, resource)
+	versions, err := h.store.Versions.ListResourceVersions(resource.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch versions"})
+		return
+	}
+	if err := h.store.Resources.DeleteResourceByID(resource.ID, resource.UserID); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete resource"})
+		return
+	}
+	h.search.Remove(resource.ID)
+	trash.ReleaseFiles(h.store.BlobRefs, h.blobs, resource.Resource, versions)
+
+	writeJSON(w, http.StatusOK, existing)
+}
+
+// checkFile aplica a política ao arquivo enviado. Se alguma regra falhar, já responde
+// 422 com a lista de regras violadas e devolve ok = false.
+func checkFile(w http.ResponseWriter, policy validation.Policy, fileName string, file io.ReaderAt, size int64) (*validation.Result, bool) {
+	result, err := policy.Check(fileName, file, size)
+	if err != nil {
+		if writeValidationError(w, err) {
+			return nil, false
+		}
+		log.Printf("Erro ao validar arquivo %s: %v", fileName, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to read file"})
+		return nil, false
+	}
+	return result, true
+}
+
+// writeValidationError responde 422 com as regras violadas se err for um
+// *validation.Error; devolve false para os outros erros.
+func writeValidationError(w http.ResponseWriter, err error) bool {
+	var invalid *validation.Error
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"error":      "File failed validation",
+		"violations": invalid.Violations,
+	})
+	return true
+}
+
+// storeUploadedFile grava o arquivo em blob.PendingPrefix, calculando o SHA-256 durante
+// a própria escrita, e devolve a chave do blob e o hash. Depois da verificação o
+// pipeline move o arquivo para a chave definitiva, ou reaproveita o blob que já tinha
+// o mesmo conteúdo.
+func (h *Handler) storeUploadedFile(r io.Reader, checked *validation.Result, size int64) (string, string, error) {
+	key := blob.PendingPrefix + uuid.New().String() + checked.Extension
+	hasher := sha256.New()
+	if err := h.blobs.Put(key, io.TeeReader(r, hasher), size, checked.MIME); err != nil {
+		return "", "", err
+	}
+	return key, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// scanFile passa pelo antivírus um arquivo que é gravado na hora (avatares e fotos de
+// professores). Se algo for encontrado, guarda o arquivo na quarentena e responde 422
+// como uma falha de validação; se o antivírus não responder, responde 503.
+func (h *Handler) scanFile(w http.ResponseWriter, file io.ReaderAt, size int64, fileName, key, source string, userID *primitive.ObjectID) bool {
+	result, err := h.scanner.Scan(io.NewSectionReader(file, 0, size))
+	if err != nil {
+		log.Printf("Erro ao verificar %s no antivírus: %v", fileName, err)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "Malware scanner unavailable, try again later"})
+		return false
+	}
+	if !result.Infected {
+		return true
+	}
+
+	log.Printf("Antivírus: %s (%s) contém %s; arquivo em quarentena", fileName, source, result.Signature)
+	quarantineKey := blob.QuarantinePrefix + key
+	if err := h.blobs.Put(quarantineKey, io.NewSectionReader(file, 0, size), size, ""); err != nil {
+		log.Printf("Erro ao guardar %s na quarentena: %v", quarantineKey, err)
+	}
+	entry := &models.QuarantinedFile{
+		ID:         primitive.NewObjectID(),
+		Key:        quarantineKey,
+		FileName:   fileName,
+		Source:     source,
+		UserID:     userID,
+		Signature:  result.Signature,
+		DetectedAt: time.Now(),
+	}
+	if err := h.store.Quarantine.CreateQuarantinedFile(entry); err != nil {
+		log.Printf("Erro ao registrar arquivo em quarentena %s: %v", quarantineKey, err)
+	}
+	writeValidationError(w, &validation.Error{Violations: []validation.Violation{{
+		Rule: validation.RuleMalware, Message: "The file was flagged by the malware scanner (" + result.Signature + ")",
+	}}})
+	return false
 }
 
-func HandleGetResources(w http.ResponseWriter, r *http.Request) {
-	resources, err := store.ListResources()
+func (h *Handler) HandleGetResources(w http.ResponseWriter, r *http.Request) {
+	query, err := parseResourceQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	page, err := h.store.Resources.SearchResources(query)
 	if err != nil {
+		if err == store.ErrInvalidCursor {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resources"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, resources)
+	writeJSON(w, http.StatusOK, page)
 }
 
-func HandleGetResourceByID(w http.ResponseWriter, r *http.Request) {
+// HandleSearch faz a busca textual em GET /api/search?q=...&limit=...&offset=...
+// Os resultados vêm ordenados por relevância, com trechos destacados em <mark>.
+func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := strings.TrimSpace(params.Get("q"))
+	if q == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing search query"})
+		return
+	}
+
+	limit := store.DefaultResourceLimit
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > store.MaxResourceLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid limit (must be between 1 and %d)", store.MaxResourceLimit)})
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid offset"})
+			return
+		}
+		offset = n
+	}
+
+	hits, total := h.search.Search(q, offset, limit)
+	items := make([]models.ResourceSearchHit, 0, len(hits))
+	for _, hit := range hits {
+		res, err := h.store.Resources.GetResourceByID(hit.ID)
+		if err != nil || !res.Visible() {
+			// O índice pode estar um passo atrás do banco (ex.: recurso removido, na
+			// lixeira ou escondido por outra instância).
+			continue
+		}
+		items = append(items, models.ResourceSearchHit{ResourceWithDetails: *res, Score: hit.Score, Highlights: hit.Highlights})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "total": total})
+}
+
+// parseResourceQuery lê os filtros de GET /api/resources:
+//
+//	q, courseCode, type, semester, professorId, uploaderId,
+//	tags (separadas por vírgula ou repetidas), tagMatch=any|all,
+//	from/to (YYYY-MM-DD ou RFC3339; "to" com data pura inclui o dia inteiro),
+//	sort=newest|likes|comments, cursor, limit (máx. 100).
+func parseResourceQuery(r *http.Request) (store.ResourceQuery, error) {
+	params := r.URL.Query()
+	query := store.ResourceQuery{
+		Text:       params.Get("q"),
+		CourseCode: params.Get("courseCode"),
+		Type:       params.Get("type"),
+		Semester:   params.Get("semester"),
+		Cursor:     params.Get("cursor"),
+	}
+
+	for _, field := range []struct {
+		name   string
+		target **primitive.ObjectID
+	}{{"professorId", &query.ProfessorID}, {"uploaderId", &query.UploaderID}} {
+		if hex := params.Get(field.name); hex != "" {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return query, fmt.Errorf("Invalid %s", field.name)
+			}
+			*field.target = &id
+		}
+	}
+
+	for _, value := range params["tags"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				query.Tags = append(query.Tags, tag)
+			}
+		}
+	}
+	switch params.Get("tagMatch") {
+	case "", "any":
+	case "all":
+		query.MatchAllTags = true
+	default:
+		return query, errors.New("tagMatch must be 'any' or 'all'")
+	}
+
+	var err error
+	if query.From, err = parseDateParam(params.Get("from"), false); err != nil {
+		return query, errors.New("Invalid 'from' date")
+	}
+	if query.To, err = parseDateParam(params.Get("to"), true); err != nil {
+		return query, errors.New("Invalid 'to' date")
+	}
+
+	switch sortBy := params.Get("sort"); sortBy {
+	case "", store.SortNewest, store.SortMostLiked, store.SortMostCommented:
+		query.Sort = sortBy
+	default:
+		return query, errors.New("sort must be 'newest', 'likes' or 'comments'")
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > store.MaxResourceLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", store.MaxResourceLimit)
+		}
+		query.Limit = n
+	}
+
+	return query, nil
+}
+
+// parseDateParam aceita YYYY-MM-DD ou RFC3339. Com endOfDay, uma data pura vira o
+// início do dia seguinte, já que o limite superior é exclusivo.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (h *Handler) HandleGetResourceByID(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "id")
 	objID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -269,24 +745,102 @@ func HandleGetResourceByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resourceData, err := store.GetResourceByID(objID)
+	resourceData, err := h.store.Resources.GetResourceByID(objID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == store.ErrNotFound {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
 			return
 		}
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
 		return
 	}
+	// Em verificação ou em quarentena: só o dono vê, por /api/my-uploads.
+	if !resourceData.Visible() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+		return
+	}
 
 	writeJSON(w, http.StatusOK, resourceData)
 }
 
-func HandleListComments(w http.ResponseWriter, r *http.Request) {
-	resourceIDHex := chi.URLParam(r, "id")
-	resourceID, _ := primitive.ObjectIDFromHex(resourceIDHex)
+// HandleDownloadResource redireciona para uma URL assinada e temporária do arquivo.
+// Com ?view=true o arquivo abre no navegador em vez de ser baixado.
+func (h *Handler) HandleDownloadResource(w http.ResponseWriter, r *http.Request) {
+	objID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid resource ID"})
+		return
+	}
+
+	resource, err := h.store.Resources.GetResourceByID(objID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return
+	}
+	if !resource.Visible() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+		return
+	}
+	key := blob.KeyFromURL(resource.FileUrl)
+	if key == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource has no file"})
+		return
+	}
 
-	comments, err := store.GetCommentsByResourceID(resourceID)
+	url, err := h.blobs.SignedURL(key, downloadURLTTL, r.URL.Query().Get("view") == "true")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to sign download URL"})
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// deleteBlobs apaga arquivos que não chegaram a ser de nenhum recurso. Falhas só são
+// logadas: o arquivo órfão não é visível para ninguém.
+func (h *Handler) deleteBlobs(urls ...string) {
+	for _, url := range urls {
+		key := blob.KeyFromURL(url)
+		if key == "" {
+			continue
+		}
+		if err := h.blobs.Delete(key); err != nil {
+			log.Printf("Erro ao apagar arquivo %s: %v", key, err)
+		}
+	}
+}
+
+// HandleGetResourceText devolve o texto extraído do arquivo, uma entrada por página.
+func (h *Handler) HandleGetResourceText(w http.ResponseWriter, r *http.Request) {
+	resource, ok := h.visibleResource(w, r)
+	if !ok {
+		return
+	}
+
+	pages, err := h.store.Resources.GetResourceText(resource.ID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "No extracted text for this resource"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource text"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"pageCount": len(pages), "pages": pages})
+}
+
+func (h *Handler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+	// Os comentários de um recurso na lixeira somem e voltam junto com ele.
+	resource, ok := h.visibleResource(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := h.store.Comments.GetCommentsByResourceID(resource.ID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comments"})
 		return
@@ -295,9 +849,12 @@ func HandleListComments(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, comments)
 }
 
-func HandlePostComment(w http.ResponseWriter, r *http.Request) {
-	resourceIDHex := chi.URLParam(r, "id")
-	resourceID, _ := primitive.ObjectIDFromHex(resourceIDHex)
+func (h *Handler) HandlePostComment(w http.ResponseWriter, r *http.Request) {
+	resource, ok := h.visibleResource(w, r)
+	if !ok {
+		return
+	}
+	resourceID := resource.ID
 
 	userIDHex, _ := r.Context().Value(userContextKey).(string)
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
@@ -334,78 +891,45 @@ func HandlePostComment(w http.ResponseWriter, r *http.Request) {
 		log.Printf("ParentID recebido ('%s') é inválido ou vazio. Criando como comentário principal.", req.ParentID)
 	}
 
-	if err := store.CreateComment(&comment); err != nil {
+	if err := h.store.Comments.CreateComment(&comment); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to post comment"})
 		return
 	}
 
 	if comment.ParentID != nil {
-		parentComment, err := store.GetCommentByID(*comment.ParentID)
+		parentComment, err := h.store.Comments.GetCommentByID(*comment.ParentID)
 		if err == nil && parentComment.UserID != comment.UserID {
-			actor, _ := store.GetUserByID(comment.UserID)
-
-			notification := models.Notification{
-				ID:         primitive.NewObjectID(),
-				UserID:     parentComment.UserID,
-				ActorName:  actor.Name,
-				Type:       "reply",
-				Message:    "respondeu ao seu comentário.",
-				ResourceID: comment.ResourceID,
-				CommentID:  comment.ID,
-				IsRead:     false,
-				CreatedAt:  time.Now(),
+			actor, _ := h.store.Users.GetUserByID(comment.UserID)
+			if actor != nil {
+				notification := models.Notification{
+					ID:         primitive.NewObjectID(),
+					UserID:     parentComment.UserID,
+					ActorName:  actor.Name,
+					Type:       models.NotificationReply,
+					Message:    "respondeu ao seu comentário.",
+					ResourceID: comment.ResourceID,
+					CommentID:  comment.ID,
+					IsRead:     false,
+					CreatedAt:  time.Now(),
+				}
+				h.notify(&notification)
+			} else {
+				log.Printf("Aviso: não foi possível buscar o usuário %s para enviar notificação de resposta.", comment.UserID.Hex())
 			}
-			store.CreateNotification(&notification)
 		}
 	}
 
-	newCommentData, err := store.GetCommentWithAuthorByID(comment.ID)
+	newCommentData, err := h.store.Comments.GetCommentWithAuthorByID(comment.ID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Comment posted, but failed to retrieve it"})
 		return
 	}
+	h.pushComment(resourceID, newCommentData)
 
 	writeJSON(w, http.StatusCreated, newCommentData)
 }
 
-func HandleGetNotifications(w http.ResponseWriter, r *http.Request) {
-	userIDHex, ok := r.Context().Value(userContextKey).(string)
-	if !ok {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
-		return
-	}
-	userID, _ := primitive.ObjectIDFromHex(userIDHex)
-
-	notifications, err := store.GetNotificationsByUserID(userID)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notifications"})
-		return
-	}
-
-	writeJSON(w, http.StatusOK, notifications)
-}
-
-func HandleMarkNotificationAsRead(w http.ResponseWriter, r *http.Request) {
-	notificationIDHex := chi.URLParam(r, "id")
-	notificationID, err := primitive.ObjectIDFromHex(notificationIDHex)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid notification ID"})
-		return
-	}
-
-	userIDHex, _ := r.Context().Value(userContextKey).(string)
-	userID, _ := primitive.ObjectIDFromHex(userIDHex)
-
-	err = store.MarkNotificationAsRead(notificationID, userID)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to mark notification as read"})
-		return
-	}
-
-	writeJSON(w, http.StatusOK, map[string]string{"message": "Notification marked as read"})
-}
-
-func HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 	userIDHex, _ := r.Context().Value(userContextKey).(string)
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
@@ -423,16 +947,14 @@ func HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Atualizando perfil do usuário %s: %+v", userIDHex, req)
 
-	update := bson.M{
-		"$set": bson.M{
-			"name":    req.Name,
-			"course":  req.Course,
-			"faculty": req.Faculty,
-			"bio":     req.Bio,
-		},
+	update := store.ProfileUpdate{
+		Name:    req.Name,
+		Course:  req.Course,
+		Faculty: req.Faculty,
+		Bio:     req.Bio,
 	}
 
-	if err := store.UpdateUserByID(userID, update); err != nil {
+	if err := h.store.Users.UpdateUserProfile(userID, update); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update profile"})
 		return
 	}
@@ -440,10 +962,11 @@ func HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Profile updated successfully"})
 }
 
-func HandleUpdateAvatar(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleUpdateAvatar(w http.ResponseWriter, r *http.Request) {
 	userIDHex, _ := r.Context().Value(userContextKey).(string)
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
+	r.Body = http.MaxBytesReader(w, r.Body, h.avatarPolicy.MaxSize()+multipartOverhead)
 	r.ParseMultipartForm(2 << 20) // Limite de 2MB
 	file, handler, err := r.FormFile("avatar")
 	if err != nil {
@@ -452,19 +975,24 @@ func HandleUpdateAvatar(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	avatarFileName := userID.Hex() + filepath.Ext(handler.Filename)
-	avatarPath := filepath.Join("uploads", "avatars", avatarFileName)
-
-	os.MkdirAll(filepath.Dir(avatarPath), os.ModePerm)
+	checked, ok := checkFile(w, h.avatarPolicy, handler.Filename, file, handler.Size)
+	if !ok {
+		return
+	}
 
-	dst, _ := os.Create(avatarPath)
-	defer dst.Close()
-	io.Copy(dst, file)
+	avatarKey := blob.AvatarPrefix + userID.Hex() + checked.Extension
+	if !h.scanFile(w, file, handler.Size, handler.Filename, avatarKey, models.QuarantineAvatar, &userID) {
+		return
+	}
+	if err := h.blobs.Put(avatarKey, file, handler.Size, checked.MIME); err != nil {
+		log.Printf("Erro ao salvar avatar %s: %v", avatarKey, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save avatar"})
+		return
+	}
 
-	avatarUrl := "/uploads/avatars/" + avatarFileName
+	avatarUrl := blob.PublicURL(avatarKey)
 
-	update := bson.M{"$set": bson.M{"avatarUrl": avatarUrl}}
-	if err := store.UpdateUserByID(userID, update); err != nil {
+	if err := h.store.Users.UpdateUserAvatar(userID, avatarUrl); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update avatar URL"})
 		return
 	}
@@ -472,8 +1000,8 @@ func HandleUpdateAvatar(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"avatarUrl": avatarUrl})
 }
 
-func HandleGetTags(w http.ResponseWriter, r *http.Request) {
-	tags, err := store.GetDistinctFieldValues("tags")
+func (h *Handler) HandleGetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.store.Resources.GetDistinctFieldValues("tags")
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch tags"})
 		return
@@ -481,8 +1009,8 @@ func HandleGetTags(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, tags)
 }
 
-func HandleListTags(w http.ResponseWriter, r *http.Request) {
-	tags, err := store.ListTags()
+func (h *Handler) HandleListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.store.Catalog.ListTags()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch tags"})
 		return
@@ -490,7 +1018,7 @@ func HandleListTags(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, tags)
 }
 
-func HandleCreateTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreateTag(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name string `json:"name"`
 	}
@@ -499,16 +1027,16 @@ func HandleCreateTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tag := models.Tag{ID: primitive.NewObjectID(), Name: req.Name}
-	if err := store.CreateTag(&tag); err != nil {
+	if err := h.store.Catalog.CreateTag(&tag); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create tag"})
 		return
 	}
 	writeJSON(w, http.StatusCreated, tag)
 }
 
-func HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
 	id, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
-	if err := store.DeleteTagByID(id); err != nil {
+	if err := h.store.Catalog.DeleteTagByID(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete tag"})
 		return
 	}
@@ -517,8 +1045,8 @@ func HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
 
 // --- Handlers para Courses ---
 
-func HandleListCourses(w http.ResponseWriter, r *http.Request) {
-	courses, err := store.ListCourses()
+func (h *Handler) HandleListCourses(w http.ResponseWriter, r *http.Request) {
+	courses, err := h.store.Catalog.ListCourses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch courses"})
 		return
@@ -526,23 +1054,23 @@ func HandleListCourses(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, courses)
 }
 
-func HandleCreateCourse(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreateCourse(w http.ResponseWriter, r *http.Request) {
 	var req models.Course
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Code == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Course name and code are required"})
 		return
 	}
 	req.ID = primitive.NewObjectID()
-	if err := store.CreateCourse(&req); err != nil {
+	if err := h.store.Catalog.CreateCourse(&req); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create course"})
 		return
 	}
 	writeJSON(w, http.StatusCreated, req)
 }
 
-func HandleDeleteCourse(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleDeleteCourse(w http.ResponseWriter, r *http.Request) {
 	id, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
-	if err := store.DeleteCourseByID(id); err != nil {
+	if err := h.store.Catalog.DeleteCourseByID(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete course"})
 		return
 	}
@@ -551,8 +1079,8 @@ func HandleDeleteCourse(w http.ResponseWriter, r *http.Request) {
 
 // --- Handlers para Professors ---
 
-func HandleListProfessors(w http.ResponseWriter, r *http.Request) {
-	profs, err := store.ListProfessors()
+func (h *Handler) HandleListProfessors(w http.ResponseWriter, r *http.Request) {
+	profs, err := h.store.Catalog.ListProfessors()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch professors"})
 		return
@@ -560,7 +1088,7 @@ func HandleListProfessors(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, profs)
 }
 
-func HandleCreateProfessor(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreateProfessor(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(2 << 20); err != nil { // Limite de 2MB
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Request too large"})
 		return
@@ -574,37 +1102,67 @@ func HandleCreateProfessor(w http.ResponseWriter, r *http.Request) {
 	file, handler, err := r.FormFile("avatar")
 	if err == nil {
 		defer file.Close()
-		avatarFileName := professor.ID.Hex() + filepath.Ext(handler.Filename)
-		avatarPath := filepath.Join("uploads", "avatars", avatarFileName)
-		os.MkdirAll(filepath.Dir(avatarPath), os.ModePerm)
-		dst, _ := os.Create(avatarPath)
-		defer dst.Close()
-		io.Copy(dst, file)
-		professor.AvatarURL = "/uploads/avatars/" + avatarFileName
-	}
-	if err := store.CreateProfessor(&professor); err != nil {
+		checked, ok := checkFile(w, h.avatarPolicy, handler.Filename, file, handler.Size)
+		if !ok {
+			return
+		}
+		avatarKey := blob.AvatarPrefix + professor.ID.Hex() + checked.Extension
+		adminID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+		if !h.scanFile(w, file, handler.Size, handler.Filename, avatarKey, models.QuarantineProfessor, &adminID) {
+			return
+		}
+		if err := h.blobs.Put(avatarKey, file, handler.Size, checked.MIME); err != nil {
+			log.Printf("Erro ao salvar avatar %s: %v", avatarKey, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save avatar"})
+			return
+		}
+		professor.AvatarURL = blob.PublicURL(avatarKey)
+	}
+	if err := h.store.Catalog.CreateProfessor(&professor); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create professor"})
 		return
 	}
 	writeJSON(w, http.StatusCreated, professor)
 }
 
-func HandleDeleteProfessor(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleDeleteProfessor(w http.ResponseWriter, r *http.Request) {
 	id, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
-	if err := store.DeleteProfessorByID(id); err != nil {
+	if err := h.store.Catalog.DeleteProfessorByID(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete professor"})
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Professor deleted successfully"})
 }
 
-func HandleSearchUsers(w http.ResponseWriter, r *http.Request) {
+// HandleRegenerateThumbnails reenfileira a geração de thumbnail de todos os recursos
+// (ex.: arquivos enviados antes dos thumbnails existirem). O trabalho é feito em
+// segundo plano; a resposta só informa quantos recursos entraram na fila.
+func (h *Handler) HandleRegenerateThumbnails(w http.ResponseWriter, r *http.Request) {
+	resources, err := h.store.Resources.ListResources()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resources"})
+		return
+	}
+
+	queued := 0
+	for _, res := range resources {
+		if res.FileUrl == "" {
+			continue
+		}
+		h.pipeline.EnqueueThumbnail(res.ID)
+		queued++
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]int{"queued": queued})
+}
+
+func (h *Handler) HandleSearchUsers(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 
 	userIDHex, _ := r.Context().Value(userContextKey).(string)
 	userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
-	users, err := store.SearchUsersByNameOrEmail(query, userID)
+	users, err := h.store.Users.SearchUsersByNameOrEmail(query, userID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to search users"})
 		return
@@ -613,7 +1171,7 @@ func HandleSearchUsers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, users)
 }
 
-func HandleShareResource(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleShareResource(w http.ResponseWriter, r *http.Request) {
 	senderIDHex, _ := r.Context().Value(userContextKey).(string)
 	senderID, _ := primitive.ObjectIDFromHex(senderIDHex)
 
@@ -629,22 +1187,26 @@ func HandleShareResource(w http.ResponseWriter, r *http.Request) {
 	}
 	recipientID, _ := primitive.ObjectIDFromHex(req.RecipientID)
 
-	sender, _ := store.GetUserByID(senderID)
-	resource, _ := store.GetResourceByID(resourceID)
+	sender, _ := h.store.Users.GetUserByID(senderID)
+	resource, err := h.store.Resources.GetResourceByID(resourceID)
+	if err != nil || sender == nil || !resource.Visible() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+		return
+	}
 
 	notification := models.Notification{
 		ID:         primitive.NewObjectID(),
 		UserID:     recipientID,
 		ActorName:  sender.Name,
-		Type:       "share",
-		Message:    "compartilhou o material '" + resource["title"].(string) + "' com você.",
+		Type:       models.NotificationShare,
+		Message:    "compartilhou o material '" + resource.Title + "' com você.",
 		ResourceID: resourceID,
 		CommentID:  primitive.NilObjectID,
 		IsRead:     false,
 		CreatedAt:  time.Now(),
 	}
 
-	if err := store.CreateNotification(&notification); err != nil {
+	if err := h.notify(&notification); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create share notification"})
 		return
 	}
@@ -652,70 +1214,82 @@ func HandleShareResource(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Material shared successfully"})
 }
 
-func HandleToggleLike(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleToggleLike(w http.ResponseWriter, r *http.Request) {
 	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
 	resourceID, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
 
-	hasLiked, err := store.HasUserLikedResource(userID, resourceID)
+	hasLiked, err := h.store.Likes.HasUserLikedResource(userID, resourceID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Error checking like status"})
 		return
 	}
 
 	if hasLiked {
-		store.DeleteLike(userID, resourceID)
+		h.store.Likes.DeleteLike(userID, resourceID)
 	} else {
+		resource, ok := h.visibleResource(w, r)
+		if !ok {
+			return
+		}
 		like := models.Like{
 			ID:         primitive.NewObjectID(),
 			UserID:     userID,
 			ResourceID: resourceID,
 			CreatedAt:  time.Now(),
 		}
-		if err := store.CreateLike(&like); err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to like resource"})
-			return
-		}
 
-		resourceData, err := store.GetResourceByID(resourceID)
-		if err == nil && resourceData != nil {
-
-			if uploaderInfo, ok := resourceData["uploaderInfo"].(primitive.M); ok && uploaderInfo != nil {
-
-				if resourceAuthorID, ok := uploaderInfo["_id"].(primitive.ObjectID); ok {
-
-					if resourceAuthorID != userID {
-						sender, _ := store.GetUserByID(userID)
-						if sender != nil {
-							notification := models.Notification{
-								ID:         primitive.NewObjectID(),
-								UserID:     resourceAuthorID,
-								ActorName:  sender.Name,
-								Type:       "like",
-								Message:    "curtiu seu material '" + resourceData["title"].(string) + "'.",
-								ResourceID: resourceID,
-								IsRead:     false,
-								CreatedAt:  time.Now(),
-							}
-							store.CreateNotification(&notification)
-						}
-					}
+		// O like e a notificação para o autor são gravados juntos: nenhum dos dois
+		// fica no banco se o outro falhar.
+		var notification *models.Notification
+		if resource.UserID != userID {
+			sender, _ := h.store.Users.GetUserByID(userID)
+			if sender != nil {
+				notification = &models.Notification{
+					ID:         primitive.NewObjectID(),
+					UserID:     resource.UserID,
+					ActorName:  sender.Name,
+					Type:       models.NotificationLike,
+					Message:    "curtiu seu material '" + resource.Title + "'.",
+					ResourceID: resourceID,
+					IsRead:     false,
+					CreatedAt:  time.Now(),
 				}
+			} else {
+				log.Printf("Aviso: não foi possível buscar o usuário %s para enviar notificação de like.", userID.Hex())
 			}
-		} else {
-			log.Printf("Aviso: não foi possível buscar dados do recurso %s para enviar notificação de like.", resourceID.Hex())
+		}
+		// Quem desligou a lista para likes não recebe a notificação gravada, mas ela
+		// ainda pode sair por e-mail ou em tempo real.
+		var prefs *models.NotificationPreferences
+		stored := notification
+		if notification != nil {
+			prefs = h.notificationPreferences(notification.UserID)
+			if !prefs.Channels(notification.Type).InApp {
+				stored = nil
+			}
+		}
+		// Um like repetido (dois cliques ao mesmo tempo) já está gravado; basta
+		// devolver o estado atual.
+		err := h.store.Likes.LikeResource(&like, stored)
+		if err != nil && err != store.ErrDuplicateKey {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to like resource"})
+			return
+		}
+		if err == nil && notification != nil {
+			h.deliver(notification, prefs)
 		}
 	}
 
-	newLikeCount, _ := store.CountLikesForResource(resourceID)
+	newLikeCount, _ := h.store.Likes.CountLikesForResource(resourceID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"likes":    newLikeCount,
 		"hasLiked": !hasLiked,
 	})
 }
 
-func HandleGetMyLikes(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetMyLikes(w http.ResponseWriter, r *http.Request) {
 	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
-	likedIDs, err := store.GetUserLikedResourceIDs(userID)
+	likedIDs, err := h.store.Likes.GetUserLikedResourceIDs(userID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user likes"})
 		return
@@ -723,14 +1297,24 @@ func HandleGetMyLikes(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, likedIDs)
 }
 
-func HandleToggleCommentLike(w http.ResponseWriter, r *http.Request) {
+// HandleToggleCommentLike curte ou descurte um comentário. Comentários apagados ou de
+// recursos fora do ar respondem 404.
+func (h *Handler) HandleToggleCommentLike(w http.ResponseWriter, r *http.Request) {
 	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
-	commentID, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	comment, ok := h.visibleComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.DeletedAt != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found"})
+		return
+	}
+	commentID := comment.ID
 
-	hasLiked, _ := store.HasUserLikedComment(userID, commentID)
+	hasLiked, _ := h.store.Likes.HasUserLikedComment(userID, commentID)
 
 	if hasLiked {
-		store.UnlikeComment(userID, commentID)
+		h.store.Likes.UnlikeComment(userID, commentID)
 	} else {
 		like := models.CommentLike{
 			ID:        primitive.NewObjectID(),
@@ -738,36 +1322,45 @@ func HandleToggleCommentLike(w http.ResponseWriter, r *http.Request) {
 			CommentID: commentID,
 			CreatedAt: time.Now(),
 		}
-		store.LikeComment(&like)
-
-		comment, _ := store.GetCommentByID(commentID)
-		if comment != nil && comment.UserID != userID {
-			sender, _ := store.GetUserByID(userID)
-			notification := models.Notification{
-				ID:         primitive.NewObjectID(),
-				UserID:     comment.UserID,
-				ActorName:  sender.Name,
-				Type:       "comment_like",
-				Message:    "curtiu seu comentário.",
-				ResourceID: comment.ResourceID,
-				CommentID:  comment.ID,
-				IsRead:     false,
-				CreatedAt:  time.Now(),
+		// Um like repetido (dois cliques ao mesmo tempo) já está gravado e já
+		// notificou o autor; basta devolver o estado atual.
+		err := h.store.Likes.LikeComment(&like)
+		if err != nil && err != store.ErrDuplicateKey {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to like comment"})
+			return
+		}
+
+		if err == nil && comment.UserID != userID {
+			sender, _ := h.store.Users.GetUserByID(userID)
+			if sender != nil {
+				notification := models.Notification{
+					ID:         primitive.NewObjectID(),
+					UserID:     comment.UserID,
+					ActorName:  sender.Name,
+					Type:       models.NotificationCommentLike,
+					Message:    "curtiu seu comentário.",
+					ResourceID: comment.ResourceID,
+					CommentID:  comment.ID,
+					IsRead:     false,
+					CreatedAt:  time.Now(),
+				}
+				h.notify(&notification)
+			} else {
+				log.Printf("Aviso: não foi possível buscar o usuário %s para enviar notificação de like.", userID.Hex())
 			}
-			store.CreateNotification(&notification)
 		}
 	}
 
-	newLikeCount, _ := store.CountLikesForComment(commentID)
+	newLikeCount, _ := h.store.Likes.CountLikesForComment(commentID)
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"likes":    newLikeCount,
 		"hasLiked": !hasLiked,
 	})
 }
 
-func HandleGetMyCommentLikes(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetMyCommentLikes(w http.ResponseWriter, r *http.Request) {
 	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
-	likedIDs, err := store.GetUserLikedCommentIDs(userID)
+	likedIDs, err := h.store.Likes.GetUserLikedCommentIDs(userID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user comment likes"})
 		return
@@ -775,22 +1368,13 @@ func HandleGetMyCommentLikes(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, likedIDs)
 }
 
-func HandleGetRelatedResources(w http.ResponseWriter, r *http.Request) {
-	resourceID, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
-
-	currentResource, err := store.GetResourceByID(resourceID)
-	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
-		return
-	}
-
-	courseCode, ok := currentResource["courseCode"].(string)
+func (h *Handler) HandleGetRelatedResources(w http.ResponseWriter, r *http.Request) {
+	currentResource, ok := h.visibleResource(w, r)
 	if !ok {
-		writeJSON(w, http.StatusOK, []models.Resource{})
 		return
 	}
 
-	relatedResources, err := store.FindRelatedResources(courseCode, resourceID)
+	relatedResources, err := h.store.Resources.FindRelatedResources(currentResource.CourseCode, currentResource.ID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch related resources"})
 		return
@@ -799,24 +1383,24 @@ func HandleGetRelatedResources(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, relatedResources)
 }
 
-func HandleGetStats(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetStats(w http.ResponseWriter, r *http.Request) {
 	var g errgroup.Group
 
 	var userCount, resourceCount, courseCount int64
 
 	g.Go(func() error {
-		count, err := database.UserCollection.CountDocuments(context.Background(), bson.M{})
+		count, err := h.store.Users.CountUsers()
 		userCount = count
 		return err
 	})
 	g.Go(func() error {
-		count, err := database.ResourceCollection.CountDocuments(context.Background(), bson.M{})
+		count, err := h.store.Resources.CountResources()
 		resourceCount = count
 		return err
 	})
 	g.Go(func() error {
-		distinctCourses, err := database.CourseCollection.Distinct(context.Background(), "code", bson.M{})
-		courseCount = int64(len(distinctCourses))
+		count, err := h.store.Catalog.CountCourses()
+		courseCount = count
 		return err
 	})
 
@@ -835,20 +1419,21 @@ func HandleGetStats(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, stats)
 }
 
-func HandleDeleteResource(w http.ResponseWriter, r *http.Request) {
+// HandleDeleteResource manda o recurso para a lixeira do dono. Ele é apagado de vez
+// (com os arquivos) pelo trash.Purger depois do prazo de retenção.
+func (h *Handler) HandleDeleteResource(w http.ResponseWriter, r *http.Request) {
 	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
 	resourceID, _ := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
 
-	err := store.DeleteResourceByID(resourceID, userID)
-
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
+	if err := h.store.Resources.TrashResource(resourceID, userID, time.Now()); err != nil {
+		if err == store.ErrNotFound {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied or resource not found"})
 			return
 		}
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete resource"})
 		return
 	}
+	h.search.Remove(resourceID)
 
-	writeJSON(w, http.StatusOK, map[string]string{"message": "Resource deleted successfully"})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Resource moved to trash"})
 }
@@ -1,316 +1,2601 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
 	"log"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
-	"uspshare/config"
-	"uspshare/database"
+	"uspshare/blob"
+	"uspshare/mail"
 	"uspshare/models"
+	"uspshare/processing"
+	"uspshare/ratelimit"
+	"uspshare/rbac"
+	"uspshare/resumable"
+	"uspshare/scan"
+	"uspshare/search"
+	"uspshare/store"
+	"uspshare/trash"
+	"uspshare/validation"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var testRouter *chi.Mux
-var testDBClient *mongo.Client
+var testStore *store.Store
+var testHandler *Handler
+var testPipeline *processing.Pipeline
+var testBlobs blob.Store
+var testMailbox *testMailer
 
 // TestMain é a função de setup para todos os testes neste pacote.
 func TestMain(m *testing.M) {
-	// Carrega o .env do diretório raiz do projeto
-	if err := godotenv.Load("../.env"); err != nil {
-		log.Fatal("Erro: não foi possível carregar o arquivo .env. Certifique-se que ele está na raiz do projeto.")
+	// Os handlers gravam arquivos em "uploads/" relativo ao diretório atual,
+	// então os testes rodam dentro de um diretório temporário.
+	tmpDir, err := os.MkdirTemp("", "uspshare-test")
+	if err != nil {
+		log.Fatalf("Erro ao criar diretório temporário para testes: %v", err)
 	}
-
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		log.Fatal("MONGO_URI não está definida no arquivo .env")
+	if err := os.Mkdir(filepath.Join(tmpDir, "uploads"), os.ModePerm); err != nil {
+		log.Fatalf("Erro ao criar diretório de uploads para testes: %v", err)
 	}
+	if err := os.Chdir(tmpDir); err != nil {
+		log.Fatalf("Erro ao entrar no diretório temporário: %v", err)
+	}
+
+	// Executa todos os testes
+	exitCode := m.Run()
+
+	os.RemoveAll(tmpDir)
+	os.Exit(exitCode)
+}
+
+// =================================
+//  HELPERS
+// =================================
 
-	// Conecta a um banco de dados de TESTE para evitar sujar o de desenvolvimento
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// testScanner faz o papel do clamd nos testes: acusa qualquer arquivo com o trecho
+// "EICAR" no conteúdo.
+type testScanner struct{}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+func (testScanner) Scan(r io.Reader) (scan.Result, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		log.Fatalf("Erro ao conectar ao MongoDB para testes: %v", err)
+		return scan.Result{}, err
+	}
+	if bytes.Contains(data, []byte("EICAR")) {
+		return scan.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+// testMailer guarda os e-mails em vez de mandá-los.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *testMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastLink devolve o token do último link mandado para o endereço, ou "".
+func (m *testMailer) lastLink(to string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != to {
+			continue
+		}
+		if match := linkTokenPattern.FindStringSubmatch(m.sent[i].Body); match != nil {
+			return match[1]
+		}
 	}
-	testDBClient = client
+	return ""
+}
 
-	// Aponta as coleções do pacote 'database' para o banco de dados de TESTE
-	testDatabase := testDBClient.Database("uspshare_test")
-	database.UserCollection = testDatabase.Collection("users")
-	database.ResourceCollection = testDatabase.Collection("resources")
-	database.CommentCollection = testDatabase.Collection("comments")
-	database.LikeCollection = testDatabase.Collection("likes")
-	database.CommentLikeCollection = testDatabase.Collection("comment_likes")
-	database.TagCollection = testDatabase.Collection("tags")
-	database.CourseCollection = testDatabase.Collection("courses")
-	database.ProfessorCollection = testDatabase.Collection("professors")
-	database.NotificationCollection = testDatabase.Collection("notifications")
+var linkTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
 
-	log.Println("Conectado ao banco de dados de teste 'uspshare_test' com sucesso!")
+var testJWTSecret = []byte("segredo-usado-apenas-nos-testes")
 
-	// Configura o roteador com todas as rotas da aplicação
+// clearDatabase troca o store por um novo, vazio, para garantir isolamento entre os testes.
+func clearDatabase(t *testing.T) {
+	testStore = store.NewMemoryStore()
+	idx := search.NewIndex()
+	testBlobs = blob.NewLocalStore("uploads", testJWTSecret)
+	testPipeline = processing.NewPipeline(testStore, idx, testBlobs, testScanner{})
+	testPipeline.Start(1)
+	t.Cleanup(testPipeline.Stop)
+	uploads, err := resumable.NewManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	testHandler = NewHandler(testStore, idx, testPipeline, testBlobs, uploads, testScanner{})
+	testHandler.SetJWTSecret(testJWTSecret)
+	testMailbox = &testMailer{}
+	testHandler.SetMailer(testMailbox, "http://app.test")
+	// Os limites ficam desligados para os testes poderem repetir requisições à
+	// vontade; os testes de limite ligam os seus com enableRateLimits.
+	testHandler.SetRateLimits(ratelimit.NewMemory(), RateLimits{}, ratelimit.LockoutPolicy{})
 	testRouter = chi.NewRouter()
-	RegisterRoutes(testRouter)
+	RegisterRoutes(testRouter, testHandler)
+}
 
-	// Executa todos os testes
-	exitCode := m.Run()
+// enableRateLimits liga os limites e a política de bloqueio e remonta as rotas.
+func enableRateLimits(limits RateLimits, lockout ratelimit.LockoutPolicy) {
+	testHandler.SetRateLimits(ratelimit.NewMemory(), limits, lockout)
+	testRouter = chi.NewRouter()
+	RegisterRoutes(testRouter, testHandler)
+}
+
+// createTestUser cria um usuário com um papel específico (role) diretamente no store.
+func createTestUser(t *testing.T, name, email, password, role string) *models.User {
+	user := &models.User{
+		Name:     name,
+		Email:    email,
+		Password: password,
+	}
+
+	err := testStore.Users.CreateUser(user)
+	assert.NoError(t, err, "Falha ao inserir usuário de teste no store")
+
+	err = testStore.Users.SetUserRole(user.ID, role, nil) // "user" ou "admin"
+	assert.NoError(t, err, "Falha ao definir o papel do usuário de teste")
+	user.Role = role
+
+	return user
+}
+
+// generateTestToken abre uma sessão para o usuário e devolve o header Authorization
+// com o token de acesso, com o papel que ele tem no store agora.
+func generateTestToken(t *testing.T, userID primitive.ObjectID) string {
+	user, err := testStore.Users.GetUserByID(userID)
+	assert.NoError(t, err, "Usuário do token de teste não existe")
+	pair, err := testHandler.startSession(httptest.NewRequest("POST", "/api/login", nil), user)
+	assert.NoError(t, err, "Falha ao abrir a sessão de teste")
+	return "Bearer " + pair.Token
+}
+
+// createTestResource cria um recurso no banco para ser usado em testes.
+func createTestResource(t *testing.T, userID primitive.ObjectID, title string) *models.Resource {
+	resource := &models.Resource{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		Title:       title,
+		CourseCode:  "MAC0110",
+		Description: "Descrição de teste",
+		UploadDate:  time.Now(),
+	}
+	err := testStore.Resources.CreateResource(resource)
+	assert.NoError(t, err)
+	return resource
+}
 
-	// Limpeza: apaga o banco de dados de teste e desconecta
-	log.Println("Limpando e desconectando o banco de dados de teste...")
-	if err := testDatabase.Drop(context.Background()); err != nil {
-		log.Printf("Aviso: não foi possível apagar o banco de dados de teste: %v", err)
+// createTestResourceWithFile cria um recurso cujo arquivo está de fato no blob store.
+func createTestResourceWithFile(t *testing.T, userID primitive.ObjectID, title, key, content string) *models.Resource {
+	assert.NoError(t, testBlobs.Put(key, strings.NewReader(content), int64(len(content)), ""))
+	resource := &models.Resource{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		Title:      title,
+		FileName:   key,
+		FileUrl:    blob.PublicURL(key),
+		UploadDate: time.Now(),
 	}
-	testDBClient.Disconnect(context.Background())
+	assert.NoError(t, testStore.Resources.CreateResource(resource))
+	return resource
+}
 
-	os.Exit(exitCode)
+// listTestNotifications devolve a caixa de entrada do usuário, direto do store.
+func listTestNotifications(t *testing.T, userID primitive.ObjectID) []models.Notification {
+	page, err := testStore.Notifications.ListNotifications(userID, store.NotificationQuery{Limit: store.MaxNotificationLimit})
+	assert.NoError(t, err)
+	return page.Items
 }
 
 // =================================
-//  HELPERS
+//  TESTS
 // =================================
 
-// clearDatabase limpa todas as coleções para garantir isolamento entre os testes.
-func clearDatabase(t *testing.T) {
-	collections := []string{
-		"users", "resources", "comments", "likes",
-		"comment_likes", "tags", "courses", "professors", "notifications",
+func TestHandleSignup(t *testing.T) {
+	clearDatabase(t)
+
+	t.Run("Cadastro com sucesso", func(t *testing.T) {
+		payload := map[string]string{
+			"name":     "Novo Usuário",
+			"email":    "novo@usp.br",
+			"password": "senhaforte123",
+		}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code, "O status code deveria ser 201 Created")
+
+		// Verifica se o usuário foi realmente criado no banco
+		user, err := testStore.Users.GetUserByEmail("novo@usp.br")
+		assert.NoError(t, err, "O usuário deveria existir no banco de dados")
+		assert.Equal(t, "Novo Usuário", user.Name)
+		assert.True(t, user.EmailPending, "A conta fica pendente até confirmar o e-mail")
+		assert.NotEmpty(t, testMailbox.lastLink("novo@usp.br"), "O link de confirmação deveria ter sido enviado")
+	})
+
+	t.Run("Aceita subdomínios da USP", func(t *testing.T) {
+		body := `{"name": "Aluna do IME", "email": "aluna@ime.usp.br", "password": "senhaforte123"}`
+		req := httptest.NewRequest("POST", "/api/signup", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("Falha com e-mail de fora da USP", func(t *testing.T) {
+		for _, email := range []string{"aluno@gmail.com", "aluno@notusp.br", "aluno@usp.br.example.com"} {
+			body := `{"name": "Intruso", "email": "` + email + `", "password": "senhaforte123"}`
+			req := httptest.NewRequest("POST", "/api/signup", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, email)
+			assert.Contains(t, rr.Body.String(), "@usp.br")
+		}
+		assert.Empty(t, testMailbox.lastLink("aluno@gmail.com"))
+	})
+
+	t.Run("Falha ao cadastrar com e-mail já existente", func(t *testing.T) {
+		createTestUser(t, "Usuário Existente", "existente@usp.br", "senha123", "user")
+
+		payload := map[string]string{
+			"name":     "Outro Usuário",
+			"email":    "existente@usp.br", // E-mail repetido
+			"password": "outrasenha",
+		}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		// A lógica atual retorna 500, o que é aceitável, mas um 409 Conflict seria mais semântico.
+		assert.Equal(t, http.StatusInternalServerError, rr.Code, "O status code deveria ser 500 para e-mail duplicado")
+	})
+
+	t.Run("Falha ao cadastrar com campos faltando", func(t *testing.T) {
+		payload := map[string]string{
+			"name":  "Usuário Incompleto",
+			"email": "incompleto@usp.br",
+			// Senha faltando
+		}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "O status code deveria ser 400 Bad Request")
+	})
+}
+
+func TestHandleLogin(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Login Test", "login@test.com", "senha123", "user")
+
+	t.Run("Login com sucesso", func(t *testing.T) {
+		payload := map[string]string{"email": user.Email, "password": "senha123"}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, "O status code deveria ser 200 OK")
+
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.NotEmpty(t, resp["token"], "A resposta deveria conter um token JWT")
+	})
+
+	t.Run("Login com senha incorreta", func(t *testing.T) {
+		payload := map[string]string{"email": user.Email, "password": "senha_errada"}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "O status code deveria ser 401 Unauthorized")
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	clearDatabase(t)
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	login := `{"email": "caloura@usp.br", "password": "senha123"}`
+
+	rr := do("/api/signup", `{"name": "Caloura", "email": "caloura@usp.br", "password": "senha123"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	first := testMailbox.lastLink("caloura@usp.br")
+	assert.NotEmpty(t, first)
+
+	t.Run("Conta pendente não entra", func(t *testing.T) {
+		rr := do("/api/login", login)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, "email_not_verified", resp["code"])
+	})
+
+	t.Run("Reenvio troca o link", func(t *testing.T) {
+		rr := do("/api/verify-email/resend", `{"email": "caloura@usp.br"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		second := testMailbox.lastLink("caloura@usp.br")
+		assert.NotEqual(t, first, second)
+
+		rr = do("/api/verify-email", `{"token": "`+first+`"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "O link antigo deixa de valer")
+	})
+
+	t.Run("Reenvio não revela quem tem conta", func(t *testing.T) {
+		createTestUser(t, "Veterana", "veterana@usp.br", "senha123", "student")
+		sent := len(testMailbox.sent)
+		for _, email := range []string{"ninguem@usp.br", "veterana@usp.br"} {
+			rr := do("/api/verify-email/resend", `{"email": "`+email+`"}`)
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}
+		assert.Len(t, testMailbox.sent, sent, "Só contas pendentes recebem o link")
+	})
+
+	t.Run("Confirmação libera o login", func(t *testing.T) {
+		token := testMailbox.lastLink("caloura@usp.br")
+		rr := do("/api/verify-email", `{"token": "`+token+`"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do("/api/login", login)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do("/api/verify-email", `{"token": "`+token+`"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "O link só vale uma vez")
+	})
+
+	t.Run("Token inválido", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do("/api/verify-email", `{"token": "nao-existe"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do("/api/verify-email", `{}`).Code)
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Esquecida", "esquecida@usp.br", "senha-antiga", "student")
+	oldToken := generateTestToken(t, user.ID)
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Pedido não revela quem tem conta", func(t *testing.T) {
+		rr := do("/api/password/forgot", `{"email": "ninguem@usp.br"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, testMailbox.sent)
+	})
+
+	rr := do("/api/password/forgot", `{"email": "esquecida@usp.br"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	token := testMailbox.lastLink("esquecida@usp.br")
+	assert.NotEmpty(t, token)
+	assert.Contains(t, testMailbox.sent[0].Body, "http://app.test/reset-password?token=")
+
+	t.Run("Senha curta é recusada sem gastar o link", func(t *testing.T) {
+		rr := do("/api/password/reset", `{"token": "`+token+`", "password": "curta"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Link de confirmação não troca senha", func(t *testing.T) {
+		assert.NoError(t, testHandler.sendVerification(user))
+		verify := testMailbox.lastLink("esquecida@usp.br")
+		rr := do("/api/password/reset", `{"token": "`+verify+`", "password": "senha-nova-123"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Troca a senha e derruba as sessões", func(t *testing.T) {
+		rr := do("/api/password/reset", `{"token": "`+token+`", "password": "senha-nova-123"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, do("/api/login", `{"email": "esquecida@usp.br", "password": "senha-antiga"}`).Code)
+		assert.Equal(t, http.StatusOK, do("/api/login", `{"email": "esquecida@usp.br", "password": "senha-nova-123"}`).Code)
+
+		req := httptest.NewRequest("GET", "/api/profile", nil)
+		req.Header.Set("Authorization", oldToken)
+		rr = httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "As sessões de antes da troca não valem mais")
+	})
+
+	t.Run("O link só vale uma vez", func(t *testing.T) {
+		rr := do("/api/password/reset", `{"token": "`+token+`", "password": "outra-senha-123"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Conta pendente fica confirmada", func(t *testing.T) {
+		rr := do("/api/signup", `{"name": "Caloura", "email": "caloura@usp.br", "password": "senha123"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		do("/api/password/forgot", `{"email": "caloura@usp.br"}`)
+		rr = do("/api/password/reset", `{"token": "`+testMailbox.lastLink("caloura@usp.br")+`", "password": "senha-nova-123"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusOK, do("/api/login", `{"email": "caloura@usp.br", "password": "senha-nova-123"}`).Code)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Cuidadosa", "cuidadosa@usp.br", "senha-antiga", "student")
+	token := generateTestToken(t, user.ID)
+	otherDevice := generateTestToken(t, user.ID)
+
+	change := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/profile/password", strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Exige a senha atual", func(t *testing.T) {
+		rr := change(token, `{"currentPassword": "errada", "newPassword": "senha-nova-123"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = change(token, `{"currentPassword": "senha-antiga", "newPassword": "curta"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = change("", `{"currentPassword": "senha-antiga", "newPassword": "senha-nova-123"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Troca a senha e renova a sessão", func(t *testing.T) {
+		rr := change(token, `{"currentPassword": "senha-antiga", "newPassword": "senha-nova-123"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var pair tokenPair
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pair))
+		assert.NotEmpty(t, pair.Token)
+		assert.NotEmpty(t, pair.RefreshToken)
+
+		for _, old := range []string{token, otherDevice} {
+			req := httptest.NewRequest("GET", "/api/profile", nil)
+			req.Header.Set("Authorization", old)
+			rr := httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code, "As sessões de antes da troca não valem mais")
+		}
+
+		req := httptest.NewRequest("GET", "/api/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.Token)
+		rr = httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		stored, _ := testStore.Users.GetUserByID(user.ID)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("senha-nova-123")))
+	})
+}
+
+func TestSessions(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Sessões", "sessions@test.com", "senha123", "user")
+	other := createTestUser(t, "Outra", "other@test.com", "senha123", "user")
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("User-Agent", "Teste/1.0")
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	login := func() tokenPair {
+		rr := do("POST", "/api/login", "", `{"email": "sessions@test.com", "password": "senha123"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var pair tokenPair
+		json.Unmarshal(rr.Body.Bytes(), &pair)
+		assert.NotEmpty(t, pair.RefreshToken)
+		assert.Equal(t, int64(DefaultAccessTTL/time.Second), pair.ExpiresIn)
+		return pair
+	}
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"refreshToken": refreshToken})
+		return do("POST", "/api/token/refresh", "", string(body))
+	}
+
+	laptop := login()
+	phone := login()
+
+	t.Run("Lista as sessões e marca a atual", func(t *testing.T) {
+		rr := do("GET", "/api/profile/sessions", phone.Token, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var sessions []sessionView
+		json.Unmarshal(rr.Body.Bytes(), &sessions)
+		if assert.Len(t, sessions, 2) {
+			assert.True(t, sessions[0].Current)
+			assert.False(t, sessions[1].Current)
+			assert.Equal(t, "Teste/1.0", sessions[0].UserAgent)
+			assert.NotEmpty(t, sessions[0].IP)
+		}
+		assert.NotContains(t, rr.Body.String(), "refreshHash")
+	})
+
+	t.Run("Renovação troca o refresh token", func(t *testing.T) {
+		rr := refresh(laptop.RefreshToken)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var renewed tokenPair
+		json.Unmarshal(rr.Body.Bytes(), &renewed)
+		assert.NotEqual(t, laptop.RefreshToken, renewed.RefreshToken)
+		assert.Equal(t, http.StatusOK, do("GET", "/api/profile", renewed.Token, "").Code)
+
+		// O refresh token antigo aparecendo de novo: a sessão cai inteira.
+		assert.Equal(t, http.StatusUnauthorized, refresh(laptop.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(renewed.RefreshToken).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/profile", renewed.Token, "").Code)
+
+		assert.Equal(t, http.StatusUnauthorized, refresh("lixo").Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(primitive.NewObjectID().Hex()+".abc").Code)
+	})
+
+	t.Run("Segredo inventado não derruba a sessão", func(t *testing.T) {
+		pair := login()
+		session, _, _ := strings.Cut(pair.RefreshToken, ".")
+		assert.Equal(t, http.StatusUnauthorized, refresh(session+".lixo").Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/api/profile", pair.Token, "").Code)
+		assert.Equal(t, http.StatusOK, refresh(pair.RefreshToken).Code)
+	})
+
+	t.Run("Logout derruba o token na hora", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("POST", "/api/logout", phone.Token, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/profile", phone.Token, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(phone.RefreshToken).Code)
+	})
+
+	t.Run("Revoga uma sessão específica, só do próprio usuário", func(t *testing.T) {
+		desktop := login()
+		tablet := login()
+		session, _, _ := strings.Cut(tablet.RefreshToken, ".")
+
+		rr := do("DELETE", "/api/profile/sessions/"+session, strings.TrimPrefix(generateTestToken(t, other.ID), "Bearer "), "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = do("DELETE", "/api/profile/sessions/"+session, desktop.Token, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/profile", tablet.Token, "").Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/api/profile", desktop.Token, "").Code)
+	})
+
+	t.Run("Sair de todos os dispositivos", func(t *testing.T) {
+		first := login()
+		second := login()
+		rr := do("POST", "/api/logout/all", first.Token, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/profile", first.Token, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/profile", second.Token, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(second.RefreshToken).Code)
+	})
+
+	t.Run("Conta suspensa não renova, mas pode sair", func(t *testing.T) {
+		pair := login()
+		now := time.Now()
+		assert.NoError(t, testStore.Users.SetUserSuspended(user.ID, &now))
+		assert.Equal(t, http.StatusForbidden, refresh(pair.RefreshToken).Code)
+		assert.Equal(t, http.StatusOK, do("POST", "/api/logout", pair.Token, "").Code)
+	})
+}
+
+func TestRateLimits(t *testing.T) {
+	clearDatabase(t)
+	enableRateLimits(RateLimits{
+		Auth:  ratelimit.Limit{Requests: 2, Per: time.Minute},
+		Write: ratelimit.Limit{Requests: 2, Per: time.Minute},
+	}, ratelimit.LockoutPolicy{})
+	owner := createTestUser(t, "Dona", "dona@usp.br", "senha123", "user")
+	resource := createTestResource(t, owner.ID, "Prova Resolvida")
+
+	login := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"email": "dona@usp.br", "password": "senha123"}`))
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Limita as rotas de login por IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, login("10.0.0.1:1000").Code)
+		assert.Equal(t, http.StatusOK, login("10.0.0.1:1001").Code)
+		rr := login("10.0.0.1:1002")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+
+		// O cadastro está no mesmo grupo: o IP continua sem fichas.
+		req := httptest.NewRequest("POST", "/api/signup", strings.NewReader(`{}`))
+		req.RemoteAddr = "10.0.0.1:1003"
+		rr = httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+		assert.Equal(t, http.StatusOK, login("10.0.0.2:1000").Code, "Outro IP tem seu próprio limite")
+	})
+
+	t.Run("Limita as escritas por usuário", func(t *testing.T) {
+		like := func(token string) int {
+			req := httptest.NewRequest("POST", "/api/resource/"+resource.ID.Hex()+"/like", nil)
+			req.Header.Set("Authorization", token)
+			rr := httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, req)
+			return rr.Code
+		}
+		fan := createTestUser(t, "Fã", "fa@usp.br", "senha123", "user")
+		token := generateTestToken(t, fan.ID)
+		assert.Equal(t, http.StatusOK, like(token))
+		assert.Equal(t, http.StatusOK, like(generateTestToken(t, fan.ID)))
+		assert.Equal(t, http.StatusTooManyRequests, like(token), "O limite é do usuário, não do token")
+		assert.Equal(t, http.StatusOK, like(generateTestToken(t, owner.ID)))
+
+		// Leituras não contam.
+		req := httptest.NewRequest("GET", "/api/my-likes", nil)
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	clearDatabase(t)
+	enableRateLimits(RateLimits{}, ratelimit.LockoutPolicy{Threshold: 3, Base: time.Minute, Max: time.Hour, Window: time.Hour})
+	createTestUser(t, "Alvo", "alvo@usp.br", "senha-certa", "user")
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Uma senha certa zera as falhas", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, login("alvo@usp.br", "errada").Code)
+		assert.Equal(t, http.StatusUnauthorized, login("alvo@usp.br", "errada").Code)
+		assert.Equal(t, http.StatusOK, login("alvo@usp.br", "senha-certa").Code)
+		assert.Equal(t, http.StatusUnauthorized, login("alvo@usp.br", "errada").Code)
+		assert.Equal(t, http.StatusUnauthorized, login("alvo@usp.br", "errada").Code)
+		assert.Equal(t, http.StatusOK, login("alvo@usp.br", "senha-certa").Code)
+	})
+
+	t.Run("Bloqueia o e-mail depois de várias falhas", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login("ALVO@usp.br", "errada").Code)
+		}
+		rr := login("alvo@usp.br", "senha-certa")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code, "Nem a senha certa entra durante o bloqueio")
+		assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.Equal(t, "login_locked", resp["code"])
+	})
+
+	t.Run("E-mails sem conta também são bloqueados", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login("ninguem@usp.br", "qualquer").Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, login("ninguem@usp.br", "qualquer").Code)
+	})
+}
+
+func TestHandleUploadResource(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Uploader", "uploader@test.com", "senha123", "user")
+	token := generateTestToken(t, user.ID)
+
+	t.Run("Upload com sucesso", func(t *testing.T) {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+
+		// Adiciona campos do formulário
+		_ = writer.WriteField("title", "Meu Primeiro Upload de Teste")
+		_ = writer.WriteField("description", "Uma descrição detalhada.")
+		_ = writer.WriteField("courseCode", "BCC021")
+		_ = writer.WriteField("tags", `["prova", "p1"]`)
+
+		// Adiciona o arquivo
+		part, err := writer.CreateFormFile("file", "teste.txt")
+		assert.NoError(t, err)
+		part.Write([]byte("conteúdo do arquivo de teste"))
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/upload", body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code, "O status code deveria ser 201 Created")
+
+		// Verifica se o recurso foi criado no banco
+		var created models.Resource
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		resource, err := testStore.Resources.GetResourceByID(created.ID)
+		assert.NoError(t, err, "O recurso deveria existir no banco de dados")
+		if assert.NotNil(t, resource) {
+			assert.Equal(t, "Meu Primeiro Upload de Teste", resource.Title)
+			assert.Equal(t, user.ID, resource.UserID)
+			assert.Contains(t, resource.Tags, "prova")
+		}
+		assert.Equal(t, models.ProcessingPending, created.ProcessingStatus, "O processamento deveria começar pendente")
+
+		// O arquivo não é um PDF: o processamento termina sem texto extraído.
+		testPipeline.Wait()
+		req = httptest.NewRequest("GET", "/api/resource/"+created.ID.Hex(), nil)
+		rr = httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		var fetched models.Resource
+		json.Unmarshal(rr.Body.Bytes(), &fetched)
+		assert.Equal(t, models.ProcessingDone, fetched.ProcessingStatus)
+		assert.Equal(t, 0, fetched.PageCount)
+
+		req = httptest.NewRequest("GET", "/api/resource/"+created.ID.Hex()+"/text", nil)
+		rr = httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Falha no upload sem autenticação", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/upload", nil) // Sem corpo e sem token
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "O status code deveria ser 401 Unauthorized")
+	})
+}
+
+// purgeTrash apaga de vez tudo o que está na lixeira.
+func purgeTrash(t *testing.T) {
+	_, err := trash.NewPurger(testStore, testBlobs, 0).Purge()
+	assert.NoError(t, err)
+}
+
+// uploadTestFile envia um arquivo por POST /api/upload.
+func uploadTestFile(t *testing.T, token, title, fileName string, content []byte) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("title", title)
+	part, err := writer.CreateFormFile("file", fileName)
+	assert.NoError(t, err)
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/upload", body)
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestUploadDeduplication(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Uploader", "dedup@test.com", "senha123", "user")
+	token := generateTestToken(t, user.ID)
+	content := []byte("%PDF-1.4 prova antiga de cálculo")
+	countUploadedFiles := func() int {
+		entries, _ := os.ReadDir("uploads")
+		var files int
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasSuffix(e.Name(), "_thumb.jpg") {
+				files++
+			}
+		}
+		return files
+	}
+	filesBefore := countUploadedFiles()
+
+	type uploadResult struct {
+		models.Resource
+		Duplicate *struct {
+			ResourceID  string `json:"resourceId"`
+			Link        string `json:"link"`
+			UseExisting string `json:"useExisting"`
+			Message     string `json:"message"`
+		} `json:"duplicate"`
+	}
+	// O arquivo só vai para a chave definitiva depois de passar pelo antivírus.
+	upload := func(title, fileName string, content []byte) uploadResult {
+		rr := uploadTestFile(t, token, title, fileName, content)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var result uploadResult
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		assert.Equal(t, models.ScanScanning, result.ScanStatus)
+		testPipeline.Wait()
+		stored, err := testStore.Resources.GetResourceByID(result.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, models.ScanClean, stored.ScanStatus)
+			result.FileUrl = stored.FileUrl
+		}
+		return result
+	}
+
+	first := upload("P1 2019", "p1.pdf", content)
+	assert.Len(t, first.ContentHash, 64, "O upload deveria guardar o SHA-256 do arquivo")
+	assert.Nil(t, first.Duplicate, "O primeiro upload não é duplicado")
+
+	second := upload("Prova 1 de 2019", "outro-nome.pdf", content)
+	assert.Equal(t, first.ContentHash, second.ContentHash)
+	assert.Equal(t, first.FileUrl, second.FileUrl, "O mesmo conteúdo deveria usar o mesmo blob")
+	if assert.NotNil(t, second.Duplicate, "O upload repetido deveria avisar sobre o recurso existente") {
+		assert.Equal(t, first.ID.Hex(), second.Duplicate.ResourceID)
+		assert.Equal(t, "/file/"+first.ID.Hex(), second.Duplicate.Link)
+		assert.Contains(t, second.Duplicate.Message, "P1 2019")
+	}
+
+	other := upload("Outra prova", "p2.pdf", []byte("%PDF-1.4 outra prova"))
+	assert.Nil(t, other.Duplicate)
+	assert.NotEqual(t, first.FileUrl, other.FileUrl)
+
+	assert.Equal(t, filesBefore+2, countUploadedFiles(), "Só deveriam existir dois arquivos novos em disco")
+
+	t.Run("Quem enviou pode ficar com o recurso existente", func(t *testing.T) {
+		useExisting := func(path, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", path, nil)
+			req.Header.Set("Authorization", token)
+			rr := httptest.NewRecorder()
+			testRouter.ServeHTTP(rr, req)
+			return rr
+		}
+		third := upload("P1 de novo", "p1-copia.pdf", content)
+		if !assert.NotNil(t, third.Duplicate) {
+			return
+		}
+		assert.Equal(t, "/api/resource/"+third.ID.Hex()+"/use-existing", third.Duplicate.UseExisting)
+
+		stranger := createTestUser(t, "Outra", "dedup-other@test.com", "senha123", "user")
+		rr := useExisting(third.Duplicate.UseExisting, generateTestToken(t, stranger.ID))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = useExisting("/api/resource/"+other.ID.Hex()+"/use-existing", token)
+		assert.Equal(t, http.StatusConflict, rr.Code, "Sem duplicata não há o que usar")
+
+		rr = useExisting(third.Duplicate.UseExisting, token)
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var kept models.ResourceWithDetails
+		json.Unmarshal(rr.Body.Bytes(), &kept)
+		assert.Equal(t, first.ID, kept.ID)
+
+		_, err := testStore.Resources.GetResourceByID(third.ID)
+		assert.Equal(t, store.ErrNotFound, err, "O upload novo deveria ter sido apagado")
+		rc, err := testBlobs.Open(blob.KeyFromURL(first.FileUrl))
+		if assert.NoError(t, err, "O blob continua com os outros recursos") {
+			rc.Close()
+		}
+	})
+
+	deleteResource := func(id primitive.ObjectID) {
+		req := httptest.NewRequest("DELETE", "/api/resource/"+id.Hex(), nil)
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		purgeTrash(t)
+	}
+	key := blob.KeyFromURL(first.FileUrl)
+
+	deleteResource(first.ID)
+	rc, err := testBlobs.Open(key)
+	if assert.NoError(t, err, "O blob ainda é usado pelo segundo recurso") {
+		rc.Close()
+	}
+
+	deleteResource(second.ID)
+	_, err = testBlobs.Open(key)
+	assert.Equal(t, blob.ErrNotFound, err, "Sem referências, o blob deveria ser apagado")
+}
+
+func TestUploadValidation(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Uploader", "validation@test.com", "senha123", "user")
+	token := generateTestToken(t, user.ID)
+
+	violations := func(rr *httptest.ResponseRecorder) []string {
+		var resp struct {
+			Error      string `json:"error"`
+			Violations []struct {
+				Rule    string `json:"rule"`
+				Message string `json:"message"`
+			} `json:"violations"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		var rules []string
+		for _, v := range resp.Violations {
+			assert.NotEmpty(t, v.Message)
+			rules = append(rules, v.Rule)
+		}
+		return rules
+	}
+
+	t.Run("Executável é recusado mesmo com extensão .pdf", func(t *testing.T) {
+		rr := uploadTestFile(t, token, "Prova", "prova.pdf", []byte("MZ\x90\x00 executável"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, []string{validation.RuleExecutable}, violations(rr))
+	})
+
+	t.Run("Extensão precisa bater com o conteúdo", func(t *testing.T) {
+		rr := uploadTestFile(t, token, "Prova", "prova.docx", []byte("%PDF-1.4 na verdade um PDF"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, []string{validation.RuleExtension}, violations(rr))
+	})
+
+	t.Run("Tipo fora da política configurada", func(t *testing.T) {
+		policy, _ := validation.DefaultPolicy().Only("pdf")
+		testHandler.SetUploadPolicy(policy)
+		defer testHandler.SetUploadPolicy(validation.DefaultPolicy())
+
+		rr := uploadTestFile(t, token, "Notas", "notas.txt", []byte("anotações"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, []string{validation.RuleContentType}, violations(rr))
+	})
+
+	t.Run("Arquivo recusado não é gravado", func(t *testing.T) {
+		resources, _ := testStore.Resources.ListResources()
+		assert.Empty(t, resources)
+	})
+
+	t.Run("Extensão do arquivo gravado é normalizada", func(t *testing.T) {
+		rr := uploadTestFile(t, token, "Prova", "PROVA.PDF", []byte("%PDF-1.4 prova"))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var created models.Resource
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		assert.NotContains(t, rr.Body.String(), "fileUrl", "O caminho do blob não sai na API")
+		stored, _ := testStore.Resources.GetResourceByID(created.ID)
+		assert.True(t, strings.HasSuffix(stored.FileUrl, ".pdf"), stored.FileUrl)
+		assert.Equal(t, "PROVA.PDF", created.FileName)
+	})
+
+	t.Run("Avatar precisa ser imagem", func(t *testing.T) {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "avatar.png")
+		part.Write([]byte("<html><script>alert(1)</script></html>"))
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/profile/avatar", body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, []string{validation.RuleContentType}, violations(rr))
+	})
+}
+
+func TestResumableUpload(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Uploader", "resumable@test.com", "senha123", "user")
+	token := generateTestToken(t, user.ID)
+	other := generateTestToken(t, createTestUser(t, "Outro", "outro-resumable@test.com", "senha123", "user").ID)
+
+	metadata := func(pairs ...string) string {
+		var parts []string
+		for i := 0; i < len(pairs); i += 2 {
+			parts = append(parts, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+		}
+		return strings.Join(parts, ",")
+	}
+	request := func(method, target, token string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("Authorization", token)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	create := func(length int, meta string) *httptest.ResponseRecorder {
+		return request("POST", "/api/uploads", token, nil, map[string]string{
+			"Tus-Resumable": "1.0.0", "Upload-Length": strconv.Itoa(length), "Upload-Metadata": meta,
+		})
+	}
+	patch := func(location, token string, offset int, chunk string) *httptest.ResponseRecorder {
+		return request("PATCH", location, token, strings.NewReader(chunk), map[string]string{
+			"Tus-Resumable": "1.0.0", "Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(offset),
+		})
+	}
+
+	content := "%PDF-1.4 coletânea de provas digitalizadas"
+
+	t.Run("Upload em pedaços vira um recurso", func(t *testing.T) {
+		rr := create(len(content), metadata("filename", "provas.pdf", "title", "Coletânea de P1", "tags", `["prova"]`))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		location := rr.Header().Get("Location")
+		assert.True(t, strings.HasPrefix(location, "/api/uploads/"))
+		assert.Equal(t, "0", rr.Header().Get("Upload-Offset"))
+
+		rr = patch(location, token, 0, content[:10])
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("Upload-Offset"))
+
+		assert.Equal(t, http.StatusConflict, patch(location, token, 0, content[:10]).Code, "Offset antigo é recusado")
+		assert.Equal(t, http.StatusNotFound, patch(location, other, 10, content[10:]).Code, "Sessão de outro usuário")
+
+		rr = request("HEAD", location, token, nil, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("Upload-Offset"))
+		assert.Equal(t, strconv.Itoa(len(content)), rr.Header().Get("Upload-Length"))
+
+		rr = request("POST", location+"/finalize", token, nil, nil)
+		assert.Equal(t, http.StatusConflict, rr.Code, "Upload incompleto não pode ser finalizado")
+
+		assert.Equal(t, http.StatusNoContent, patch(location, token, 10, content[10:]).Code)
+
+		rr = request("POST", location+"/finalize", token, nil, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var created models.Resource
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		assert.Equal(t, "Coletânea de P1", created.Title)
+		assert.Equal(t, "provas.pdf", created.FileName)
+		assert.Equal(t, []string{"prova"}, created.Tags)
+		assert.Equal(t, user.ID, created.UserID)
+
+		stored, _ := testStore.Resources.GetResourceByID(created.ID)
+		rc, err := testBlobs.Open(blob.KeyFromURL(stored.FileUrl))
+		if assert.NoError(t, err) {
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			assert.Equal(t, content, string(data))
+		}
+
+		assert.Equal(t, http.StatusNotFound, request("HEAD", location, token, nil, nil).Code, "A sessão some depois de finalizada")
+	})
+
+	t.Run("Tipo e tamanho são conferidos ao abrir a sessão", func(t *testing.T) {
+		rr := create(100, metadata("filename", "setup.exe"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		rr = create(6<<20, metadata("filename", "foto.png"))
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, http.StatusBadRequest, create(10, metadata("title", "Sem nome")).Code)
+		assert.Equal(t, http.StatusBadRequest, create(10, "filename n\xe3o-base64!").Code)
+	})
+
+	t.Run("Conteúdo inválido é recusado na finalização", func(t *testing.T) {
+		payload := "MZ executável"
+		location := create(len(payload), metadata("filename", "prova.pdf")).Header().Get("Location")
+		assert.Equal(t, http.StatusNoContent, patch(location, token, 0, payload).Code)
+		rr := request("POST", location+"/finalize", token, nil, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, http.StatusNotFound, request("HEAD", location, token, nil, nil).Code)
+	})
+
+	t.Run("Cancelamento apaga a sessão", func(t *testing.T) {
+		location := create(len(content), metadata("filename", "provas.pdf")).Header().Get("Location")
+		assert.Equal(t, http.StatusNoContent, request("DELETE", location, token, nil, nil).Code)
+		assert.Equal(t, http.StatusNotFound, request("HEAD", location, token, nil, nil).Code)
+	})
+}
+
+func TestHandleGetResources(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Uploader", "list@test.com", "senha123", "user")
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fixtures := []models.Resource{
+		{Title: "Prova P1 de Cálculo", CourseCode: "MAT2453", Type: "Prova", Semester: "2024.1", Tags: []string{"prova", "p1"}},
+		{Title: "Lista de Exercícios", CourseCode: "MAT2453", Type: "Lista", Semester: "2024.1", Tags: []string{"lista"}},
+		{Title: "Resumo de Algoritmos", CourseCode: "MAC0110", Type: "Resumo", Semester: "2023.2", Tags: []string{"resumo", "p1"}},
+	}
+	for i := range fixtures {
+		fixtures[i].ID = primitive.NewObjectID()
+		fixtures[i].UserID = user.ID
+		fixtures[i].UploadDate = base.AddDate(0, 0, i)
+		assert.NoError(t, testStore.Resources.CreateResource(&fixtures[i]))
+	}
+	testStore.Likes.CreateLike(&models.Like{ID: primitive.NewObjectID(), UserID: user.ID, ResourceID: fixtures[1].ID})
+
+	get := func(t *testing.T, query string) (int, store.ResourcePage) {
+		req := httptest.NewRequest("GET", "/api/resources"+query, nil)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+
+		var page store.ResourcePage
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		return rr.Code, page
+	}
+	titles := func(page store.ResourcePage) []string {
+		var out []string
+		for _, item := range page.Items {
+			out = append(out, item.Title)
+		}
+		return out
+	}
+
+	t.Run("Sem filtros retorna tudo do mais novo para o mais antigo", func(t *testing.T) {
+		code, page := get(t, "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(3), page.Total)
+		assert.Equal(t, []string{"Resumo de Algoritmos", "Lista de Exercícios", "Prova P1 de Cálculo"}, titles(page))
+		assert.Empty(t, page.Next)
+	})
+
+	t.Run("Filtros combinados", func(t *testing.T) {
+		_, page := get(t, "?courseCode=MAT2453&type=Prova")
+		assert.Equal(t, []string{"Prova P1 de Cálculo"}, titles(page))
+
+		_, page = get(t, "?q=algoritmos")
+		assert.Equal(t, []string{"Resumo de Algoritmos"}, titles(page))
+
+		_, page = get(t, "?tags=prova,resumo")
+		assert.Equal(t, int64(2), page.Total)
+
+		_, page = get(t, "?tags=prova,p1&tagMatch=all")
+		assert.Equal(t, []string{"Prova P1 de Cálculo"}, titles(page))
+
+		_, page = get(t, "?from=2024-03-02&to=2024-03-02")
+		assert.Equal(t, []string{"Lista de Exercícios"}, titles(page))
+	})
+
+	t.Run("Ordenação por likes", func(t *testing.T) {
+		_, page := get(t, "?sort=likes&limit=1")
+		assert.Equal(t, []string{"Lista de Exercícios"}, titles(page))
+	})
+
+	t.Run("Paginação por cursor", func(t *testing.T) {
+		_, first := get(t, "?limit=2")
+		assert.Len(t, first.Items, 2)
+		assert.Equal(t, int64(3), first.Total)
+		assert.NotEmpty(t, first.Next)
+
+		_, second := get(t, "?limit=2&cursor="+first.Next)
+		assert.Equal(t, []string{"Prova P1 de Cálculo"}, titles(second))
+		assert.Empty(t, second.Next)
+	})
+
+	t.Run("Cursor de outra ordenação é rejeitado", func(t *testing.T) {
+		_, first := get(t, "?limit=1")
+		assert.NotEmpty(t, first.Next)
+
+		code, _ := get(t, "?sort=likes&limit=1&cursor="+first.Next)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Parâmetros inválidos", func(t *testing.T) {
+		for _, query := range []string{"?sort=random", "?limit=0", "?professorId=xyz", "?cursor=lixo", "?from=ontem"} {
+			code, _ := get(t, query)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+	})
+}
+
+func TestHandleSearch(t *testing.T) {
+	clearDatabase(t)
+	user := createTestUser(t, "Buscador", "busca@test.com", "senha123", "user")
+	token := generateTestToken(t, user.ID)
+
+	calculo := createTestResource(t, user.ID, "Prova de Cálculo II")
+	createTestResource(t, user.ID, "Lista de Álgebra Linear")
+	assert.NoError(t, search.RebuildFromStore(testHandler.search, testStore.Resources))
+
+	doSearch := func(query string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/api/search?"+query, nil)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("Busca sem acento encontra título acentuado", func(t *testing.T) {
+		code, resp := doSearch("q=calculo")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, float64(1), resp["total"])
+		items := resp["items"].([]interface{})
+		if assert.Len(t, items, 1) {
+			item := items[0].(map[string]interface{})
+			assert.Equal(t, calculo.ID.Hex(), item["id"])
+			assert.Equal(t, "Buscador", item["uploaderName"])
+			highlights := item["highlights"].(map[string]interface{})
+			assert.Equal(t, "Prova de <mark>Cálculo</mark> II", highlights["title"])
+		}
+	})
+
+	t.Run("Recurso novo entra no índice após o upload", func(t *testing.T) {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		_ = writer.WriteField("title", "Resumo de Termodinâmica")
+		_ = writer.WriteField("tags", `["física"]`)
+		part, _ := writer.CreateFormFile("file", "resumo.pdf")
+		part.Write([]byte("%PDF-1.4 conteúdo"))
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/upload", body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		_, resp := doSearch("q=fisica+termodinamica")
+		assert.Equal(t, float64(0), resp["total"], "Antes da verificação o recurso não aparece na busca")
+		testPipeline.Wait()
+		_, resp = doSearch("q=fisica+termodinamica")
+		assert.Equal(t, float64(1), resp["total"])
+	})
+
+	t.Run("Recurso removido sai do índice", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/resource/"+calculo.ID.Hex(), nil)
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		_, resp := doSearch("q=calculo")
+		assert.Equal(t, float64(0), resp["total"])
+		assert.Empty(t, resp["items"])
+	})
+
+	t.Run("Recurso escondido não aparece mesmo ainda no índice", func(t *testing.T) {
+		geometria := createTestResource(t, user.ID, "Prova de Geometria")
+		assert.NoError(t, search.RebuildFromStore(testHandler.search, testStore.Resources))
+		assert.NoError(t, testStore.Resources.TrashResource(geometria.ID, user.ID, time.Now()))
+
+		_, resp := doSearch("q=geometria")
+		assert.Empty(t, resp["items"])
+	})
+
+	t.Run("Parâmetros inválidos", func(t *testing.T) {
+		for _, query := range []string{"", "q=+", "q=prova&limit=0", "q=prova&offset=-1"} {
+			code, _ := doSearch(query)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+	})
+}
+
+func TestHandleDeleteResource(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Dono", "owner@test.com", "senha123", "user")
+	anotherUser := createTestUser(t, "Outro", "another@test.com", "senha123", "user")
+	resource := createTestResourceWithFile(t, owner.ID, "Recurso para Deletar", "deletar.pdf", "%PDF-1.4")
+	assert.NoError(t, testBlobs.Put("deletar_thumb.jpg", strings.NewReader("jpg"), 3, "image/jpeg"))
+	assert.NoError(t, testStore.Resources.SetResourceThumbnail(resource.ID, "/uploads/deletar_thumb.jpg"))
+
+	ownerToken := generateTestToken(t, owner.ID)
+	anotherUserToken := generateTestToken(t, anotherUser.ID)
+
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	fileExists := func(key string) bool {
+		rc, err := testBlobs.Open(key)
+		if err == nil {
+			rc.Close()
+		}
+		return err == nil
+	}
+	trashIDs := func(token string) []primitive.ObjectID {
+		var items []struct {
+			models.Resource
+			PurgeAt time.Time `json:"purgeAt"`
+		}
+		json.Unmarshal(do("GET", "/api/my-trash", token).Body.Bytes(), &items)
+		var ids []primitive.ObjectID
+		for _, item := range items {
+			ids = append(ids, item.ID)
+			assert.True(t, item.PurgeAt.After(*item.DeletedAt))
+		}
+		return ids
+	}
+
+	t.Run("Falha ao deletar recurso de outro usuário", func(t *testing.T) {
+		rr := do("DELETE", "/api/resource/"+resource.ID.Hex(), anotherUserToken) // Tentando deletar com o token de outro usuário
+		assert.Equal(t, http.StatusForbidden, rr.Code, "O status code deveria ser 403 Forbidden")
+	})
+
+	t.Run("Recurso apagado vai para a lixeira", func(t *testing.T) {
+		rr := do("DELETE", "/api/resource/"+resource.ID.Hex(), ownerToken)
+		assert.Equal(t, http.StatusOK, rr.Code, "O status code deveria ser 200 OK")
+
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/resource/"+resource.ID.Hex(), "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/resource/"+resource.ID.Hex()+"/comments", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/resource/"+resource.ID.Hex()+"/text", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/resource/"+resource.ID.Hex()+"/related", "").Code)
+		all, _ := testStore.Resources.ListResources()
+		assert.Empty(t, all)
+		mine, _ := testStore.Resources.GetResourcesByUserID(owner.ID)
+		assert.Empty(t, mine)
+
+		assert.Equal(t, []primitive.ObjectID{resource.ID}, trashIDs(ownerToken))
+		assert.Empty(t, trashIDs(anotherUserToken))
+		assert.True(t, fileExists("deletar.pdf"), "O arquivo só é apagado quando a lixeira é esvaziada")
+		assert.Equal(t, http.StatusForbidden, do("DELETE", "/api/resource/"+resource.ID.Hex(), ownerToken).Code,
+			"Recurso já na lixeira")
+		assert.Equal(t, http.StatusNotFound, do("PUT", "/api/resource/"+resource.ID.Hex(), ownerToken).Code,
+			"Recurso na lixeira não se edita")
+	})
+
+	t.Run("Restaurar tira o recurso da lixeira", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do("POST", "/api/resource/"+resource.ID.Hex()+"/restore", anotherUserToken).Code)
+
+		rr := do("POST", "/api/resource/"+resource.ID.Hex()+"/restore", ownerToken)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/api/resource/"+resource.ID.Hex(), "").Code)
+		assert.Empty(t, trashIDs(ownerToken))
+		hits, _ := testHandler.search.Search("deletar", 0, 10)
+		assert.Len(t, hits, 1, "O recurso restaurado volta para a busca")
+
+		assert.Equal(t, http.StatusNotFound, do("POST", "/api/resource/"+resource.ID.Hex()+"/restore", ownerToken).Code)
+	})
+
+	t.Run("Esvaziar a lixeira apaga o recurso e os arquivos", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("DELETE", "/api/resource/"+resource.ID.Hex(), ownerToken).Code)
+		purgeTrash(t)
+
+		// Verifica se o recurso foi removido do banco
+		_, err := testStore.Resources.GetResourceByID(resource.ID)
+		assert.Equal(t, store.ErrNotFound, err, "O recurso não deveria mais existir no banco")
+
+		// Verifica se o arquivo e o thumbnail foram apagados
+		assert.False(t, fileExists("deletar.pdf"), "O arquivo deveria ter sido apagado")
+		assert.False(t, fileExists("deletar_thumb.jpg"), "O thumbnail deveria ter sido apagado")
+	})
+}
+
+func TestHandleDownloadResource(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Dono", "owner@test.com", "senha123", "user")
+	resource := createTestResourceWithFile(t, owner.ID, "Prova", "prova.pdf", "%PDF-1.4 conteúdo")
+
+	t.Run("Redireciona para uma URL assinada que serve o arquivo", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/resource/"+resource.ID.Hex()+"/download", nil)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusFound, rr.Code)
+
+		location := rr.Header().Get("Location")
+		assert.Contains(t, location, "sig=")
+
+		files := http.StripPrefix(blob.URLPrefix, blob.Handler(testBlobs))
+		rr = httptest.NewRecorder()
+		files.ServeHTTP(rr, httptest.NewRequest("GET", location, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "attachment", rr.Header().Get("Content-Disposition"))
+		assert.Equal(t, "%PDF-1.4 conteúdo", rr.Body.String())
+	})
+
+	t.Run("view=true abre no navegador", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/resource/"+resource.ID.Hex()+"/download?view=true", nil)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Contains(t, rr.Header().Get("Location"), "view=true")
+	})
+
+	t.Run("Recurso inexistente", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/resource/"+primitive.NewObjectID().Hex()+"/download", nil)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestHandleUpdateResource(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Dono", "owner@test.com", "senha123", "user")
+	anotherUser := createTestUser(t, "Outro", "another@test.com", "senha123", "user")
+	resource := createTestResource(t, owner.ID, "Lista Antiga")
+
+	put := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/resource/"+resource.ID.Hex(), strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Só o dono pode editar", func(t *testing.T) {
+		rr := put(generateTestToken(t, anotherUser.ID), `{"title": "Invasão"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Campos ausentes mantêm o valor atual", func(t *testing.T) {
+		rr := put(generateTestToken(t, owner.ID), `{"title": "Lista Nova", "tags": ["gabarito"]}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var updated models.ResourceWithDetails
+		json.Unmarshal(rr.Body.Bytes(), &updated)
+		assert.Equal(t, "Lista Nova", updated.Title)
+		assert.Equal(t, []string{"gabarito"}, updated.Tags)
+		assert.Equal(t, resource.CourseCode, updated.CourseCode)
+
+		hits, _ := testHandler.search.Search("nova", 0, 10)
+		assert.Len(t, hits, 1, "A edição deve ser reindexada")
+	})
+
+	t.Run("Título vazio é recusado", func(t *testing.T) {
+		rr := put(generateTestToken(t, owner.ID), `{"title": "  "}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestHandleToggleLike(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Dono", "owner@test.com", "senha123", "user")
+	fan := createTestUser(t, "Fã", "fan@test.com", "senha123", "user")
+	resource := createTestResource(t, owner.ID, "Lista Curtida")
+
+	toggle := func(token string, id primitive.ObjectID) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/api/resource/"+id.Hex()+"/like", nil)
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		var body map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body
+	}
+
+	t.Run("Curtir notifica o autor", func(t *testing.T) {
+		code, body := toggle(generateTestToken(t, fan.ID), resource.ID)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, true, body["hasLiked"])
+		assert.Equal(t, float64(1), body["likes"])
+
+		notifications := listTestNotifications(t, owner.ID)
+		if assert.Len(t, notifications, 1) {
+			assert.Equal(t, "like", notifications[0].Type)
+			assert.Equal(t, "Fã", notifications[0].ActorName)
+		}
+	})
+
+	t.Run("Curtir de novo desfaz o like", func(t *testing.T) {
+		code, body := toggle(generateTestToken(t, fan.ID), resource.ID)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, false, body["hasLiked"])
+		assert.Equal(t, float64(0), body["likes"])
+	})
+
+	t.Run("O autor não é notificado do próprio like", func(t *testing.T) {
+		code, _ := toggle(generateTestToken(t, owner.ID), resource.ID)
+		assert.Equal(t, http.StatusOK, code)
+		notifications := listTestNotifications(t, owner.ID)
+		assert.Len(t, notifications, 1)
+	})
+
+	t.Run("Recurso inexistente ou na lixeira", func(t *testing.T) {
+		code, _ := toggle(generateTestToken(t, fan.ID), primitive.NewObjectID())
+		assert.Equal(t, http.StatusNotFound, code)
+
+		assert.NoError(t, testStore.Resources.TrashResource(resource.ID, owner.ID, time.Now()))
+		code, _ = toggle(generateTestToken(t, fan.ID), resource.ID)
+		assert.Equal(t, http.StatusNotFound, code)
+		liked, _ := testStore.Likes.HasUserLikedResource(fan.ID, resource.ID)
+		assert.False(t, liked)
+	})
+}
+
+func TestCommentModeration(t *testing.T) {
+	clearDatabase(t)
+	author := createTestUser(t, "Autor", "author@test.com", "senha123", "user")
+	reader := createTestUser(t, "Leitor", "reader@test.com", "senha123", "user")
+	admin := createTestUser(t, "Admin", "admin@test.com", "senha123", "admin")
+	resource := createTestResource(t, author.ID, "Lista Comentada")
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	comment := func(token, content, parentID string) models.CommentWithAuthor {
+		body, _ := json.Marshal(map[string]string{"content": content, "parentId": parentID})
+		rr := do("POST", "/api/resource/"+resource.ID.Hex()+"/comments", token, string(body))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var c models.CommentWithAuthor
+		json.Unmarshal(rr.Body.Bytes(), &c)
+		return c
+	}
+	authorToken := generateTestToken(t, author.ID)
+	readerToken := generateTestToken(t, reader.ID)
+	adminToken := generateTestToken(t, admin.ID)
+
+	root := comment(authorToken, "Comentário original", "")
+	reply := comment(readerToken, "Resposta", root.ID.Hex())
+
+	t.Run("Só o autor edita", func(t *testing.T) {
+		rr := do("PUT", "/api/comment/"+root.ID.Hex(), readerToken, `{"content": "Invasão"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("PUT", "/api/comment/"+root.ID.Hex(), authorToken, `{"content": "  "}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Edição guarda o histórico e marca o comentário", func(t *testing.T) {
+		rr := do("PUT", "/api/comment/"+root.ID.Hex(), authorToken, `{"content": "Comentário corrigido"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var edited models.CommentWithAuthor
+		json.Unmarshal(rr.Body.Bytes(), &edited)
+		assert.Equal(t, "Comentário corrigido", edited.Content)
+		assert.NotNil(t, edited.EditedAt)
+
+		rr = do("GET", "/api/comment/"+root.ID.Hex()+"/history", "", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var edits []models.CommentEdit
+		json.Unmarshal(rr.Body.Bytes(), &edits)
+		if assert.Len(t, edits, 1) {
+			assert.Equal(t, "Comentário original", edits[0].Content)
+		}
+	})
+
+	var reportID string
+	t.Run("Denúncia entra na fila dos admins", func(t *testing.T) {
+		rr := do("POST", "/api/comment/"+root.ID.Hex()+"/report", authorToken, `{"reason": "spam"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Ninguém denuncia o próprio comentário")
+		rr = do("POST", "/api/comment/"+root.ID.Hex()+"/report", readerToken, `{}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = do("POST", "/api/comment/"+root.ID.Hex()+"/report", readerToken, `{"reason": "Spam"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Motivo fora da lista")
+
+		rr = do("POST", "/api/comment/"+root.ID.Hex()+"/report", readerToken, `{"reason": "spam"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		rr = do("POST", "/api/comment/"+root.ID.Hex()+"/report", readerToken, `{"reason": "spam"}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = do("GET", "/api/admin/reports", readerToken, "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("GET", "/api/admin/reports?type=comment", adminToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var reports []models.Report
+		json.Unmarshal(rr.Body.Bytes(), &reports)
+		if assert.Len(t, reports, 1) {
+			assert.Equal(t, "Comentário corrigido", reports[0].Content)
+			reportID = reports[0].ID.Hex()
+		}
+	})
+
+	t.Run("Admin apaga o comentário denunciado", func(t *testing.T) {
+		rr := do("POST", "/api/admin/reports/"+reportID+"/actions", adminToken, `{"action": "delete"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = do("POST", "/api/admin/reports/"+reportID+"/actions", adminToken, `{"action": "dismiss"}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		rr = do("GET", "/api/admin/reports", adminToken, "")
+		assert.JSONEq(t, `[]`, rr.Body.String())
+		rr = do("GET", "/api/admin/reports?status=actioned", adminToken, "")
+		var reports []models.Report
+		json.Unmarshal(rr.Body.Bytes(), &reports)
+		assert.Len(t, reports, 1)
+
+		rr = do("GET", "/api/resource/"+resource.ID.Hex()+"/comments", "", "")
+		var tree []models.CommentWithAuthor
+		json.Unmarshal(rr.Body.Bytes(), &tree)
+		if assert.Len(t, tree, 1) {
+			assert.Equal(t, models.CommentRemovedContent, tree[0].Content)
+			assert.Empty(t, tree[0].AuthorName)
+			assert.Len(t, tree[0].Replies, 1, "A resposta continua na árvore")
+		}
+	})
+
+	t.Run("Autor apaga a própria resposta; outros não", func(t *testing.T) {
+		rr := do("DELETE", "/api/comment/"+reply.ID.Hex(), authorToken, "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("DELETE", "/api/comment/"+reply.ID.Hex(), readerToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = do("DELETE", "/api/comment/"+reply.ID.Hex(), readerToken, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = do("PUT", "/api/comment/"+reply.ID.Hex(), readerToken, `{"content": "Volta"}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Comentário do autor vai para a lixeira e volta", func(t *testing.T) {
+		rr := do("GET", "/api/my-trash/comments", readerToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var trash []struct {
+			ID      primitive.ObjectID `json:"id"`
+			Content string             `json:"content"`
+			PurgeAt time.Time          `json:"purgeAt"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &trash)
+		if assert.Len(t, trash, 1) {
+			assert.Equal(t, reply.ID, trash[0].ID)
+			assert.Equal(t, "Resposta", trash[0].Content)
+			assert.False(t, trash[0].PurgeAt.IsZero())
+		}
+		rr = do("GET", "/api/my-trash/comments", authorToken, "")
+		assert.JSONEq(t, `[]`, rr.Body.String(), "O comentário removido pela moderação não vai para a lixeira")
+
+		rr = do("GET", "/api/comment/"+reply.ID.Hex()+"/history", "", "")
+		assert.JSONEq(t, `[]`, rr.Body.String())
+
+		rr = do("POST", "/api/comment/"+reply.ID.Hex()+"/restore", authorToken, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = do("POST", "/api/comment/"+root.ID.Hex()+"/restore", authorToken, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code, "Removido pela moderação não se restaura")
+		rr = do("POST", "/api/comment/"+reply.ID.Hex()+"/restore", readerToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var restored models.CommentWithAuthor
+		json.Unmarshal(rr.Body.Bytes(), &restored)
+		assert.Equal(t, "Resposta", restored.Content)
+		assert.Nil(t, restored.DeletedAt)
+
+		rr = do("DELETE", "/api/comment/"+reply.ID.Hex(), readerToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Só curte comentário visível", func(t *testing.T) {
+		rr := do("POST", "/api/comment/"+reply.ID.Hex()+"/like", authorToken, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code, "Comentário apagado")
+
+		fresh := comment(readerToken, "Outro comentário", "")
+		rr = do("POST", "/api/comment/"+fresh.ID.Hex()+"/like", authorToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		assert.NoError(t, testStore.Resources.HideResource(resource.ID, time.Now()))
+		rr = do("POST", "/api/comment/"+fresh.ID.Hex()+"/like", authorToken, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code, "Recurso escondido")
+		count, _ := testStore.Likes.CountLikesForComment(fresh.ID)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestModerationQueue(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Dono", "owner@test.com", "senha123", "user")
+	reader := createTestUser(t, "Leitor", "reader@test.com", "senha123", "user")
+	admin := createTestUser(t, "Admin", "admin@test.com", "senha123", "admin")
+	resource := createTestResource(t, owner.ID, "Material Denunciado")
+	testHandler.indexResource(resource.ID)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	listReports := func(query string) []models.Report {
+		rr := do("GET", "/api/admin/reports"+query, generateTestToken(t, admin.ID), "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var reports []models.Report
+		json.Unmarshal(rr.Body.Bytes(), &reports)
+		return reports
+	}
+	ownerToken := generateTestToken(t, owner.ID)
+	readerToken := generateTestToken(t, reader.ID)
+	adminToken := generateTestToken(t, admin.ID)
+
+	t.Run("Denúncias de recurso e de perfil", func(t *testing.T) {
+		rr := do("POST", "/api/resource/"+resource.ID.Hex()+"/report", ownerToken, `{"reason": "spam"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Ninguém denuncia o próprio recurso")
+		rr = do("POST", "/api/resource/"+resource.ID.Hex()+"/report", readerToken, `{"reason": "copyright", "details": " Cópia do livro "}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var report models.Report
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		assert.Equal(t, owner.ID, report.OwnerID)
+		assert.Equal(t, "Cópia do livro", report.Details)
+		assert.Equal(t, models.ReportOpen, report.Status)
+
+		rr = do("POST", "/api/users/"+owner.ID.Hex()+"/report", readerToken, `{"reason": "harassment"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		rr = do("POST", "/api/users/"+primitive.NewObjectID().Hex()+"/report", readerToken, `{"reason": "harassment"}`)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = do("POST", "/api/users/"+reader.ID.Hex()+"/report", readerToken, `{"reason": "other"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Filtros da fila", func(t *testing.T) {
+		assert.Len(t, listReports(""), 2)
+		assert.Len(t, listReports("?type=resource"), 1)
+		assert.Len(t, listReports("?reason=harassment"), 1)
+		assert.Len(t, listReports("?status=dismissed"), 0)
+		rr := do("GET", "/api/admin/reports?status=closed", adminToken, "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Esconder o recurso fecha a denúncia", func(t *testing.T) {
+		reports := listReports("?type=resource")
+		if !assert.Len(t, reports, 1) {
+			return
+		}
+		rr := do("POST", "/api/admin/reports/"+reports[0].ID.Hex()+"/actions", adminToken, `{"action": "suspend-forever"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = do("POST", "/api/admin/reports/"+reports[0].ID.Hex()+"/actions", adminToken, `{"action": "hide", "note": "Material protegido"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do("GET", "/api/resource/"+resource.ID.Hex(), "", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = do("GET", "/api/search?q=Denunciado", "", "")
+		assert.NotContains(t, rr.Body.String(), resource.ID.Hex())
+
+		rr = do("GET", "/api/admin/reports/"+reports[0].ID.Hex(), adminToken, "")
+		var report models.Report
+		json.Unmarshal(rr.Body.Bytes(), &report)
+		assert.Equal(t, models.ReportActioned, report.Status)
+		assert.Equal(t, models.ModerationHide, report.Action)
+		assert.Equal(t, admin.ID, *report.ResolvedBy)
+	})
+
+	userReports := listReports("?type=user")
+	if !assert.Len(t, userReports, 1) {
+		return
+	}
+
+	t.Run("Ações de conteúdo não valem para perfis", func(t *testing.T) {
+		rr := do("POST", "/api/admin/reports/"+userReports[0].ID.Hex()+"/actions", adminToken, `{"action": "hide"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Suspensão derruba as sessões e bloqueia login", func(t *testing.T) {
+		rr := do("POST", "/api/admin/reports/"+userReports[0].ID.Hex()+"/actions", adminToken, `{"action": "suspend"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do("POST", "/api/login", "", `{"email": "owner@test.com", "password": "senha123"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("POST", "/api/resource/"+resource.ID.Hex()+"/restore", ownerToken, "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		rr = do("GET", "/api/profile", ownerToken, "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "Sessões abertas caem com a suspensão")
+	})
+
+	t.Run("Admin tira a suspensão", func(t *testing.T) {
+		rr := do("DELETE", "/api/admin/users/"+owner.ID.Hex()+"/suspension", adminToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = do("DELETE", "/api/admin/users/"+owner.ID.Hex()+"/suspension", adminToken, "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		rr = do("POST", "/api/login", "", `{"email": "owner@test.com", "password": "senha123"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		ownerToken = generateTestToken(t, owner.ID)
+	})
+
+	t.Run("Aviso vira notificação do dono", func(t *testing.T) {
+		rr := do("POST", "/api/users/"+owner.ID.Hex()+"/report", generateTestToken(t, admin.ID), `{"reason": "spam"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		reports := listReports("?type=user")
+		if !assert.Len(t, reports, 1) {
+			return
+		}
+		rr = do("POST", "/api/admin/reports/"+reports[0].ID.Hex()+"/actions", adminToken, `{"action": "warn", "note": "Evite spam."}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = do("GET", "/api/notifications", ownerToken, "")
+		var page store.NotificationPage
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		if assert.Len(t, page.Items, 1) {
+			assert.Equal(t, "moderation_warning", page.Items[0].Type)
+			assert.Contains(t, page.Items[0].Message, "Evite spam.")
+		}
+	})
+
+	t.Run("Auditoria registra quem decidiu o quê", func(t *testing.T) {
+		rr := do("GET", "/api/admin/audit?targetId="+owner.ID.Hex(), adminToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var actions []models.ModerationAction
+		json.Unmarshal(rr.Body.Bytes(), &actions)
+		if assert.Len(t, actions, 3) {
+			assert.Equal(t, models.ModerationWarn, actions[0].Action)
+			assert.Equal(t, models.ModerationUnsuspend, actions[1].Action)
+			assert.Equal(t, models.ModerationSuspend, actions[2].Action)
+			assert.Equal(t, admin.ID, actions[2].AdminID)
+			assert.NotNil(t, actions[2].ReportID)
+		}
+		rr = do("GET", "/api/admin/audit?adminId="+admin.ID.Hex(), adminToken, "")
+		json.Unmarshal(rr.Body.Bytes(), &actions)
+		assert.Len(t, actions, 4)
+		rr = do("GET", "/api/admin/audit?adminId=xyz", adminToken, "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Equipe suspensa não modera", func(t *testing.T) {
+		now := time.Now()
+		assert.NoError(t, testStore.Users.SetUserSuspended(admin.ID, &now))
+		defer testStore.Users.SetUserSuspended(admin.ID, nil)
+
+		rr := do("POST", "/api/admin/reports/"+userReports[0].ID.Hex()+"/actions", adminToken, `{"action": "dismiss"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("GET", "/api/admin/reports", adminToken, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestRoles(t *testing.T) {
+	clearDatabase(t)
+	admin := createTestUser(t, "Admin", "admin@test.com", "senha123", "admin")
+	staff := createTestUser(t, "Equipe", "staff@test.com", "senha123", "user")
+	author := createTestUser(t, "Autora", "author@test.com", "senha123", "user")
+	for _, code := range []string{"MAC0110", "MAT0111"} {
+		assert.NoError(t, testStore.Catalog.CreateCourse(&models.Course{ID: primitive.NewObjectID(), Code: code, Name: code}))
 	}
-	for _, c := range collections {
-		_, err := testDBClient.Database("uspshare_test").Collection(c).DeleteMany(context.Background(), bson.M{})
-		if err != nil {
-			t.Fatalf("Falha ao limpar a coleção %s: %v", c, err)
+	inCourse := createTestResource(t, author.ID, "Lista de MAC0110")
+	otherCourse := createTestResource(t, author.ID, "Lista de MAT0111")
+	assert.NoError(t, testStore.Resources.UpdateResourceMetadata(otherCourse.ID, author.ID, store.ResourceUpdate{
+		Title: otherCourse.Title, CourseCode: "MAT0111",
+	}))
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", token)
 		}
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	comment := func(resource *models.Resource) string {
+		rr := do("POST", "/api/resource/"+resource.ID.Hex()+"/comments", generateTestToken(t, author.ID), `{"content": "Spam"}`)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var c models.CommentWithAuthor
+		json.Unmarshal(rr.Body.Bytes(), &c)
+		return c.ID.Hex()
+	}
+	setRole := func(body string) *httptest.ResponseRecorder {
+		return do("PUT", "/api/admin/users/"+staff.ID.Hex()+"/role", generateTestToken(t, admin.ID), body)
 	}
-}
 
-// createTestUser cria um usuário com um papel específico (role) diretamente no banco.
-func createTestUser(t *testing.T, name, email, password, role string) *models.User {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	assert.NoError(t, err, "Falha ao gerar hash da senha")
+	t.Run("Só admin lista e atribui papéis", func(t *testing.T) {
+		rr := do("GET", "/api/admin/roles", generateTestToken(t, staff.ID), "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("GET", "/api/admin/roles", generateTestToken(t, admin.ID), "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var roles []rbac.Role
+		json.Unmarshal(rr.Body.Bytes(), &roles)
+		assert.Len(t, roles, len(rbac.Roles))
+	})
 
-	user := &models.User{
-		ID:        primitive.NewObjectID(),
-		Name:      name,
-		Email:     email,
-		Password:  string(hashedPassword),
-		Role:      role, // "user" ou "admin"
-		CreatedAt: time.Now(),
-	}
+	t.Run("Validação da atribuição", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, setRole(`{"role": "root"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, setRole(`{"role": "monitor"}`).Code, "Monitor precisa de disciplina")
+		assert.Equal(t, http.StatusBadRequest, setRole(`{"role": "monitor", "courses": ["FLF0113"]}`).Code)
+		assert.Equal(t, http.StatusBadRequest, setRole(`{"role": "moderator", "courses": ["MAC0110"]}`).Code)
+		rr := do("PUT", "/api/admin/users/"+admin.ID.Hex()+"/role", generateTestToken(t, admin.ID), `{"role": "student"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Admin não rebaixa a si mesmo")
+	})
+
+	t.Run("Monitor modera só a própria disciplina", func(t *testing.T) {
+		rr := setRole(`{"role": "monitor", "courses": ["MAC0110", "MAC0110"]}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var user models.User
+		json.Unmarshal(rr.Body.Bytes(), &user)
+		assert.Equal(t, []string{"MAC0110"}, user.RoleCourses)
+
+		token := generateTestToken(t, staff.ID)
+		rr = do("DELETE", "/api/comment/"+comment(otherCourse), token, "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("DELETE", "/api/comment/"+comment(inCourse), token, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		rr = do("PUT", "/api/resource/"+inCourse.ID.Hex(), token, `{"title": "Renomeado"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code, "Monitor não faz curadoria")
+	})
 
-	_, err = database.UserCollection.InsertOne(context.Background(), user)
-	assert.NoError(t, err, "Falha ao inserir usuário de teste no banco")
+	t.Run("Curador edita os recursos da disciplina", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, setRole(`{"role": "curator", "courses": ["MAC0110"]}`).Code)
+		token := generateTestToken(t, staff.ID)
+
+		rr := do("PUT", "/api/resource/"+inCourse.ID.Hex(), token, `{"title": "Lista 1 de MAC0110", "isAnonymous": true}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		updated, _ := testStore.Resources.GetResourceByID(inCourse.ID)
+		assert.Equal(t, "Lista 1 de MAC0110", updated.Title)
+		assert.False(t, updated.IsAnonymous, "Anonimato é escolha do dono")
+
+		rr = do("PUT", "/api/resource/"+inCourse.ID.Hex(), token, `{"courseCode": "MAT0111"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		rr = do("PUT", "/api/resource/"+otherCourse.ID.Hex(), token, `{"title": "Invasão"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = do("GET", "/api/admin/audit?targetId="+inCourse.ID.Hex(), generateTestToken(t, admin.ID), "")
+		var actions []models.ModerationAction
+		json.Unmarshal(rr.Body.Bytes(), &actions)
+		if assert.Len(t, actions, 1, "Só a edição aceita vai para a auditoria") {
+			assert.Equal(t, models.ModerationEdit, actions[0].Action)
+			assert.Equal(t, staff.ID, actions[0].AdminID)
+		}
+	})
 
-	return user
-}
+	t.Run("Moderador vê a fila, mas não o catálogo", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, setRole(`{"role": "moderator"}`).Code)
+		rr := do("POST", "/api/login", "", `{"email": "staff@test.com", "password": "senha123"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var login struct {
+			Token string `json:"token"`
+			User  struct {
+				Role  string   `json:"role"`
+				Perms []string `json:"perms"`
+			} `json:"user"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &login)
+		assert.Equal(t, models.RoleModerator, login.User.Role)
+		assert.Contains(t, login.User.Perms, string(rbac.ReviewReports))
+
+		token := "Bearer " + login.Token
+		assert.Equal(t, http.StatusOK, do("GET", "/api/admin/reports", token, "").Code)
+		assert.Equal(t, http.StatusForbidden, do("POST", "/api/admin/tags", token, `{"name": "Nova"}`).Code)
+		rr = do("DELETE", "/api/comment/"+comment(otherCourse), token, "")
+		assert.Equal(t, http.StatusOK, rr.Code, "Moderador modera em qualquer disciplina")
+	})
 
-// generateTestToken cria um token JWT válido para um determinado ID de usuário.
-func generateTestToken(t *testing.T, userID primitive.ObjectID) string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": userID.Hex(),
-		"exp":    time.Now().Add(time.Hour).Unix(),
+	t.Run("Trocas de papel vão para a auditoria", func(t *testing.T) {
+		rr := do("GET", "/api/admin/audit?targetId="+staff.ID.Hex(), generateTestToken(t, admin.ID), "")
+		var actions []models.ModerationAction
+		json.Unmarshal(rr.Body.Bytes(), &actions)
+		if assert.Len(t, actions, 3) {
+			assert.Equal(t, models.ModerationSetRole, actions[0].Action)
+			assert.Equal(t, "moderator", actions[0].Note)
+			assert.Equal(t, "curator (MAC0110)", actions[1].Note)
+		}
 	})
-	tokenString, err := token.SignedString(config.JWT_SECRET)
-	assert.NoError(t, err, "Falha ao assinar o token de teste")
-	return "Bearer " + tokenString
 }
 
-// createTestResource cria um recurso no banco para ser usado em testes.
-func createTestResource(t *testing.T, userID primitive.ObjectID, title string) *models.Resource {
-	resource := &models.Resource{
-		ID:          primitive.NewObjectID(),
-		UserID:      userID,
-		Title:       title,
-		CourseCode:  "MAC0110",
-		Description: "Descrição de teste",
-		UploadDate:  time.Now(),
-	}
-	_, err := database.ResourceCollection.InsertOne(context.Background(), resource)
+// uploadTestVersion envia um novo arquivo por POST /api/resource/{id}/versions.
+func uploadTestVersion(t *testing.T, token string, resourceID primitive.ObjectID, fileName, note string, content []byte) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("note", note)
+	part, err := writer.CreateFormFile("file", fileName)
 	assert.NoError(t, err)
-	return resource
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/resource/"+resourceID.Hex()+"/versions", body)
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, req)
+	return rr
 }
 
-// =================================
-//  TESTS
-// =================================
-
-func TestHandleSignup(t *testing.T) {
+func TestResourceVersions(t *testing.T) {
 	clearDatabase(t)
-
-	t.Run("Cadastro com sucesso", func(t *testing.T) {
-		payload := map[string]string{
-			"name":     "Novo Usuário",
-			"email":    "novo@email.com",
-			"password": "senhaforte123",
-		}
-		body, _ := json.Marshal(payload)
-		req := httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body))
+	owner := createTestUser(t, "Dono", "versions@test.com", "senha123", "user")
+	anotherUser := createTestUser(t, "Outro", "other-versions@test.com", "senha123", "user")
+	token := generateTestToken(t, owner.ID)
+
+	rr := uploadTestFile(t, token, "Resumo", "resumo.txt", []byte("primeira versão"))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var resource models.Resource
+	json.Unmarshal(rr.Body.Bytes(), &resource)
+	testPipeline.Wait()
+
+	type versionList struct {
+		Current  int               `json:"current"`
+		Versions []versionResponse `json:"versions"`
+	}
+	listVersions := func() versionList {
+		req := httptest.NewRequest("GET", "/api/resource/"+resource.ID.Hex()+"/versions", nil)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var list versionList
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		return list
+	}
+	download := func(number string) string {
+		req := httptest.NewRequest("GET", "/api/resource/"+resource.ID.Hex()+"/versions/"+number+"/download", nil)
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound {
+			return ""
+		}
+		rr2 := httptest.NewRecorder()
+		http.StripPrefix(blob.URLPrefix, blob.Handler(testBlobs)).ServeHTTP(rr2,
+			httptest.NewRequest("GET", rr.Header().Get("Location"), nil))
+		return rr2.Body.String()
+	}
 
-		assert.Equal(t, http.StatusCreated, rr.Code, "O status code deveria ser 201 Created")
+	t.Run("Recurso sem histórico tem só a versão 1", func(t *testing.T) {
+		list := listVersions()
+		assert.Equal(t, 1, list.Current)
+		if assert.Len(t, list.Versions, 1) {
+			assert.Equal(t, "resumo.txt", list.Versions[0].FileName)
+			assert.Equal(t, "Dono", list.Versions[0].UploaderName)
+		}
+		assert.Equal(t, "primeira versão", download("1"))
+	})
 
-		// Verifica se o usuário foi realmente criado no banco
-		var user models.User
-		err := database.UserCollection.FindOne(context.Background(), bson.M{"email": "novo@email.com"}).Decode(&user)
-		assert.NoError(t, err, "O usuário deveria existir no banco de dados")
-		assert.Equal(t, "Novo Usuário", user.Name)
+	t.Run("Só o dono envia versões", func(t *testing.T) {
+		rr := uploadTestVersion(t, generateTestToken(t, anotherUser.ID), resource.ID, "resumo.txt", "", []byte("intrusa"))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
 	})
 
-	t.Run("Falha ao cadastrar com e-mail já existente", func(t *testing.T) {
-		createTestUser(t, "Usuário Existente", "existente@email.com", "senha123", "user")
+	t.Run("Nova versão vira a atual depois da verificação", func(t *testing.T) {
+		rr := uploadTestVersion(t, token, resource.ID, "resumo-v2.txt", "Corrigi a fórmula da questão 2", []byte("segunda versão"))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var created models.ResourceVersion
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		assert.Equal(t, 2, created.Version)
+		assert.Equal(t, models.ScanScanning, created.ScanStatus)
+		testPipeline.Wait()
+
+		stored, _ := testStore.Resources.GetResourceByID(resource.ID)
+		assert.Equal(t, 2, stored.Version)
+		assert.Equal(t, "resumo-v2.txt", stored.FileName)
+
+		list := listVersions()
+		assert.Equal(t, 2, list.Current)
+		if assert.Len(t, list.Versions, 2) {
+			assert.Equal(t, "resumo.txt", list.Versions[0].FileName)
+			assert.Equal(t, "Corrigi a fórmula da questão 2", list.Versions[1].Note)
+			assert.Equal(t, owner.ID, list.Versions[1].UserID)
+		}
+		assert.Equal(t, "primeira versão", download("1"), "A versão anterior continua disponível")
+		assert.Equal(t, "segunda versão", download("2"))
+		assert.Empty(t, download("3"))
+	})
 
-		payload := map[string]string{
-			"name":     "Outro Usuário",
-			"email":    "existente@email.com", // E-mail repetido
-			"password": "outrasenha",
+	t.Run("Versão infectada não substitui o arquivo", func(t *testing.T) {
+		rr := uploadTestVersion(t, token, resource.ID, "resumo-v3.txt", "", []byte("terceira EICAR"))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		testPipeline.Wait()
+
+		stored, _ := testStore.Resources.GetResourceByID(resource.ID)
+		assert.Equal(t, 2, stored.Version)
+		list := listVersions()
+		if assert.Len(t, list.Versions, 3) {
+			assert.Equal(t, models.ScanQuarantined, list.Versions[2].ScanStatus)
 		}
-		body, _ := json.Marshal(payload)
-		req := httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body))
-		rr := httptest.NewRecorder()
-		testRouter.ServeHTTP(rr, req)
+		assert.Empty(t, download("3"))
+	})
 
-		// A lógica atual retorna 500, o que é aceitável, mas um 409 Conflict seria mais semântico.
-		assert.Equal(t, http.StatusInternalServerError, rr.Code, "O status code deveria ser 500 para e-mail duplicado")
+	t.Run("Recurso na lixeira ou escondido não recebe versões", func(t *testing.T) {
+		assert.NoError(t, testStore.Resources.TrashResource(resource.ID, owner.ID, time.Now()))
+		rr := uploadTestVersion(t, token, resource.ID, "resumo-v4.txt", "", []byte("quarta versão"))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NoError(t, testStore.Resources.RestoreResource(resource.ID, owner.ID))
+
+		hidden := createTestResource(t, owner.ID, "Resumo escondido")
+		assert.NoError(t, testStore.Resources.HideResource(hidden.ID, time.Now()))
+		rr = uploadTestVersion(t, token, hidden.ID, "resumo.txt", "", []byte("outra versão"))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 
-	t.Run("Falha ao cadastrar com campos faltando", func(t *testing.T) {
-		payload := map[string]string{
-			"name":  "Usuário Incompleto",
-			"email": "incompleto@email.com",
-			// Senha faltando
-		}
-		body, _ := json.Marshal(payload)
-		req := httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body))
+	t.Run("Apagar o recurso libera os arquivos de todas as versões", func(t *testing.T) {
+		versions, _ := testStore.Versions.ListResourceVersions(resource.ID)
+		req := httptest.NewRequest("DELETE", "/api/resource/"+resource.ID.Hex(), nil)
+		req.Header.Set("Authorization", token)
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		purgeTrash(t)
 
-		assert.Equal(t, http.StatusBadRequest, rr.Code, "O status code deveria ser 400 Bad Request")
+		for _, v := range versions[:2] {
+			_, err := testBlobs.Open(blob.KeyFromURL(v.FileUrl))
+			assert.Equal(t, blob.ErrNotFound, err, "O arquivo da versão %d deveria ter sido apagado", v.Version)
+		}
+		remaining, _ := testStore.Versions.ListResourceVersions(resource.ID)
+		assert.Empty(t, remaining)
 	})
 }
 
-func TestHandleLogin(t *testing.T) {
+func TestMalwareScanning(t *testing.T) {
 	clearDatabase(t)
-	user := createTestUser(t, "Login Test", "login@test.com", "senha123", "user")
+	admin := createTestUser(t, "Admin", "admin-scan@test.com", "admin123", "admin")
+	user := createTestUser(t, "Uploader", "scan@test.com", "senha123", "user")
+	adminToken := generateTestToken(t, admin.ID)
+	token := generateTestToken(t, user.ID)
 
-	t.Run("Login com sucesso", func(t *testing.T) {
-		payload := map[string]string{"email": user.Email, "password": "senha123"}
-		body, _ := json.Marshal(payload)
-		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
 
-		assert.Equal(t, http.StatusOK, rr.Code, "O status code deveria ser 200 OK")
-
-		var resp map[string]interface{}
-		json.Unmarshal(rr.Body.Bytes(), &resp)
-		assert.NotEmpty(t, resp["token"], "A resposta deveria conter um token JWT")
+	rr := uploadTestFile(t, token, "Notas", "notas.txt", []byte("anotações EICAR"))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var infected models.Resource
+	json.Unmarshal(rr.Body.Bytes(), &infected)
+	testPipeline.Wait()
+
+	t.Run("Recurso infectado fica em quarentena e escondido", func(t *testing.T) {
+		stored, _ := testStore.Resources.GetResourceByID(infected.ID)
+		assert.Equal(t, models.ScanQuarantined, stored.ScanStatus)
+		assert.True(t, strings.HasPrefix(stored.FileUrl, blob.URLPrefix+blob.QuarantinePrefix))
+
+		all, _ := testStore.Resources.ListResources()
+		assert.Empty(t, all)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/resource/"+infected.ID.Hex(), "").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/resource/"+infected.ID.Hex()+"/download", "").Code)
+
+		var mine []models.ResourceWithDetails
+		json.Unmarshal(do("GET", "/api/my-uploads", token).Body.Bytes(), &mine)
+		if assert.Len(t, mine, 1, "O dono ainda vê o próprio upload") {
+			assert.Equal(t, models.ScanQuarantined, mine[0].ScanStatus)
+		}
 	})
 
-	t.Run("Login com senha incorreta", func(t *testing.T) {
-		payload := map[string]string{"email": user.Email, "password": "senha_errada"}
-		body, _ := json.Marshal(payload)
-		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+	t.Run("Avatar infectado é recusado", func(t *testing.T) {
+		var img bytes.Buffer
+		assert.NoError(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+		img.WriteString("EICAR")
+
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("avatar", "eu.png")
+		part.Write(img.Bytes())
+		writer.Close()
+		req := httptest.NewRequest("POST", "/api/profile/avatar", body)
+		req.Header.Set("Authorization", token)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusUnauthorized, rr.Code, "O status code deveria ser 401 Unauthorized")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"rule":"malware"`)
+		stored, _ := testStore.Users.GetUserByID(user.ID)
+		assert.Empty(t, stored.AvatarURL)
+		_, err := testBlobs.Open("avatars/" + user.ID.Hex() + ".png")
+		assert.Equal(t, blob.ErrNotFound, err)
+	})
+
+	t.Run("Admin vê e apaga os arquivos em quarentena", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do("GET", "/api/admin/quarantine", token).Code)
+
+		rr := do("GET", "/api/admin/quarantine", adminToken)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var files []models.QuarantinedFile
+		json.Unmarshal(rr.Body.Bytes(), &files)
+		if !assert.Len(t, files, 2) {
+			return
+		}
+		assert.Equal(t, models.QuarantineAvatar, files[0].Source)
+		assert.Equal(t, models.QuarantineResource, files[1].Source)
+		assert.Equal(t, infected.ID, *files[1].ResourceID)
+		assert.Equal(t, "Eicar-Test-Signature", files[1].Signature)
+
+		rr = do("DELETE", "/api/admin/quarantine/"+files[1].ID.Hex(), adminToken)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		_, err := testBlobs.Open(files[1].Key)
+		assert.Equal(t, blob.ErrNotFound, err)
+		_, err = testStore.Resources.GetResourceByID(infected.ID)
+		assert.Equal(t, store.ErrNotFound, err, "O recurso infectado sai junto")
+
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/admin/quarantine/"+files[1].ID.Hex(), adminToken).Code)
 	})
 }
 
-func TestHandleUploadResource(t *testing.T) {
-	clearDatabase(t)
-	user := createTestUser(t, "Uploader", "uploader@test.com", "senha123", "user")
-	token := generateTestToken(t, user.ID)
+// sseEvent é um evento lido do canal de Server-Sent Events.
+type sseEvent struct {
+	ID, Type string
+	Data     map[string]any
+}
 
-	t.Run("Upload com sucesso", func(t *testing.T) {
-		body := new(bytes.Buffer)
-		writer := multipart.NewWriter(body)
+// readSSE lê o próximo evento do canal, pulando comentários e o retry.
+func readSSE(t *testing.T, br *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("lendo o canal de eventos: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && ev.Type != "":
+			return ev
+		case strings.HasPrefix(line, "id: "):
+			ev.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.Type = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.Data))
+		}
+	}
+}
 
-		// Adiciona campos do formulário
-		_ = writer.WriteField("title", "Meu Primeiro Upload de Teste")
-		_ = writer.WriteField("description", "Uma descrição detalhada.")
-		_ = writer.WriteField("courseCode", "BCC021")
-		_ = writer.WriteField("tags", `["prova", "p1"]`)
+// streamTicket pede um tíquete do canal de eventos com o token de acesso.
+func streamTicket(t *testing.T, token string) string {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/events/ticket", nil)
+	req.Header.Set("Authorization", token)
+	rr := httptest.NewRecorder()
+	testRouter.ServeHTTP(rr, req)
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		t.FailNow()
+	}
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	return body.Ticket
+}
 
-		// Adiciona o arquivo
-		part, err := writer.CreateFormFile("file", "teste.pdf")
-		assert.NoError(t, err)
-		part.Write([]byte("conteúdo do pdf de teste"))
-		writer.Close()
+// openSSE conecta ao canal de eventos com um tíquete na query, como o EventSource.
+func openSSE(t *testing.T, srv *httptest.Server, token, query, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	return openSSEURL(t, srv.URL+"/api/events?ticket="+streamTicket(t, token)+query, lastEventID)
+}
 
-		req := httptest.NewRequest("POST", "/api/upload", body)
-		req.Header.Set("Authorization", token)
-		req.Header.Set("Content-Type", writer.FormDataContentType())
+func openSSEURL(t *testing.T, url, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
 
+func TestEventStream(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Autora", "autora@usp.br", "senha123", "user")
+	fan := createTestUser(t, "Leitor", "leitor@usp.br", "senha123", "user")
+	resource := createTestResource(t, owner.ID, "Lista de Cálculo")
+	ownerToken, fanToken := generateTestToken(t, owner.ID), generateTestToken(t, fan.ID)
+	srv := httptest.NewServer(testRouter)
+	defer srv.Close()
+
+	post := func(token, path, body string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Authorization", token)
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		assert.Less(t, rr.Code, 300, "%s: %s", path, rr.Body.String())
+	}
 
-		assert.Equal(t, http.StatusCreated, rr.Code, "O status code deveria ser 201 Created")
+	t.Run("Exige token e recurso visível", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/api/events")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 
-		// Verifica se o recurso foi criado no banco
-		var resource models.Resource
-		err = database.ResourceCollection.FindOne(context.Background(), bson.M{"title": "Meu Primeiro Upload de Teste"}).Decode(&resource)
-		assert.NoError(t, err, "O recurso deveria existir no banco de dados")
-		assert.Equal(t, user.ID, resource.UserID)
-		assert.Contains(t, resource.Tags, "prova")
+		resp, _ = openSSE(t, srv, ownerToken, "&resource="+primitive.NewObjectID().Hex(), "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
-	t.Run("Falha no upload sem autenticação", func(t *testing.T) {
-		req := httptest.NewRequest("POST", "/api/upload", nil) // Sem corpo e sem token
+	t.Run("Aceita só tíquete de uso único na query", func(t *testing.T) {
+		resp, _ := openSSEURL(t, srv.URL+"/api/events?access_token="+strings.TrimPrefix(ownerToken, "Bearer "), "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		ticket := streamTicket(t, ownerToken)
+		resp, _ = openSSEURL(t, srv.URL+"/api/events?ticket="+ticket, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+		resp, _ = openSSEURL(t, srv.URL+"/api/events?ticket="+ticket, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		// O tíquete não vale como token de acesso.
+		req := httptest.NewRequest("GET", "/api/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+streamTicket(t, ownerToken))
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
 
-		assert.Equal(t, http.StatusUnauthorized, rr.Code, "O status code deveria ser 401 Unauthorized")
+	var lastID string
+	t.Run("Entrega notificações e comentários na hora", func(t *testing.T) {
+		resp, br := openSSE(t, srv, ownerToken, "&resource="+resource.ID.Hex(), "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		ev := readSSE(t, br)
+		assert.Equal(t, "unread", ev.Type)
+		assert.Equal(t, float64(0), ev.Data["count"])
+
+		post(fanToken, "/api/resource/"+resource.ID.Hex()+"/share", `{"recipientId": "`+owner.ID.Hex()+`"}`)
+		ev = readSSE(t, br)
+		assert.Equal(t, "notification", ev.Type)
+		assert.Equal(t, "share", ev.Data["type"])
+		assert.Equal(t, "Leitor", ev.Data["actorName"])
+		assert.NotEmpty(t, ev.ID)
+		ev = readSSE(t, br)
+		assert.Equal(t, "unread", ev.Type)
+		assert.Equal(t, float64(1), ev.Data["count"])
+
+		post(fanToken, "/api/resource/"+resource.ID.Hex()+"/comments", `{"content": "Valeu pela lista!"}`)
+		ev = readSSE(t, br)
+		assert.Equal(t, "comment", ev.Type)
+		assert.Equal(t, resource.ID.Hex(), ev.Data["resourceId"])
+		assert.Equal(t, "Valeu pela lista!", ev.Data["comment"].(map[string]any)["content"])
+		lastID = ev.ID
+	})
+
+	t.Run("Reenvia o que se perdeu na reconexão", func(t *testing.T) {
+		// Desconectada: a curtida gera notificação e nova contagem.
+		post(fanToken, "/api/resource/"+resource.ID.Hex()+"/like", "")
+
+		_, br := openSSE(t, srv, ownerToken, "&resource="+resource.ID.Hex(), lastID)
+		ev := readSSE(t, br)
+		assert.Equal(t, "unread", ev.Type)
+		assert.Equal(t, float64(2), ev.Data["count"])
+		assert.Empty(t, ev.ID, "A contagem inicial não faz parte do histórico")
+
+		ev = readSSE(t, br)
+		assert.Equal(t, "notification", ev.Type)
+		assert.Equal(t, "like", ev.Data["type"])
+
+		_, br = openSSE(t, srv, ownerToken, "", "processo-antigo-3")
+		readSSE(t, br)
+		assert.Equal(t, "resync", readSSE(t, br).Type)
+	})
+
+	t.Run("Ler uma notificação atualiza a contagem", func(t *testing.T) {
+		_, br := openSSE(t, srv, ownerToken, "", "")
+		readSSE(t, br)
+
+		notifications := listTestNotifications(t, owner.ID)
+		post(ownerToken, "/api/notifications/"+notifications[0].ID.Hex()+"/read", "")
+		ev := readSSE(t, br)
+		assert.Equal(t, "unread", ev.Type)
+		assert.Equal(t, float64(1), ev.Data["count"])
 	})
 }
 
-func TestHandleDeleteResource(t *testing.T) {
+func TestEventSocket(t *testing.T) {
 	clearDatabase(t)
-	owner := createTestUser(t, "Dono", "owner@test.com", "senha123", "user")
-	anotherUser := createTestUser(t, "Outro", "another@test.com", "senha123", "user")
-	resource := createTestResource(t, owner.ID, "Recurso para Deletar")
+	owner := createTestUser(t, "Autora", "autora@usp.br", "senha123", "user")
+	fan := createTestUser(t, "Leitor", "leitor@usp.br", "senha123", "user")
+	resource := createTestResource(t, owner.ID, "Resumo de Física")
+	srv := httptest.NewServer(testRouter)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	token := streamTicket(t, generateTestToken(t, owner.ID))
+	fmt.Fprintf(conn, "GET /api/ws?ticket=%s HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", token)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode) {
+		return
+	}
+
+	// Frames curtos, sem fragmentação: basta o tamanho de um byte.
+	read := func() map[string]any {
+		head := make([]byte, 2)
+		_, err := io.ReadFull(br, head)
+		assert.NoError(t, err)
+		payload := make([]byte, head[1]&0x7F)
+		if head[1]&0x7F == 126 {
+			ext := make([]byte, 2)
+			io.ReadFull(br, ext)
+			payload = make([]byte, int(ext[0])<<8|int(ext[1]))
+		}
+		io.ReadFull(br, payload)
+		var msg map[string]any
+		assert.NoError(t, json.Unmarshal(payload, &msg), string(payload))
+		return msg
+	}
+	write := func(text string) {
+		frame := []byte{0x81, 0x80 | byte(len(text)), 0, 0, 0, 0}
+		conn.Write(append(frame, text...))
+	}
+
+	msg := read()
+	assert.Equal(t, "unread", msg["type"])
+
+	write(`{"type": "watch", "resourceId": "` + primitive.NewObjectID().Hex() + `"}`)
+	msg = read()
+	assert.Equal(t, "error", msg["type"])
+	assert.Equal(t, "Resource not found", msg["data"].(map[string]any)["error"])
+
+	write(`{"type": "watch", "resourceId": "` + resource.ID.Hex() + `"}`)
+	msg = read()
+	assert.Equal(t, "watching", msg["type"])
+	assert.Equal(t, resource.ID.Hex(), msg["data"].(map[string]any)["resourceId"])
+
+	req := httptest.NewRequest("POST", "/api/resource/"+resource.ID.Hex()+"/comments", strings.NewReader(`{"content": "Muito bom"}`))
+	req.Header.Set("Authorization", generateTestToken(t, fan.ID))
+	testRouter.ServeHTTP(httptest.NewRecorder(), req)
 
+	msg = read()
+	assert.Equal(t, "comment", msg["type"])
+	assert.NotEmpty(t, msg["id"])
+}
+
+func TestNotificationInbox(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Autora", "autora@usp.br", "senha123", "user")
+	other := createTestUser(t, "Outra", "outra@usp.br", "senha123", "user")
 	ownerToken := generateTestToken(t, owner.ID)
-	anotherUserToken := generateTestToken(t, anotherUser.ID)
 
-	t.Run("Falha ao deletar recurso de outro usuário", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/resource/"+resource.ID.Hex(), nil)
-		req.Header.Set("Authorization", anotherUserToken) // Tentando deletar com o token de outro usuário
+	base := time.Now().Add(-time.Hour)
+	var ids []string
+	for i, typ := range []string{models.NotificationLike, models.NotificationReply, models.NotificationLike, models.NotificationShare} {
+		n := &models.Notification{ID: primitive.NewObjectID(), UserID: owner.ID, ActorName: "Leitor", Type: typ,
+			Message: "fez algo.", CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		assert.NoError(t, testStore.Notifications.CreateNotification(n))
+		ids = append(ids, n.ID.Hex())
+	}
+	foreign := &models.Notification{ID: primitive.NewObjectID(), UserID: other.ID, ActorName: "Leitor", Type: models.NotificationLike,
+		Message: "fez algo.", CreatedAt: base}
+	assert.NoError(t, testStore.Notifications.CreateNotification(foreign))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", ownerToken)
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		return rr
+	}
+	list := func(query string) store.NotificationPage {
+		rr := do("GET", "/api/notifications"+query, "")
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var page store.NotificationPage
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		return page
+	}
+	unread := func() float64 {
+		rr := do("GET", "/api/notifications/unread-count", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var body map[string]float64
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return body["count"]
+	}
 
-		assert.Equal(t, http.StatusForbidden, rr.Code, "O status code deveria ser 403 Forbidden")
+	t.Run("Paginação e filtros", func(t *testing.T) {
+		page := list("?limit=3")
+		if assert.Len(t, page.Items, 3) && assert.NotEmpty(t, page.Next) {
+			assert.Equal(t, ids[3], page.Items[0].ID.Hex())
+			rest := list("?limit=3&cursor=" + page.Next)
+			if assert.Len(t, rest.Items, 1) {
+				assert.Equal(t, ids[0], rest.Items[0].ID.Hex())
+			}
+			assert.Empty(t, rest.Next)
+		}
+		assert.Len(t, list("?type=like").Items, 2)
+		assert.Len(t, list("?type=reply,share").Items, 2)
+
+		for _, query := range []string{"?type=spam", "?read=talvez", "?limit=0", "?limit=101", "?cursor=xyz"} {
+			rr := do("GET", "/api/notifications"+query, "")
+			assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		}
 	})
 
-	t.Run("Sucesso ao deletar próprio recurso", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/resource/"+resource.ID.Hex(), nil)
-		req.Header.Set("Authorization", ownerToken)
+	t.Run("Ler uma e todas", func(t *testing.T) {
+		assert.Equal(t, float64(4), unread())
+		assert.Equal(t, http.StatusOK, do("POST", "/api/notifications/"+ids[0]+"/read", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/api/notifications/"+foreign.ID.Hex()+"/read", "").Code)
+		assert.Equal(t, float64(3), unread())
+		assert.Len(t, list("?read=false").Items, 3)
+
+		rr := do("POST", "/api/notifications/read-all", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"updated": 3}`, rr.Body.String())
+		assert.Equal(t, float64(0), unread())
+		count, _ := testStore.Notifications.CountUnreadNotifications(other.ID)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Arquivar e apagar", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("POST", "/api/notifications/"+ids[0]+"/archive", "").Code)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/api/notifications/"+foreign.ID.Hex()+"/archive", "").Code)
+		rr := do("POST", "/api/notifications/archive", `{"ids": ["`+ids[1]+`", "`+foreign.ID.Hex()+`"]}`)
+		assert.JSONEq(t, `{"archived": 1}`, rr.Body.String())
+		assert.Len(t, list("").Items, 2)
+		assert.Len(t, list("?archived=true").Items, 2)
+
+		assert.Equal(t, http.StatusOK, do("DELETE", "/api/notifications/"+ids[2], "").Code)
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/notifications/"+ids[2], "").Code)
+		rr = do("POST", "/api/notifications/delete", `{"ids": ["`+ids[0]+`", "`+ids[3]+`"]}`)
+		assert.JSONEq(t, `{"deleted": 2}`, rr.Body.String())
+		assert.Empty(t, list("").Items)
+		assert.Len(t, list("?archived=true").Items, 1)
+		assert.Len(t, listTestNotifications(t, other.ID), 1)
+
+		for _, body := range []string{`{}`, `{"ids": ["xyz"]}`} {
+			assert.Equal(t, http.StatusBadRequest, do("POST", "/api/notifications/delete", body).Code, body)
+		}
+	})
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	clearDatabase(t)
+	owner := createTestUser(t, "Autora", "autora@usp.br", "senha123", "user")
+	fan := createTestUser(t, "Leitor", "leitor@usp.br", "senha123", "user")
+	resource := createTestResource(t, owner.ID, "Lista de Cálculo")
+	assert.NoError(t, testStore.Catalog.CreateCourse(&models.Course{ID: primitive.NewObjectID(), Code: "MAC0110", Name: "MAC0110"}))
+	ownerToken := generateTestToken(t, owner.ID)
+
+	send := func(method, token, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/api/notifications/preferences", strings.NewReader(body))
+		req.Header.Set("Authorization", token)
 		rr := httptest.NewRecorder()
 		testRouter.ServeHTTP(rr, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
 
-		assert.Equal(t, http.StatusOK, rr.Code, "O status code deveria ser 200 OK")
+	t.Run("Sem preferências guardadas valem as padrão", func(t *testing.T) {
+		code, body := send("GET", ownerToken, "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, models.DigestOff, body["digest"])
+		like := body["types"].(map[string]interface{})[models.NotificationLike].(map[string]interface{})
+		assert.Equal(t, true, like["inApp"])
+		assert.Equal(t, false, like["email"])
+	})
 
-		// Verifica se o recurso foi removido do banco
-		count, err := database.ResourceCollection.CountDocuments(context.Background(), bson.M{"_id": resource.ID})
+	t.Run("Valores inválidos", func(t *testing.T) {
+		for _, body := range []string{
+			`{"types": {"spam": {"inApp": true}}}`,
+			`{"digest": "hourly"}`,
+			`{"quietHours": {"start": "25:00", "end": "07:00"}}`,
+			`{"quietHours": {"start": "22:00", "end": "07:00", "timeZone": "Marte/Olympus"}}`,
+			`{"digestCourses": ["XYZ9999"]}`,
+		} {
+			code, _ := send("PUT", ownerToken, body)
+			assert.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+
+	t.Run("Likes só por e-mail", func(t *testing.T) {
+		code, body := send("PUT", ownerToken, `{"types": {"like": {"inApp": false, "email": true}},
+			"quietHours": {"start": "22:00", "end": "07:00"}, "digest": "weekly", "digestCourses": ["MAC0110"]}`)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "America/Sao_Paulo", body["quietHours"].(map[string]interface{})["timeZone"])
+
+		prefs, err := testStore.Preferences.GetNotificationPreferences(owner.ID)
 		assert.NoError(t, err)
-		assert.Equal(t, int64(0), count, "O recurso não deveria mais existir no banco")
+		assert.Equal(t, models.DigestWeekly, prefs.Digest)
+		assert.Equal(t, []string{"MAC0110"}, prefs.DigestCourses)
+		assert.True(t, prefs.Channels(models.NotificationReply).InApp, "Tipos omitidos seguem o padrão")
+
+		// O teste pode cair no horário de silêncio; fora dele, o like sai por e-mail.
+		quiet := prefs.QuietHours.Quiet(time.Now())
+		req := httptest.NewRequest("POST", "/api/resource/"+resource.ID.Hex()+"/like", nil)
+		req.Header.Set("Authorization", generateTestToken(t, fan.ID))
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		notifications := listTestNotifications(t, owner.ID)
+		assert.Empty(t, notifications, "Com a lista desligada nada é gravado")
+		liked, _ := testStore.Likes.HasUserLikedResource(fan.ID, resource.ID)
+		assert.True(t, liked)
+
+		testHandler.notificationMail.Wait()
+		testMailbox.mu.Lock()
+		defer testMailbox.mu.Unlock()
+		if quiet {
+			assert.Empty(t, testMailbox.sent)
+		} else if assert.Len(t, testMailbox.sent, 1) {
+			assert.Equal(t, "autora@usp.br", testMailbox.sent[0].To)
+			assert.Equal(t, "Leitor curtiu seu material 'Lista de Cálculo'.", testMailbox.sent[0].Subject)
+			assert.Contains(t, testMailbox.sent[0].Body, "http://app.test/file/"+resource.ID.Hex())
+		}
 	})
 }
 
@@ -348,9 +2633,41 @@ func TestAdminRoutes(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, rr.Code, "Admin deveria conseguir criar tags")
 
 		// Verifica se a tag foi criada no banco
-		count, err := database.TagCollection.CountDocuments(context.Background(), bson.M{"name": "Tag de Admin"})
+		tags, err := testStore.Catalog.ListTags()
+		assert.NoError(t, err)
+		if assert.Len(t, tags, 1, "A tag deveria ter sido criada no banco") {
+			assert.Equal(t, "Tag de Admin", tags[0].Name)
+		}
+	})
+
+	t.Run("Admin regenera thumbnails dos arquivos existentes", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+		f, err := os.Create(filepath.Join("uploads", "antigo.png"))
+		assert.NoError(t, err)
+		assert.NoError(t, png.Encode(f, img))
+		f.Close()
+
+		resource := &models.Resource{
+			ID:         primitive.NewObjectID(),
+			UserID:     adminUser.ID,
+			Title:      "Foto do quadro",
+			FileUrl:    "/uploads/antigo.png",
+			UploadDate: time.Now(),
+		}
+		assert.NoError(t, testStore.Resources.CreateResource(resource))
+
+		req := httptest.NewRequest("POST", "/api/admin/thumbnails/regenerate", nil)
+		req.Header.Set("Authorization", adminToken)
+		rr := httptest.NewRecorder()
+		testRouter.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.JSONEq(t, `{"queued": 1}`, rr.Body.String())
+
+		testPipeline.Wait()
+		updated, err := testStore.Resources.GetResourceByID(resource.ID)
 		assert.NoError(t, err)
-		assert.Equal(t, int64(1), count, "A tag deveria ter sido criada no banco")
+		assert.Equal(t, "/uploads/antigo_thumb.jpg", updated.ThumbnailUrl)
+		assert.FileExists(t, filepath.Join("uploads", "antigo_thumb.jpg"))
 	})
 }
 
@@ -373,7 +2690,7 @@ func TestAuthMiddleware(t *testing.T) {
 	})
 
 	// Aplica o middleware ao nosso handler dummy
-	handlerToTest := AuthMiddleware(dummyHandler)
+	handlerToTest := testHandler.AuthMiddleware(dummyHandler)
 
 	t.Run("Sucesso com token válido", func(t *testing.T) {
 		token := generateTestToken(t, user.ID)
@@ -412,11 +2729,26 @@ func TestAuthMiddleware(t *testing.T) {
 
 		assert.Equal(t, http.StatusUnauthorized, rr.Code, "Deveria retornar 401 com token inválido")
 	})
+
+	t.Run("Falha com token sem sessão", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"userId": user.ID.Hex(),
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		})
+		tokenString, err := token.SignedString(testJWTSecret)
+		assert.NoError(t, err)
+		req := httptest.NewRequest("GET", "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		rr := httptest.NewRecorder()
+		handlerToTest.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, "Tokens de antes das sessões não valem mais")
+	})
 }
 
-func TestAdminMiddleware(t *testing.T) {
+func TestRequirePermission(t *testing.T) {
 	clearDatabase(t)
 	adminUser := createTestUser(t, "Admin User", "admin-mid@test.com", "senha123", "admin")
+	moderator := createTestUser(t, "Moderador", "moderator-mid@test.com", "senha123", models.RoleModerator)
 	regularUser := createTestUser(t, "Regular User", "regular-mid@test.com", "senha123", "user")
 
 	dummyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -424,30 +2756,37 @@ func TestAdminMiddleware(t *testing.T) {
 		w.Write([]byte("Admin Acessou"))
 	})
 
-	// O AdminMiddleware roda depois do AuthMiddleware.
-	// Então, para testá-lo, precisamos primeiro passar o request pelo AuthMiddleware.
-	handlerToTest := AuthMiddleware(AdminMiddleware(dummyHandler))
-
-	t.Run("Sucesso com usuário admin", func(t *testing.T) {
-		token := generateTestToken(t, adminUser.ID)
+	// O RequirePermission roda depois do AuthMiddleware, que põe o principal no contexto.
+	handlerToTest := testHandler.AuthMiddleware(RequirePermission(rbac.ManageCatalog)(dummyHandler))
+	call := func(userID primitive.ObjectID) *httptest.ResponseRecorder {
 		req := httptest.NewRequest("GET", "/admin-only", nil)
-		req.Header.Set("Authorization", token)
+		req.Header.Set("Authorization", generateTestToken(t, userID))
 		rr := httptest.NewRecorder()
-
 		handlerToTest.ServeHTTP(rr, req)
+		return rr
+	}
 
+	t.Run("Sucesso com usuário admin", func(t *testing.T) {
+		rr := call(adminUser.ID)
 		assert.Equal(t, http.StatusOK, rr.Code, "Admin deveria ter acesso")
 		assert.Equal(t, "Admin Acessou", rr.Body.String())
 	})
 
 	t.Run("Falha com usuário normal", func(t *testing.T) {
-		token := generateTestToken(t, regularUser.ID)
+		assert.Equal(t, http.StatusForbidden, call(regularUser.ID).Code, "Usuário normal não deveria ter acesso")
+	})
+
+	t.Run("Falha com papel sem a permissão", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, call(moderator.ID).Code, "Moderador não mexe no catálogo")
+	})
+
+	t.Run("Decide pelo token, sem ir ao banco", func(t *testing.T) {
+		token := generateTestToken(t, adminUser.ID)
+		assert.NoError(t, testStore.Users.SetUserRole(adminUser.ID, models.RoleStudent, nil))
 		req := httptest.NewRequest("GET", "/admin-only", nil)
 		req.Header.Set("Authorization", token)
 		rr := httptest.NewRecorder()
-
 		handlerToTest.ServeHTTP(rr, req)
-
-		assert.Equal(t, http.StatusForbidden, rr.Code, "Usuário normal não deveria ter acesso")
+		assert.Equal(t, http.StatusOK, rr.Code, "O token emitido antes da troca ainda vale")
 	})
 }
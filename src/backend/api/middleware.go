@@ -2,11 +2,12 @@ package api
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
-	"uspshare/config"
-	"uspshare/store"
+	"time"
+	"uspshare/rbac"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,7 +17,27 @@ type contextKey string
 
 const userContextKey = contextKey("userId")
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// principalContextKey guarda o rbac.Principal lido do token.
+const principalContextKey = contextKey("principal")
+
+// sessionContextKey guarda o ID da sessão (models.Session) do token.
+const sessionContextKey = contextKey("session")
+
+// expiresContextKey guarda quando o token expira, para as conexões longas do canal
+// de eventos.
+const expiresContextKey = contextKey("expires")
+
+// principalFrom devolve quem fez a requisição; fora das rotas autenticadas é um
+// principal sem permissões.
+func principalFrom(r *http.Request) rbac.Principal {
+	p, _ := r.Context().Value(principalContextKey).(rbac.Principal)
+	return p
+}
+
+// AuthMiddleware aceita tokens de acesso válidos de sessões ainda ativas: depois do
+// logout, o token de acesso para de valer na hora, não só quando expira. A sessão é
+// uma busca por chave primária; o usuário em si não é consultado.
+func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -30,39 +51,86 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, log.Output(1, "Unexpected signing method")
-			}
-			return []byte(config.JWT_SECRET), nil
-		})
-
-		if err != nil || !token.Valid {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or expired token"})
+		ctx, _, msg := h.authenticate(r.Context(), tokenString, h.jwtSecret)
+		if msg != "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": msg})
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid token claims"})
-			return
+// authenticate confere um token assinado com key e a sessão dele e devolve ctx com
+// quem fez a requisição, junto com as claims do token. Se o token não vale, devolve
+// a mensagem do 401.
+func (h *Handler) authenticate(ctx context.Context, tokenString string, key []byte) (context.Context, jwt.MapClaims, string) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, log.Output(1, "Unexpected signing method")
 		}
+		if len(h.jwtSecret) == 0 {
+			return nil, errors.New("chave do JWT não configurada")
+		}
+		return key, nil
+	})
 
-		userId := claims["userId"].(string)
+	if err != nil || !token.Valid {
+		return nil, nil, "Invalid or expired token"
+	}
 
-		ctx := context.WithValue(r.Context(), userContextKey, userId)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil, "Invalid token claims"
+	}
+
+	userId, _ := claims["userId"].(string)
+	sid, _ := claims["sid"].(string)
+	sessionID, err := primitive.ObjectIDFromHex(sid)
+	if err != nil {
+		return nil, nil, "Invalid or expired token"
+	}
+	session, err := h.store.Sessions.GetSession(sessionID)
+	if err != nil || !session.Active(time.Now()) || session.UserID.Hex() != userId {
+		return nil, nil, "Session revoked or expired"
+	}
+
+	ctx = context.WithValue(ctx, userContextKey, userId)
+	ctx = context.WithValue(ctx, principalContextKey, principalFromClaims(claims))
+	ctx = context.WithValue(ctx, sessionContextKey, sessionID)
+	if expires, err := claims.GetExpirationTime(); err == nil && expires != nil {
+		ctx = context.WithValue(ctx, expiresContextKey, expires.Time)
+	}
+	return ctx, claims, ""
 }
 
-func AdminMiddleware(next http.Handler) http.Handler {
+// RequirePermission barra quem não tem a permissão em toda a plataforma. Roda depois
+// do AuthMiddleware e decide só pelo token, sem ir ao banco.
+func RequirePermission(perm rbac.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !principalFrom(r).Can(perm) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SuspensionMiddleware deixa contas suspensas só lerem: qualquer requisição que não
+// seja GET ou HEAD é recusada.
+func (h *Handler) SuspensionMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
 		userIDHex, _ := r.Context().Value(userContextKey).(string)
 		userID, _ := primitive.ObjectIDFromHex(userIDHex)
 
-		user, err := store.GetUserByID(userID)
-		if err != nil || user.Role != "admin" {
-			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Admin access required"})
+		user, err := h.store.Users.GetUserByID(userID)
+		if err == nil && user.SuspendedAt != nil {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Account suspended"})
 			return
 		}
 
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"uspshare/models"
+	"uspshare/rbac"
+	"uspshare/store"
+	"uspshare/trash"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// moderationActor é o nome que aparece nas notificações mandadas pela moderação.
+const moderationActor = "Moderação"
+
+// maxReportDetails limita o texto livre de uma denúncia.
+const maxReportDetails = 1000
+
+func validReportReason(reason string) bool {
+	for _, r := range models.ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// fileReport completa a denúncia com o corpo da requisição ({reason, details}) e a
+// põe na fila. O chamador já preencheu o alvo e o conteúdo denunciado.
+func (h *Handler) fileReport(w http.ResponseWriter, r *http.Request, report models.Report) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	var req struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if !validReportReason(req.Reason) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Reason must be one of: " + strings.Join(models.ReportReasons, ", ")})
+		return
+	}
+	details := strings.TrimSpace(req.Details)
+	if len(details) > maxReportDetails {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Details must have at most %d characters", maxReportDetails)})
+		return
+	}
+
+	report.ID = primitive.NewObjectID()
+	report.ReporterID = userID
+	report.Reason = req.Reason
+	report.Details = details
+	report.Status = models.ReportOpen
+	report.CreatedAt = time.Now()
+	if err := h.store.Reports.CreateReport(&report); err != nil {
+		if err == store.ErrDuplicateKey {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "You have already reported this"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create report"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, report)
+}
+
+// HandleReportResource põe um recurso na fila de moderação.
+func (h *Handler) HandleReportResource(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	resource, ok := h.visibleResource(w, r)
+	if !ok {
+		return
+	}
+	if resource.UserID == userID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "You cannot report your own resource"})
+		return
+	}
+	h.fileReport(w, r, models.Report{
+		TargetType: models.ReportTargetResource,
+		TargetID:   resource.ID,
+		OwnerID:    resource.UserID,
+		ResourceID: &resource.ID,
+		Content:    resource.Title + "\n" + resource.Description,
+	})
+}
+
+// HandleReportUser põe um perfil na fila de moderação.
+func (h *Handler) HandleReportUser(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	targetID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		return
+	}
+	if targetID == userID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "You cannot report yourself"})
+		return
+	}
+	user, err := h.store.Users.GetUserByID(targetID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+		return
+	}
+	h.fileReport(w, r, models.Report{
+		TargetType: models.ReportTargetUser,
+		TargetID:   user.ID,
+		OwnerID:    user.ID,
+		Content:    user.Name + "\n" + user.Bio,
+	})
+}
+
+// HandleListReports devolve a fila de moderação. Sem ?status= mostra só as denúncias
+// abertas; ?status=all mostra todas. ?type= e ?reason= filtram pelo alvo e pelo motivo.
+func (h *Handler) HandleListReports(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.ReportFilter{
+		Status:     query.Get("status"),
+		TargetType: query.Get("type"),
+		Reason:     query.Get("reason"),
+	}
+	switch filter.Status {
+	case "":
+		filter.Status = models.ReportOpen
+	case "all":
+		filter.Status = ""
+	case models.ReportOpen, models.ReportDismissed, models.ReportActioned:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid status"})
+		return
+	}
+	switch filter.TargetType {
+	case "", models.ReportTargetResource, models.ReportTargetComment, models.ReportTargetUser:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid type"})
+		return
+	}
+	if filter.Reason != "" && !validReportReason(filter.Reason) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid reason"})
+		return
+	}
+
+	reports, err := h.store.Reports.ListReports(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch reports"})
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// reportFromURL busca a denúncia da URL, respondendo 400 ou 404 quando não dá.
+func (h *Handler) reportFromURL(w http.ResponseWriter, r *http.Request) (*models.Report, bool) {
+	reportID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid report ID"})
+		return nil, false
+	}
+	report, err := h.store.Reports.GetReport(reportID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Report not found"})
+			return nil, false
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch report"})
+		return nil, false
+	}
+	return report, true
+}
+
+// HandleGetReport devolve uma denúncia da fila.
+func (h *Handler) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.reportFromURL(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// recordModeration fecha as denúncias abertas do alvo com a decisão e a guarda na
+// auditoria. Devolve quantas denúncias foram fechadas.
+func (h *Handler) recordModeration(decision models.ModerationAction) (int64, error) {
+	decision.ID = primitive.NewObjectID()
+	decision.CreatedAt = time.Now()
+	status := models.ReportActioned
+	if decision.Action == models.ModerationDismiss {
+		status = models.ReportDismissed
+	}
+	resolved, err := h.store.Reports.ResolveReports(decision.TargetType, decision.TargetID, store.ReportResolution{
+		Status:  status,
+		Action:  decision.Action,
+		AdminID: decision.AdminID,
+		At:      decision.CreatedAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := h.store.Reports.CreateModerationAction(&decision); err != nil {
+		return resolved, err
+	}
+	return resolved, nil
+}
+
+// errModerationTarget é uma ação que não se aplica ao tipo de alvo da denúncia.
+type errModerationTarget struct{ action, targetType string }
+
+func (e errModerationTarget) Error() string {
+	return fmt.Sprintf("Action %q cannot be applied to a %s", e.action, e.targetType)
+}
+
+// HandleReportAction aplica a decisão de um admin sobre uma denúncia aberta: dismiss,
+// hide, delete, warn ou suspend. Todas as denúncias abertas do mesmo alvo são
+// fechadas juntas e a decisão vai para a auditoria.
+func (h *Handler) HandleReportAction(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	report, ok := h.reportFromURL(w, r)
+	if !ok {
+		return
+	}
+	if report.Status != models.ReportOpen {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Report is already resolved"})
+		return
+	}
+
+	var req struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+
+	var err error
+	switch req.Action {
+	case models.ModerationDismiss:
+	case models.ModerationHide:
+		err = h.hideReported(report)
+	case models.ModerationDelete:
+		err = h.deleteReported(report)
+	case models.ModerationWarn:
+		err = h.warnOwner(report, req.Note)
+	case models.ModerationSuspend:
+		if !principalFrom(r).Can(rbac.SuspendUsers) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied"})
+			return
+		}
+		if h.isStaff(report.OwnerID) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Moderators and admins cannot be suspended"})
+			return
+		}
+		now := time.Now()
+		err = h.store.Users.SetUserSuspended(report.OwnerID, &now)
+		if err == store.ErrNotFound {
+			err = nil // a conta já não existe: não há o que suspender
+		} else if err == nil {
+			h.revokeAllSessions(report.OwnerID)
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid action"})
+		return
+	}
+	if err != nil {
+		if e, ok := err.(errModerationTarget); ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": e.Error()})
+			return
+		}
+		log.Printf("Erro ao aplicar %s na denúncia %s: %v", req.Action, report.ID.Hex(), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to apply moderation action"})
+		return
+	}
+
+	resolved, err := h.recordModeration(models.ModerationAction{
+		AdminID:    adminID,
+		Action:     req.Action,
+		TargetType: report.TargetType,
+		TargetID:   report.TargetID,
+		ReportID:   &report.ID,
+		Note:       req.Note,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Action applied, but failed to resolve reports"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "resolved", "action": req.Action, "resolved": resolved})
+}
+
+// hideReported tira o alvo de circulação sem apagá-lo. Um comentário escondido vira
+// "[removed]", como na remoção.
+func (h *Handler) hideReported(report *models.Report) error {
+	switch report.TargetType {
+	case models.ReportTargetResource:
+		if err := h.store.Resources.HideResource(report.TargetID, time.Now()); err != nil && err != store.ErrNotFound {
+			return err
+		}
+		h.search.Remove(report.TargetID)
+		return nil
+	case models.ReportTargetComment:
+		return h.removeReportedComment(report)
+	}
+	return errModerationTarget{models.ModerationHide, report.TargetType}
+}
+
+// deleteReported apaga o alvo de vez. Um recurso não passa pela lixeira do dono.
+func (h *Handler) deleteReported(report *models.Report) error {
+	switch report.TargetType {
+	case models.ReportTargetResource:
+		resource, err := h.store.Resources.GetResourceByID(report.TargetID)
+		if err == store.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		versions, err := h.store.Versions.ListResourceVersions(resource.ID)
+		if err != nil {
+			return err
+		}
+		if err := h.store.Resources.DeleteResourceByID(resource.ID, resource.UserID); err != nil && err != store.ErrNotFound {
+			return err
+		}
+		h.search.Remove(resource.ID)
+		trash.ReleaseFiles(h.store.BlobRefs, h.blobs, resource.Resource, versions)
+		return nil
+	case models.ReportTargetComment:
+		return h.removeReportedComment(report)
+	}
+	return errModerationTarget{models.ModerationDelete, report.TargetType}
+}
+
+func (h *Handler) removeReportedComment(report *models.Report) error {
+	if err := h.store.Comments.RemoveComment(report.TargetID, time.Now()); err != nil && err != store.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// warnOwner avisa quem publicou o alvo, por notificação.
+func (h *Handler) warnOwner(report *models.Report, note string) error {
+	message := "Um conteúdo seu foi denunciado e revisado pela moderação."
+	if note != "" {
+		message += " " + note
+	}
+	notification := models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    report.OwnerID,
+		ActorName: moderationActor,
+		Type:      models.NotificationModeration,
+		Message:   message,
+		IsRead:    false,
+		CreatedAt: time.Now(),
+	}
+	if report.ResourceID != nil {
+		notification.ResourceID = *report.ResourceID
+	}
+	if report.TargetType == models.ReportTargetComment {
+		notification.CommentID = report.TargetID
+	}
+	return h.notify(&notification)
+}
+
+// HandleListModerationActions devolve a auditoria da moderação, da decisão mais
+// recente para a mais antiga. ?targetId= e ?adminId= filtram.
+func (h *Handler) HandleListModerationActions(w http.ResponseWriter, r *http.Request) {
+	var filter store.ModerationActionFilter
+	for param, dest := range map[string]**primitive.ObjectID{"targetId": &filter.TargetID, "adminId": &filter.AdminID} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid " + param})
+			return
+		}
+		*dest = &id
+	}
+
+	actions, err := h.store.Reports.ListModerationActions(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch moderation actions"})
+		return
+	}
+	writeJSON(w, http.StatusOK, actions)
+}
+
+// HandleLiftSuspension tira a suspensão de uma conta.
+func (h *Handler) HandleLiftSuspension(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	userID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		return
+	}
+	user, err := h.store.Users.GetUserByID(userID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+		return
+	}
+	if user.SuspendedAt == nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "User is not suspended"})
+		return
+	}
+	if err := h.store.Users.SetUserSuspended(userID, nil); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to lift suspension"})
+		return
+	}
+
+	audit := models.ModerationAction{
+		ID:         primitive.NewObjectID(),
+		AdminID:    adminID,
+		Action:     models.ModerationUnsuspend,
+		TargetType: models.ReportTargetUser,
+		TargetID:   userID,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.store.Reports.CreateModerationAction(&audit); err != nil {
+		log.Printf("Erro ao registrar auditoria de %s: %v", userID.Hex(), err)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Suspension lifted"})
+}
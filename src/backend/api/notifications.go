@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"uspshare/models"
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleGetNotifications devolve uma página da caixa de notificações do usuário,
+// das mais recentes para as mais antigas. Ver parseNotificationQuery.
+func (h *Handler) HandleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	query, err := parseNotificationQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	page, err := h.store.Notifications.ListNotifications(userID, query)
+	if err != nil {
+		if err == store.ErrInvalidCursor {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notifications"})
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseNotificationQuery lê os filtros de GET /api/notifications:
+//
+//	type (separados por vírgula ou repetidos), read=true|false,
+//	archived=true (as arquivadas em vez da caixa de entrada), cursor, limit (máx. 100).
+func parseNotificationQuery(r *http.Request) (store.NotificationQuery, error) {
+	params := r.URL.Query()
+	query := store.NotificationQuery{Cursor: params.Get("cursor")}
+
+	known := map[string]bool{models.NotificationModeration: true}
+	for _, t := range models.NotificationTypes {
+		known[t] = true
+	}
+	for _, value := range params["type"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t == "" {
+				continue
+			}
+			if !known[t] {
+				return query, fmt.Errorf("Unknown notification type: %s", t)
+			}
+			query.Types = append(query.Types, t)
+		}
+	}
+
+	if v := params.Get("read"); v != "" {
+		read, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, errors.New("read must be 'true' or 'false'")
+		}
+		query.Read = &read
+	}
+	if v := params.Get("archived"); v != "" {
+		archived, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, errors.New("archived must be 'true' or 'false'")
+		}
+		query.Archived = archived
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > store.MaxNotificationLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", store.MaxNotificationLimit)
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
+
+// HandleUnreadCount devolve só a contagem de não lidas, para o contador do menu.
+func (h *Handler) HandleUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	count, err := h.store.Notifications.CountUnreadNotifications(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to count notifications"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"count": count})
+}
+
+func (h *Handler) HandleMarkNotificationAsRead(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid notification ID"})
+		return
+	}
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	err = h.store.Notifications.MarkNotificationAsRead(notificationID, userID, time.Now())
+	if err == store.ErrNotFound {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to mark notification as read"})
+		return
+	}
+	h.pushUnread(userID)
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Notification marked as read"})
+}
+
+// HandleMarkAllNotificationsRead marca como lidas todas as notificações do usuário.
+func (h *Handler) HandleMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	marked, err := h.store.Notifications.MarkAllNotificationsRead(userID, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to mark notifications as read"})
+		return
+	}
+	if marked > 0 {
+		h.pushUnread(userID)
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"updated": marked})
+}
+
+// HandleArchiveNotification tira uma notificação da caixa de entrada.
+func (h *Handler) HandleArchiveNotification(w http.ResponseWriter, r *http.Request) {
+	h.changeNotification(w, r, "archived", h.store.Notifications.ArchiveNotifications)
+}
+
+// HandleDeleteNotification apaga uma notificação.
+func (h *Handler) HandleDeleteNotification(w http.ResponseWriter, r *http.Request) {
+	h.changeNotification(w, r, "deleted", func(userID primitive.ObjectID, ids []primitive.ObjectID, _ time.Time) (int64, error) {
+		return h.store.Notifications.DeleteNotifications(userID, ids)
+	})
+}
+
+// HandleArchiveNotifications arquiva de uma vez as notificações de {"ids": [...]}.
+func (h *Handler) HandleArchiveNotifications(w http.ResponseWriter, r *http.Request) {
+	h.changeNotifications(w, r, "archived", h.store.Notifications.ArchiveNotifications)
+}
+
+// HandleDeleteNotifications apaga de uma vez as notificações de {"ids": [...]}.
+func (h *Handler) HandleDeleteNotifications(w http.ResponseWriter, r *http.Request) {
+	h.changeNotifications(w, r, "deleted", func(userID primitive.ObjectID, ids []primitive.ObjectID, _ time.Time) (int64, error) {
+		return h.store.Notifications.DeleteNotifications(userID, ids)
+	})
+}
+
+// notificationChange arquiva ou apaga as notificações de ids que são do usuário e
+// devolve quantas eram dele.
+type notificationChange func(userID primitive.ObjectID, ids []primitive.ObjectID, at time.Time) (int64, error)
+
+// changeNotification aplica change à notificação da URL; 404 se ela não é do usuário.
+func (h *Handler) changeNotification(w http.ResponseWriter, r *http.Request, done string, change notificationChange) {
+	notificationID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid notification ID"})
+		return
+	}
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	changed, err := change(userID, []primitive.ObjectID{notificationID}, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update notification"})
+		return
+	}
+	if changed == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Notification not found"})
+		return
+	}
+	h.pushUnread(userID)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Notification " + done})
+}
+
+// changeNotifications aplica change às notificações de {"ids": [...]}, no máximo
+// store.MaxNotificationLimit por vez. As que não são do usuário são ignoradas.
+func (h *Handler) changeNotifications(w http.ResponseWriter, r *http.Request, done string, change notificationChange) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if len(req.IDs) > store.MaxNotificationLimit {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("At most %d notifications at a time", store.MaxNotificationLimit)})
+		return
+	}
+	ids := make([]primitive.ObjectID, 0, len(req.IDs))
+	for _, hex := range req.IDs {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid notification ID: " + hex})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	changed, err := change(userID, ids, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update notifications"})
+		return
+	}
+	if changed > 0 {
+		h.pushUnread(userID)
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{done: changed})
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"uspshare/mail"
+	"uspshare/models"
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPasswordResetTTL é por quanto tempo o link de troca de senha vale.
+const DefaultPasswordResetTTL = time.Hour
+
+// minPasswordLength vale para as senhas novas definidas pela troca ou recuperação.
+const minPasswordLength = 8
+
+// SetPasswordResetTTL define por quanto tempo o link de troca de senha vale.
+func (h *Handler) SetPasswordResetTTL(d time.Duration) {
+	h.resetTTL = d
+}
+
+// revokeAllSessions derruba as sessões do usuário depois de uma troca de senha ou de
+// uma suspensão: quem tinha a senha antiga (ou um refresh token roubado) sai junto.
+func (h *Handler) revokeAllSessions(userID primitive.ObjectID) {
+	if _, err := h.store.Sessions.RevokeUserSessions(userID, time.Now()); err != nil {
+		log.Printf("Erro ao revogar as sessões de %s: %v", userID.Hex(), err)
+	}
+}
+
+// HandleForgotPassword manda um link de troca de senha para o e-mail. A resposta é a
+// mesma exista ou não uma conta com ele, para não revelar quem tem conta.
+func (h *Handler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Requisição inválida"})
+		return
+	}
+
+	user, err := h.store.Users.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível enviar o link"})
+		return
+	}
+	if err == nil {
+		if err := h.sendPasswordReset(user); err != nil {
+			log.Printf("Erro ao mandar a troca de senha para '%s': %v", user.Email, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível enviar o link"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Se houver uma conta com esse e-mail, enviamos um link para trocar a senha."})
+}
+
+func (h *Handler) sendPasswordReset(user *models.User) error {
+	secret, err := h.newUserToken(user, models.TokenResetPassword, h.resetTTL)
+	if err != nil {
+		return err
+	}
+	link := h.appURL + "/reset-password?token=" + url.QueryEscape(secret)
+	return h.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Troca de senha no USPShare",
+		Body: fmt.Sprintf("Olá, %s!\n\nRecebemos um pedido para trocar a senha da sua conta. Para escolher uma nova, "+
+			"abra o link abaixo:\n\n%s\n\nO link vale por %d minutos e só pode ser usado uma vez. "+
+			"Se você não pediu a troca, ignore esta mensagem; sua senha continua a mesma.\n",
+			user.Name, link, int(h.resetTTL/time.Minute)),
+	})
+}
+
+// HandleResetPassword define a nova senha com o token do link. Todas as sessões da
+// conta são encerradas. Como o link chegou pelo e-mail, uma conta ainda pendente
+// fica confirmada.
+func (h *Handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Requisição inválida"})
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("A senha precisa ter ao menos %d caracteres.", minPasswordLength)})
+		return
+	}
+
+	token, err := h.store.Tokens.ConsumeUserToken(models.TokenResetPassword, hashSecretToken(req.Token), time.Now())
+	if err == store.ErrNotFound {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Link de troca de senha inválido ou expirado"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível trocar a senha"})
+		return
+	}
+	if err := h.store.Users.SetUserPassword(token.UserID, req.Password); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Link de troca de senha inválido ou expirado"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível trocar a senha"})
+		return
+	}
+	h.revokeAllSessions(token.UserID)
+	if err := h.store.Users.SetUserEmailVerified(token.UserID); err != nil {
+		log.Printf("Erro ao confirmar o e-mail de %s na troca de senha: %v", token.UserID.Hex(), err)
+	}
+
+	log.Printf("Senha de %s trocada pelo link de recuperação.", token.UserID.Hex())
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Senha trocada. Entre com a nova senha."})
+}
+
+// HandleChangePassword troca a senha do usuário logado, que precisa informar a
+// atual. Todas as sessões são encerradas, inclusive a da requisição, e a resposta
+// traz um par de tokens de uma sessão nova, para quem trocou continuar logado.
+func (h *Handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Requisição inválida"})
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("A senha precisa ter ao menos %d caracteres.", minPasswordLength)})
+		return
+	}
+
+	user, err := h.store.Users.GetUserByID(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível trocar a senha"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Senha atual incorreta"})
+		return
+	}
+	if err := h.store.Users.SetUserPassword(userID, req.NewPassword); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível trocar a senha"})
+		return
+	}
+	h.revokeAllSessions(userID)
+
+	log.Printf("Senha de %s trocada pelo perfil.", userID.Hex())
+	pair, err := h.startSession(r, user)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Senha trocada, mas não foi possível gerar o token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
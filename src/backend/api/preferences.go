@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"uspshare/mail"
+	"uspshare/models"
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultQuietTimeZone é o fuso do horário de silêncio quando o cliente não manda um.
+const defaultQuietTimeZone = "America/Sao_Paulo"
+
+// notificationPreferences devolve as preferências do usuário, ou as padrão se ele
+// nunca as mudou. Um erro do banco também cai nas padrão: a notificação não deixa
+// de sair por causa dele.
+func (h *Handler) notificationPreferences(userID primitive.ObjectID) *models.NotificationPreferences {
+	prefs, err := h.store.Preferences.GetNotificationPreferences(userID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("Erro ao carregar as preferências de notificação de %s: %v", userID.Hex(), err)
+		}
+		return models.DefaultNotificationPreferences(userID)
+	}
+	return prefs
+}
+
+// emailNotification põe a notificação na fila de e-mails do destinatário, para sair a
+// partir de at (ou já, com at zero).
+func (h *Handler) emailNotification(notification *models.Notification, at time.Time) error {
+	user, err := h.store.Users.GetUserByID(notification.UserID)
+	if err != nil {
+		return err
+	}
+	body := "Olá, " + user.Name + "!\n\n" + notification.Text() + "\n"
+	if !notification.ResourceID.IsZero() {
+		body += "\nVeja em " + h.appURL + "/file/" + notification.ResourceID.Hex() + "\n"
+	}
+	body += "\nVocê recebe este e-mail pelas suas preferências de notificação, que podem ser mudadas no seu perfil.\n"
+	h.notificationMail.SendAt(mail.Message{
+		To:      user.Email,
+		Subject: notification.Text(),
+		Body:    body,
+	}, at)
+	return nil
+}
+
+// HandleGetNotificationPreferences devolve as preferências de notificação do usuário.
+func (h *Handler) HandleGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	prefs, err := h.store.Preferences.GetNotificationPreferences(userID)
+	if err == store.ErrNotFound {
+		prefs, err = models.DefaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notification preferences"})
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// HandleUpdateNotificationPreferences substitui as preferências de notificação do
+// usuário. Os tipos que não vierem em types voltam ao padrão; as disciplinas do
+// resumo precisam estar no catálogo.
+func (h *Handler) HandleUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	var req struct {
+		Types         map[string]models.NotificationChannels `json:"types"`
+		QuietHours    *models.QuietHours                     `json:"quietHours"`
+		Digest        string                                 `json:"digest"`
+		DigestCourses []string                               `json:"digestCourses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	prefs := models.DefaultNotificationPreferences(userID)
+	for t, channels := range req.Types {
+		if _, ok := prefs.Types[t]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown notification type: " + t})
+			return
+		}
+		prefs.Types[t] = channels
+	}
+
+	if q := req.QuietHours; q != nil {
+		if q.TimeZone == "" {
+			q.TimeZone = defaultQuietTimeZone
+		}
+		_, errStart := time.Parse("15:04", q.Start)
+		_, errEnd := time.Parse("15:04", q.End)
+		if errStart != nil || errEnd != nil || q.Start == q.End {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Quiet hours need distinct start and end times as HH:MM"})
+			return
+		}
+		if _, err := time.LoadLocation(q.TimeZone); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown time zone: " + q.TimeZone})
+			return
+		}
+		prefs.QuietHours = q
+	}
+
+	switch req.Digest {
+	case "":
+	case models.DigestOff, models.DigestDaily, models.DigestWeekly:
+		prefs.Digest = req.Digest
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid digest frequency"})
+		return
+	}
+	if len(req.DigestCourses) > 0 {
+		courses, ok := h.catalogCourses(w, req.DigestCourses)
+		if !ok {
+			return
+		}
+		prefs.DigestCourses = courses
+	}
+
+	// O resumo continua de onde o anterior parou, mesmo que a frequência mude.
+	if current, err := h.store.Preferences.GetNotificationPreferences(userID); err == nil {
+		prefs.LastDigestAt = current.LastDigestAt
+	} else if err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notification preferences"})
+		return
+	}
+	prefs.UpdatedAt = time.Now()
+	if err := h.store.Preferences.SaveNotificationPreferences(prefs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save notification preferences"})
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleListQuarantine lista os arquivos barrados pelo antivírus, do mais recente
+// para o mais antigo.
+func (h *Handler) HandleListQuarantine(w http.ResponseWriter, r *http.Request) {
+	files, err := h.store.Quarantine.ListQuarantinedFiles()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch quarantined files"})
+		return
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+// HandleDeleteQuarantined apaga de vez um arquivo da quarentena e, se ele era de um
+// recurso, o próprio recurso. Se era uma versão nova, só ela sai do histórico: o
+// recurso continua com o arquivo anterior.
+func (h *Handler) HandleDeleteQuarantined(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid quarantine ID"})
+		return
+	}
+	file, err := h.store.Quarantine.GetQuarantinedFile(id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Quarantined file not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch quarantined file"})
+		return
+	}
+
+	if file.ResourceID != nil && file.Version > 0 {
+		err := h.store.Versions.DeleteResourceVersion(*file.ResourceID, file.Version)
+		if err != nil && err != store.ErrNotFound {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete version"})
+			return
+		}
+	} else if file.ResourceID != nil && file.UserID != nil {
+		err := h.store.Resources.DeleteResourceByID(*file.ResourceID, *file.UserID)
+		if err != nil && err != store.ErrNotFound {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete resource"})
+			return
+		}
+		h.search.Remove(*file.ResourceID)
+	}
+	if err := h.blobs.Delete(file.Key); err != nil {
+		log.Printf("Erro ao apagar arquivo em quarentena %s: %v", file.Key, err)
+	}
+	if err := h.store.Quarantine.DeleteQuarantinedFile(id); err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to delete quarantined file"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Quarantined file deleted"})
+}
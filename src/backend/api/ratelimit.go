@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"uspshare/ratelimit"
+)
+
+// RateLimits são os limites de cada grupo de rotas. Um limite zero desliga o grupo.
+type RateLimits struct {
+	// Auth vale por IP nas rotas abertas de login, cadastro e senha.
+	Auth ratelimit.Limit
+	// Write vale por usuário em comentários, curtidas, compartilhamentos e denúncias.
+	Write ratelimit.Limit
+	// Upload vale por usuário no envio de materiais, versões e avatar.
+	Upload ratelimit.Limit
+}
+
+var DefaultRateLimits = RateLimits{
+	Auth:   ratelimit.Limit{Requests: 10, Per: time.Minute},
+	Write:  ratelimit.Limit{Requests: 60, Per: time.Minute},
+	Upload: ratelimit.Limit{Requests: 20, Per: time.Hour},
+}
+
+// SetRateLimits troca o backend dos limites, os limites de cada grupo e a política
+// de bloqueio do login. O mesmo backend guarda os tíquetes do canal de eventos já
+// usados. Precisa vir antes de RegisterRoutes, que monta os middlewares.
+func (h *Handler) SetRateLimits(b ratelimit.Backend, limits RateLimits, lockout ratelimit.LockoutPolicy) {
+	h.limiter = ratelimit.NewLimiter(b)
+	h.lockout = ratelimit.NewLockout(b, lockout)
+	h.streamTickets = b
+	h.rateLimits = limits
+}
+
+// userRateKey conta as requisições pelo usuário do token; só serve atrás da
+// AuthMiddleware.
+func userRateKey(r *http.Request) string {
+	userID, _ := r.Context().Value(userContextKey).(string)
+	if userID == "" {
+		return ""
+	}
+	return "user:" + userID
+}
+
+// loginLockoutKey é a chave das falhas de login de um e-mail.
+func loginLockoutKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
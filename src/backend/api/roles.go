@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"uspshare/models"
+	"uspshare/rbac"
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleListRoles devolve os papéis existentes e as permissões de cada um.
+func (h *Handler) HandleListRoles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, rbac.Roles)
+}
+
+// HandleSetUserRole troca o papel de um usuário. Monitores e curadores precisam de
+// ao menos uma disciplina do catálogo; os outros papéis não levam disciplinas. A
+// troca vai para a auditoria e chega ao token do usuário na próxima renovação.
+func (h *Handler) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	userID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		return
+	}
+	if userID == adminID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "You cannot change your own role"})
+		return
+	}
+
+	var req struct {
+		Role    string   `json:"role"`
+		Courses []string `json:"courses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	role, ok := rbac.Lookup(req.Role)
+	if !ok || req.Role == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+		return
+	}
+	courses, ok := h.roleCourses(w, role, req.Courses)
+	if !ok {
+		return
+	}
+
+	if _, err := h.store.Users.GetUserByID(userID); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "User not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch user"})
+		return
+	}
+	if err := h.store.Users.SetUserRole(userID, role.Name, courses); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update role"})
+		return
+	}
+
+	note := role.Name
+	if len(courses) > 0 {
+		note += " (" + strings.Join(courses, ", ") + ")"
+	}
+	audit := models.ModerationAction{
+		ID:         primitive.NewObjectID(),
+		AdminID:    adminID,
+		Action:     models.ModerationSetRole,
+		TargetType: models.ReportTargetUser,
+		TargetID:   userID,
+		Note:       note,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.store.Reports.CreateModerationAction(&audit); err != nil {
+		log.Printf("Erro ao registrar auditoria de %s: %v", userID.Hex(), err)
+	}
+
+	user, err := h.store.Users.GetUserByID(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Role updated, but failed to fetch user"})
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// roleCourses confere as disciplinas pedidas para o papel e devolve os códigos sem
+// repetição.
+func (h *Handler) roleCourses(w http.ResponseWriter, role rbac.Role, requested []string) ([]string, bool) {
+	if !role.Scoped {
+		if len(requested) > 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Role " + role.Name + " does not take courses"})
+			return nil, false
+		}
+		return nil, true
+	}
+	if len(requested) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Role " + role.Name + " requires at least one course"})
+		return nil, false
+	}
+	return h.catalogCourses(w, requested)
+}
+
+// catalogCourses confere os códigos de disciplina contra o catálogo e devolve-os sem
+// repetição.
+func (h *Handler) catalogCourses(w http.ResponseWriter, requested []string) ([]string, bool) {
+	catalog, err := h.store.Catalog.ListCourses()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch courses"})
+		return nil, false
+	}
+	known := make(map[string]bool, len(catalog))
+	for _, c := range catalog {
+		known[c.Code] = true
+	}
+	courses := []string{}
+	seen := map[string]bool{}
+	for _, code := range requested {
+		code = strings.TrimSpace(code)
+		if !known[code] {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown course: " + code})
+			return nil, false
+		}
+		if !seen[code] {
+			seen[code] = true
+			courses = append(courses, code)
+		}
+	}
+	return courses, true
+}
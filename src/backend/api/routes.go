@@ -1,60 +1,161 @@
 package api
 
-import "github.com/go-chi/chi/v5"
+import (
+	"uspshare/ratelimit"
+	"uspshare/rbac"
 
-func RegisterRoutes(r *chi.Mux) {
-	// Rotas Públicas
-	r.Get("/api/stats", HandleGetStats)
+	"github.com/go-chi/chi/v5"
+)
 
-	r.Post("/api/signup", HandleSignup)
-	r.Post("/api/login", HandleLogin)
-	r.Get("/api/resources", HandleGetResources)
-	r.Get("/api/resource/{id}", HandleGetResourceByID)
-	r.Get("/api/resource/{id}/comments", HandleListComments)
+func RegisterRoutes(r *chi.Mux, h *Handler) {
+	// Rotas Públicas
+	r.Get("/api/stats", h.HandleGetStats)
 
-	r.Get("/api/data/courses", HandleListCourses)
-	r.Get("/api/data/professors", HandleListProfessors)
-	r.Get("/api/data/tags", HandleListTags)
+	// Login, cadastro e senha: limitados por IP contra força bruta e envio em massa
+	// de e-mails.
+	r.Group(func(r chi.Router) {
+		r.Use(h.limiter.Middleware("auth", h.rateLimits.Auth, ratelimit.ByIP))
+		r.Post("/api/signup", h.HandleSignup)
+		r.Post("/api/login", h.HandleLogin)
+		r.Post("/api/verify-email", h.HandleVerifyEmail)
+		r.Post("/api/verify-email/resend", h.HandleResendVerification)
+		r.Post("/api/password/forgot", h.HandleForgotPassword)
+		r.Post("/api/password/reset", h.HandleResetPassword)
+		r.Post("/api/token/refresh", h.HandleRefreshToken)
+	})
+	r.Get("/api/resources", h.HandleGetResources)
+	r.Get("/api/search", h.HandleSearch)
+	r.Get("/api/resource/{id}", h.HandleGetResourceByID)
+	r.Get("/api/resource/{id}/comments", h.HandleListComments)
+	r.Get("/api/resource/{id}/text", h.HandleGetResourceText)
+	r.Get("/api/resource/{id}/download", h.HandleDownloadResource)
+	r.Get("/api/resource/{id}/versions", h.HandleListVersions)
+	r.Get("/api/resource/{id}/versions/{version}/download", h.HandleDownloadVersion)
+	r.Get("/api/comment/{id}/history", h.HandleCommentHistory)
+
+	r.Get("/api/data/courses", h.HandleListCourses)
+	r.Get("/api/data/professors", h.HandleListProfessors)
+	r.Get("/api/data/tags", h.HandleListTags)
+
+	r.Get("/api/resource/{id}/related", h.HandleGetRelatedResources)
+
+	// Sessões e senha: ficam fora da SuspensionMiddleware para uma conta suspensa poder
+	// sair e proteger a conta.
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		r.Get("/api/profile/sessions", h.HandleListSessions)
+		r.Delete("/api/profile/sessions/{id}", h.HandleRevokeSession)
+		r.Post("/api/logout", h.HandleLogout)
+		r.Post("/api/logout/all", h.HandleLogoutAll)
+		r.With(h.limiter.Middleware("auth", h.rateLimits.Auth, userRateKey)).
+			Post("/api/profile/password", h.HandleChangePassword)
+	})
 
-	r.Get("/api/resource/{id}/related", HandleGetRelatedResources)
+	// Canal de eventos em tempo real: notificações, contagem de não lidas e
+	// comentários novos do recurso aberto.
+	r.With(h.AuthMiddleware).Post("/api/events/ticket", h.HandleStreamTicket)
+	r.Group(func(r chi.Router) {
+		r.Use(h.StreamAuthMiddleware)
+		r.Get("/api/events", h.HandleEventStream)
+		r.Get("/api/ws", h.HandleEventSocket)
+	})
 
 	// Rotas Protegidas
 	r.Group(func(r chi.Router) {
-		r.Use(AuthMiddleware)
-		r.Post("/api/upload", HandleUploadResource)
-		r.Get("/api/profile", HandleGetProfile)
-		r.Get("/api/my-uploads", HandleGetUserUploads)
-		r.Post("/api/resource/{id}/comments", HandlePostComment)
-
-		r.Get("/api/notifications", HandleGetNotifications)
-		r.Post("/api/notifications/{id}/read", HandleMarkNotificationAsRead)
-
-		r.Put("/api/profile", HandleUpdateProfile)
-		r.Post("/api/profile/avatar", HandleUpdateAvatar)
-
-		r.Get("/api/users/search", HandleSearchUsers)
-		r.Post("/api/resource/{id}/share", HandleShareResource)
-
-		r.Post("/api/resource/{id}/like", HandleToggleLike)
-		r.Get("/api/my-likes", HandleGetMyLikes)
-		r.Post("/api/comment/{id}/like", HandleToggleCommentLike)
-		r.Get("/api/my-comment-likes", HandleGetMyCommentLikes)
-
-		r.Delete("/api/resource/{id}", HandleDeleteResource)
+		r.Use(h.AuthMiddleware)
+		r.Use(h.SuspensionMiddleware)
+		// Os pedaços de um upload retomável (PATCH) não contam: o limite vale na
+		// criação do upload.
+		uploadLimit := h.limiter.Middleware("upload", h.rateLimits.Upload, userRateKey)
+		writeLimit := h.limiter.Middleware("write", h.rateLimits.Write, userRateKey)
+
+		r.With(uploadLimit).Post("/api/upload", h.HandleUploadResource)
+		r.With(uploadLimit).Post("/api/uploads", h.HandleCreateUpload)
+		r.Head("/api/uploads/{id}", h.HandleUploadStatus)
+		r.Patch("/api/uploads/{id}", h.HandleUploadChunk)
+		r.Post("/api/uploads/{id}/finalize", h.HandleFinalizeUpload)
+		r.Delete("/api/uploads/{id}", h.HandleDeleteUpload)
+		r.Get("/api/profile", h.HandleGetProfile)
+		r.Get("/api/my-uploads", h.HandleGetUserUploads)
+		r.With(writeLimit).Post("/api/resource/{id}/comments", h.HandlePostComment)
+
+		r.Get("/api/notifications", h.HandleGetNotifications)
+		r.Get("/api/notifications/unread-count", h.HandleUnreadCount)
+		r.Post("/api/notifications/read-all", h.HandleMarkAllNotificationsRead)
+		r.Post("/api/notifications/archive", h.HandleArchiveNotifications)
+		r.Post("/api/notifications/delete", h.HandleDeleteNotifications)
+		r.Post("/api/notifications/{id}/read", h.HandleMarkNotificationAsRead)
+		r.Post("/api/notifications/{id}/archive", h.HandleArchiveNotification)
+		r.Delete("/api/notifications/{id}", h.HandleDeleteNotification)
+		r.Get("/api/notifications/preferences", h.HandleGetNotificationPreferences)
+		r.Put("/api/notifications/preferences", h.HandleUpdateNotificationPreferences)
+
+		r.Put("/api/profile", h.HandleUpdateProfile)
+		r.With(uploadLimit).Post("/api/profile/avatar", h.HandleUpdateAvatar)
+
+		r.Get("/api/users/search", h.HandleSearchUsers)
+		r.With(writeLimit).Post("/api/resource/{id}/share", h.HandleShareResource)
+
+		r.With(writeLimit).Post("/api/resource/{id}/like", h.HandleToggleLike)
+		r.Get("/api/my-likes", h.HandleGetMyLikes)
+		r.With(writeLimit).Post("/api/comment/{id}/like", h.HandleToggleCommentLike)
+		r.Get("/api/my-comment-likes", h.HandleGetMyCommentLikes)
+
+		r.With(writeLimit).Put("/api/comment/{id}", h.HandleEditComment)
+		r.Delete("/api/comment/{id}", h.HandleDeleteComment)
+		r.With(writeLimit).Post("/api/comment/{id}/report", h.HandleReportComment)
+		r.With(writeLimit).Post("/api/resource/{id}/report", h.HandleReportResource)
+		r.With(writeLimit).Post("/api/users/{id}/report", h.HandleReportUser)
+
+		r.Put("/api/resource/{id}", h.HandleUpdateResource)
+		r.With(uploadLimit).Post("/api/resource/{id}/versions", h.HandleCreateVersion)
+		r.Delete("/api/resource/{id}", h.HandleDeleteResource)
+		r.Post("/api/resource/{id}/restore", h.HandleRestoreResource)
+		r.Post("/api/resource/{id}/use-existing", h.HandleUseExistingResource)
+		r.Get("/api/my-trash", h.HandleListTrash)
+		r.Post("/api/comment/{id}/restore", h.HandleRestoreComment)
+		r.Get("/api/my-trash/comments", h.HandleListCommentTrash)
 	})
 
+	// Rotas da equipe: cada grupo exige uma permissão, lida do token.
 	r.Group(func(r chi.Router) {
-		r.Use(AuthMiddleware)
-		r.Use(AdminMiddleware) // Proteção dupla!
-
-		r.Post("/api/admin/tags", HandleCreateTag)
-		r.Delete("/api/admin/tags/{id}", HandleDeleteTag)
-
-		r.Post("/api/admin/courses", HandleCreateCourse)
-		r.Delete("/api/admin/courses/{id}", HandleDeleteCourse)
-
-		r.Post("/api/admin/professors", HandleCreateProfessor)
-		r.Delete("/api/admin/professors/{id}", HandleDeleteProfessor)
-
+		r.Use(h.AuthMiddleware)
+		r.Use(h.SuspensionMiddleware)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequirePermission(rbac.ManageCatalog))
+			r.Post("/api/admin/tags", h.HandleCreateTag)
+			r.Delete("/api/admin/tags/{id}", h.HandleDeleteTag)
+
+			r.Post("/api/admin/courses", h.HandleCreateCourse)
+			r.Delete("/api/admin/courses/{id}", h.HandleDeleteCourse)
+
+			r.Post("/api/admin/professors", h.HandleCreateProfessor)
+			r.Delete("/api/admin/professors/{id}", h.HandleDeleteProfessor)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequirePermission(rbac.ManageFiles))
+			r.Post("/api/admin/thumbnails/regenerate", h.HandleRegenerateThumbnails)
+
+			r.Get("/api/admin/quarantine", h.HandleListQuarantine)
+			r.Delete("/api/admin/quarantine/{id}", h.HandleDeleteQuarantined)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequirePermission(rbac.ReviewReports))
+			r.Get("/api/admin/reports", h.HandleListReports)
+			r.Get("/api/admin/reports/{id}", h.HandleGetReport)
+			r.Post("/api/admin/reports/{id}/actions", h.HandleReportAction)
+			r.Get("/api/admin/audit", h.HandleListModerationActions)
+		})
+
+		r.With(RequirePermission(rbac.SuspendUsers)).Delete("/api/admin/users/{id}/suspension", h.HandleLiftSuspension)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequirePermission(rbac.ManageRoles))
+			r.Get("/api/admin/roles", h.HandleListRoles)
+			r.Put("/api/admin/users/{id}/role", h.HandleSetUserRole)
+		})
 	})
 }
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"uspshare/models"
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// trashedResource é um item da lixeira com a data em que ele será apagado de vez.
+type trashedResource struct {
+	models.ResourceWithDetails
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// HandleListTrash devolve a lixeira do usuário logado.
+func (h *Handler) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	resources, err := h.store.Resources.ListTrashedResources(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch trash"})
+		return
+	}
+	items := make([]trashedResource, len(resources))
+	for i, res := range resources {
+		items[i] = trashedResource{ResourceWithDetails: res, PurgeAt: res.DeletedAt.Add(h.trashRetention)}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// HandleRestoreResource tira um recurso da lixeira do usuário logado.
+func (h *Handler) HandleRestoreResource(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	resourceID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid resource ID"})
+		return
+	}
+
+	if err := h.store.Resources.RestoreResource(resourceID, userID); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found in trash"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to restore resource"})
+		return
+	}
+	h.indexResource(resourceID)
+
+	resource, err := h.store.Resources.GetResourceByID(resourceID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return
+	}
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// trashedComment é um comentário da lixeira com a data em que o texto será apagado.
+type trashedComment struct {
+	models.Comment
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// HandleListCommentTrash devolve os comentários que o usuário logado apagou e ainda
+// pode restaurar.
+func (h *Handler) HandleListCommentTrash(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+
+	comments, err := h.store.Comments.ListTrashedComments(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch trash"})
+		return
+	}
+	items := make([]trashedComment, len(comments))
+	for i, c := range comments {
+		items[i] = trashedComment{Comment: c, PurgeAt: c.DeletedAt.Add(h.trashRetention)}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// HandleRestoreComment tira um comentário da lixeira do usuário logado. Comentários de
+// recursos fora do ar respondem 404.
+func (h *Handler) HandleRestoreComment(w http.ResponseWriter, r *http.Request) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	comment, ok := h.visibleComment(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Comments.RestoreComment(comment.ID, userID); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Comment not found in trash"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to restore comment"})
+		return
+	}
+
+	restored, err := h.store.Comments.GetCommentWithAuthorByID(comment.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch comment"})
+		return
+	}
+	writeJSON(w, http.StatusOK, restored)
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"uspshare/resumable"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Uploads retomáveis, no estilo do protocolo tus (https://tus.io):
+//
+//	POST   /api/uploads                 abre a sessão (Upload-Length, Upload-Metadata)
+//	HEAD   /api/uploads/{id}            informa quanto já chegou (Upload-Offset)
+//	PATCH  /api/uploads/{id}            envia um pedaço a partir de Upload-Offset
+//	POST   /api/uploads/{id}/finalize   valida o arquivo e cria o recurso
+//	DELETE /api/uploads/{id}            desiste do upload
+//
+// Upload-Metadata segue o formato do tus: pares "chave valor-em-base64" separados por
+// vírgula. "filename" é obrigatório; os demais são os campos do formulário de upload
+// (title, description, courseCode, tags, ...).
+
+const (
+	tusVersion          = "1.0.0"
+	offsetOctetStream   = "application/offset+octet-stream"
+	resumableUploadPath = "/api/uploads/"
+)
+
+// parseUploadMetadata decodifica o cabeçalho Upload-Metadata.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, errors.New("invalid Upload-Metadata value for " + parts[0])
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+func setUploadHeaders(w http.ResponseWriter, s *resumable.Session) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(s.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(s.Length, 10))
+	w.Header().Set("Upload-Expires", s.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// HandleCreateUpload abre uma sessão de upload retomável.
+func (h *Handler) HandleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	userIDHex, _ := r.Context().Value(userContextKey).(string)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing or invalid Upload-Length"})
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	fileName := metadata["filename"]
+	if fileName == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Upload-Metadata must include filename"})
+		return
+	}
+	// Extensão e tamanho já são conferidos aqui, para ninguém enviar 500MB à toa; o
+	// conteúdo é validado em HandleFinalizeUpload.
+	if err := h.uploadPolicy.CheckName(fileName, length); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	session, err := h.uploads.Create(userIDHex, fileName, length, metadata)
+	if err != nil {
+		log.Printf("Erro ao criar upload retomável: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create upload"})
+		return
+	}
+	setUploadHeaders(w, session)
+	w.Header().Set("Location", resumableUploadPath+session.ID)
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// ownUploadSession busca a sessão da URL e confere se é de quem está logado. Sessões
+// de outros usuários respondem 404, como se não existissem.
+func (h *Handler) ownUploadSession(w http.ResponseWriter, r *http.Request) (*resumable.Session, bool) {
+	userIDHex, _ := r.Context().Value(userContextKey).(string)
+	session, err := h.uploads.Get(chi.URLParam(r, "id"))
+	if err == nil && session.UserID != userIDHex {
+		err = resumable.ErrNotFound
+	}
+	if err != nil {
+		writeUploadError(w, err)
+		return nil, false
+	}
+	return session, true
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	switch err {
+	case resumable.ErrNotFound:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Upload not found"})
+	case resumable.ErrExpired:
+		writeJSON(w, http.StatusGone, map[string]string{"error": "Upload expired"})
+	case resumable.ErrOffsetMismatch:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Upload-Offset does not match the current offset"})
+	case resumable.ErrTooLarge:
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "Chunk exceeds Upload-Length"})
+	case resumable.ErrIncomplete:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Upload is not complete"})
+	default:
+		log.Printf("Erro no upload retomável: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Upload failed"})
+	}
+}
+
+// HandleUploadStatus (HEAD) informa o offset atual, de onde o cliente deve retomar.
+func (h *Handler) HandleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.ownUploadSession(w, r)
+	if !ok {
+		return
+	}
+	setUploadHeaders(w, session)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleUploadChunk (PATCH) grava um pedaço do arquivo.
+func (h *Handler) HandleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != offsetOctetStream {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be " + offsetOctetStream})
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Missing or invalid Upload-Offset"})
+		return
+	}
+	session, ok := h.ownUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	session, err = h.uploads.Append(session.ID, offset, r.Body)
+	if err != nil {
+		// Se a conexão caiu no meio, o que chegou foi guardado e o cliente consulta o
+		// novo offset com HEAD.
+		writeUploadError(w, err)
+		return
+	}
+	setUploadHeaders(w, session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFinalizeUpload valida o arquivo completo e o transforma num recurso, como o
+// upload comum faria. A sessão é apagada se o recurso for criado ou se o arquivo for
+// recusado pela validação.
+func (h *Handler) HandleFinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.ownUploadSession(w, r)
+	if !ok {
+		return
+	}
+	f, err := h.uploads.Open(session.ID)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	defer f.Close()
+
+	checked, err := h.uploadPolicy.Check(session.FileName, f, session.Length)
+	if err != nil {
+		if writeValidationError(w, err) {
+			h.removeUploadSession(session.ID)
+			return
+		}
+		writeUploadError(w, err)
+		return
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(session.UserID)
+	field := func(name string) string { return session.Metadata[name] }
+	if h.createUploadedResource(w, userID, f, checked, session.FileName, session.Length, field) {
+		h.removeUploadSession(session.ID)
+	}
+}
+
+// HandleDeleteUpload (DELETE) desiste do upload e apaga o que já tinha chegado.
+func (h *Handler) HandleDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.ownUploadSession(w, r)
+	if !ok {
+		return
+	}
+	if err := h.uploads.Remove(session.ID); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) removeUploadSession(id string) {
+	if err := h.uploads.Remove(id); err != nil && err != resumable.ErrNotFound {
+		log.Printf("Erro ao apagar upload retomável %s: %v", id, err)
+	}
+}
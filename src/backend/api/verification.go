@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"uspshare/mail"
+	"uspshare/models"
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Padrões do cadastro: só e-mails da USP, com o link de confirmação valendo dois dias.
+const (
+	DefaultAppURL          = "http://localhost:5173"
+	DefaultVerificationTTL = 48 * time.Hour
+)
+
+var DefaultEmailDomains = []string{"usp.br"}
+
+// SetMailer troca o driver de e-mail e o endereço do front-end usado nos links. As
+// notificações saem por uma fila em segundo plano sobre o mesmo driver.
+func (h *Handler) SetMailer(m mail.Mailer, appURL string) {
+	h.mailer = m
+	h.notificationMail = mail.NewQueue(m, mail.DefaultQueueWorkers)
+	h.appURL = strings.TrimRight(appURL, "/")
+}
+
+// SetEmailDomains define os domínios aceitos no cadastro.
+func (h *Handler) SetEmailDomains(domains []string) {
+	h.emailDomains = domains
+}
+
+// SetVerificationTTL define por quanto tempo o link de confirmação vale.
+func (h *Handler) SetVerificationTTL(d time.Duration) {
+	h.verificationTTL = d
+}
+
+// allowedEmail informa se o e-mail é de um dos domínios do cadastro ou de um
+// subdomínio deles (aluno@ime.usp.br vale para "usp.br").
+func (h *Handler) allowedEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range h.emailDomains {
+		allowed = strings.ToLower(allowed)
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// newUserToken guarda um novo token de uso único do usuário para o propósito,
+// invalidando os anteriores, e devolve a parte secreta, que vai no link.
+func (h *Handler) newUserToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	secret, hash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := models.UserToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Hash:      hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := h.store.Tokens.CreateUserToken(&token); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// sendVerification gera um novo link de confirmação para o usuário e o manda por
+// e-mail.
+func (h *Handler) sendVerification(user *models.User) error {
+	secret, err := h.newUserToken(user, models.TokenVerifyEmail, h.verificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := h.appURL + "/verify-email?token=" + url.QueryEscape(secret)
+	return h.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirme seu e-mail no USPShare",
+		Body: fmt.Sprintf("Olá, %s!\n\nPara ativar sua conta no USPShare, abra o link abaixo:\n\n%s\n\n"+
+			"O link vale por %d horas. Se você não se cadastrou, ignore esta mensagem.\n",
+			user.Name, link, int(h.verificationTTL/time.Hour)),
+	})
+}
+
+// HandleVerifyEmail confirma o e-mail com o token do link mandado no cadastro.
+func (h *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Requisição inválida"})
+		return
+	}
+
+	token, err := h.store.Tokens.ConsumeUserToken(models.TokenVerifyEmail, hashSecretToken(req.Token), time.Now())
+	if err == store.ErrNotFound {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Link de confirmação inválido ou expirado"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível confirmar o e-mail"})
+		return
+	}
+	if err := h.store.Users.SetUserEmailVerified(token.UserID); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Link de confirmação inválido ou expirado"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível confirmar o e-mail"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "E-mail confirmado. Você já pode entrar."})
+}
+
+// HandleResendVerification manda um novo link de confirmação. A resposta é a mesma
+// exista ou não um cadastro pendente com o e-mail, para não revelar quem tem conta.
+func (h *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Requisição inválida"})
+		return
+	}
+
+	user, err := h.store.Users.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível reenviar o link"})
+		return
+	}
+	if err == nil && user.EmailPending {
+		if err := h.sendVerification(user); err != nil {
+			log.Printf("Erro ao reenviar a confirmação para '%s': %v", user.Email, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Não foi possível reenviar o link"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Se houver um cadastro pendente com esse e-mail, enviamos um novo link."})
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/rbac"
+	"uspshare/store"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxVersionNoteLength limita a nota de alterações de uma versão.
+const maxVersionNoteLength = 1000
+
+// ownedResource carrega o recurso da URL e confere se o usuário logado é o dono.
+// Responde 400/403/500 e devolve nil quando não for possível continuar; como em
+// HandleDeleteResource, recurso inexistente e recurso de outro usuário dão 403.
+func (h *Handler) ownedResource(w http.ResponseWriter, r *http.Request) (*models.ResourceWithDetails, primitive.ObjectID) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	resourceID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid resource ID"})
+		return nil, userID
+	}
+
+	resource, err := h.store.Resources.GetResourceByID(resourceID)
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return nil, userID
+	}
+	if err == store.ErrNotFound || resource.UserID != userID {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied or resource not found"})
+		return nil, userID
+	}
+	return resource, userID
+}
+
+// curatableResource é como ownedResource, mas também deixa passar quem faz a
+// curadoria da disciplina do recurso. curating diz se quem edita não é o dono. Um
+// recurso na lixeira só volta a ser editável depois de restaurado.
+func (h *Handler) curatableResource(w http.ResponseWriter, r *http.Request) (resource *models.ResourceWithDetails, curating bool) {
+	userID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+	resourceID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid resource ID"})
+		return nil, false
+	}
+
+	resource, err = h.store.Resources.GetResourceByID(resourceID)
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return nil, false
+	}
+	if err == store.ErrNotFound {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied or resource not found"})
+		return nil, false
+	}
+	if resource.UserID == userID {
+		if resource.DeletedAt != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+			return nil, false
+		}
+		return resource, false
+	}
+	if resource.DeletedAt == nil && principalFrom(r).CanInCourse(rbac.CurateResources, resource.CourseCode) {
+		return resource, true
+	}
+	writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied or resource not found"})
+	return nil, false
+}
+
+// resourceUpdateRequest é o corpo de PUT /api/resource/{id}. Campos ausentes mantêm
+// o valor atual; professorId vazio desvincula o professor.
+type resourceUpdateRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	CourseCode  string   `json:"courseCode"`
+	Course      string   `json:"course"`
+	Type        string   `json:"type"`
+	Semester    string   `json:"semester"`
+	Tags        []string `json:"tags"`
+	ProfessorID string   `json:"professorId"`
+	IsAnonymous bool     `json:"isAnonymous"`
+}
+
+// HandleUpdateResource edita os metadados de um recurso. O arquivo não muda por aqui:
+// para isso há HandleCreateVersion. Curadores editam os recursos das suas
+// disciplinas, mas não tiram o recurso delas nem mexem no anonimato do dono; a
+// edição de um curador vai para a auditoria.
+func (h *Handler) HandleUpdateResource(w http.ResponseWriter, r *http.Request) {
+	resource, curating := h.curatableResource(w, r)
+	if resource == nil {
+		return
+	}
+
+	req := resourceUpdateRequest{
+		Title:       resource.Title,
+		Description: resource.Description,
+		CourseCode:  resource.CourseCode,
+		Course:      resource.Course,
+		Type:        resource.Type,
+		Semester:    resource.Semester,
+		Tags:        resource.Tags,
+		IsAnonymous: resource.IsAnonymous,
+	}
+	if resource.ProfessorID != nil {
+		req.ProfessorID = resource.ProfessorID.Hex()
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Title is required"})
+		return
+	}
+	if curating {
+		if !principalFrom(r).CanInCourse(rbac.CurateResources, req.CourseCode) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "You can only move resources between your own courses"})
+			return
+		}
+		req.IsAnonymous = resource.IsAnonymous
+	}
+	update := store.ResourceUpdate{
+		Title:       req.Title,
+		Description: req.Description,
+		CourseCode:  req.CourseCode,
+		Course:      req.Course,
+		Type:        req.Type,
+		Semester:    req.Semester,
+		Tags:        req.Tags,
+		IsAnonymous: req.IsAnonymous,
+	}
+	if req.ProfessorID != "" {
+		profID, err := primitive.ObjectIDFromHex(req.ProfessorID)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid professor ID"})
+			return
+		}
+		update.ProfessorID = &profID
+	}
+
+	if err := h.store.Resources.UpdateResourceMetadata(resource.ID, resource.UserID, update); err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied or resource not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to update resource"})
+		return
+	}
+	h.indexResource(resource.ID)
+	if curating {
+		curatorID, _ := primitive.ObjectIDFromHex(r.Context().Value(userContextKey).(string))
+		decision := models.ModerationAction{
+			AdminID:    curatorID,
+			Action:     models.ModerationEdit,
+			TargetType: models.ReportTargetResource,
+			TargetID:   resource.ID,
+		}
+		if _, err := h.recordModeration(decision); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Resource updated, but failed to record the moderation"})
+			return
+		}
+	}
+
+	updated, err := h.store.Resources.GetResourceByID(resource.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// HandleCreateVersion recebe um novo arquivo para o recurso, com uma nota opcional
+// sobre o que mudou. A versão passa pelo antivírus no pipeline e, se estiver limpa,
+// vira o arquivo atual; até lá o recurso continua com o arquivo anterior.
+func (h *Handler) HandleCreateVersion(w http.ResponseWriter, r *http.Request) {
+	resource, userID := h.ownedResource(w, r)
+	if resource == nil {
+		return
+	}
+	if resource.DeletedAt != nil || resource.HiddenAt != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+		return
+	}
+	if !resource.Visible() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "Resource is still being scanned or was quarantined"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.uploadPolicy.MaxSize()+multipartOverhead)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "File too large"})
+		return
+	}
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid file field"})
+		return
+	}
+	defer file.Close()
+
+	note := strings.TrimSpace(r.FormValue("note"))
+	if len(note) > maxVersionNoteLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Note is too long"})
+		return
+	}
+	checked, ok := checkFile(w, h.uploadPolicy, handler.Filename, file, handler.Size)
+	if !ok {
+		return
+	}
+
+	number, err := h.nextVersion(&resource.Resource)
+	if err != nil {
+		log.Printf("Erro ao numerar a nova versão do recurso %s: %v", resource.ID.Hex(), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create version"})
+		return
+	}
+
+	fileKey, contentHash, err := h.storeUploadedFile(file, checked, handler.Size)
+	if err != nil {
+		log.Printf("Erro ao salvar arquivo %s: %v", handler.Filename, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to save file"})
+		return
+	}
+	version := models.ResourceVersion{
+		ID:          primitive.NewObjectID(),
+		ResourceID:  resource.ID,
+		Version:     number,
+		UserID:      userID,
+		FileName:    handler.Filename,
+		FileUrl:     blob.PublicURL(fileKey),
+		ContentHash: contentHash,
+		ScanStatus:  models.ScanScanning,
+		Note:        note,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.store.Versions.CreateResourceVersion(&version); err != nil {
+		h.deleteBlobs(version.FileUrl)
+		if err == store.ErrDuplicateKey {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "Another version was uploaded at the same time, try again"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to create version"})
+		return
+	}
+	h.pipeline.EnqueueVersion(resource.ID, number)
+
+	writeJSON(w, http.StatusCreated, version)
+}
+
+// nextVersion devolve o número da próxima versão do recurso. O histórico só começa
+// a ser gravado na primeira versão nova: nesse momento o arquivo original vira a
+// versão 1, levando consigo a referência ao blob que era do recurso.
+func (h *Handler) nextVersion(resource *models.Resource) (int, error) {
+	versions, err := h.store.Versions.ListResourceVersions(resource.ID)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) > 0 {
+		return versions[len(versions)-1].Version + 1, nil
+	}
+
+	original := originalVersion(resource)
+	original.ID = primitive.NewObjectID()
+	// Outra versão enviada ao mesmo tempo pode ter gravado a original primeiro.
+	if err := h.store.Versions.CreateResourceVersion(&original); err != nil && err != store.ErrDuplicateKey {
+		return 0, err
+	}
+	return 2, nil
+}
+
+// versionResponse é uma versão do histórico com o nome de quem a enviou.
+type versionResponse struct {
+	models.ResourceVersion
+	UploaderName string `json:"uploaderName,omitempty"`
+}
+
+// HandleListVersions devolve o histórico de arquivos do recurso, da versão mais
+// antiga para a mais nova, e qual delas é a atual. Recursos que nunca receberam uma
+// versão nova têm só a versão 1, montada a partir do próprio recurso.
+func (h *Handler) HandleListVersions(w http.ResponseWriter, r *http.Request) {
+	resource, ok := h.visibleResource(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.store.Versions.ListResourceVersions(resource.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch versions"})
+		return
+	}
+	if len(versions) == 0 {
+		versions = []models.ResourceVersion{originalVersion(&resource.Resource)}
+	}
+
+	names := map[primitive.ObjectID]string{}
+	response := make([]versionResponse, len(versions))
+	for i, v := range versions {
+		name, found := names[v.UserID]
+		if !found {
+			if user, err := h.store.Users.GetUserByID(v.UserID); err == nil {
+				name = user.Name
+			}
+			names[v.UserID] = name
+		}
+		response[i] = versionResponse{ResourceVersion: v, UploaderName: name}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"current":  currentVersion(&resource.Resource),
+		"versions": response,
+	})
+}
+
+// HandleDownloadVersion redireciona para uma URL assinada do arquivo de uma versão
+// específica, como HandleDownloadResource faz com a atual.
+func (h *Handler) HandleDownloadVersion(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || number < 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid version number"})
+		return
+	}
+	resource, ok := h.visibleResource(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := h.store.Versions.GetResourceVersion(resource.ID, number)
+	if err == store.ErrNotFound && number == 1 {
+		original := originalVersion(&resource.Resource)
+		version, err = &original, nil
+	}
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Version not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch version"})
+		return
+	}
+	if version.ScanStatus != models.ScanClean {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Version not found"})
+		return
+	}
+
+	url, err := h.blobs.SignedURL(blob.KeyFromURL(version.FileUrl), downloadURLTTL, r.URL.Query().Get("view") == "true")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to sign download URL"})
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// visibleResource carrega o recurso da URL e responde 404 se ele não existe ou ainda
+// não pode ser visto.
+func (h *Handler) visibleResource(w http.ResponseWriter, r *http.Request) (*models.ResourceWithDetails, bool) {
+	resourceID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid resource ID"})
+		return nil, false
+	}
+	resource, err := h.store.Resources.GetResourceByID(resourceID)
+	if err != nil && err != store.ErrNotFound {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch resource"})
+		return nil, false
+	}
+	if err == store.ErrNotFound || !resource.Visible() {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Resource not found"})
+		return nil, false
+	}
+	return resource, true
+}
+
+// originalVersion descreve como versão 1 o arquivo de um recurso sem histórico.
+func originalVersion(resource *models.Resource) models.ResourceVersion {
+	return models.ResourceVersion{
+		ResourceID:  resource.ID,
+		Version:     1,
+		UserID:      resource.UserID,
+		FileName:    resource.FileName,
+		FileUrl:     resource.FileUrl,
+		ContentHash: resource.ContentHash,
+		ScanStatus:  models.ScanClean,
+		CreatedAt:   resource.UploadDate,
+	}
+}
+
+func currentVersion(resource *models.Resource) int {
+	if resource.Version == 0 {
+		return 1
+	}
+	return resource.Version
+}
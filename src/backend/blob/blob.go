@@ -0,0 +1,85 @@
+// Package blob guarda os arquivos enviados pelos usuários (materiais, avatares e
+// thumbnails). Os handlers só conhecem a interface Store; o driver (disco local ou
+// um serviço compatível com S3) é escolhido em main.
+package blob
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound é retornado quando a chave pedida não existe.
+var ErrNotFound = errors.New("blob: not found")
+
+// Store guarda blobs identificados por uma chave relativa, como "abc.pdf" ou
+// "avatars/<id>.png".
+type Store interface {
+	// Put grava o conteúdo de r na chave, substituindo o que existir. size pode ser -1
+	// quando o tamanho não é conhecido.
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	// Delete não reclama de chaves que não existem.
+	Delete(key string) error
+	// SignedURL devolve uma URL de download que expira depois de ttl. Com inline=false
+	// o navegador baixa o arquivo em vez de abri-lo.
+	SignedURL(key string, ttl time.Duration, inline bool) (string, error)
+}
+
+// URLPrefix é o caminho público em que main expõe os blobs com Handler. As URLs
+// gravadas no banco (Resource.FileUrl, avatares, thumbnails) começam com ele.
+const URLPrefix = "/uploads/"
+
+// Prefixos de chaves que Handler nunca serve: arquivos que ainda não passaram pelo
+// antivírus e os que ele barrou.
+const (
+	PendingPrefix    = "pending/"
+	QuarantinePrefix = "quarantine/"
+)
+
+// Private informa se a chave está num dos prefixos que Handler não serve.
+func Private(key string) bool {
+	return strings.HasPrefix(key, PendingPrefix) || strings.HasPrefix(key, QuarantinePrefix)
+}
+
+// Arquivos públicos, que Handler serve sem assinatura: avatares e thumbnails. Os
+// materiais e suas versões só saem por URLs assinadas.
+const (
+	AvatarPrefix    = "avatars/"
+	ThumbnailSuffix = "_thumb.jpg"
+)
+
+// Public informa se a chave é de um arquivo que Handler serve sem assinatura.
+func Public(key string) bool {
+	return strings.HasPrefix(key, AvatarPrefix) || strings.HasSuffix(key, ThumbnailSuffix)
+}
+
+// PublicURL é a URL estável, sem assinatura, gravada no banco para a chave. Fora dos
+// arquivos públicos (ver Public), ela só identifica o blob: para baixá-lo é preciso
+// uma URL de SignedURL.
+func PublicURL(key string) string {
+	return URLPrefix + key
+}
+
+// KeyFromURL faz o caminho inverso de PublicURL. Devolve "" para URLs que não
+// apontam para um blob.
+func KeyFromURL(url string) string {
+	if !strings.HasPrefix(url, URLPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(url, URLPrefix)
+}
+
+// validKey recusa chaves vazias, absolutas ou que tentem sair do diretório base.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// signatureVerifier é implementado pelos drivers cujas URLs assinadas apontam para
+// o próprio servidor (LocalStore).
+type signatureVerifier interface {
+	VerifySignedURL(key string, q url.Values) error
+}
+
+// Handler serve os blobs; main o monta em URLPrefix com http.StripPrefix. Sem
+// ?view=true a resposta leva "Content-Disposition: attachment", como o FileServer
+// fazia antes. Só os arquivos públicos (ver Public) saem sem assinatura; os demais
+// exigem uma URL de SignedURL válida. Chaves privadas (ver Private) respondem 404
+// mesmo com assinatura.
+func Handler(s Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if !validKey(key) || Private(key) {
+			http.NotFound(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		if q.Has("sig") || !Public(key) {
+			verifier, ok := s.(signatureVerifier)
+			if !ok || verifier.VerifySignedURL(key, q) != nil {
+				http.Error(w, "invalid or expired link", http.StatusForbidden)
+				return
+			}
+		}
+
+		rc, err := s.Open(key)
+		if err == ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to open file", http.StatusInternalServerError)
+			return
+		}
+		defer rc.Close()
+
+		if q.Get("view") != "true" {
+			w.Header().Set("Content-Disposition", "attachment")
+		}
+
+		if seeker, ok := rc.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, path.Base(key), time.Time{}, seeker)
+			return
+		}
+		if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		io.Copy(w, rc)
+	})
+}
@@ -0,0 +1,124 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidSignature é retornado por VerifySignedURL para URLs adulteradas ou expiradas.
+var ErrInvalidSignature = errors.New("blob: invalid or expired signature")
+
+// LocalStore guarda os blobs num diretório do disco (por padrão, "uploads").
+// As URLs assinadas apontam para o próprio servidor e são conferidas por Handler.
+type LocalStore struct {
+	root   string
+	secret []byte
+	now    func() time.Time
+}
+
+func NewLocalStore(root string, secret []byte) *LocalStore {
+	return &LocalStore{root: root, secret: secret, now: time.Now}
+}
+
+func (l *LocalStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("blob: invalid key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put escreve num arquivo temporário e renomeia no fim, para que ninguém leia um
+// arquivo pela metade.
+func (l *LocalStore) Put(key string, r io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *LocalStore) Open(key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *LocalStore) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL gera "/uploads/<key>?expires=<unix>&sig=<hmac>", com view=true quando inline.
+func (l *LocalStore) SignedURL(key string, ttl time.Duration, inline bool) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("blob: invalid key %q", key)
+	}
+	expires := strconv.FormatInt(l.now().Add(ttl).Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	if inline {
+		q.Set("view", "true")
+	}
+	q.Set("sig", l.signature(key, expires, inline))
+	return PublicURL(key) + "?" + q.Encode(), nil
+}
+
+// VerifySignedURL confere a assinatura e a validade dos parâmetros de uma URL gerada
+// por SignedURL.
+func (l *LocalStore) VerifySignedURL(key string, q url.Values) error {
+	expires := q.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || l.now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	expected := l.signature(key, expires, q.Get("view") == "true")
+	if !hmac.Equal([]byte(expected), []byte(q.Get("sig"))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (l *LocalStore) signature(key, expires string, inline bool) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%t", key, expires, inline)
+	return hex.EncodeToString(mac.Sum(nil))
+}
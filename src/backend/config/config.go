@@ -1,3 +1,616 @@
+// Package config monta a configuração do servidor. Cada valor vem, do mais fraco
+// para o mais forte: do padrão em Default, de um arquivo JSON opcional, das variáveis
+// de ambiente (o .env entra aqui) e das flags da linha de comando.
 package config
 
-var JWT_SECRET = []byte("chave-secreta-muito-segura-para-o-uspshare")
+import (
+	"crypto/rand"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"uspshare/ratelimit"
+
+	"github.com/joho/godotenv"
+)
+
+// Modos de execução. Em produção nenhum segredo tem valor padrão.
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// minSecretLen é o tamanho mínimo do JWT_SECRET em produção, o mesmo da chave do HS256.
+const minSecretLen = 32
+
+// Config é a configuração completa do servidor. A tag env dá o nome da variável de
+// ambiente de cada campo; a tag json, o nome no arquivo de configuração.
+type Config struct {
+	Env       string          `json:"env" env:"APP_ENV"`
+	Server    ServerConfig    `json:"server"`
+	Auth      AuthConfig      `json:"auth"`
+	Database  DatabaseConfig  `json:"database"`
+	Blob      BlobConfig      `json:"blob"`
+	Uploads   UploadConfig    `json:"uploads"`
+	Trash     TrashConfig     `json:"trash"`
+	Mail      MailConfig      `json:"mail"`
+	Digest    DigestConfig    `json:"digest"`
+	Inbox     InboxConfig     `json:"inbox"`
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	// ClamdAddress aponta para o clamd, ex.: "tcp://localhost:3310" ou
+	// "unix:///run/clamav/clamd.ctl". Vazio desliga o antivírus.
+	ClamdAddress string `json:"clamdAddress" env:"CLAMD_ADDRESS"`
+
+	// generatedSecret marca que o JWT_SECRET foi sorteado por falta de um configurado.
+	generatedSecret bool
+}
+
+type ServerConfig struct {
+	Addr string `json:"addr" env:"HTTP_ADDR"`
+	// AllowedOrigins são as origens aceitas pelo CORS; "*" só vale em desenvolvimento.
+	AllowedOrigins []string `json:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+	// AppURL é o endereço do front-end, usado nos links mandados por e-mail.
+	AppURL string `json:"appURL" env:"APP_URL"`
+}
+
+type AuthConfig struct {
+	JWTSecret       Secret   `json:"jwtSecret" env:"JWT_SECRET"`
+	AccessTokenTTL  Duration `json:"accessTokenTTL" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL Duration `json:"refreshTokenTTL" env:"REFRESH_TOKEN_TTL"`
+	// AllowedEmailDomains são os domínios aceitos no cadastro; os subdomínios
+	// (ex.: ime.usp.br) também valem.
+	AllowedEmailDomains  []string `json:"allowedEmailDomains" env:"ALLOWED_EMAIL_DOMAINS"`
+	EmailVerificationTTL Duration `json:"emailVerificationTTL" env:"EMAIL_VERIFICATION_TTL"`
+	PasswordResetTTL     Duration `json:"passwordResetTTL" env:"PASSWORD_RESET_TTL"`
+}
+
+type DatabaseConfig struct {
+	// Backend é "mongo" ou "postgres".
+	Backend string `json:"backend" env:"DB_BACKEND"`
+	// As URLs de conexão costumam levar a senha, por isso são segredos.
+	MongoURI      Secret `json:"mongoURI" env:"MONGO_URI"`
+	MongoDatabase string `json:"mongoDatabase" env:"MONGO_DATABASE"`
+	PostgresURL   Secret `json:"postgresURL" env:"POSTGRES_URL"`
+}
+
+type BlobConfig struct {
+	// Driver é "local" ou "s3".
+	Driver      string `json:"driver" env:"BLOB_DRIVER"`
+	LocalDir    string `json:"localDir" env:"BLOB_LOCAL_DIR"`
+	S3Endpoint  string `json:"s3Endpoint" env:"S3_ENDPOINT"`
+	S3Bucket    string `json:"s3Bucket" env:"S3_BUCKET"`
+	S3Region    string `json:"s3Region" env:"S3_REGION"`
+	S3AccessKey Secret `json:"s3AccessKey" env:"S3_ACCESS_KEY"`
+	S3SecretKey Secret `json:"s3SecretKey" env:"S3_SECRET_KEY"`
+}
+
+type UploadConfig struct {
+	// PartialDir guarda os pedaços dos uploads retomáveis.
+	PartialDir string `json:"partialDir" env:"PARTIAL_UPLOAD_DIR"`
+	// AllowedTypes restringe os tipos de arquivo aceitos (ex.: "pdf,image,docx");
+	// vazio aceita todos os tipos conhecidos.
+	AllowedTypes []string `json:"allowedTypes" env:"UPLOAD_ALLOWED_TYPES"`
+	// MaxMB troca o limite de tamanho de um tipo, em MB. Pelo ambiente, um tipo por
+	// variável: UPLOAD_MAX_MB_PDF=30.
+	MaxMB map[string]int64 `json:"maxMB"`
+}
+
+type MailConfig struct {
+	// Driver é "log" (as mensagens vão para o log), "file" (para o arquivo File),
+	// "maildir" (uma caixa Maildir no diretório Dir) ou "smtp". Em produção, só "smtp".
+	Driver       string `json:"driver" env:"MAIL_DRIVER"`
+	From         string `json:"from" env:"MAIL_FROM"`
+	File         string `json:"file" env:"MAIL_FILE"`
+	Dir          string `json:"dir" env:"MAIL_DIR"`
+	SMTPHost     string `json:"smtpHost" env:"SMTP_HOST"`
+	SMTPPort     int    `json:"smtpPort" env:"SMTP_PORT"`
+	SMTPUsername string `json:"smtpUsername" env:"SMTP_USERNAME"`
+	SMTPPassword Secret `json:"smtpPassword" env:"SMTP_PASSWORD"`
+}
+
+type DigestConfig struct {
+	// Interval é de quanto em quanto tempo o job procura resumos por e-mail vencidos.
+	Interval Duration `json:"interval" env:"DIGEST_INTERVAL"`
+}
+
+type InboxConfig struct {
+	// ReadRetentionDays é por quantos dias uma notificação lida fica na caixa antes de
+	// ser apagada.
+	ReadRetentionDays int `json:"readRetentionDays" env:"NOTIFICATION_READ_RETENTION_DAYS"`
+}
+
+type RateLimitConfig struct {
+	// Backend é "memory", quando há uma instância só, ou "database", para as
+	// instâncias contarem juntas no banco.
+	Backend string `json:"backend" env:"RATE_LIMIT_BACKEND"`
+	// Os limites são por grupo de rotas, no formato "10/1m" ou "off": Auth por IP
+	// (login, cadastro, senha), Write por usuário (comentários, curtidas, denúncias)
+	// e Upload por usuário.
+	Auth   ratelimit.Limit `json:"auth" env:"RATE_LIMIT_AUTH"`
+	Write  ratelimit.Limit `json:"write" env:"RATE_LIMIT_WRITE"`
+	Upload ratelimit.Limit `json:"upload" env:"RATE_LIMIT_UPLOAD"`
+	// Depois de LockoutThreshold senhas erradas seguidas, o e-mail fica bloqueado
+	// por LockoutBase, dobrando a cada nova falha até LockoutMax. Zero desliga.
+	LockoutThreshold int      `json:"lockoutThreshold" env:"LOGIN_LOCKOUT_THRESHOLD"`
+	LockoutBase      Duration `json:"lockoutBase" env:"LOGIN_LOCKOUT_BASE"`
+	LockoutMax       Duration `json:"lockoutMax" env:"LOGIN_LOCKOUT_MAX"`
+}
+
+type TrashConfig struct {
+	// RetentionDays é por quantos dias um recurso fica na lixeira.
+	RetentionDays int `json:"retentionDays" env:"TRASH_RETENTION_DAYS"`
+}
+
+// Secret é um valor que não pode vazar: aparece como "[redacted]" quando impresso
+// ou convertido em JSON.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Duration é um time.Duration escrito como texto ("15m", "720h") no arquivo de
+// configuração e no ambiente.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duração precisa ser texto, ex.: \"15m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Default devolve a configuração de desenvolvimento, sem nenhum segredo.
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		Server: ServerConfig{
+			Addr:           ":8080",
+			AllowedOrigins: []string{"*"},
+			AppURL:         "http://localhost:5173",
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:       Duration{15 * time.Minute},
+			RefreshTokenTTL:      Duration{30 * 24 * time.Hour},
+			AllowedEmailDomains:  []string{"usp.br"},
+			EmailVerificationTTL: Duration{48 * time.Hour},
+			PasswordResetTTL:     Duration{time.Hour},
+		},
+		Database: DatabaseConfig{
+			Backend:       "mongo",
+			MongoDatabase: "uspshare",
+		},
+		Blob: BlobConfig{
+			Driver:   "local",
+			LocalDir: "uploads",
+		},
+		Uploads: UploadConfig{
+			PartialDir: "partial-uploads",
+			MaxMB:      map[string]int64{},
+		},
+		Trash:  TrashConfig{RetentionDays: 30},
+		Digest: DigestConfig{Interval: Duration{time.Hour}},
+		Inbox:  InboxConfig{ReadRetentionDays: 90},
+		RateLimit: RateLimitConfig{
+			Backend:          "memory",
+			Auth:             ratelimit.Limit{Requests: 10, Per: time.Minute},
+			Write:            ratelimit.Limit{Requests: 60, Per: time.Minute},
+			Upload:           ratelimit.Limit{Requests: 20, Per: time.Hour},
+			LockoutThreshold: ratelimit.DefaultLockout.Threshold,
+			LockoutBase:      Duration{ratelimit.DefaultLockout.Base},
+			LockoutMax:       Duration{ratelimit.DefaultLockout.Max},
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "USPShare <nao-responda@localhost>",
+			File:     "mail.log",
+			Dir:      "mailbox",
+			SMTPPort: 587,
+		},
+	}
+}
+
+// Flags são as opções de linha de comando que mexem na configuração.
+type Flags struct {
+	File string
+	Env  string
+	Addr string
+}
+
+// RegisterFlags registra -config, -env e -addr no FlagSet.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	fs.StringVar(&f.File, "config", "", "arquivo de configuração JSON (ou CONFIG_FILE)")
+	fs.StringVar(&f.Env, "env", "", "modo de execução: development ou production (ou APP_ENV)")
+	fs.StringVar(&f.Addr, "addr", "", "endereço do servidor HTTP, ex.: :8080 (ou HTTP_ADDR)")
+	return f
+}
+
+// LoadDotEnv carrega o arquivo .env, se existir. As variáveis já definidas no
+// ambiente têm prioridade sobre as do arquivo.
+func LoadDotEnv(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return godotenv.Load(path)
+}
+
+// Load monta a configuração a partir do arquivo (flags.File ou CONFIG_FILE), do
+// ambiente em environ (no formato de os.Environ) e das flags, e a valida. Se a
+// validação falhar, a configuração volta junto com o erro, para ser mostrada.
+//
+// Em desenvolvimento, sem JWT_SECRET, é sorteado um segredo que vale até o processo
+// reiniciar; em produção, a falta dele é um erro.
+func Load(flags Flags, environ []string) (*Config, error) {
+	env := envMap(environ)
+	cfg := Default()
+
+	path := flags.File
+	if path == "" {
+		path = env["CONFIG_FILE"]
+	}
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(env); err != nil {
+		return nil, err
+	}
+	if flags.Env != "" {
+		cfg.Env = flags.Env
+	}
+	if flags.Addr != "" {
+		cfg.Server.Addr = flags.Addr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	if cfg.Auth.JWTSecret == "" {
+		secret, err := randomSecret()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Auth.JWTSecret = secret
+		cfg.generatedSecret = true
+	}
+	return cfg, nil
+}
+
+// GeneratedSecret informa se o JWT_SECRET foi sorteado por Load. Os tokens emitidos
+// com ele deixam de valer quando o processo reinicia.
+func (c *Config) GeneratedSecret() bool {
+	return c.generatedSecret
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("não foi possível abrir o arquivo de configuração: %w", err)
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("arquivo de configuração %s inválido: %w", path, err)
+	}
+	if c.Uploads.MaxMB == nil {
+		c.Uploads.MaxMB = map[string]int64{}
+	}
+	return nil
+}
+
+func envMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+const maxMBPrefix = "UPLOAD_MAX_MB_"
+
+// applyEnv sobrepõe os campos com tag env definidos no ambiente. Variáveis vazias
+// são ignoradas, como se não existissem.
+func (c *Config) applyEnv(env map[string]string) error {
+	if err := setFromEnv(reflect.ValueOf(c).Elem(), env); err != nil {
+		return err
+	}
+	for k, v := range env {
+		if !strings.HasPrefix(k, maxMBPrefix) || v == "" {
+			continue
+		}
+		mb, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s inválido: %q", k, v)
+		}
+		c.Uploads.MaxMB[strings.ToLower(strings.TrimPrefix(k, maxMBPrefix))] = mb
+	}
+	return nil
+}
+
+func setFromEnv(v reflect.Value, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, sf := v.Field(i), t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Tag.Get("env")
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				if err := setFromEnv(field, env); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		raw := strings.TrimSpace(env[name])
+		if raw == "" {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			return fmt.Errorf("%s inválido: %q", name, raw)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, raw string) error {
+	switch p := field.Addr().Interface().(type) {
+	case *Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		p.Duration = d
+		return nil
+	case *[]string:
+		*p = splitList(raw)
+		return nil
+	case encoding.TextUnmarshaler:
+		return p.UnmarshalText([]byte(raw))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("tipo sem suporte: %s", field.Type())
+	}
+	return nil
+}
+
+// splitList separa uma lista por vírgulas, sem espaços nem itens vazios.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func randomSecret() (Secret, error) {
+	b := make([]byte, minSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return Secret(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+// ValidationError junta todos os problemas da configuração, para o operador
+// corrigir tudo de uma vez.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "configuração inválida:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate confere a configuração inteira. Em produção, exige os segredos e origens
+// de CORS explícitas.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	production := c.Env == EnvProduction
+	if c.Env != EnvDevelopment && !production {
+		add("APP_ENV desconhecido: %q (use %q ou %q)", c.Env, EnvDevelopment, EnvProduction)
+	}
+	if c.Server.Addr == "" {
+		add("HTTP_ADDR vazio")
+	}
+	if len(c.Server.AllowedOrigins) == 0 {
+		add("CORS_ALLOWED_ORIGINS vazio")
+	}
+	for _, origin := range c.Server.AllowedOrigins {
+		if origin == "*" && production {
+			add("CORS_ALLOWED_ORIGINS não pode ser \"*\" em produção; liste as origens do front-end")
+		}
+	}
+
+	switch {
+	case c.Auth.JWTSecret == "" && production:
+		add("JWT_SECRET é obrigatório em produção")
+	case c.Auth.JWTSecret != "" && production && len(c.Auth.JWTSecret) < minSecretLen:
+		add("JWT_SECRET precisa ter ao menos %d bytes em produção", minSecretLen)
+	}
+	if c.Server.AppURL == "" {
+		add("APP_URL vazio")
+	}
+	if len(c.Auth.AllowedEmailDomains) == 0 {
+		add("ALLOWED_EMAIL_DOMAINS vazio")
+	}
+	if c.Auth.EmailVerificationTTL.Duration <= 0 || c.Auth.PasswordResetTTL.Duration <= 0 {
+		add("EMAIL_VERIFICATION_TTL e PASSWORD_RESET_TTL precisam ser positivos")
+	}
+	access, refresh := c.Auth.AccessTokenTTL.Duration, c.Auth.RefreshTokenTTL.Duration
+	if access <= 0 || refresh <= 0 {
+		add("ACCESS_TOKEN_TTL e REFRESH_TOKEN_TTL precisam ser positivos")
+	} else if access >= refresh {
+		add("ACCESS_TOKEN_TTL (%s) precisa ser menor que REFRESH_TOKEN_TTL (%s)", access, refresh)
+	}
+
+	switch c.Database.Backend {
+	case "mongo":
+		if c.Database.MongoURI == "" {
+			add("MONGO_URI é obrigatório com DB_BACKEND=mongo")
+		}
+		if c.Database.MongoDatabase == "" {
+			add("MONGO_DATABASE vazio")
+		}
+	case "postgres":
+		if c.Database.PostgresURL == "" {
+			add("POSTGRES_URL é obrigatório com DB_BACKEND=postgres")
+		}
+	default:
+		add("DB_BACKEND desconhecido: %q (use \"mongo\" ou \"postgres\")", c.Database.Backend)
+	}
+
+	switch c.Blob.Driver {
+	case "local":
+		if c.Blob.LocalDir == "" {
+			add("BLOB_LOCAL_DIR vazio")
+		}
+	case "s3":
+		if c.Blob.S3Endpoint == "" || c.Blob.S3Bucket == "" {
+			add("S3_ENDPOINT e S3_BUCKET são obrigatórios com BLOB_DRIVER=s3")
+		}
+		if production && (c.Blob.S3AccessKey == "" || c.Blob.S3SecretKey == "") {
+			add("S3_ACCESS_KEY e S3_SECRET_KEY são obrigatórios em produção")
+		}
+	default:
+		add("BLOB_DRIVER desconhecido: %q (use \"local\" ou \"s3\")", c.Blob.Driver)
+	}
+
+	switch c.Mail.Driver {
+	case "log", "file", "maildir":
+		if production {
+			add("MAIL_DRIVER=%s é só para desenvolvimento; use \"smtp\" em produção", c.Mail.Driver)
+		}
+		if c.Mail.Driver == "file" && c.Mail.File == "" {
+			add("MAIL_FILE é obrigatório com MAIL_DRIVER=file")
+		}
+		if c.Mail.Driver == "maildir" && c.Mail.Dir == "" {
+			add("MAIL_DIR é obrigatório com MAIL_DRIVER=maildir")
+		}
+	case "smtp":
+		if c.Mail.SMTPHost == "" || c.Mail.SMTPPort <= 0 {
+			add("SMTP_HOST e SMTP_PORT são obrigatórios com MAIL_DRIVER=smtp")
+		}
+		if c.Mail.From == "" {
+			add("MAIL_FROM vazio")
+		}
+	default:
+		add("MAIL_DRIVER desconhecido: %q (use \"log\", \"file\", \"maildir\" ou \"smtp\")", c.Mail.Driver)
+	}
+
+	if c.Uploads.PartialDir == "" {
+		add("PARTIAL_UPLOAD_DIR vazio")
+	}
+	for name, mb := range c.Uploads.MaxMB {
+		if mb <= 0 {
+			add("%s%s precisa ser positivo: %d", maxMBPrefix, strings.ToUpper(name), mb)
+		}
+	}
+	if c.Trash.RetentionDays <= 0 {
+		add("TRASH_RETENTION_DAYS precisa ser positivo: %d", c.Trash.RetentionDays)
+	}
+
+	if c.Inbox.ReadRetentionDays <= 0 {
+		add("NOTIFICATION_READ_RETENTION_DAYS precisa ser positivo: %d", c.Inbox.ReadRetentionDays)
+	}
+
+	if c.Digest.Interval.Duration <= 0 {
+		add("DIGEST_INTERVAL precisa ser positivo: %s", c.Digest.Interval)
+	}
+
+	if c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "database" {
+		add("RATE_LIMIT_BACKEND desconhecido: %q (use \"memory\" ou \"database\")", c.RateLimit.Backend)
+	}
+	if c.RateLimit.LockoutThreshold < 0 {
+		add("LOGIN_LOCKOUT_THRESHOLD não pode ser negativo: %d", c.RateLimit.LockoutThreshold)
+	}
+	if c.RateLimit.LockoutThreshold > 0 {
+		base, max := c.RateLimit.LockoutBase.Duration, c.RateLimit.LockoutMax.Duration
+		if base <= 0 || max < base {
+			add("LOGIN_LOCKOUT_BASE precisa ser positivo e até LOGIN_LOCKOUT_MAX (%s, %s)", base, max)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// LockoutPolicy é a política de bloqueio do login.
+func (c *Config) LockoutPolicy() ratelimit.LockoutPolicy {
+	p := ratelimit.DefaultLockout
+	p.Threshold = c.RateLimit.LockoutThreshold
+	p.Base = c.RateLimit.LockoutBase.Duration
+	p.Max = c.RateLimit.LockoutMax.Duration
+	return p
+}
+
+// TrashRetention é o prazo da lixeira como duração.
+func (c *Config) TrashRetention() time.Duration {
+	return time.Duration(c.Trash.RetentionDays) * 24 * time.Hour
+}
+
+// ReadNotificationRetention é por quanto tempo uma notificação lida é guardada.
+func (c *Config) ReadNotificationRetention() time.Duration {
+	return time.Duration(c.Inbox.ReadRetentionDays) * 24 * time.Hour
+}
+
+// Redacted devolve a configuração em JSON com os segredos escondidos, para
+// -print-config.
+func (c *Config) Redacted() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
@@ -2,42 +2,22 @@ package database
 
 import (
 	"context"
-	"fmt"
 	"log"
-	"os"
 	"time"
+	"uspshare/models"
 
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-var DB *mongo.Client
-var UserCollection *mongo.Collection
-var ResourceCollection *mongo.Collection
-var CommentCollection *mongo.Collection
-var NotificationCollection *mongo.Collection
-var CourseCollection *mongo.Collection
-var ProfessorCollection *mongo.Collection
-var TagCollection *mongo.Collection
-var LikeCollection *mongo.Collection
-var CommentLikeCollection *mongo.Collection
-
-func InitDB() {
+// InitDB conecta ao MongoDB em uri, usa o banco name e prepara índices e migrações.
+func InitDB(uri, name string) *mongo.Database {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	fmt.Println("Hello, World!")
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	MONGODB_URI := os.Getenv("MONGO_URI")
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(MONGODB_URI))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
 		log.Fatal("Erro ao conectar ao MongoDB:", err)
 	}
@@ -46,23 +26,17 @@ func InitDB() {
 		log.Fatal("Não foi possível pingar o MongoDB:", err)
 	}
 
-	DB = client
-	database := DB.Database("uspshare")
-	UserCollection = database.Collection("users")
-	ResourceCollection = database.Collection("resources")
-	CommentCollection = database.Collection("comments")
-	NotificationCollection = database.Collection("notifications")
-	CourseCollection = database.Collection("courses")
-	ProfessorCollection = database.Collection("professors")
-	TagCollection = database.Collection("tags")
-	LikeCollection = database.Collection("likes")
-	CommentLikeCollection = database.Collection("comment_likes")
+	database := client.Database(name)
 
 	log.Println("Conectado ao MongoDB com sucesso!")
-	createIndexes()
+	createIndexes(database)
+	migrateCommentReports(database)
+	migrateUserRoles(database)
+	backfillResourceCounters(database)
+	return database
 }
 
-func createIndexes() {
+func createIndexes(database *mongo.Database) {
 	indexModel := mongo.IndexModel{
 		Keys: bson.M{
 			"email": 1,
@@ -70,10 +44,224 @@ func createIndexes() {
 		Options: options.Index().SetUnique(true),
 	}
 
-	_, err := UserCollection.Indexes().CreateOne(context.Background(), indexModel)
+	_, err := database.Collection("users").Indexes().CreateOne(context.Background(), indexModel)
 	if err != nil {
 		log.Printf("Não foi possível criar índice para 'users': %v\n", err)
 	} else {
 		log.Println("Índice de email único criado com sucesso.")
 	}
+
+	// Usado para achar recursos com o mesmo conteúdo na hora do upload.
+	hashIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "contentHash", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}
+	if _, err := database.Collection("resources").Indexes().CreateOne(context.Background(), hashIndex); err != nil {
+		log.Printf("Não foi possível criar índice de contentHash em 'resources': %v\n", err)
+	}
+
+	// Usado pelo purgador da lixeira; só os recursos apagados têm o campo.
+	trashIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}
+	if _, err := database.Collection("resources").Indexes().CreateOne(context.Background(), trashIndex); err != nil {
+		log.Printf("Não foi possível criar índice de deletedAt em 'resources': %v\n", err)
+	}
+
+	// Lixeira de comentários; só os que o autor apagou têm trashed.
+	commentTrashIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "trashed", Value: 1}, {Key: "deletedAt", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}
+	if _, err := database.Collection("comments").Indexes().CreateOne(context.Background(), commentTrashIndex); err != nil {
+		log.Printf("Não foi possível criar índice de lixeira em 'comments': %v\n", err)
+	}
+
+	// Ordenações da listagem por likes e por comentários.
+	counterIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "likeCount", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "commentCount", Value: -1}, {Key: "_id", Value: -1}}},
+	}
+	if _, err := database.Collection("resources").Indexes().CreateMany(context.Background(), counterIndexes); err != nil {
+		log.Printf("Não foi possível criar os índices de contadores em 'resources': %v\n", err)
+	}
+
+	// Impede que duas versões enviadas ao mesmo tempo recebam o mesmo número.
+	versionIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "resourceId", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := database.Collection("resource_versions").Indexes().CreateOne(context.Background(), versionIndex); err != nil {
+		log.Printf("Não foi possível criar índice de versões em 'resource_versions': %v\n", err)
+	}
+
+	// Um like por usuário e recurso, como no PostgreSQL. Um like repetido falha antes
+	// de LikeResource gravar a notificação.
+	likeIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "resourceId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := database.Collection("likes").Indexes().CreateOne(context.Background(), likeIndex); err != nil {
+		log.Printf("Não foi possível criar índice de likes em 'likes': %v\n", err)
+	}
+	commentLikeIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "commentId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := database.Collection("comment_likes").Indexes().CreateOne(context.Background(), commentLikeIndex); err != nil {
+		log.Printf("Não foi possível criar índice de likes em 'comment_likes': %v\n", err)
+	}
+
+	editIndex := mongo.IndexModel{Keys: bson.D{{Key: "commentId", Value: 1}, {Key: "editedAt", Value: 1}}}
+	if _, err := database.Collection("comment_edits").Indexes().CreateOne(context.Background(), editIndex); err != nil {
+		log.Printf("Não foi possível criar índice de edições em 'comment_edits': %v\n", err)
+	}
+
+	// Cada usuário denuncia um mesmo alvo uma vez só.
+	reportIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}, {Key: "reporterId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := database.Collection("reports").Indexes().CreateOne(context.Background(), reportIndex); err != nil {
+		log.Printf("Não foi possível criar índice de denúncias em 'reports': %v\n", err)
+	}
+	queueIndex := mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}}
+	if _, err := database.Collection("reports").Indexes().CreateOne(context.Background(), queueIndex); err != nil {
+		log.Printf("Não foi possível criar índice da fila em 'reports': %v\n", err)
+	}
+
+	auditIndex := mongo.IndexModel{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "createdAt", Value: -1}}}
+	if _, err := database.Collection("moderation_actions").Indexes().CreateOne(context.Background(), auditIndex); err != nil {
+		log.Printf("Não foi possível criar índice de auditoria em 'moderation_actions': %v\n", err)
+	}
+
+	// O índice TTL apaga as sessões assim que expiresAt passa.
+	sessionIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+	if _, err := database.Collection("sessions").Indexes().CreateMany(context.Background(), sessionIndexes); err != nil {
+		log.Printf("Não foi possível criar índices em 'sessions': %v\n", err)
+	}
+
+	// Tokens de e-mail (confirmação de cadastro): busca pelo hash; o TTL apaga os vencidos.
+	tokenIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}
+	if _, err := database.Collection("user_tokens").Indexes().CreateMany(context.Background(), tokenIndexes); err != nil {
+		log.Printf("Não foi possível criar índices em 'user_tokens': %v\n", err)
+	}
+
+	// Estado do limitador de requisições compartilhado; o TTL apaga as chaves vencidas.
+	rateIndex := mongo.IndexModel{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+	if _, err := database.Collection("rate_limits").Indexes().CreateOne(context.Background(), rateIndex); err != nil {
+		log.Printf("Não foi possível criar índice em 'rate_limits': %v\n", err)
+	}
+
+	// A caixa de notificações pagina por (createdAt, _id), e o job de retenção procura
+	// as lidas pela data de leitura.
+	notificationIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "isRead", Value: 1}, {Key: "readAt", Value: 1}}},
+	}
+	if _, err := database.Collection("notifications").Indexes().CreateMany(context.Background(), notificationIndexes); err != nil {
+		log.Printf("Não foi possível criar índices em 'notifications': %v\n", err)
+	}
+
+	// O job do resumo por e-mail só lê quem assina algum resumo.
+	digestIndex := mongo.IndexModel{Keys: bson.D{{Key: "digest", Value: 1}}}
+	if _, err := database.Collection("notification_preferences").Indexes().CreateOne(context.Background(), digestIndex); err != nil {
+		log.Printf("Não foi possível criar índice em 'notification_preferences': %v\n", err)
+	}
+}
+
+// migrateCommentReports move as denúncias de comentário da coleção antiga,
+// comment_reports, para a fila genérica em reports. O motivo livre de antes vira
+// details, com reason "other".
+func migrateCommentReports(database *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	old := database.Collection("comment_reports")
+	count, err := old.CountDocuments(ctx, bson.M{})
+	if err != nil || count == 0 {
+		return
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{"from": "comments", "localField": "commentId", "foreignField": "_id", "as": "comment"}}},
+		{{Key: "$unwind", Value: bson.M{"path": "$comment", "preserveNullAndEmptyArrays": true}}},
+		{{Key: "$project", Value: bson.M{
+			"targetType": "comment",
+			"targetId":   "$commentId",
+			"ownerId":    "$comment.userId",
+			"resourceId": "$resourceId",
+			"reporterId": "$reporterId",
+			"reason":     "other",
+			"details":    "$reason",
+			"content":    "$content",
+			"status":     "$status",
+			"action":     bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "actioned"}}, "delete", "$$REMOVE"}},
+			"createdAt":  "$createdAt",
+			"resolvedAt": "$resolvedAt",
+			"resolvedBy": "$resolvedBy",
+		}}},
+		{{Key: "$merge", Value: bson.M{"into": "reports", "whenMatched": "keepExisting"}}},
+	}
+	cursor, err := old.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Não foi possível migrar 'comment_reports' para 'reports': %v\n", err)
+		return
+	}
+	cursor.Close(ctx)
+	if err := old.Drop(ctx); err != nil {
+		log.Printf("Não foi possível apagar 'comment_reports' depois da migração: %v\n", err)
+		return
+	}
+	log.Printf("%d denúncias de comentário migradas para 'reports'.", count)
+}
+
+// migrateUserRoles dá o papel de estudante às contas antigas, criadas sem papel ou
+// com "user".
+func migrateUserRoles(database *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := database.Collection("users").UpdateMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"role": bson.M{"$exists": false}},
+		bson.M{"role": bson.M{"$in": bson.A{"", "user"}}},
+	}}, bson.M{"$set": bson.M{"role": models.RoleStudent}})
+	if err != nil {
+		log.Printf("Não foi possível migrar os papéis de 'users': %v\n", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("%d contas antigas agora têm o papel '%s'.", result.ModifiedCount, models.RoleStudent)
+	}
+}
+
+// backfillResourceCounters calcula likeCount e commentCount dos recursos criados antes
+// de os contadores existirem.
+func backfillResourceCounters(database *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"likeCount": bson.M{"$exists": false}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "likes", "localField": "_id", "foreignField": "resourceId", "as": "likeData"}}},
+		{{Key: "$lookup", Value: bson.M{"from": "comments", "localField": "_id", "foreignField": "resourceId", "as": "commentData"}}},
+		{{Key: "$project", Value: bson.M{
+			"likeCount":    bson.M{"$size": "$likeData"},
+			"commentCount": bson.M{"$size": "$commentData"},
+		}}},
+		{{Key: "$merge", Value: bson.M{"into": "resources", "whenMatched": "merge", "whenNotMatched": "discard"}}},
+	}
+	cursor, err := database.Collection("resources").Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Não foi possível preencher os contadores de 'resources': %v\n", err)
+		return
+	}
+	cursor.Close(ctx)
 }
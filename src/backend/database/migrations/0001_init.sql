@@ -0,0 +1,95 @@
+-- Esquema inicial do backend PostgreSQL. Os IDs são ObjectIDs em hexadecimal,
+-- para que os modelos sejam os mesmos usados pelo backend MongoDB.
+
+CREATE TABLE users (
+    id          CHAR(24) PRIMARY KEY,
+    name        TEXT NOT NULL,
+    email       TEXT NOT NULL UNIQUE,
+    password    TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    course      TEXT NOT NULL DEFAULT '',
+    faculty     TEXT NOT NULL DEFAULT '',
+    year_joined TEXT NOT NULL DEFAULT '',
+    bio         TEXT NOT NULL DEFAULT '',
+    avatar_url  TEXT NOT NULL DEFAULT '',
+    badges      TEXT[] NOT NULL DEFAULT '{}',
+    role        TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE courses (
+    id   CHAR(24) PRIMARY KEY,
+    code TEXT NOT NULL,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE professors (
+    id         CHAR(24) PRIMARY KEY,
+    name       TEXT NOT NULL,
+    avatar_url TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE tags (
+    id   CHAR(24) PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE resources (
+    id           CHAR(24) PRIMARY KEY,
+    user_id      CHAR(24) NOT NULL,
+    professor_id CHAR(24),
+    course_code  TEXT NOT NULL DEFAULT '',
+    course       TEXT NOT NULL DEFAULT '',
+    type         TEXT NOT NULL DEFAULT '',
+    file_name    TEXT NOT NULL DEFAULT '',
+    file_url     TEXT NOT NULL DEFAULT '',
+    upload_date  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    title        TEXT NOT NULL DEFAULT '',
+    description  TEXT NOT NULL DEFAULT '',
+    semester     TEXT NOT NULL DEFAULT '',
+    tags         TEXT[] NOT NULL DEFAULT '{}',
+    is_anonymous BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX resources_user_id_idx ON resources (user_id);
+CREATE INDEX resources_course_code_idx ON resources (course_code);
+
+CREATE TABLE comments (
+    id          CHAR(24) PRIMARY KEY,
+    resource_id CHAR(24) NOT NULL REFERENCES resources (id) ON DELETE CASCADE,
+    user_id     CHAR(24) NOT NULL,
+    parent_id   CHAR(24),
+    content     TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX comments_resource_id_idx ON comments (resource_id);
+
+CREATE TABLE likes (
+    id          CHAR(24) PRIMARY KEY,
+    user_id     CHAR(24) NOT NULL,
+    resource_id CHAR(24) NOT NULL REFERENCES resources (id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, resource_id)
+);
+
+CREATE TABLE comment_likes (
+    id         CHAR(24) PRIMARY KEY,
+    user_id    CHAR(24) NOT NULL,
+    comment_id CHAR(24) NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, comment_id)
+);
+
+CREATE TABLE notifications (
+    id          CHAR(24) PRIMARY KEY,
+    user_id     CHAR(24) NOT NULL,
+    actor_name  TEXT NOT NULL DEFAULT '',
+    type        TEXT NOT NULL,
+    message     TEXT NOT NULL DEFAULT '',
+    resource_id CHAR(24) NOT NULL,
+    comment_id  CHAR(24) NOT NULL,
+    is_read     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX notifications_user_id_created_at_idx ON notifications (user_id, created_at DESC);
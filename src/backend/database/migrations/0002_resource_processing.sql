@@ -0,0 +1,12 @@
+-- Estado do processamento assíncrono (extração de texto) e o texto extraído
+-- de cada recurso, uma entrada por página.
+
+ALTER TABLE resources
+    ADD COLUMN processing_status TEXT NOT NULL DEFAULT '',
+    ADD COLUMN processing_error  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN page_count        INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE resource_texts (
+    resource_id CHAR(24) PRIMARY KEY REFERENCES resources(id) ON DELETE CASCADE,
+    pages       TEXT[] NOT NULL DEFAULT '{}'
+);
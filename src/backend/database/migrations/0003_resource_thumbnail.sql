@@ -0,0 +1,3 @@
+-- URL do thumbnail gerado pelo processamento assíncrono do upload.
+
+ALTER TABLE resources ADD COLUMN thumbnail_url TEXT NOT NULL DEFAULT '';
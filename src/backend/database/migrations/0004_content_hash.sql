@@ -0,0 +1,12 @@
+-- Deduplicação por conteúdo: o SHA-256 de cada arquivo e a contagem de recursos
+-- que apontam para cada blob guardado.
+
+ALTER TABLE resources ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX resources_content_hash_idx ON resources (content_hash) WHERE content_hash <> '';
+
+CREATE TABLE blob_refs (
+    hash      TEXT PRIMARY KEY,
+    blob_key  TEXT NOT NULL,
+    ref_count BIGINT NOT NULL CHECK (ref_count >= 0)
+);
@@ -0,0 +1,16 @@
+-- Verificação de malware: o estado de cada recurso e o registro dos arquivos que
+-- foram para a quarentena.
+
+ALTER TABLE resources ADD COLUMN scan_status TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE quarantined_files (
+    id          CHAR(24) PRIMARY KEY,
+    blob_key    TEXT NOT NULL,
+    file_name   TEXT NOT NULL,
+    source      TEXT NOT NULL,
+    -- Sem chave estrangeira: o registro continua depois que o recurso ou o usuário sai.
+    resource_id CHAR(24),
+    user_id     CHAR(24),
+    signature   TEXT NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,19 @@
+-- Histórico de versões dos arquivos de cada recurso.
+
+ALTER TABLE resources ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE resource_versions (
+    id           CHAR(24) PRIMARY KEY,
+    resource_id  CHAR(24) NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+    version      INTEGER NOT NULL,
+    user_id      CHAR(24) NOT NULL,
+    file_name    TEXT NOT NULL,
+    file_url     TEXT NOT NULL,
+    content_hash TEXT NOT NULL DEFAULT '',
+    scan_status  TEXT NOT NULL,
+    note         TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    UNIQUE (resource_id, version)
+);
+
+CREATE INDEX resource_versions_scanning_idx ON resource_versions (scan_status) WHERE scan_status = 'scanning';
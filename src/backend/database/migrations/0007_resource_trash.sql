@@ -0,0 +1,5 @@
+-- Lixeira: recursos apagados pelo dono ficam marcados até o prazo de retenção.
+
+ALTER TABLE resources ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX resources_deleted_at_idx ON resources (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,30 @@
+-- Moderação de comentários: edição com histórico, remoção que mantém o lugar na
+-- árvore e denúncias para a fila dos admins.
+
+ALTER TABLE comments ADD COLUMN edited_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE TABLE comment_edits (
+    id         CHAR(24) PRIMARY KEY,
+    comment_id CHAR(24) NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    content    TEXT NOT NULL,
+    edited_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX comment_edits_comment_id_idx ON comment_edits (comment_id, edited_at);
+
+CREATE TABLE comment_reports (
+    id          CHAR(24) PRIMARY KEY,
+    comment_id  CHAR(24) NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    resource_id CHAR(24) NOT NULL,
+    reporter_id CHAR(24) NOT NULL,
+    reason      TEXT NOT NULL DEFAULT '',
+    content     TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL DEFAULT 'open',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by CHAR(24),
+    UNIQUE (comment_id, reporter_id)
+);
+
+CREATE INDEX comment_reports_status_idx ON comment_reports (status, created_at);
@@ -0,0 +1,48 @@
+-- Fila de moderação genérica (recursos, comentários e usuários), decisões dos admins
+-- e as ações que elas aplicam: esconder recursos e suspender contas.
+
+CREATE TABLE reports (
+    id          CHAR(24) PRIMARY KEY,
+    target_type TEXT NOT NULL,
+    target_id   CHAR(24) NOT NULL,
+    owner_id    CHAR(24) NOT NULL,
+    resource_id CHAR(24),
+    reporter_id CHAR(24) NOT NULL,
+    reason      TEXT NOT NULL,
+    details     TEXT NOT NULL DEFAULT '',
+    content     TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL DEFAULT 'open',
+    action      TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by CHAR(24),
+    UNIQUE (target_type, target_id, reporter_id)
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+
+-- As denúncias de comentário de antes entram na fila nova; o motivo livre vira details.
+INSERT INTO reports (id, target_type, target_id, owner_id, resource_id, reporter_id, reason, details, content,
+                     status, action, created_at, resolved_at, resolved_by)
+SELECT cr.id, 'comment', cr.comment_id, c.user_id, cr.resource_id, cr.reporter_id, 'other', cr.reason, cr.content,
+       cr.status, CASE WHEN cr.status = 'actioned' THEN 'delete' ELSE '' END, cr.created_at, cr.resolved_at, cr.resolved_by
+FROM comment_reports cr
+JOIN comments c ON c.id = cr.comment_id;
+
+DROP TABLE comment_reports;
+
+CREATE TABLE moderation_actions (
+    id          CHAR(24) PRIMARY KEY,
+    admin_id    CHAR(24) NOT NULL,
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id   CHAR(24) NOT NULL,
+    report_id   CHAR(24),
+    note        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX moderation_actions_target_idx ON moderation_actions (target_id, created_at DESC);
+
+ALTER TABLE resources ADD COLUMN hidden_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMPTZ;
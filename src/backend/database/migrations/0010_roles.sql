@@ -0,0 +1,6 @@
+-- Papéis: contas antigas ("" ou "user") viram estudantes, e monitores e curadores
+-- guardam as disciplinas em que atuam.
+
+UPDATE users SET role = 'student' WHERE role IN ('', 'user');
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'student';
+ALTER TABLE users ADD COLUMN role_courses TEXT[] NOT NULL DEFAULT '{}';
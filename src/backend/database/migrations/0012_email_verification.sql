@@ -0,0 +1,16 @@
+-- Confirmação de e-mail no cadastro. As contas que já existiam valem como confirmadas.
+
+ALTER TABLE users ADD COLUMN email_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Tokens de uso único mandados por e-mail; só o hash fica guardado.
+CREATE TABLE user_tokens (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose    TEXT NOT NULL,
+    hash       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX user_tokens_user_idx ON user_tokens (user_id, purpose);
@@ -0,0 +1,14 @@
+-- Estado do limitador de requisições compartilhado entre as instâncias
+-- (RATE_LIMIT_BACKEND=database): baldes de fichas e bloqueios de login.
+
+CREATE TABLE rate_limits (
+    key          TEXT PRIMARY KEY,
+    tokens       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    failures     INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    version      BIGINT NOT NULL
+);
+
+CREATE INDEX rate_limits_expires_idx ON rate_limits (expires_at);
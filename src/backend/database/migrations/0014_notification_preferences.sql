@@ -0,0 +1,14 @@
+-- Preferências de notificação: canais por tipo, horário de silêncio e resumo por
+-- e-mail. Quem nunca mexeu nelas não tem linha e segue os padrões.
+
+CREATE TABLE notification_preferences (
+    user_id        TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    types          JSONB NOT NULL DEFAULT '{}',
+    quiet_hours    JSONB,
+    digest         TEXT NOT NULL DEFAULT 'off',
+    digest_courses TEXT[] NOT NULL DEFAULT '{}',
+    last_digest_at TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX notification_preferences_digest_idx ON notification_preferences (digest) WHERE digest <> 'off';
@@ -0,0 +1,10 @@
+-- Caixa de notificações: data de leitura (para apagar as lidas antigas) e
+-- arquivamento. As já lidas contam como lidas na data de criação.
+
+ALTER TABLE notifications ADD COLUMN read_at TIMESTAMPTZ;
+ALTER TABLE notifications ADD COLUMN archived_at TIMESTAMPTZ;
+
+UPDATE notifications SET read_at = created_at WHERE is_read;
+
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE NOT is_read;
+CREATE INDEX notifications_read_at_idx ON notifications (read_at) WHERE is_read;
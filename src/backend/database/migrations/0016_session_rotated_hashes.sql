@@ -0,0 +1,4 @@
+-- Hashes dos refresh tokens já trocados, para distinguir a reutilização de um token
+-- copiado de um token qualquer inválido.
+
+ALTER TABLE sessions ADD COLUMN rotated_hashes TEXT[] NOT NULL DEFAULT '{}';
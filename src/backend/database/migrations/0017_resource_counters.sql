@@ -0,0 +1,12 @@
+-- Contadores de likes e comentários guardados no próprio recurso, para a listagem
+-- ordenar por eles com índice em vez de contar tudo a cada página.
+
+ALTER TABLE resources ADD COLUMN like_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE resources ADD COLUMN comment_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE resources r SET
+    like_count = (SELECT COUNT(*) FROM likes l WHERE l.resource_id = r.id),
+    comment_count = (SELECT COUNT(*) FROM comments c WHERE c.resource_id = r.id);
+
+CREATE INDEX resources_like_count_idx ON resources (like_count DESC, id COLLATE "C" DESC);
+CREATE INDEX resources_comment_count_idx ON resources (comment_count DESC, id COLLATE "C" DESC);
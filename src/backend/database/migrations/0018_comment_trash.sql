@@ -0,0 +1,6 @@
+-- Comentários que o autor mandou para a lixeira: aparecem como apagados, mas o texto
+-- fica guardado até serem restaurados ou o prazo da lixeira vencer.
+
+ALTER TABLE comments ADD COLUMN trashed BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX comments_trashed_idx ON comments (deleted_at) WHERE trashed;
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// InitPostgres conecta ao PostgreSQL em url e aplica as migrações pendentes.
+func InitPostgres(url string) *sql.DB {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		log.Fatal("Erro ao abrir conexão com o PostgreSQL:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		log.Fatal("Não foi possível pingar o PostgreSQL:", err)
+	}
+
+	log.Println("Conectado ao PostgreSQL com sucesso!")
+
+	if err := MigratePostgres(db); err != nil {
+		log.Fatal("Erro ao aplicar migrações do PostgreSQL:", err)
+	}
+	return db
+}
+
+// MigratePostgres aplica, em ordem, os arquivos de migrations/ que ainda não constam
+// em schema_migrations. Cada arquivo roda dentro de sua própria transação.
+func MigratePostgres(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		version := entry.Name()
+
+		var applied bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrationFiles.ReadFile("migrations/" + version)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migração %s: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Migração %s aplicada.", version)
+	}
+	return nil
+}
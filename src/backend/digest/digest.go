@@ -0,0 +1,190 @@
+// Package digest manda os resumos periódicos por e-mail: as notificações ainda não
+// lidas e os materiais novos nas disciplinas que o usuário acompanha, para quem
+// assinou um resumo diário ou semanal nas preferências de notificação.
+package digest
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"uspshare/mail"
+	"uspshare/models"
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxResourcesPerCourse limita quantos materiais novos de cada disciplina entram
+// num resumo; o resto fica como "e mais N".
+const maxResourcesPerCourse = 10
+
+// Sender manda os resumos vencidos.
+type Sender struct {
+	store  *store.Store
+	mailer mail.Mailer
+	appURL string
+	now    func() time.Time
+}
+
+func NewSender(s *store.Store, mailer mail.Mailer, appURL string) *Sender {
+	return &Sender{store: s, mailer: mailer, appURL: strings.TrimRight(appURL, "/"), now: time.Now}
+}
+
+// Period é o intervalo entre dois resumos da frequência, ou zero para DigestOff.
+func Period(frequency string) time.Duration {
+	switch frequency {
+	case models.DigestDaily:
+		return 24 * time.Hour
+	case models.DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Send manda os resumos vencidos e devolve quantos e-mails saíram. Um resumo sem
+// nada de novo não é mandado, mas conta como feito. Quem está no horário de silêncio
+// e os envios que falham ficam para a próxima rodada.
+func (d *Sender) Send() (int, error) {
+	subscribers, err := d.store.Preferences.ListDigestSubscribers()
+	if err != nil {
+		return 0, err
+	}
+	now := d.now()
+	sent := 0
+	for i := range subscribers {
+		prefs := &subscribers[i]
+		period := Period(prefs.Digest)
+		if period == 0 || (prefs.LastDigestAt != nil && now.Sub(*prefs.LastDigestAt) < period) {
+			continue
+		}
+		if prefs.QuietHours.Quiet(now) {
+			continue
+		}
+		ok, err := d.sendOne(prefs, now.Add(-period), now)
+		if err != nil {
+			log.Printf("Erro ao mandar o resumo de %s: %v", prefs.UserID.Hex(), err)
+			continue
+		}
+		if err := d.store.Preferences.SetLastDigest(prefs.UserID, now); err != nil {
+			log.Printf("Erro ao registrar o resumo de %s: %v", prefs.UserID.Hex(), err)
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendOne monta e manda o resumo do usuário com o que aconteceu desde o último (ou
+// desde fallback, no primeiro). Devolve false se não havia nada para mandar.
+func (d *Sender) sendOne(prefs *models.NotificationPreferences, fallback, now time.Time) (bool, error) {
+	since := fallback
+	if prefs.LastDigestAt != nil {
+		since = *prefs.LastDigestAt
+	}
+	user, err := d.store.Users.GetUserByID(prefs.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	unread, err := d.unreadSince(prefs.UserID, since)
+	if err != nil {
+		return false, err
+	}
+
+	var b strings.Builder
+	if len(unread) > 0 {
+		fmt.Fprintf(&b, "Notificações não lidas (%d):\n\n", len(unread))
+		for _, n := range unread {
+			fmt.Fprintf(&b, "- %s\n", n.Text())
+		}
+		b.WriteString("\n")
+	}
+	uploads := 0
+	for _, code := range prefs.DigestCourses {
+		page, err := d.store.Resources.SearchResources(store.ResourceQuery{
+			CourseCode: code,
+			From:       since,
+			To:         now,
+			Sort:       store.SortNewest,
+			Limit:      maxResourcesPerCourse,
+		})
+		if err != nil {
+			return false, err
+		}
+		var items []models.ResourceWithDetails
+		for _, res := range page.Items {
+			if res.UserID != user.ID {
+				items = append(items, res)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		uploads += len(items)
+		fmt.Fprintf(&b, "Materiais novos em %s:\n\n", code)
+		for _, res := range items {
+			fmt.Fprintf(&b, "- %s: %s/file/%s\n", res.Title, d.appURL, res.ID.Hex())
+		}
+		if more := page.Total - int64(len(page.Items)); more > 0 {
+			fmt.Fprintf(&b, "- e mais %d\n", more)
+		}
+		b.WriteString("\n")
+	}
+	if len(unread) == 0 && uploads == 0 {
+		return false, nil
+	}
+
+	title := "Seu resumo diário do USPShare"
+	if prefs.Digest == models.DigestWeekly {
+		title = "Seu resumo semanal do USPShare"
+	}
+	body := "Olá, " + user.Name + "!\n\n" + b.String() +
+		"Para mudar ou cancelar o resumo, acesse suas preferências de notificação no perfil.\n"
+	if err := d.mailer.Send(mail.Message{To: user.Email, Subject: title, Body: body}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unreadSince devolve as notificações não lidas da caixa de entrada criadas depois
+// de since, das mais recentes para as mais antigas.
+func (d *Sender) unreadSince(userID primitive.ObjectID, since time.Time) ([]models.Notification, error) {
+	unread := false
+	query := store.NotificationQuery{Read: &unread, Limit: store.MaxNotificationLimit}
+	var items []models.Notification
+	for {
+		page, err := d.store.Notifications.ListNotifications(userID, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range page.Items {
+			if !n.CreatedAt.After(since) {
+				return items, nil
+			}
+			items = append(items, n)
+		}
+		if page.Next == "" {
+			return items, nil
+		}
+		query.Cursor = page.Next
+	}
+}
+
+// Start roda Send a cada interval numa goroutine própria.
+func (d *Sender) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sent, err := d.Send()
+			if err != nil {
+				log.Printf("Erro ao mandar os resumos por e-mail: %v", err)
+			} else if sent > 0 {
+				log.Printf("%d resumos foram mandados por e-mail", sent)
+			}
+		}
+	}()
+}
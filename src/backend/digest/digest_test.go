@@ -0,0 +1,125 @@
+package digest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"uspshare/mail"
+	"uspshare/models"
+	"uspshare/store"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *testMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestSender(t *testing.T) {
+	s := store.NewMemoryStore()
+	mailer := &testMailer{}
+	d := NewSender(s, mailer, "http://app.test/")
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	newUser := func(name, email string) *models.User {
+		u := &models.User{Name: name, Email: email, Password: "senha123"}
+		assert.NoError(t, s.Users.CreateUser(u))
+		return u
+	}
+	ana := newUser("Ana", "ana@usp.br")
+	bia := newUser("Bia", "bia@usp.br")
+	caio := newUser("Caio", "caio@usp.br")
+
+	notify := func(userID primitive.ObjectID, read bool, at time.Time) {
+		n := &models.Notification{ID: primitive.NewObjectID(), UserID: userID, ActorName: "Bia",
+			Type: models.NotificationLike, Message: "curtiu seu material 'P1'.", IsRead: read, CreatedAt: at}
+		assert.NoError(t, s.Notifications.CreateNotification(n))
+	}
+	notify(ana.ID, false, now.Add(-time.Hour))
+	notify(ana.ID, true, now.Add(-time.Hour))
+	notify(ana.ID, false, now.Add(-48*time.Hour))
+
+	upload := func(userID primitive.ObjectID, title string, at time.Time) {
+		res := &models.Resource{ID: primitive.NewObjectID(), UserID: userID, Title: title, CourseCode: "MAC0110",
+			ScanStatus: models.ScanClean, UploadDate: at}
+		assert.NoError(t, s.Resources.CreateResource(res))
+	}
+	upload(bia.ID, "Lista 3", now.Add(-2*time.Hour))
+	upload(ana.ID, "Minha lista", now.Add(-2*time.Hour))
+	upload(bia.ID, "Lista antiga", now.Add(-72*time.Hour))
+
+	daily := models.DefaultNotificationPreferences(ana.ID)
+	daily.Digest = models.DigestDaily
+	daily.DigestCourses = []string{"MAC0110"}
+	assert.NoError(t, s.Preferences.SaveNotificationPreferences(daily))
+
+	// Caio assina o resumo, mas não tem nada de novo.
+	weekly := models.DefaultNotificationPreferences(caio.ID)
+	weekly.Digest = models.DigestWeekly
+	assert.NoError(t, s.Preferences.SaveNotificationPreferences(weekly))
+
+	sent, err := d.Send()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, mailer.sent, 1) {
+		msg := mailer.sent[0]
+		assert.Equal(t, "ana@usp.br", msg.To)
+		assert.Equal(t, "Seu resumo diário do USPShare", msg.Subject)
+		assert.Contains(t, msg.Body, "Notificações não lidas (1)")
+		assert.Contains(t, msg.Body, "Bia curtiu seu material 'P1'.")
+		assert.Contains(t, msg.Body, "Lista 3: http://app.test/file/")
+		assert.NotContains(t, msg.Body, "Minha lista", "Os próprios uploads não entram")
+		assert.NotContains(t, msg.Body, "Lista antiga")
+	}
+	for _, id := range []primitive.ObjectID{ana.ID, caio.ID} {
+		prefs, _ := s.Preferences.GetNotificationPreferences(id)
+		if assert.NotNil(t, prefs.LastDigestAt, "Um resumo vazio também conta como feito") {
+			assert.True(t, now.Equal(*prefs.LastDigestAt))
+		}
+	}
+
+	// Antes do próximo período nada sai; depois, só o que chegou desde o último.
+	now = now.Add(12 * time.Hour)
+	sent, _ = d.Send()
+	assert.Equal(t, 0, sent)
+
+	now = now.Add(13 * time.Hour)
+	notify(ana.ID, false, now.Add(-time.Hour))
+	sent, _ = d.Send()
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, mailer.sent, 2) {
+		assert.Contains(t, mailer.sent[1].Body, "Notificações não lidas (1)")
+		assert.NotContains(t, mailer.sent[1].Body, "Lista 3")
+	}
+
+	// No horário de silêncio o resumo espera.
+	now = now.Add(25 * time.Hour)
+	notify(ana.ID, false, now.Add(-time.Hour))
+	daily, _ = s.Preferences.GetNotificationPreferences(ana.ID)
+	daily.QuietHours = &models.QuietHours{Start: "14:00", End: "18:00", TimeZone: "UTC"}
+	assert.NoError(t, s.Preferences.SaveNotificationPreferences(daily))
+	sent, _ = d.Send()
+	assert.Equal(t, 0, sent)
+	now = now.Add(4 * time.Hour)
+	sent, _ = d.Send()
+	assert.Equal(t, 1, sent)
+	assert.True(t, strings.HasPrefix(mailer.sent[2].Body, "Olá, Ana!"))
+}
+
+func TestPeriod(t *testing.T) {
+	assert.Equal(t, 24*time.Hour, Period(models.DigestDaily))
+	assert.Equal(t, 7*24*time.Hour, Period(models.DigestWeekly))
+	assert.Equal(t, time.Duration(0), Period(models.DigestOff))
+}
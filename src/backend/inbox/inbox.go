@@ -0,0 +1,43 @@
+// Package inbox apaga as notificações lidas que passaram do prazo de retenção, para a
+// caixa de cada usuário não crescer para sempre.
+package inbox
+
+import (
+	"log"
+	"time"
+
+	"uspshare/store"
+)
+
+// Expirer apaga as notificações lidas vencidas.
+type Expirer struct {
+	notifications store.NotificationStore
+	retention     time.Duration
+	now           func() time.Time
+}
+
+func NewExpirer(notifications store.NotificationStore, retention time.Duration) *Expirer {
+	return &Expirer{notifications: notifications, retention: retention, now: time.Now}
+}
+
+// Expire apaga as notificações lidas há mais que o prazo de retenção e devolve
+// quantas saíram. As não lidas ficam, por mais antigas que sejam.
+func (e *Expirer) Expire() (int64, error) {
+	return e.notifications.DeleteReadNotificationsBefore(e.now().Add(-e.retention))
+}
+
+// Start roda Expire a cada interval numa goroutine própria.
+func (e *Expirer) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expired, err := e.Expire()
+			if err != nil {
+				log.Printf("Erro ao apagar as notificações lidas antigas: %v", err)
+			} else if expired > 0 {
+				log.Printf("%d notificações lidas antigas foram apagadas", expired)
+			}
+		}
+	}()
+}
@@ -0,0 +1,37 @@
+package inbox
+
+import (
+	"testing"
+	"time"
+
+	"uspshare/models"
+	"uspshare/store"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExpirer(t *testing.T) {
+	s := store.NewMemoryStore()
+	e := NewExpirer(s.Notifications, 30*24*time.Hour)
+	now := time.Now()
+	e.now = func() time.Time { return now }
+
+	userID := primitive.NewObjectID()
+	notify := func(created time.Time, readAt *time.Time) {
+		n := &models.Notification{ID: primitive.NewObjectID(), UserID: userID, Type: models.NotificationLike,
+			CreatedAt: created, IsRead: readAt != nil, ReadAt: readAt}
+		assert.NoError(t, s.Notifications.CreateNotification(n))
+	}
+	old, recent := now.Add(-40*24*time.Hour), now.Add(-time.Hour)
+	notify(old, &old)
+	notify(old, &recent)
+	notify(old, nil)
+
+	expired, err := e.Expire()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+
+	page, _ := s.Notifications.ListNotifications(userID, store.NotificationQuery{})
+	assert.Len(t, page.Items, 2, "A lida há pouco e a não lida ficam")
+}
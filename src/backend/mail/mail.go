@@ -0,0 +1,63 @@
+// Package mail manda os e-mails do servidor, como o link de confirmação do
+// cadastro. O driver de produção fala SMTP; em desenvolvimento e nos testes as
+// mensagens vão para o log, para um arquivo ou para uma caixa Maildir local. Quem
+// usa o pacote só conhece a interface Mailer.
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message é um e-mail de texto simples.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer entrega mensagens. Um erro significa que a mensagem não saiu.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer escreve as mensagens no log em vez de mandá-las. É o driver padrão em
+// desenvolvimento: o link de confirmação aparece no terminal do servidor.
+type LogMailer struct{}
+
+func (LogMailer) Send(msg Message) error {
+	log.Printf("E-mail para %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer acrescenta as mensagens a um arquivo, uma depois da outra, para serem
+// lidas por quem testa o cadastro sem um servidor SMTP.
+type FileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{path: path}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package mail
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileMailerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFileMailer(path)
+	for _, to := range []string{"ana@usp.br", "bia@usp.br"} {
+		if err := m.Send(Message{To: to, Subject: "Confirme seu e-mail", Body: "Link: http://x/verify"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: ana@usp.br", "To: bia@usp.br", "Link: http://x/verify"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("arquivo sem %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	m, err := NewSMTPMailer(SMTPConfig{
+		Host: "smtp.usp.br", Port: 587, Username: "uspshare", Password: "segredo",
+		From: "USPShare <nao-responda@uspshare.com.br>",
+	})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: %v", err)
+	}
+
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	m.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if a == nil {
+			t.Error("com usuário, a conexão deveria autenticar")
+		}
+		gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+		return nil
+	}
+	err = m.Send(Message{To: "Ana <ana@usp.br>", Subject: "Confirmação de e-mail", Body: "Olá, Ana!\nConfirme aqui."})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if gotAddr != "smtp.usp.br:587" || gotFrom != "nao-responda@uspshare.com.br" || len(gotTo) != 1 || gotTo[0] != "ana@usp.br" {
+		t.Errorf("envelope = %s %s %v", gotAddr, gotFrom, gotTo)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(string(gotMsg)))
+	if err != nil {
+		t.Fatalf("mensagem malformada: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Confirmação de e-mail" {
+		t.Errorf("Subject = %q", subject)
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if string(body) != "Olá, Ana!\r\nConfirme aqui." {
+		t.Errorf("corpo = %q", body)
+	}
+}
+
+func TestSMTPMailerErrors(t *testing.T) {
+	if _, err := NewSMTPMailer(SMTPConfig{Port: 25, From: "a@b.c"}); err == nil {
+		t.Error("sem host deveria falhar")
+	}
+	if _, err := NewSMTPMailer(SMTPConfig{Host: "localhost", Port: 25, From: "não é endereço"}); err == nil {
+		t.Error("remetente inválido deveria falhar")
+	}
+
+	m, _ := NewSMTPMailer(SMTPConfig{Host: "localhost", Port: 25, From: "a@b.c"})
+	if m.auth != nil {
+		t.Error("sem usuário, a conexão não autentica")
+	}
+	m.send = func(string, smtp.Auth, string, []string, []byte) error { return errors.New("conexão recusada") }
+	if err := m.Send(Message{To: "ana@usp.br"}); err == nil {
+		t.Error("o erro do servidor deveria voltar")
+	}
+}
+
+func TestMaildirMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mailbox")
+	m, err := NewMaildirMailer(dir, "USPShare <nao-responda@localhost>")
+	if err != nil {
+		t.Fatalf("NewMaildirMailer: %v", err)
+	}
+	for _, to := range []string{"ana@usp.br", "bia@usp.br"} {
+		if err := m.Send(Message{To: to, Subject: "Seu resumo semanal", Body: "3 notificações não lidas"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if err := m.Send(Message{To: "sem arroba", Subject: "x"}); err == nil {
+		t.Error("destinatário inválido deveria falhar")
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "new"))
+	if len(entries) != 2 {
+		t.Fatalf("new tem %d mensagens, want 2", len(entries))
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Errorf("tmp deveria ficar vazio, tem %d arquivos", len(tmp))
+	}
+	f, err := os.Open(filepath.Join(dir, "new", entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	parsed, err := netmail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("a mensagem deveria ser um e-mail válido: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Seu resumo semanal" || !strings.Contains(parsed.Header.Get("From"), "nao-responda@localhost") {
+		t.Errorf("cabeçalhos = %v", parsed.Header)
+	}
+}
+
+// slowMailer demora para mandar, como um servidor SMTP lento.
+type slowMailer struct {
+	delay time.Duration
+	mu    sync.Mutex
+	sent  []string
+}
+
+func (m *slowMailer) Send(msg Message) error {
+	time.Sleep(m.delay)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg.To)
+	return nil
+}
+
+func (m *slowMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+func TestQueue(t *testing.T) {
+	m := &slowMailer{delay: 50 * time.Millisecond}
+	q := NewQueue(m, 2)
+
+	start := time.Now()
+	for _, to := range []string{"ana@usp.br", "bia@usp.br", "caio@usp.br"} {
+		if err := q.Send(Message{To: to}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= m.delay {
+		t.Errorf("Send esperou o envio (%s)", elapsed)
+	}
+	q.Wait()
+	if n := m.count(); n != 3 {
+		t.Errorf("%d mensagens saíram, want 3", n)
+	}
+
+	// A marcada para depois não sai antes da hora nem segura Wait.
+	q.SendAt(Message{To: "depois@usp.br"}, time.Now().Add(200*time.Millisecond))
+	q.Wait()
+	if n := m.count(); n != 3 {
+		t.Errorf("a mensagem marcada saiu antes da hora")
+	}
+	time.Sleep(300 * time.Millisecond)
+	q.Wait()
+	if n := m.count(); n != 4 {
+		t.Errorf("%d mensagens saíram, want 4", n)
+	}
+}
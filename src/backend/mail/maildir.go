@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"fmt"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// MaildirMailer entrega cada mensagem como um arquivo num diretório no formato
+// Maildir (tmp, new e cur), que clientes como o mutt e o Thunderbird abrem como uma
+// caixa de entrada local. Serve para ver em desenvolvimento os e-mails como eles
+// sairiam pelo SMTP, resumos incluídos.
+type MaildirMailer struct {
+	dir  string
+	from *netmail.Address
+	seq  uint64
+}
+
+func NewMaildirMailer(dir, from string) (*MaildirMailer, error) {
+	sender, err := netmail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid sender %q: %w", from, err)
+	}
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, fmt.Errorf("mail: %w", err)
+		}
+	}
+	return &MaildirMailer{dir: dir, from: sender}, nil
+}
+
+func (m *MaildirMailer) Send(msg Message) error {
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("mail: invalid recipient %q: %w", msg.To, err)
+	}
+	data, err := formatMessage(m.from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	// A mensagem é escrita em tmp e só depois movida para new, para um leitor nunca
+	// ver um arquivo pela metade.
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.uspshare", now.Unix(), now.Nanosecond()/1000, os.Getpid(), atomic.AddUint64(&m.seq, 1))
+	tmp := filepath.Join(m.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(m.dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
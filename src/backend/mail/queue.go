@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultQueueWorkers é quantos e-mails uma Queue manda ao mesmo tempo.
+const DefaultQueueWorkers = 4
+
+// Queue manda as mensagens em segundo plano, para quem pede o envio não esperar o
+// servidor de e-mail. Uma mensagem com data marcada (SendAt) espera até ela; as que
+// ainda esperam quando o processo termina se perdem. Os erros de envio vão para o
+// log.
+type Queue struct {
+	mailer Mailer
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	inflight int
+	idle     *sync.Cond
+}
+
+func NewQueue(m Mailer, workers int) *Queue {
+	if workers <= 0 {
+		workers = DefaultQueueWorkers
+	}
+	q := &Queue{mailer: m, slots: make(chan struct{}, workers)}
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+// Send põe a mensagem na fila para sair assim que possível. Nunca falha: o erro do
+// envio só aparece no log.
+func (q *Queue) Send(msg Message) error {
+	q.SendAt(msg, time.Time{})
+	return nil
+}
+
+// SendAt põe a mensagem na fila para sair a partir de at.
+func (q *Queue) SendAt(msg Message, at time.Time) {
+	if wait := time.Until(at); wait > 0 {
+		time.AfterFunc(wait, func() { q.start(msg) })
+		return
+	}
+	q.start(msg)
+}
+
+func (q *Queue) start(msg Message) {
+	q.mu.Lock()
+	q.inflight++
+	q.mu.Unlock()
+	go func() {
+		q.slots <- struct{}{}
+		defer func() {
+			<-q.slots
+			q.mu.Lock()
+			q.inflight--
+			if q.inflight == 0 {
+				q.idle.Broadcast()
+			}
+			q.mu.Unlock()
+		}()
+		if err := q.mailer.Send(msg); err != nil {
+			log.Printf("Erro ao mandar o e-mail '%s' para %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// Wait espera as mensagens que já deviam ter saído terminarem de sair. As marcadas
+// para mais tarde não entram.
+func (q *Queue) Wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.inflight > 0 {
+		q.idle.Wait()
+	}
+}
@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig descreve o servidor de saída. Sem Username, a conexão é feita sem
+// autenticação (ex.: um relay interno).
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From é o remetente, ex.: "USPShare <nao-responda@uspshare.com.br>".
+	From string
+}
+
+// SMTPMailer manda as mensagens por SMTP. net/smtp usa STARTTLS sempre que o
+// servidor oferece, e só aceita autenticação em conexões cifradas ou locais.
+type SMTPMailer struct {
+	addr string
+	from *netmail.Address
+	auth smtp.Auth
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("mail: missing SMTP host")
+	}
+	if cfg.Port <= 0 {
+		return nil, fmt.Errorf("mail: invalid SMTP port %d", cfg.Port)
+	}
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid sender %q: %w", cfg.From, err)
+	}
+	m := &SMTPMailer{
+		addr: cfg.Host + ":" + strconv.Itoa(cfg.Port),
+		from: from,
+		send: smtp.SendMail,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	to, err := netmail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("mail: invalid recipient %q: %w", msg.To, err)
+	}
+	body, err := formatMessage(m.from, to, msg)
+	if err != nil {
+		return err
+	}
+	if err := m.send(m.addr, m.auth, m.from.Address, []string{to.Address}, body); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return nil
+}
+
+// formatMessage monta a mensagem em UTF-8, com o assunto codificado e o corpo em
+// quoted-printable, para os acentos chegarem inteiros.
+func formatMessage(from, to *netmail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,10 +1,27 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 	"uspshare/api"
+	"uspshare/blob"
+	"uspshare/config"
 	"uspshare/database"
+	"uspshare/digest"
+	"uspshare/inbox"
+	"uspshare/mail"
+	"uspshare/processing"
+	"uspshare/ratelimit"
+	"uspshare/resumable"
+	"uspshare/scan"
+	"uspshare/search"
+	"uspshare/store"
+	"uspshare/trash"
+	"uspshare/validation"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,38 +29,217 @@ import (
 )
 
 func main() {
-	database.InitDB()
+	checkIntegrity := flag.Bool("check-integrity", false, "procura documentos órfãos no banco e sai")
+	repair := flag.Bool("repair", false, "com -check-integrity, apaga os órfãos encontrados")
+	printConfig := flag.Bool("print-config", false, "mostra a configuração final, sem os segredos, e sai")
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := config.LoadDotEnv(".env"); err != nil {
+		log.Fatalf("Não foi possível ler o .env: %v", err)
+	}
+	cfg, err := config.Load(*flags, os.Environ())
+	if *printConfig {
+		os.Exit(runPrintConfig(cfg, err))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.GeneratedSecret() {
+		log.Println("Aviso: JWT_SECRET não definido; usando um segredo aleatório, e os tokens deixam de valer quando o servidor reiniciar.")
+	}
+
+	var s *store.Store
+	switch cfg.Database.Backend {
+	case "mongo":
+		s = store.NewMongoStore(database.InitDB(string(cfg.Database.MongoURI), cfg.Database.MongoDatabase))
+	case "postgres":
+		s = store.NewPostgresStore(database.InitPostgres(string(cfg.Database.PostgresURL)))
+	}
+	if *checkIntegrity {
+		os.Exit(runIntegrityCheck(s, *repair))
+	}
+
+	idx := search.NewIndex()
+	if err := search.RebuildFromStore(idx, s.Resources); err != nil {
+		log.Fatalf("Não foi possível montar o índice de busca: %v", err)
+	}
+
+	jwtSecret := []byte(cfg.Auth.JWTSecret)
+	var blobs blob.Store
+	switch cfg.Blob.Driver {
+	case "local":
+		blobs = blob.NewLocalStore(cfg.Blob.LocalDir, jwtSecret)
+	case "s3":
+		s3, err := blob.NewS3Store(blob.S3Config{
+			Endpoint:  cfg.Blob.S3Endpoint,
+			Bucket:    cfg.Blob.S3Bucket,
+			Region:    cfg.Blob.S3Region,
+			AccessKey: string(cfg.Blob.S3AccessKey),
+			SecretKey: string(cfg.Blob.S3SecretKey),
+		})
+		if err != nil {
+			log.Fatalf("Configuração do S3 inválida: %v", err)
+		}
+		blobs = s3
+	}
+
+	scanner := scan.FromAddress(cfg.ClamdAddress)
+
+	pipeline := processing.NewPipeline(s, idx, blobs, scanner)
+	pipeline.Start(2)
+	if err := pipeline.Resume(); err != nil {
+		log.Printf("Aviso: não foi possível retomar o processamento pendente: %v", err)
+	}
+	pipeline.StartResume(5 * time.Minute)
+
+	uploads, err := resumable.NewManager(cfg.Uploads.PartialDir, 24*time.Hour)
+	if err != nil {
+		log.Fatalf("Não foi possível preparar o diretório de uploads retomáveis: %v", err)
+	}
+	uploads.StartCleanup(time.Hour)
+
+	retention := cfg.TrashRetention()
+	trash.NewPurger(s, blobs, retention).Start(time.Hour)
+	inbox.NewExpirer(s.Notifications, cfg.ReadNotificationRetention()).Start(time.Hour)
+
+	h := api.NewHandler(s, idx, pipeline, blobs, uploads, scanner)
+	policy, err := uploadPolicy(cfg.Uploads)
+	if err != nil {
+		log.Fatalf("Política de upload inválida: %v", err)
+	}
+	h.SetUploadPolicy(policy)
+	h.SetTrashRetention(retention)
+	h.SetJWTSecret(jwtSecret)
+	h.SetSessionTTLs(cfg.Auth.AccessTokenTTL.Duration, cfg.Auth.RefreshTokenTTL.Duration)
+
+	var mailer mail.Mailer
+	switch cfg.Mail.Driver {
+	case "log":
+		mailer = mail.LogMailer{}
+	case "file":
+		mailer = mail.NewFileMailer(cfg.Mail.File)
+	case "maildir":
+		maildir, err := mail.NewMaildirMailer(cfg.Mail.Dir, cfg.Mail.From)
+		if err != nil {
+			log.Fatalf("Não foi possível preparar a caixa Maildir: %v", err)
+		}
+		mailer = maildir
+	case "smtp":
+		smtp, err := mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: string(cfg.Mail.SMTPPassword),
+			From:     cfg.Mail.From,
+		})
+		if err != nil {
+			log.Fatalf("Configuração do SMTP inválida: %v", err)
+		}
+		mailer = smtp
+	}
+	h.SetMailer(mailer, cfg.Server.AppURL)
+	h.SetEmailDomains(cfg.Auth.AllowedEmailDomains)
+	h.SetVerificationTTL(cfg.Auth.EmailVerificationTTL.Duration)
+	h.SetPasswordResetTTL(cfg.Auth.PasswordResetTTL.Duration)
+
+	digest.NewSender(s, mailer, cfg.Server.AppURL).Start(cfg.Digest.Interval.Duration)
+
+	var limits ratelimit.Backend = ratelimit.NewMemory()
+	if cfg.RateLimit.Backend == "database" {
+		limits = ratelimit.NewShared(s.RateLimits)
+	}
+	h.SetRateLimits(limits, api.RateLimits{
+		Auth:   cfg.RateLimit.Auth,
+		Write:  cfg.RateLimit.Write,
+		Upload: cfg.RateLimit.Upload,
+	}, cfg.LockoutPolicy())
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins:   cfg.Server.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Last-Event-ID"},
+		ExposedHeaders:   []string{"Link", "Location", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Expires", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	fileServer := http.FileServer(http.Dir("./uploads/"))
+	r.Handle(blob.URLPrefix+"*", http.StripPrefix(blob.URLPrefix, blob.Handler(blobs)))
 
-	smartFileHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		viewParam := r.URL.Query().Get("view")
+	api.RegisterRoutes(r, h)
 
-		if viewParam != "true" {
-			w.Header().Set("Content-Disposition", "attachment")
-		}
+	log.Printf("Servidor iniciado em %s (%s)", cfg.Server.Addr, cfg.Env)
+	if err := http.ListenAndServe(cfg.Server.Addr, r); err != nil {
+		log.Fatalf("Não foi possível iniciar o servidor: %v", err)
+	}
+}
 
-		fileServer.ServeHTTP(w, r)
-	})
+// runPrintConfig imprime a configuração com os segredos escondidos e devolve o
+// código de saída: 1 se ela não passou na validação.
+func runPrintConfig(cfg *config.Config, loadErr error) int {
+	if cfg == nil {
+		log.Print(loadErr)
+		return 1
+	}
+	out, err := cfg.Redacted()
+	if err != nil {
+		log.Printf("Erro ao mostrar a configuração: %v", err)
+		return 1
+	}
+	fmt.Println(string(out))
+	if loadErr != nil {
+		log.Print(loadErr)
+		return 1
+	}
+	return 0
+}
 
-	r.Handle("/uploads/*", http.StripPrefix("/uploads/", smartFileHandler))
+// uploadPolicy monta a política de upload: só os tipos de AllowedTypes (vazio
+// aceita todos os tipos conhecidos), com os limites de tamanho de MaxMB.
+func uploadPolicy(c config.UploadConfig) (validation.Policy, error) {
+	policy := validation.DefaultPolicy()
+	if len(c.AllowedTypes) > 0 {
+		var err error
+		if policy, err = policy.Only(c.AllowedTypes...); err != nil {
+			return policy, err
+		}
+	}
+	for name, mb := range c.MaxMB {
+		var err error
+		if policy, err = policy.WithMaxSize(name, mb<<20); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
 
-	api.RegisterRoutes(r)
+// runIntegrityCheck imprime quantos órfãos há em cada coleção e devolve o código de
+// saída: 1 se sobrou algum órfão (sem -repair) ou se a verificação falhou.
+func runIntegrityCheck(s *store.Store, repair bool) int {
+	report, err := s.Integrity.CheckIntegrity(repair)
+	if err != nil {
+		log.Printf("Erro ao verificar a integridade do banco: %v", err)
+		return 1
+	}
+	fmt.Printf("likes:               %d\n", report.Likes)
+	fmt.Printf("comentários:         %d\n", report.Comments)
+	fmt.Printf("likes de comentário: %d\n", report.CommentLikes)
+	fmt.Printf("edições:             %d\n", report.CommentEdits)
+	fmt.Printf("notificações:        %d\n", report.Notifications)
+	fmt.Printf("textos extraídos:    %d\n", report.ResourceTexts)
+	fmt.Printf("versões:             %d\n", report.Versions)
 
-	log.Println("Servidor iniciado na porta :8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		log.Fatalf("Não foi possível iniciar o servidor: %v", err)
+	switch {
+	case report.Total() == 0:
+		fmt.Println("Nenhum órfão encontrado.")
+	case repair:
+		fmt.Printf("%d órfãos apagados.\n", report.Total())
+	default:
+		fmt.Printf("%d órfãos encontrados; rode de novo com -repair para apagá-los.\n", report.Total())
+		return 1
 	}
+	return 0
 }
@@ -27,7 +27,82 @@ type User struct {
 	Badges     []string           `json:"badges" bson:"badges"`
 	Stats      UserStats          `json:"stats" bson:"stats"`
 
-	Role string `json:"role,omitempty" bson:"role,omitempty"` // "user" ou "admin"
+	// Role é um dos papéis abaixo (RoleStudent, ...). RoleCourses são os códigos das
+	// disciplinas em que um monitor ou curador atua; os outros papéis não usam.
+	Role        string   `json:"role,omitempty" bson:"role,omitempty"`
+	RoleCourses []string `json:"roleCourses,omitempty" bson:"roleCourses,omitempty"`
+
+	// SuspendedAt marca uma conta suspensa pela moderação: ela não entra nem publica
+	// nada até um admin retirar a suspensão.
+	SuspendedAt *time.Time `json:"suspendedAt,omitempty" bson:"suspendedAt,omitempty"`
+
+	// EmailPending marca uma conta recém-criada que ainda não confirmou o e-mail pelo
+	// link enviado no cadastro; ela não entra até confirmar. Contas de antes da
+	// confirmação não têm o campo e valem como confirmadas.
+	EmailPending bool `json:"emailPending,omitempty" bson:"emailPending,omitempty"`
+}
+
+// Papéis de User.Role. As permissões de cada um estão no pacote rbac.
+const (
+	RoleStudent   = "student"
+	RoleMonitor   = "monitor"
+	RoleCurator   = "curator"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Session é um login num dispositivo. O refresh token da sessão não é guardado, só o
+// hash (RefreshHash); ele muda a cada renovação do token de acesso.
+type Session struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"-" bson:"userId"`
+	RefreshHash string             `json:"-" bson:"refreshHash"`
+	UserAgent   string             `json:"userAgent" bson:"userAgent"`
+	IP          string             `json:"ip" bson:"ip"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	// LastSeenAt é o último login ou renovação.
+	LastSeenAt time.Time  `json:"lastSeenAt" bson:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt  *time.Time `json:"-" bson:"revokedAt,omitempty"`
+	// RotatedHashes são os hashes dos últimos refresh tokens já trocados: um deles
+	// voltando indica que o token foi copiado.
+	RotatedHashes []string `json:"-" bson:"rotatedHashes,omitempty"`
+}
+
+// Active informa se a sessão ainda pode ser usada em now.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// Propósitos de UserToken.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken é um token de uso único enviado por e-mail, como o link de confirmação
+// do cadastro ou o de troca de senha. Assim como nas sessões, só o hash do token é guardado.
+type UserToken struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	Purpose   string             `json:"purpose" bson:"purpose"`
+	Hash      string             `json:"-" bson:"hash"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time         `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
+
+// RateLimit é o estado de uma chave do limitador de requisições (pacote ratelimit):
+// um balde de fichas e, para logins, a contagem de falhas e o bloqueio. Version
+// serve para as instâncias do servidor não sobrescreverem a gravação umas das outras.
+type RateLimit struct {
+	Key         string    `json:"key" bson:"_id"`
+	Tokens      float64   `json:"tokens" bson:"tokens"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LockedUntil time.Time `json:"lockedUntil" bson:"lockedUntil"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+	Version     int64     `json:"version" bson:"version"`
 }
 
 type Course struct {
@@ -55,7 +130,7 @@ type Resource struct {
 	Course      string              `json:"course" bson:"course"`
 	Type        string              `json:"type" bson:"type"`
 	FileName    string              `json:"fileName" bson:"fileName"`
-	FileUrl     string              `json:"fileUrl" bson:"fileUrl"`
+	FileUrl     string              `json:"-" bson:"fileUrl"`
 	UploadDate  time.Time           `json:"uploadDate" bson:"uploadDate"`
 	Likes       int                 `json:"likes" bson:"likes"`
 	Title       string              `json:"title" bson:"title"`
@@ -63,6 +138,108 @@ type Resource struct {
 	Semester    string              `json:"semester" bson:"semester"`
 	Tags        []string            `json:"tags" bson:"tags"`
 	IsAnonymous bool                `json:"isAnonymous" bson:"isAnonymous"`
+
+	// Preenchidos pelo processamento assíncrono feito depois do upload.
+	ProcessingStatus string `json:"processingStatus,omitempty" bson:"processingStatus,omitempty"`
+	ProcessingError  string `json:"processingError,omitempty" bson:"processingError,omitempty"`
+	PageCount        int    `json:"pageCount,omitempty" bson:"pageCount,omitempty"`
+	ThumbnailUrl     string `json:"thumbnailUrl,omitempty" bson:"thumbnailUrl,omitempty"`
+
+	// ContentHash é o SHA-256 (hex) do arquivo. Recursos com o mesmo conteúdo
+	// compartilham o mesmo blob no armazenamento.
+	ContentHash string `json:"contentHash,omitempty" bson:"contentHash,omitempty"`
+
+	// ScanStatus é o resultado da verificação de malware. Enquanto não for "clean" o
+	// recurso não aparece nas listagens nem pode ser baixado.
+	ScanStatus string `json:"scanStatus,omitempty" bson:"scanStatus,omitempty"`
+
+	// Version é o número da versão atual do arquivo (ver ResourceVersion). Recursos
+	// anteriores ao versionamento ficam com 0, que vale como versão 1.
+	Version int `json:"version,omitempty" bson:"version,omitempty"`
+
+	// DeletedAt marca um recurso que o dono mandou para a lixeira. Ele some das
+	// listagens, pode ser restaurado e é apagado de vez depois do prazo de retenção.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+
+	// HiddenAt marca um recurso escondido pela moderação. Só o dono continua vendo.
+	HiddenAt *time.Time `json:"hiddenAt,omitempty" bson:"hiddenAt,omitempty"`
+}
+
+// Estados de Resource.ScanStatus. Recursos anteriores à verificação ficam com o campo
+// vazio e contam como limpos.
+const (
+	ScanScanning    = "scanning"
+	ScanClean       = "clean"
+	ScanQuarantined = "quarantined"
+)
+
+// Visible informa se o recurso pode aparecer para os outros usuários: já passou pelo
+// antivírus, não está na lixeira e não foi escondido pela moderação.
+func (r *Resource) Visible() bool {
+	return (r.ScanStatus == "" || r.ScanStatus == ScanClean) && r.DeletedAt == nil && r.HiddenAt == nil
+}
+
+// Estados de Resource.ProcessingStatus. Recursos antigos, anteriores ao pipeline,
+// ficam com o campo vazio.
+const (
+	ProcessingPending = "pending"
+	ProcessingDone    = "done"
+	ProcessingFailed  = "failed"
+)
+
+// QuarantinedFile é um arquivo em que o antivírus achou algo. O arquivo fica guardado
+// em Key (fora do alcance de /uploads) até um admin apagá-lo.
+type QuarantinedFile struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Key        string              `json:"key" bson:"key"`
+	FileName   string              `json:"fileName" bson:"fileName"`
+	Source     string              `json:"source" bson:"source"` // "resource", "avatar" ou "professor"
+	ResourceID *primitive.ObjectID `json:"resourceId,omitempty" bson:"resourceId,omitempty"`
+	// Version é a versão do recurso a que o arquivo pertencia; 0 é o upload original.
+	Version    int                 `json:"version,omitempty" bson:"version,omitempty"`
+	UserID     *primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	Signature  string              `json:"signature" bson:"signature"`
+	DetectedAt time.Time           `json:"detectedAt" bson:"detectedAt"`
+}
+
+// Origens de QuarantinedFile.Source.
+const (
+	QuarantineResource  = "resource"
+	QuarantineAvatar    = "avatar"
+	QuarantineProfessor = "professor"
+)
+
+// ResourceVersion é um arquivo no histórico de um recurso. O histórico só passa a
+// existir quando a primeira versão nova é enviada: aí o arquivo original vira a
+// versão 1. A versão mais recente que passou pelo antivírus é a que o recurso mostra.
+type ResourceVersion struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ResourceID  primitive.ObjectID `json:"resourceId" bson:"resourceId"`
+	Version     int                `json:"version" bson:"version"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	FileName    string             `json:"fileName" bson:"fileName"`
+	FileUrl     string             `json:"-" bson:"fileUrl"`
+	ContentHash string             `json:"contentHash,omitempty" bson:"contentHash,omitempty"`
+	ScanStatus  string             `json:"scanStatus" bson:"scanStatus"`
+	Note        string             `json:"note" bson:"note"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+type ResourceWithDetails struct {
+	Resource        `bson:",inline"`
+	UploaderName    string `json:"uploaderName,omitempty" bson:"uploaderName,omitempty"`
+	UploaderAvatar  string `json:"uploaderAvatar,omitempty" bson:"uploaderAvatar,omitempty"`
+	ProfessorName   string `json:"professorName,omitempty" bson:"professorName,omitempty"`
+	ProfessorAvatar string `json:"professorAvatar,omitempty" bson:"professorAvatar,omitempty"`
+	Comments        int    `json:"comments" bson:"comments"`
+}
+
+// ResourceSearchHit é um item de GET /api/search: o recurso, a relevância calculada
+// pelo índice e os trechos destacados por campo.
+type ResourceSearchHit struct {
+	ResourceWithDetails
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
 }
 
 type Comment struct {
@@ -72,8 +249,93 @@ type Comment struct {
 	ParentID   *primitive.ObjectID `json:"parentId,omitempty" bson:"parentId,omitempty"`
 	Content    string              `json:"content" bson:"content"`
 	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+
+	// EditedAt é a data da última edição; os textos anteriores ficam em CommentEdit.
+	EditedAt *time.Time `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	// DeletedAt marca um comentário apagado pelo autor ou por um admin. Ele continua na
+	// árvore, com CommentRemovedContent no lugar do texto, para não soltar as respostas.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Trashed marca um comentário que o autor mandou para a lixeira: o texto continua
+	// guardado até ele restaurar o comentário ou o prazo da lixeira vencer.
+	Trashed bool `json:"-" bson:"trashed,omitempty"`
+}
+
+// CommentRemovedContent é o texto que fica no lugar de um comentário apagado.
+const CommentRemovedContent = "[removed]"
+
+// CommentEdit é um texto que o comentário tinha antes de ser editado.
+type CommentEdit struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CommentID primitive.ObjectID `json:"commentId" bson:"commentId"`
+	Content   string             `json:"content" bson:"content"`
+	// EditedAt é quando esse texto foi substituído.
+	EditedAt time.Time `json:"editedAt" bson:"editedAt"`
+}
+
+// Report é uma denúncia na fila de moderação. Content guarda como o alvo estava no
+// momento da denúncia, para o admin avaliar mesmo que ele seja editado ou apagado.
+type Report struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TargetType string             `json:"targetType" bson:"targetType"`
+	TargetID   primitive.ObjectID `json:"targetId" bson:"targetId"`
+	// OwnerID é quem publicou o alvo (o dono do recurso, o autor do comentário ou o
+	// próprio usuário denunciado): é quem recebe avisos e suspensões.
+	OwnerID primitive.ObjectID `json:"ownerId" bson:"ownerId"`
+	// ResourceID é o recurso denunciado ou o recurso do comentário denunciado.
+	ResourceID *primitive.ObjectID `json:"resourceId,omitempty" bson:"resourceId,omitempty"`
+	ReporterID primitive.ObjectID  `json:"reporterId" bson:"reporterId"`
+	Reason     string              `json:"reason" bson:"reason"`
+	Details    string              `json:"details,omitempty" bson:"details,omitempty"`
+	Content    string              `json:"content" bson:"content"`
+	Status     string              `json:"status" bson:"status"`
+	// Action é a ação do admin que fechou a denúncia (ver ModerationAction).
+	Action     string              `json:"action,omitempty" bson:"action,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+	ResolvedAt *time.Time          `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	ResolvedBy *primitive.ObjectID `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
 }
 
+// Alvos de Report.TargetType.
+const (
+	ReportTargetResource = "resource"
+	ReportTargetComment  = "comment"
+	ReportTargetUser     = "user"
+)
+
+// ReportReasons são os motivos aceitos em Report.Reason; o texto livre vai em Details.
+var ReportReasons = []string{"spam", "harassment", "inappropriate", "copyright", "misinformation", "other"}
+
+// Estados de Report.Status.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed" // o admin achou que não era o caso
+	ReportActioned  = "actioned"  // o admin tomou uma das ações de moderação
+)
+
+// ModerationAction é uma decisão de um admin, guardada para auditoria.
+type ModerationAction struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	AdminID    primitive.ObjectID  `json:"adminId" bson:"adminId"`
+	Action     string              `json:"action" bson:"action"`
+	TargetType string              `json:"targetType" bson:"targetType"`
+	TargetID   primitive.ObjectID  `json:"targetId" bson:"targetId"`
+	ReportID   *primitive.ObjectID `json:"reportId,omitempty" bson:"reportId,omitempty"`
+	Note       string              `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// Ações de ModerationAction.Action.
+const (
+	ModerationDismiss   = "dismiss"
+	ModerationHide      = "hide"
+	ModerationDelete    = "delete"
+	ModerationWarn      = "warn"
+	ModerationSuspend   = "suspend"
+	ModerationUnsuspend = "unsuspend"
+	ModerationSetRole   = "set_role"
+	ModerationEdit      = "edit" // curador editou o recurso de outra pessoa
+)
+
 type Notification struct {
 	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	UserID     primitive.ObjectID `json:"userId" bson:"userId"`
@@ -84,6 +346,135 @@ type Notification struct {
 	CommentID  primitive.ObjectID `json:"commentId" bson:"commentId"`
 	IsRead     bool               `json:"isRead" bson:"isRead"`
 	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+
+	// ReadAt é quando a notificação foi lida; as lidas há mais tempo que o prazo de
+	// retenção são apagadas. ArchivedAt marca uma notificação tirada da caixa de
+	// entrada.
+	ReadAt     *time.Time `json:"readAt,omitempty" bson:"readAt,omitempty"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty" bson:"archivedAt,omitempty"`
+}
+
+// Tipos de Notification.Type.
+const (
+	NotificationReply       = "reply"
+	NotificationLike        = "like"
+	NotificationCommentLike = "comment_like"
+	NotificationShare       = "share"
+	// NotificationModeration é o aviso da moderação a quem publicou um conteúdo
+	// denunciado. Não pode ser desligado.
+	NotificationModeration = "moderation_warning"
+)
+
+// Text é a notificação como uma frase, como sai no e-mail: "Ana curtiu seu
+// comentário.". O aviso da moderação não começa com quem agiu.
+func (n *Notification) Text() string {
+	if n.Type == NotificationModeration {
+		return n.ActorName + ": " + n.Message
+	}
+	return n.ActorName + " " + n.Message
+}
+
+// NotificationTypes são os tipos que o usuário pode configurar.
+var NotificationTypes = []string{NotificationReply, NotificationLike, NotificationCommentLike, NotificationShare}
+
+// NotificationChannels diz por onde um tipo de notificação chega: na lista do site
+// (InApp), por e-mail na hora (Email) e em tempo real no navegador aberto (Push).
+type NotificationChannels struct {
+	InApp bool `json:"inApp" bson:"inApp"`
+	Email bool `json:"email" bson:"email"`
+	Push  bool `json:"push" bson:"push"`
+}
+
+// Frequências do resumo por e-mail.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// QuietHours é o horário de silêncio: entre Start e End ("22:00" e "07:00", no fuso
+// TimeZone) nada chega por e-mail ou em tempo real; as notificações ficam na lista e
+// entram no resumo. Start depois de End atravessa a meia-noite.
+type QuietHours struct {
+	Start    string `json:"start" bson:"start"`
+	End      string `json:"end" bson:"end"`
+	TimeZone string `json:"timeZone" bson:"timeZone"`
+}
+
+// NotificationPreferences são as preferências de notificação de um usuário. Quem
+// nunca as mudou segue DefaultNotificationPreferences.
+type NotificationPreferences struct {
+	UserID primitive.ObjectID `json:"-" bson:"_id"`
+	// Types guarda os canais de cada tipo de NotificationTypes; um tipo ausente
+	// segue o padrão.
+	Types      map[string]NotificationChannels `json:"types" bson:"types"`
+	QuietHours *QuietHours                     `json:"quietHours,omitempty" bson:"quietHours,omitempty"`
+	// Digest é a frequência do resumo por e-mail das notificações não lidas e dos
+	// materiais novos nas disciplinas de DigestCourses (códigos, como "MAC0110").
+	Digest        string   `json:"digest" bson:"digest"`
+	DigestCourses []string `json:"digestCourses" bson:"digestCourses"`
+	// LastDigestAt é até quando o último resumo foi; o próximo cobre dali em diante.
+	LastDigestAt *time.Time `json:"lastDigestAt,omitempty" bson:"lastDigestAt,omitempty"`
+	UpdatedAt    time.Time  `json:"updatedAt" bson:"updatedAt"`
+}
+
+// DefaultNotificationPreferences são as preferências de quem nunca as mudou: tudo
+// no site e em tempo real, nada por e-mail.
+func DefaultNotificationPreferences(userID primitive.ObjectID) *NotificationPreferences {
+	types := make(map[string]NotificationChannels, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		types[t] = NotificationChannels{InApp: true, Push: true}
+	}
+	return &NotificationPreferences{UserID: userID, Types: types, Digest: DigestOff, DigestCourses: []string{}}
+}
+
+// Channels devolve os canais do tipo de notificação. O aviso da moderação sempre
+// fica na lista.
+func (p *NotificationPreferences) Channels(notificationType string) NotificationChannels {
+	c, ok := p.Types[notificationType]
+	if !ok {
+		c = NotificationChannels{InApp: true, Push: true}
+	}
+	if notificationType == NotificationModeration {
+		c.InApp = true
+	}
+	return c
+}
+
+// Quiet informa se t cai no horário de silêncio. Um horário inválido nunca silencia.
+func (q *QuietHours) Quiet(t time.Time) bool {
+	if q == nil {
+		return false
+	}
+	start, errStart := time.Parse("15:04", q.Start)
+	end, errEnd := time.Parse("15:04", q.End)
+	loc, errLoc := time.LoadLocation(q.TimeZone)
+	if errStart != nil || errEnd != nil || errLoc != nil {
+		return false
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// QuietUntil devolve quando termina o horário de silêncio em que t cai, ou o próprio
+// t se ele não cai em nenhum.
+func (q *QuietHours) QuietUntil(t time.Time) time.Time {
+	if !q.Quiet(t) {
+		return t
+	}
+	end, _ := time.Parse("15:04", q.End)
+	loc, _ := time.LoadLocation(q.TimeZone)
+	local := t.In(loc)
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
 }
 
 type CommentWithAuthor struct {
@@ -95,6 +486,8 @@ type CommentWithAuthor struct {
 	ParentID     *primitive.ObjectID  `json:"parentId,omitempty" bson:"parentId,omitempty"`
 	Replies      []*CommentWithAuthor `json:"replies,omitempty"`
 	Likes        int                  `json:"likes" bson:"likes"`
+	EditedAt     *time.Time           `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	DeletedAt    *time.Time           `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
 
 type Like struct {
@@ -0,0 +1,52 @@
+package processing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfMagic é o cabeçalho de todo arquivo PDF.
+var pdfMagic = []byte("%PDF-")
+
+// isPDF olha os primeiros bytes do arquivo em vez de confiar na extensão enviada.
+func isPDF(r io.ReaderAt) bool {
+	header := make([]byte, len(pdfMagic))
+	n, _ := r.ReadAt(header, 0)
+	return bytes.Equal(header[:n], pdfMagic)
+}
+
+// extractPDFText devolve o texto de cada página do PDF. Páginas sem texto (ex.:
+// digitalizadas) entram como string vazia para manter a numeração.
+func extractPDFText(r io.ReaderAt, size int64) (pages []string, err error) {
+	// A biblioteca de PDF entra em pânico com alguns arquivos malformados.
+	defer func() {
+		if p := recover(); p != nil {
+			pages, err = nil, fmt.Errorf("PDF inválido: %v", p)
+		}
+	}()
+
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("PDF inválido: %w", err)
+	}
+
+	total := reader.NumPage()
+	pages = make([]string, 0, total)
+	for i := 1; i <= total; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			pages = append(pages, "")
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler a página %d: %w", i, err)
+		}
+		pages = append(pages, strings.TrimSpace(text))
+	}
+	return pages, nil
+}
@@ -0,0 +1,314 @@
+// Package processing roda, fora do ciclo da requisição, o trabalho pesado feito
+// sobre os arquivos enviados: verificação de malware, extração de texto dos PDFs e
+// geração de thumbnails.
+package processing
+
+import (
+	"io"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/scan"
+	"uspshare/search"
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// queueSize é quantos recursos podem esperar na fila antes de Enqueue passar a
+// despachar o envio numa goroutine própria.
+const queueSize = 100
+
+// job é um recurso na fila. thumbnailOnly vem da regeneração em massa feita pelo
+// admin, que não precisa extrair o texto de novo; version > 0 é uma nova versão do
+// arquivo esperando o antivírus.
+type job struct {
+	resourceID    primitive.ObjectID
+	thumbnailOnly bool
+	version       int
+}
+
+// Pipeline processa os recursos enfileirados com um conjunto fixo de workers. Ao
+// terminar, grava o estado em Resource.ProcessingStatus e reindexa o recurso na busca.
+type Pipeline struct {
+	store    *store.Store
+	index    *search.Index
+	blobs    blob.Store
+	scanner  scan.Scanner
+	renderer PageRenderer
+
+	jobs    chan job
+	pending sync.WaitGroup
+
+	// queued guarda os jobs ainda na fila ou rodando, para que Resume não enfileire
+	// de novo um recurso que já está sendo processado.
+	mu     sync.Mutex
+	queued map[job]bool
+}
+
+func NewPipeline(s *store.Store, idx *search.Index, blobs blob.Store, scanner scan.Scanner) *Pipeline {
+	return &Pipeline{
+		store:    s,
+		index:    idx,
+		blobs:    blobs,
+		scanner:  scanner,
+		renderer: detectPDFRenderer(),
+		jobs:     make(chan job, queueSize),
+		queued:   make(map[job]bool),
+	}
+}
+
+// Start sobe os workers. Deve ser chamado uma única vez.
+func (p *Pipeline) Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range p.jobs {
+				switch {
+				case j.version > 0:
+					p.processVersion(j.resourceID, j.version)
+				case j.thumbnailOnly:
+					p.processThumbnail(j.resourceID)
+				default:
+					p.process(j.resourceID)
+				}
+				p.mu.Lock()
+				delete(p.queued, j)
+				p.mu.Unlock()
+				p.pending.Done()
+			}
+		}()
+	}
+}
+
+// Enqueue agenda o processamento completo do recurso sem bloquear quem chama.
+func (p *Pipeline) Enqueue(resourceID primitive.ObjectID) {
+	p.enqueue(job{resourceID: resourceID})
+}
+
+// EnqueueVersion agenda a verificação de uma nova versão do arquivo do recurso.
+func (p *Pipeline) EnqueueVersion(resourceID primitive.ObjectID, number int) {
+	p.enqueue(job{resourceID: resourceID, version: number})
+}
+
+// EnqueueThumbnail agenda só a (re)geração do thumbnail do recurso.
+func (p *Pipeline) EnqueueThumbnail(resourceID primitive.ObjectID) {
+	p.enqueue(job{resourceID: resourceID, thumbnailOnly: true})
+}
+
+func (p *Pipeline) enqueue(j job) {
+	p.mu.Lock()
+	p.queued[j] = true
+	p.mu.Unlock()
+	p.pending.Add(1)
+	select {
+	case p.jobs <- j:
+	default:
+		go func() { p.jobs <- j }()
+	}
+}
+
+// Wait bloqueia até que todos os recursos enfileirados tenham sido processados.
+func (p *Pipeline) Wait() {
+	p.pending.Wait()
+}
+
+// Stop espera os jobs já enfileirados e encerra os workers. Depois dele o pipeline
+// não aceita mais jobs.
+func (p *Pipeline) Stop() {
+	p.pending.Wait()
+	close(p.jobs)
+}
+
+// enqueueIdle enfileira j só se ele já não estiver na fila ou rodando.
+func (p *Pipeline) enqueueIdle(j job) {
+	p.mu.Lock()
+	busy := p.queued[j]
+	p.mu.Unlock()
+	if !busy {
+		p.enqueue(j)
+	}
+}
+
+// Resume reenfileira os recursos que ficaram pendentes (ex.: o servidor caiu no
+// meio do processamento ou o antivírus estava fora do ar). Os que já estão na fila
+// não entram de novo.
+func (p *Pipeline) Resume() error {
+	ids, err := p.store.Resources.ListPendingResourceIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		p.enqueueIdle(job{resourceID: id})
+	}
+
+	versions, err := p.store.Versions.ListScanningVersions()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		p.enqueueIdle(job{resourceID: v.ResourceID, version: v.Version})
+	}
+	return nil
+}
+
+// StartResume roda Resume a cada interval numa goroutine própria, para que uploads
+// adiados por uma queda do antivírus não esperem a próxima subida do servidor.
+func (p *Pipeline) StartResume(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := p.Resume(); err != nil {
+				log.Printf("Erro ao retomar o processamento pendente: %v", err)
+			}
+		}
+	}()
+}
+
+func (p *Pipeline) process(id primitive.ObjectID) {
+	res, err := p.store.Resources.GetResourceByID(id)
+	if err != nil {
+		// Recurso apagado antes de chegar a vez dele.
+		if err != store.ErrNotFound {
+			log.Printf("Erro ao carregar recurso %s para processamento: %v", id.Hex(), err)
+		}
+		return
+	}
+	key := blob.KeyFromURL(res.FileUrl)
+
+	f, err := p.fetch(key)
+	if err != nil {
+		// Sem o arquivo não há verificação: o upload continua escondido e pendente, em
+		// vez de ficar em scanning para sempre fora do alcance do Resume.
+		if res.ScanStatus == models.ScanScanning {
+			p.retryLater(id, err)
+		} else {
+			p.fail(id, err)
+		}
+		return
+	}
+	defer removeTemp(f)
+
+	if res.ScanStatus == models.ScanScanning {
+		var ok bool
+		if key, ok = p.scanUpload(&res.Resource, key, f); !ok {
+			return
+		}
+	}
+
+	p.refreshThumbnail(id, key, f)
+
+	pages, err := extractText(f)
+	if err != nil {
+		p.fail(id, err)
+		return
+	}
+
+	if len(pages) > 0 {
+		if err := p.store.Resources.SaveResourceText(id, pages); err != nil {
+			log.Printf("Erro ao salvar texto do recurso %s: %v", id.Hex(), err)
+			p.store.Resources.SetResourceProcessing(id, models.ProcessingFailed, 0, "failed to save extracted text")
+			return
+		}
+	}
+	if err := p.store.Resources.SetResourceProcessing(id, models.ProcessingDone, len(pages), ""); err != nil {
+		log.Printf("Erro ao gravar estado do recurso %s: %v", id.Hex(), err)
+		return
+	}
+
+	if err := search.IndexResource(p.index, p.store.Resources, id); err != nil && err != store.ErrNotFound {
+		log.Printf("Erro ao reindexar recurso %s: %v", id.Hex(), err)
+	}
+}
+
+func (p *Pipeline) fail(id primitive.ObjectID, err error) {
+	log.Printf("Falha ao processar recurso %s: %v", id.Hex(), err)
+	if err := p.store.Resources.SetResourceProcessing(id, models.ProcessingFailed, 0, err.Error()); err != nil {
+		log.Printf("Erro ao gravar estado do recurso %s: %v", id.Hex(), err)
+	}
+}
+
+func (p *Pipeline) processThumbnail(id primitive.ObjectID) {
+	res, err := p.store.Resources.GetResourceByID(id)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("Erro ao carregar recurso %s para gerar thumbnail: %v", id.Hex(), err)
+		}
+		return
+	}
+	if !res.Visible() {
+		return
+	}
+	key := blob.KeyFromURL(res.FileUrl)
+
+	f, err := p.fetch(key)
+	if err != nil {
+		log.Printf("Falha ao gerar thumbnail do recurso %s: %v", id.Hex(), err)
+		return
+	}
+	defer removeTemp(f)
+
+	p.refreshThumbnail(id, key, f)
+}
+
+// refreshThumbnail gera o thumbnail e grava a URL no recurso. Um thumbnail que não
+// pôde ser gerado não derruba o resto do processamento.
+func (p *Pipeline) refreshThumbnail(id primitive.ObjectID, key string, f *os.File) {
+	thumbKey, err := p.generateThumbnail(key, f)
+	if err == errNoThumbnail {
+		return
+	}
+	if err != nil {
+		log.Printf("Falha ao gerar thumbnail do recurso %s: %v", id.Hex(), err)
+		return
+	}
+	if err := p.store.Resources.SetResourceThumbnail(id, blob.PublicURL(thumbKey)); err != nil {
+		log.Printf("Erro ao gravar thumbnail do recurso %s: %v", id.Hex(), err)
+	}
+}
+
+// fetch copia o blob para um arquivo temporário: a leitura do PDF precisa de acesso
+// aleatório e o pdftoppm, de um caminho no disco.
+func (p *Pipeline) fetch(key string) (*os.File, error) {
+	rc, err := p.blobs.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	f, err := os.CreateTemp("", "uspshare-blob-*"+path.Ext(key))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		removeTemp(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+func removeTemp(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// extractText devolve o texto por página do arquivo. Arquivos que não são PDF não
+// têm texto extraído (nenhuma página).
+func extractText(f *os.File) ([]string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !isPDF(f) {
+		return nil, nil
+	}
+	return extractPDFText(f, info.Size())
+}
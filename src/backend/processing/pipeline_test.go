@@ -0,0 +1,494 @@
+package processing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/scan"
+	"uspshare/search"
+	"uspshare/store"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// buildTestPDF monta um PDF mínimo, com uma linha de texto em Helvetica por página.
+func buildTestPDF(t *testing.T, pages ...string) []byte {
+	var objects []string
+	kids := make([]string, len(pages))
+	fontID := 3 + 2*len(pages)
+	for i, text := range pages {
+		pageID, contentID := 3+2*i, 4+2*i
+		kids[i] = fmt.Sprintf("%d 0 R", pageID)
+
+		encoded, err := charmap.Windows1252.NewEncoder().String(text)
+		assert.NoError(t, err)
+		escaped := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(encoded)
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", escaped)
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>", fontID, contentID),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+	objects = append([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+	}, objects...)
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// fakeScanner faz o papel do clamd: acusa qualquer arquivo com "EICAR" no conteúdo,
+// ou falha com err, como um antivírus fora do ar.
+type fakeScanner struct {
+	err error
+}
+
+func (f *fakeScanner) Scan(r io.Reader) (scan.Result, error) {
+	if f.err != nil {
+		return scan.Result{}, f.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	if bytes.Contains(data, []byte("EICAR")) {
+		return scan.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+func setupPipeline(t *testing.T) (*store.Store, *search.Index, *Pipeline) {
+	s := store.NewMemoryStore()
+	idx := search.NewIndex()
+	p := NewPipeline(s, idx, blob.NewLocalStore(t.TempDir(), []byte("segredo")), &fakeScanner{})
+	p.Start(2)
+	t.Cleanup(p.Stop)
+	return s, idx, p
+}
+
+func createUploadedResource(t *testing.T, p *Pipeline, fileName string, content []byte) primitive.ObjectID {
+	assert.NoError(t, p.blobs.Put(fileName, bytes.NewReader(content), int64(len(content)), ""))
+
+	resource := &models.Resource{
+		ID:               primitive.NewObjectID(),
+		UserID:           primitive.NewObjectID(),
+		Title:            "Material",
+		FileUrl:          blob.PublicURL(fileName),
+		UploadDate:       time.Now(),
+		ProcessingStatus: models.ProcessingPending,
+	}
+	assert.NoError(t, p.store.Resources.CreateResource(resource))
+	return resource.ID
+}
+
+func TestPipeline(t *testing.T) {
+	s, idx, p := setupPipeline(t)
+
+	t.Run("Extrai o texto do PDF página por página", func(t *testing.T) {
+		id := createUploadedResource(t, p, "lista.pdf", buildTestPDF(t, "Exercícios de cálculo", "Gabarito (parte 2)"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, err := s.Resources.GetResourceByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus)
+		assert.Equal(t, 2, res.PageCount)
+
+		pages, err := s.Resources.GetResourceText(id)
+		assert.NoError(t, err)
+		if assert.Len(t, pages, 2) {
+			assert.Equal(t, "Exercícios de cálculo", pages[0])
+			assert.Equal(t, "Gabarito (parte 2)", pages[1])
+		}
+
+		hits, _ := idx.Search("calculo", 0, 10)
+		if assert.Len(t, hits, 1, "O texto extraído deveria entrar no índice de busca") {
+			assert.Contains(t, hits[0].Highlights[search.FieldContent], "<mark>cálculo</mark>")
+		}
+	})
+
+	t.Run("PDF corrompido marca o recurso como failed", func(t *testing.T) {
+		id := createUploadedResource(t, p, "quebrado.pdf", []byte("%PDF-1.4\nisto não é um pdf"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ProcessingFailed, res.ProcessingStatus)
+		assert.NotEmpty(t, res.ProcessingError)
+	})
+
+	t.Run("Arquivo que não é PDF termina sem texto", func(t *testing.T) {
+		id := createUploadedResource(t, p, "foto.png", []byte("\x89PNG\r\n\x1a\n"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus)
+		assert.Equal(t, 0, res.PageCount)
+		_, err := s.Resources.GetResourceText(id)
+		assert.Equal(t, store.ErrNotFound, err)
+	})
+
+	t.Run("Resume reprocessa os pendentes", func(t *testing.T) {
+		id := createUploadedResource(t, p, "pendente.pdf", buildTestPDF(t, "Resumo"))
+		assert.NoError(t, p.Resume())
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus)
+		assert.Equal(t, 1, res.PageCount)
+	})
+}
+
+// fakeRenderer substitui o pdftoppm, que não está disponível no ambiente de testes.
+type fakeRenderer struct {
+	calls int
+}
+
+func (r *fakeRenderer) RenderFirstPage(pdfPath string) (image.Image, error) {
+	r.calls++
+	return image.NewRGBA(image.Rect(0, 0, 1240, 1754)), nil
+}
+
+func TestThumbnails(t *testing.T) {
+	s, _, p := setupPipeline(t)
+
+	decodeThumbnail := func(t *testing.T, url string) image.Config {
+		f, err := p.blobs.Open(blob.KeyFromURL(url))
+		if !assert.NoError(t, err) {
+			return image.Config{}
+		}
+		defer f.Close()
+		cfg, format, err := image.DecodeConfig(f)
+		assert.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		return cfg
+	}
+
+	t.Run("Imagem grande é reduzida mantendo a proporção", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1280, 960))))
+		id := createUploadedResource(t, p, "quadro.png", buf.Bytes())
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, "/uploads/quadro_thumb.jpg", res.ThumbnailUrl)
+		cfg := decodeThumbnail(t, res.ThumbnailUrl)
+		assert.Equal(t, thumbnailWidth, cfg.Width)
+		assert.Equal(t, 240, cfg.Height)
+	})
+
+	t.Run("Imagem pequena não é ampliada", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 50)), nil))
+		id := createUploadedResource(t, p, "pequena.jpg", buf.Bytes())
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		cfg := decodeThumbnail(t, res.ThumbnailUrl)
+		assert.Equal(t, 100, cfg.Width)
+	})
+
+	t.Run("PDF sem renderizador fica sem thumbnail", func(t *testing.T) {
+		p.renderer = nil
+		id := createUploadedResource(t, p, "sem-render.pdf", buildTestPDF(t, "Prova"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Empty(t, res.ThumbnailUrl)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus, "Sem thumbnail o texto ainda deve ser extraído")
+	})
+
+	t.Run("PDF usa a primeira página renderizada", func(t *testing.T) {
+		renderer := &fakeRenderer{}
+		p.renderer = renderer
+		id := createUploadedResource(t, p, "prova.pdf", buildTestPDF(t, "Prova"))
+		p.EnqueueThumbnail(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, 1, renderer.calls)
+		assert.Equal(t, "/uploads/prova_thumb.jpg", res.ThumbnailUrl)
+		cfg := decodeThumbnail(t, res.ThumbnailUrl)
+		assert.Equal(t, thumbnailWidth, cfg.Width)
+		assert.Equal(t, models.ProcessingPending, res.ProcessingStatus, "EnqueueThumbnail não deve mexer na extração de texto")
+	})
+
+	t.Run("Outros tipos de arquivo não têm thumbnail", func(t *testing.T) {
+		id := createUploadedResource(t, p, "codigo.zip", []byte("PK\x03\x04"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Empty(t, res.ThumbnailUrl)
+		_, err := p.blobs.Open("codigo_thumb.jpg")
+		assert.Equal(t, blob.ErrNotFound, err)
+	})
+}
+
+// createPendingResource imita o handler de upload: o arquivo fica em pending/ e o
+// recurso, em verificação.
+func createPendingResource(t *testing.T, p *Pipeline, fileName string, content []byte) primitive.ObjectID {
+	key := blob.PendingPrefix + fileName
+	assert.NoError(t, p.blobs.Put(key, bytes.NewReader(content), int64(len(content)), ""))
+
+	sum := sha256.Sum256(content)
+	resource := &models.Resource{
+		ID:               primitive.NewObjectID(),
+		UserID:           primitive.NewObjectID(),
+		Title:            "Material " + fileName,
+		FileName:         fileName,
+		FileUrl:          blob.PublicURL(key),
+		UploadDate:       time.Now(),
+		ContentHash:      hex.EncodeToString(sum[:]),
+		ProcessingStatus: models.ProcessingPending,
+		ScanStatus:       models.ScanScanning,
+	}
+	assert.NoError(t, p.store.Resources.CreateResource(resource))
+	return resource.ID
+}
+
+func TestMalwareScan(t *testing.T) {
+	s, idx, p := setupPipeline(t)
+	exists := func(key string) bool {
+		rc, err := p.blobs.Open(key)
+		if err == nil {
+			rc.Close()
+		}
+		return err == nil
+	}
+
+	t.Run("Arquivo limpo sai de pending e fica visível", func(t *testing.T) {
+		id := createPendingResource(t, p, "lista.pdf", buildTestPDF(t, "Limites"))
+		all, _ := s.Resources.ListResources()
+		assert.Empty(t, all, "Recurso em verificação não aparece na listagem")
+
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ScanClean, res.ScanStatus)
+		assert.Equal(t, "/uploads/lista.pdf", res.FileUrl)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus)
+		assert.True(t, exists("lista.pdf"))
+		assert.False(t, exists(blob.PendingPrefix+"lista.pdf"))
+		hits, _ := idx.Search("limites", 0, 10)
+		assert.Len(t, hits, 1)
+	})
+
+	t.Run("Cópia limpa reaproveita o blob existente", func(t *testing.T) {
+		id := createPendingResource(t, p, "copia.pdf", buildTestPDF(t, "Limites"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, "/uploads/lista.pdf", res.FileUrl)
+		assert.False(t, exists("copia.pdf"))
+		assert.False(t, exists(blob.PendingPrefix+"copia.pdf"))
+	})
+
+	t.Run("Arquivo infectado vai para a quarentena", func(t *testing.T) {
+		id := createPendingResource(t, p, "virus.pdf", []byte("%PDF-1.4 EICAR"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ScanQuarantined, res.ScanStatus)
+		assert.Equal(t, "/uploads/quarantine/virus.pdf", res.FileUrl)
+		assert.Equal(t, models.ProcessingFailed, res.ProcessingStatus)
+		assert.True(t, exists(blob.QuarantinePrefix+"virus.pdf"))
+		assert.False(t, exists(blob.PendingPrefix+"virus.pdf"))
+		assert.False(t, exists("virus.pdf"))
+
+		files, _ := s.Quarantine.ListQuarantinedFiles()
+		if assert.Len(t, files, 1) {
+			assert.Equal(t, id, *files[0].ResourceID)
+			assert.Equal(t, "Eicar-Test-Signature", files[0].Signature)
+			assert.Equal(t, models.QuarantineResource, files[0].Source)
+		}
+		all, _ := s.Resources.ListResources()
+		assert.Len(t, all, 2)
+	})
+
+	t.Run("Antivírus fora do ar deixa o recurso escondido até o Resume", func(t *testing.T) {
+		p.scanner = &fakeScanner{err: errors.New("connection refused")}
+		id := createPendingResource(t, p, "espera.pdf", buildTestPDF(t, "Derivadas"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ScanScanning, res.ScanStatus)
+		assert.Equal(t, models.ProcessingPending, res.ProcessingStatus)
+		assert.Contains(t, res.ProcessingError, "connection refused")
+		assert.True(t, exists(blob.PendingPrefix+"espera.pdf"))
+
+		p.scanner = &fakeScanner{}
+		assert.NoError(t, p.Resume())
+		p.Wait()
+		res, _ = s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ScanClean, res.ScanStatus)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus)
+		assert.Empty(t, res.ProcessingError)
+	})
+
+	t.Run("Arquivo pendente ilegível volta a ser tentado periodicamente", func(t *testing.T) {
+		content := buildTestPDF(t, "Vetores")
+		id := createPendingResource(t, p, "sumido.pdf", content)
+		assert.NoError(t, p.blobs.Delete(blob.PendingPrefix+"sumido.pdf"))
+		p.Enqueue(id)
+		p.Wait()
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ScanScanning, res.ScanStatus)
+		assert.Equal(t, models.ProcessingPending, res.ProcessingStatus, "Falha ao ler o arquivo não pode tirar o recurso do Resume")
+
+		assert.NoError(t, p.blobs.Put(blob.PendingPrefix+"sumido.pdf", bytes.NewReader(content), int64(len(content)), ""))
+		p.StartResume(10 * time.Millisecond)
+		assert.Eventually(t, func() bool {
+			res, _ := s.Resources.GetResourceByID(id)
+			return res.ProcessingStatus == models.ProcessingDone
+		}, time.Second, 10*time.Millisecond)
+		res, _ = s.Resources.GetResourceByID(id)
+		assert.Equal(t, models.ScanClean, res.ScanStatus)
+	})
+}
+
+func createPendingVersion(t *testing.T, p *Pipeline, resourceID primitive.ObjectID, number int, fileName string, content []byte) {
+	key := blob.PendingPrefix + fileName
+	assert.NoError(t, p.blobs.Put(key, bytes.NewReader(content), int64(len(content)), ""))
+
+	sum := sha256.Sum256(content)
+	version := &models.ResourceVersion{
+		ID:          primitive.NewObjectID(),
+		ResourceID:  resourceID,
+		Version:     number,
+		UserID:      primitive.NewObjectID(),
+		FileName:    fileName,
+		FileUrl:     blob.PublicURL(key),
+		ContentHash: hex.EncodeToString(sum[:]),
+		ScanStatus:  models.ScanScanning,
+		CreatedAt:   time.Now(),
+	}
+	assert.NoError(t, p.store.Versions.CreateResourceVersion(version))
+}
+
+func TestResourceVersions(t *testing.T) {
+	s, idx, p := setupPipeline(t)
+	exists := func(key string) bool {
+		rc, err := p.blobs.Open(key)
+		if err == nil {
+			rc.Close()
+		}
+		return err == nil
+	}
+
+	id := createPendingResource(t, p, "v1.pdf", buildTestPDF(t, "Integrais"))
+	p.Enqueue(id)
+	p.Wait()
+
+	t.Run("Versão limpa vira o arquivo atual e é processada", func(t *testing.T) {
+		createPendingVersion(t, p, id, 2, "v2.pdf", buildTestPDF(t, "Séries", "Sequências"))
+		p.EnqueueVersion(id, 2)
+		p.Wait()
+
+		v, _ := s.Versions.GetResourceVersion(id, 2)
+		assert.Equal(t, models.ScanClean, v.ScanStatus)
+		assert.Equal(t, "/uploads/v2.pdf", v.FileUrl)
+		assert.False(t, exists(blob.PendingPrefix+"v2.pdf"))
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, 2, res.Version)
+		assert.Equal(t, "v2.pdf", res.FileName)
+		assert.Equal(t, "/uploads/v2.pdf", res.FileUrl)
+		assert.Equal(t, models.ProcessingDone, res.ProcessingStatus)
+		assert.Equal(t, 2, res.PageCount)
+		hits, _ := idx.Search("sequências", 0, 10)
+		assert.Len(t, hits, 1, "O texto da nova versão deve entrar na busca")
+		hits, _ = idx.Search("integrais", 0, 10)
+		assert.Empty(t, hits, "O texto da versão anterior deve sair da busca")
+		assert.True(t, exists("v1.pdf"), "O arquivo anterior fica no histórico")
+	})
+
+	t.Run("Versão mais antiga que a atual não troca o arquivo", func(t *testing.T) {
+		createPendingVersion(t, p, id, 4, "v4.pdf", buildTestPDF(t, "Quatro"))
+		createPendingVersion(t, p, id, 3, "v3.pdf", buildTestPDF(t, "Três"))
+		p.EnqueueVersion(id, 4)
+		p.Wait()
+		p.EnqueueVersion(id, 3)
+		p.Wait()
+
+		v, _ := s.Versions.GetResourceVersion(id, 3)
+		assert.Equal(t, models.ScanClean, v.ScanStatus)
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, 4, res.Version)
+		assert.Equal(t, "v4.pdf", res.FileName)
+	})
+
+	t.Run("Versão infectada vai para a quarentena e o recurso não muda", func(t *testing.T) {
+		createPendingVersion(t, p, id, 5, "v5.pdf", []byte("%PDF-1.4 EICAR"))
+		p.EnqueueVersion(id, 5)
+		p.Wait()
+
+		v, _ := s.Versions.GetResourceVersion(id, 5)
+		assert.Equal(t, models.ScanQuarantined, v.ScanStatus)
+		assert.Equal(t, "/uploads/quarantine/v5.pdf", v.FileUrl)
+		assert.False(t, exists(blob.PendingPrefix+"v5.pdf"))
+
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, 4, res.Version)
+		assert.True(t, res.Visible())
+		files, _ := s.Quarantine.ListQuarantinedFiles()
+		if assert.Len(t, files, 1) {
+			assert.Equal(t, id, *files[0].ResourceID)
+			assert.Equal(t, 5, files[0].Version)
+		}
+	})
+
+	t.Run("Antivírus fora do ar deixa a versão para o Resume", func(t *testing.T) {
+		p.scanner = &fakeScanner{err: errors.New("connection refused")}
+		createPendingVersion(t, p, id, 6, "v6.pdf", buildTestPDF(t, "Seis"))
+		p.EnqueueVersion(id, 6)
+		p.Wait()
+
+		v, _ := s.Versions.GetResourceVersion(id, 6)
+		assert.Equal(t, models.ScanScanning, v.ScanStatus)
+
+		p.scanner = &fakeScanner{}
+		assert.NoError(t, p.Resume())
+		p.Wait()
+		res, _ := s.Resources.GetResourceByID(id)
+		assert.Equal(t, 6, res.Version)
+	})
+}
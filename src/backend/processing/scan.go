@@ -0,0 +1,168 @@
+package processing
+
+import (
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/scan"
+	"uspshare/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// scanUpload passa pelo antivírus um arquivo recém-enviado, que o handler deixou em
+// blob.PendingPrefix. Limpo, ele vai para a chave definitiva (ou passa a usar o blob
+// que já tinha o mesmo conteúdo) e o recurso fica visível; infectado, vai para a
+// quarentena. Devolve a chave definitiva e false se o processamento deve parar.
+func (p *Pipeline) scanUpload(res *models.Resource, pendingKey string, f *os.File) (string, bool) {
+	result, err := p.scanFile(f)
+	if err != nil {
+		p.retryLater(res.ID, err)
+		return "", false
+	}
+	if result.Infected {
+		p.quarantine(res, pendingKey, f, result.Signature)
+		return "", false
+	}
+
+	storedKey, err := p.promoteBlob(pendingKey, res.ContentHash, f)
+	if err != nil {
+		p.retryLater(res.ID, err)
+		return "", false
+	}
+	if err := p.store.Resources.SetResourceScan(res.ID, models.ScanClean, blob.PublicURL(storedKey)); err != nil {
+		// Recurso apagado durante a verificação: a referência recém-criada é desfeita.
+		log.Printf("Erro ao gravar a verificação do recurso %s: %v", res.ID.Hex(), err)
+		p.releaseBlob(res.ContentHash, storedKey)
+		return "", false
+	}
+	p.deleteBlob(pendingKey)
+
+	// Já entra na busca pelos metadados; o texto vem no fim do processamento.
+	if err := search.IndexResource(p.index, p.store.Resources, res.ID); err != nil {
+		log.Printf("Erro ao indexar recurso %s: %v", res.ID.Hex(), err)
+	}
+	return storedKey, true
+}
+
+// quarantine move o arquivo para blob.QuarantinePrefix e registra o achado para os
+// admins. O recurso continua existindo, escondido, para o dono ver o motivo.
+func (p *Pipeline) quarantine(res *models.Resource, pendingKey string, f *os.File, signature string) {
+	log.Printf("Antivírus: recurso %s (%s) contém %s; arquivo em quarentena", res.ID.Hex(), res.FileName, signature)
+
+	quarantineKey, err := p.moveToQuarantine(pendingKey, f)
+	if err != nil {
+		p.retryLater(res.ID, err)
+		return
+	}
+	if err := p.store.Resources.SetResourceScan(res.ID, models.ScanQuarantined, blob.PublicURL(quarantineKey)); err != nil {
+		log.Printf("Erro ao gravar a verificação do recurso %s: %v", res.ID.Hex(), err)
+	}
+	if err := p.store.Resources.SetResourceProcessing(res.ID, models.ProcessingFailed, 0, "malware detected: "+signature); err != nil {
+		log.Printf("Erro ao gravar estado do recurso %s: %v", res.ID.Hex(), err)
+	}
+	p.recordQuarantine(res, 0, res.FileName, quarantineKey, signature)
+}
+
+// retryLater registra o erro sem tirar o recurso de pending: ele continua escondido e
+// Resume tenta de novo na próxima rodada.
+func (p *Pipeline) retryLater(id primitive.ObjectID, err error) {
+	log.Printf("Verificação do recurso %s adiada: %v", id.Hex(), err)
+	if err := p.store.Resources.SetResourceProcessing(id, models.ProcessingPending, 0, "malware scan failed: "+err.Error()); err != nil {
+		log.Printf("Erro ao gravar estado do recurso %s: %v", id.Hex(), err)
+	}
+}
+
+func (p *Pipeline) scanFile(f *os.File) (scan.Result, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return scan.Result{}, err
+	}
+	return p.scanner.Scan(f)
+}
+
+// promoteBlob copia um arquivo limpo de pending/ para a chave definitiva e registra a
+// referência ao conteúdo; se o mesmo conteúdo já estava guardado, a cópia é
+// descartada e a chave devolvida é a do blob existente. A cópia em pending/ fica para
+// quem chamou apagar depois de gravar a nova URL.
+func (p *Pipeline) promoteBlob(pendingKey, hash string, f *os.File) (string, error) {
+	finalKey := strings.TrimPrefix(pendingKey, blob.PendingPrefix)
+	if err := p.copyTo(finalKey, f); err != nil {
+		return "", err
+	}
+	if hash == "" {
+		return finalKey, nil
+	}
+	storedKey, err := p.store.BlobRefs.AcquireBlob(hash, finalKey)
+	if err != nil {
+		p.deleteBlob(finalKey)
+		return "", err
+	}
+	if storedKey != finalKey {
+		p.deleteBlob(finalKey)
+	}
+	return storedKey, nil
+}
+
+// moveToQuarantine tira o arquivo de pending/ e o guarda em blob.QuarantinePrefix.
+func (p *Pipeline) moveToQuarantine(pendingKey string, f *os.File) (string, error) {
+	quarantineKey := blob.QuarantinePrefix + strings.TrimPrefix(pendingKey, blob.PendingPrefix)
+	if err := p.copyTo(quarantineKey, f); err != nil {
+		return "", err
+	}
+	p.deleteBlob(pendingKey)
+	return quarantineKey, nil
+}
+
+// recordQuarantine registra o achado para os admins. version é 0 para o arquivo
+// original do recurso.
+func (p *Pipeline) recordQuarantine(res *models.Resource, version int, fileName, quarantineKey, signature string) {
+	resourceID, userID := res.ID, res.UserID
+	entry := &models.QuarantinedFile{
+		ID:         primitive.NewObjectID(),
+		Key:        quarantineKey,
+		FileName:   fileName,
+		Source:     models.QuarantineResource,
+		ResourceID: &resourceID,
+		Version:    version,
+		UserID:     &userID,
+		Signature:  signature,
+		DetectedAt: time.Now(),
+	}
+	if err := p.store.Quarantine.CreateQuarantinedFile(entry); err != nil {
+		log.Printf("Erro ao registrar arquivo em quarentena %s: %v", quarantineKey, err)
+	}
+}
+
+func (p *Pipeline) copyTo(key string, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return p.blobs.Put(key, f, info.Size(), mime.TypeByExtension(path.Ext(key)))
+}
+
+func (p *Pipeline) releaseBlob(hash, key string) {
+	if hash != "" {
+		_, remaining, err := p.store.BlobRefs.ReleaseBlob(hash)
+		if err != nil || remaining > 0 {
+			return
+		}
+	}
+	p.deleteBlob(key)
+}
+
+func (p *Pipeline) deleteBlob(key string) {
+	if err := p.blobs.Delete(key); err != nil {
+		log.Printf("Erro ao apagar arquivo %s: %v", key, err)
+	}
+}
@@ -0,0 +1,138 @@
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"uspshare/blob"
+
+	"golang.org/x/image/draw"
+)
+
+// thumbnailWidth é a largura dos thumbnails exibidos nos cards; a altura segue a
+// proporção da imagem original.
+const thumbnailWidth = 320
+
+// errNoThumbnail indica que o tipo de arquivo não tem thumbnail (ex.: .zip, ou PDF
+// sem renderizador disponível). Não é tratado como falha do processamento.
+var errNoThumbnail = errors.New("no thumbnail for this file type")
+
+// PageRenderer rasteriza a primeira página de um PDF.
+type PageRenderer interface {
+	RenderFirstPage(pdfPath string) (image.Image, error)
+}
+
+// popplerRenderer usa o pdftoppm (poppler-utils), que precisa estar instalado no servidor.
+type popplerRenderer struct {
+	bin string
+}
+
+// detectPDFRenderer devolve nil quando o pdftoppm não está no PATH; nesse caso os PDFs
+// ficam sem thumbnail e só as imagens ganham um.
+func detectPDFRenderer() PageRenderer {
+	bin, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return nil
+	}
+	return popplerRenderer{bin: bin}
+}
+
+func (r popplerRenderer) RenderFirstPage(pdfPath string) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "uspshare-thumb")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	prefix := filepath.Join(dir, "page")
+	cmd := exec.Command(r.bin, "-png", "-singlefile", "-f", "1", "-l", "1",
+		"-scale-to", fmt.Sprint(thumbnailWidth*2), pdfPath, prefix)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	f, err := os.Open(prefix + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// ThumbnailKey é onde o thumbnail de um arquivo fica: ao lado do original, com o
+// sufixo blob.ThumbnailSuffix (abc.pdf -> abc_thumb.jpg).
+func ThumbnailKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + blob.ThumbnailSuffix
+}
+
+// generateThumbnail cria o thumbnail do arquivo (já copiado para f) e devolve a
+// chave em que foi gravado.
+func (p *Pipeline) generateThumbnail(key string, f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	var src image.Image
+	var err error
+	if isPDF(f) {
+		if p.renderer == nil {
+			return "", errNoThumbnail
+		}
+		if src, err = p.renderer.RenderFirstPage(f.Name()); err != nil {
+			return "", err
+		}
+	} else {
+		if _, format, err := image.DecodeConfig(f); err != nil || (format != "png" && format != "jpeg") {
+			return "", errNoThumbnail
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		if src, _, err = image.Decode(f); err != nil {
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(src, thumbnailWidth), &jpeg.Options{Quality: 80}); err != nil {
+		return "", err
+	}
+	thumbKey := ThumbnailKey(key)
+	if err := p.blobs.Put(thumbKey, &buf, int64(buf.Len()), "image/jpeg"); err != nil {
+		return "", err
+	}
+	return thumbKey, nil
+}
+
+// downscale reduz a imagem para a largura pedida (imagens menores não são
+// ampliadas) sobre fundo branco, já que JPEG não tem transparência.
+func downscale(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return src
+	}
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
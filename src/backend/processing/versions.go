@@ -0,0 +1,90 @@
+package processing
+
+import (
+	"log"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// processVersion passa pelo antivírus uma nova versão do arquivo. Limpa, ela vira o
+// arquivo atual do recurso (a menos que uma versão mais nova já tenha passado na
+// frente) e o recurso é processado de novo; infectada, vai para a quarentena e o
+// recurso continua com o arquivo anterior.
+func (p *Pipeline) processVersion(resourceID primitive.ObjectID, number int) {
+	version, err := p.store.Versions.GetResourceVersion(resourceID, number)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("Erro ao carregar a versão %d do recurso %s: %v", number, resourceID.Hex(), err)
+		}
+		return
+	}
+	if version.ScanStatus != models.ScanScanning {
+		return
+	}
+	res, err := p.store.Resources.GetResourceByID(resourceID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("Erro ao carregar recurso %s para a versão %d: %v", resourceID.Hex(), number, err)
+		}
+		return
+	}
+	pendingKey := blob.KeyFromURL(version.FileUrl)
+
+	f, err := p.fetch(pendingKey)
+	if err != nil {
+		// A versão fica em scanning e Resume tenta de novo.
+		log.Printf("Verificação da versão %d do recurso %s adiada: %v", number, resourceID.Hex(), err)
+		return
+	}
+	defer removeTemp(f)
+
+	result, err := p.scanFile(f)
+	if err != nil {
+		log.Printf("Verificação da versão %d do recurso %s adiada: %v", number, resourceID.Hex(), err)
+		return
+	}
+
+	if result.Infected {
+		log.Printf("Antivírus: versão %d do recurso %s (%s) contém %s; arquivo em quarentena",
+			number, resourceID.Hex(), version.FileName, result.Signature)
+		quarantineKey, err := p.moveToQuarantine(pendingKey, f)
+		if err != nil {
+			log.Printf("Erro ao mover a versão %d do recurso %s para a quarentena: %v", number, resourceID.Hex(), err)
+			return
+		}
+		if err := p.store.Versions.SetResourceVersionScan(resourceID, number, models.ScanQuarantined, blob.PublicURL(quarantineKey)); err != nil {
+			log.Printf("Erro ao gravar a verificação da versão %d do recurso %s: %v", number, resourceID.Hex(), err)
+		}
+		p.recordQuarantine(&res.Resource, number, version.FileName, quarantineKey, result.Signature)
+		return
+	}
+
+	storedKey, err := p.promoteBlob(pendingKey, version.ContentHash, f)
+	if err != nil {
+		log.Printf("Verificação da versão %d do recurso %s adiada: %v", number, resourceID.Hex(), err)
+		return
+	}
+	fileURL := blob.PublicURL(storedKey)
+	if err := p.store.Versions.SetResourceVersionScan(resourceID, number, models.ScanClean, fileURL); err != nil {
+		// Recurso apagado durante a verificação: a referência recém-criada é desfeita.
+		log.Printf("Erro ao gravar a verificação da versão %d do recurso %s: %v", number, resourceID.Hex(), err)
+		p.releaseBlob(version.ContentHash, storedKey)
+		return
+	}
+	p.deleteBlob(pendingKey)
+
+	// Só vira o arquivo atual se nenhuma versão mais nova passou na frente.
+	file := store.ResourceFile{Version: number, FileName: version.FileName, FileUrl: fileURL, ContentHash: version.ContentHash}
+	if err := p.store.Resources.SetResourceFile(resourceID, file); err != nil {
+		if err == store.ErrNotFound {
+			return
+		}
+		log.Printf("Erro ao trocar o arquivo do recurso %s pela versão %d: %v", resourceID.Hex(), number, err)
+		return
+	}
+	p.process(resourceID)
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"uspshare/models"
+)
+
+// Decision é a resposta do limitador para uma requisição.
+type Decision struct {
+	Allowed bool
+	// Remaining é quantas fichas inteiras sobraram no balde.
+	Remaining int
+	// RetryAfter é quanto falta para a próxima ficha, quando Allowed é false.
+	RetryAfter time.Duration
+}
+
+// Limiter aplica os limites sobre um Backend.
+type Limiter struct {
+	backend Backend
+	now     func() time.Time
+}
+
+func NewLimiter(b Backend) *Limiter {
+	return &Limiter{backend: b, now: time.Now}
+}
+
+// Allow tira uma ficha do balde da chave, se houver.
+func (l *Limiter) Allow(key string, limit Limit) (Decision, error) {
+	if limit.Disabled() {
+		return Decision{Allowed: true}, nil
+	}
+	now := l.now()
+	capacity := float64(limit.Requests)
+	perToken := limit.Per / time.Duration(limit.Requests)
+
+	var d Decision
+	_, err := l.backend.Update(key, now, func(s *models.RateLimit) {
+		d = Decision{}
+		if s.UpdatedAt.IsZero() {
+			s.Tokens = capacity
+		} else if elapsed := now.Sub(s.UpdatedAt); elapsed > 0 {
+			s.Tokens = math.Min(capacity, s.Tokens+float64(elapsed)/float64(perToken))
+		}
+		s.UpdatedAt = now
+		if s.Tokens >= 1 {
+			s.Tokens--
+			d.Allowed = true
+		} else {
+			d.RetryAfter = time.Duration((1 - s.Tokens) * float64(perToken))
+		}
+		d.Remaining = int(s.Tokens)
+		// Depois de Per parado o balde está cheio de novo, e a chave pode ser esquecida.
+		s.ExpiresAt = now.Add(limit.Per)
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	return d, nil
+}
+
+// KeyFunc diz de quem é a requisição: o balde usado é o dessa chave. Uma chave vazia
+// deixa a requisição passar sem limite.
+type KeyFunc func(r *http.Request) string
+
+// ByIP usa o endereço de quem fez a requisição, sem a porta.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Middleware limita as rotas de um grupo. name separa os baldes dos grupos, para
+// uma mesma pessoa ter um balde em cada um. Sem fichas, a resposta é 429 com o
+// header Retry-After em segundos. Se o backend falhar, a requisição passa: um banco
+// fora do ar não pode derrubar o login.
+func (l *Limiter) Middleware(name string, limit Limit, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.Disabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			d, err := l.Allow(name+":"+k, limit)
+			if err != nil {
+				log.Printf("Erro no limitador de requisições (%s): %v", name, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("X-RateLimit-Limit", limit.String())
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			if !d.Allowed {
+				TooManyRequests(w, d.RetryAfter, "Too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TooManyRequests responde 429 com Retry-After arredondado para cima, em segundos.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(retryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// RetryAfterSeconds arredonda a espera para cima, com no mínimo um segundo.
+func RetryAfterSeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		return 1
+	}
+	return s
+}
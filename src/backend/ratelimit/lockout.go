@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"time"
+
+	"uspshare/models"
+)
+
+// LockoutPolicy diz quando bloquear uma chave por falhas seguidas: a partir da
+// Threshold-ésima falha, cada nova falha bloqueia a chave por Base, depois 2×Base,
+// 4×Base e assim por diante, até Max. As falhas são esquecidas depois de Window sem
+// nenhuma nova.
+type LockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// DefaultLockout bloqueia depois de 5 falhas, de 1 minuto até 1 hora.
+var DefaultLockout = LockoutPolicy{Threshold: 5, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+
+// Lockout conta as falhas de cada chave (por exemplo, o e-mail de um login) e
+// bloqueia a chave quando elas passam da política.
+type Lockout struct {
+	backend Backend
+	policy  LockoutPolicy
+	now     func() time.Time
+}
+
+func NewLockout(b Backend, p LockoutPolicy) *Lockout {
+	return &Lockout{backend: b, policy: p, now: time.Now}
+}
+
+// Locked devolve quanto falta para a chave ser liberada, ou zero se ela não está
+// bloqueada.
+func (l *Lockout) Locked(key string) (time.Duration, error) {
+	now := l.now()
+	s, err := l.backend.Get(key, now)
+	if err != nil {
+		return 0, err
+	}
+	if now.Before(s.LockedUntil) {
+		return s.LockedUntil.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// Fail registra uma falha e devolve por quanto tempo a chave ficou bloqueada por
+// causa dela (zero se ainda não chegou ao limite).
+func (l *Lockout) Fail(key string) (time.Duration, error) {
+	if l.policy.Threshold <= 0 {
+		return 0, nil
+	}
+	now := l.now()
+	var lock time.Duration
+	_, err := l.backend.Update(key, now, func(s *models.RateLimit) {
+		lock = l.fail(s, now)
+	})
+	return lock, err
+}
+
+// Attempt faz a consulta de Locked e o registro de Fail numa única atualização, para
+// tentativas simultâneas não passarem todas pela consulta antes de alguma falha ser
+// contada. Se a chave está bloqueada, devolve quanto falta em wait e não conta nada;
+// senão, a tentativa já conta como falha (lock é o bloqueio que ela causou) e um
+// acerto deve chamar Reset.
+func (l *Lockout) Attempt(key string) (wait, lock time.Duration, err error) {
+	if l.policy.Threshold <= 0 {
+		return 0, 0, nil
+	}
+	now := l.now()
+	_, err = l.backend.Update(key, now, func(s *models.RateLimit) {
+		wait, lock = 0, 0
+		if now.Before(s.LockedUntil) {
+			wait = s.LockedUntil.Sub(now)
+			return
+		}
+		lock = l.fail(s, now)
+	})
+	return wait, lock, err
+}
+
+// fail conta uma falha em s e devolve o bloqueio que ela causou.
+func (l *Lockout) fail(s *models.RateLimit, now time.Time) time.Duration {
+	var lock time.Duration
+	s.Failures++
+	s.UpdatedAt = now
+	if over := s.Failures - l.policy.Threshold; over >= 0 {
+		lock = l.backoff(over)
+		s.LockedUntil = now.Add(lock)
+	}
+	s.ExpiresAt = now.Add(l.policy.Window)
+	if s.LockedUntil.After(s.ExpiresAt) {
+		s.ExpiresAt = s.LockedUntil
+	}
+	return lock
+}
+
+// backoff é o bloqueio da over-ésima falha depois do limite: Base dobrado over vezes,
+// sem passar de Max. Dobrar em laço, em vez de deslocar Base, evita o estouro de
+// time.Duration quando over é grande.
+func (l *Lockout) backoff(over int) time.Duration {
+	lock := l.policy.Base
+	for i := 0; i < over && lock > 0 && lock < l.policy.Max; i++ {
+		lock *= 2
+	}
+	if lock > l.policy.Max {
+		lock = l.policy.Max
+	}
+	return lock
+}
+
+// Reset esquece as falhas da chave, depois de um login bem-sucedido.
+func (l *Lockout) Reset(key string) error {
+	return l.backend.Delete(key)
+}
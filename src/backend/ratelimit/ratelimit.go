@@ -0,0 +1,192 @@
+// Package ratelimit limita a frequência das requisições com baldes de fichas (token
+// buckets) por chave, como o IP ou o usuário, e bloqueia por um tempo crescente um
+// e-mail com muitas falhas de login seguidas. O estado fica num Backend: em memória,
+// quando há uma instância só, ou no banco, compartilhado entre as instâncias.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"uspshare/models"
+	"uspshare/store"
+)
+
+// Limit permite Requests requisições a cada Per, em rajada ou espalhadas: o balde
+// começa cheio e recupera uma ficha a cada Per/Requests. O Limit zero não limita nada.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Disabled informa se o limite está desligado.
+func (l Limit) Disabled() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// String escreve o limite como "10/1m0s", ou "off" se desligado.
+func (l Limit) String() string {
+	if l.Disabled() {
+		return "off"
+	}
+	return strconv.Itoa(l.Requests) + "/" + l.Per.String()
+}
+
+// ParseLimit lê um limite no formato de String: "10/1m", "100/1h" ou "off".
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return Limit{}, nil
+	}
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q (use \"10/1m\" or \"off\")", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q (use \"10/1m\" or \"off\")", s)
+	}
+	return Limit{Requests: n, Per: d}, nil
+}
+
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Limit) UnmarshalText(b []byte) error {
+	parsed, err := ParseLimit(string(b))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Backend guarda o estado de cada chave.
+type Backend interface {
+	// Get devolve o estado da chave em now; uma chave que não existe ou já venceu
+	// volta zerada.
+	Get(key string, now time.Time) (models.RateLimit, error)
+	// Update aplica fn ao estado da chave em now (zerado, como em Get) e grava o
+	// resultado, de forma atômica. fn define o ExpiresAt e pode rodar mais de uma vez.
+	Update(key string, now time.Time, fn func(s *models.RateLimit)) (models.RateLimit, error)
+	// Delete esquece a chave.
+	Delete(key string) error
+}
+
+// Memory guarda o estado na memória do processo. As chaves vencidas são varridas de
+// tempos em tempos, nas próprias chamadas a Update.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]models.RateLimit
+	updates int
+}
+
+// sweepEvery é a cada quantas chamadas a Update Memory varre as chaves vencidas.
+const sweepEvery = 1000
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]models.RateLimit)}
+}
+
+func (m *Memory) Get(key string, now time.Time) (models.RateLimit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current(key, now), nil
+}
+
+func (m *Memory) current(key string, now time.Time) models.RateLimit {
+	entry, ok := m.entries[key]
+	if !ok || !now.Before(entry.ExpiresAt) {
+		return models.RateLimit{Key: key}
+	}
+	return entry
+}
+
+func (m *Memory) Update(key string, now time.Time, fn func(s *models.RateLimit)) (models.RateLimit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updates++
+	if m.updates%sweepEvery == 0 {
+		for k, e := range m.entries {
+			if !now.Before(e.ExpiresAt) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	entry := m.current(key, now)
+	fn(&entry)
+	m.entries[key] = entry
+	return entry, nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Shared guarda o estado no banco, para várias instâncias do servidor contarem
+// juntas. Cada Update lê a chave e grava condicionado à versão lida; se outra
+// instância gravou no meio, tenta de novo.
+type Shared struct {
+	store store.RateLimitStore
+}
+
+// sharedAttempts é quantas vezes Shared.Update tenta antes de desistir de uma chave
+// muito disputada.
+const sharedAttempts = 5
+
+func NewShared(s store.RateLimitStore) *Shared {
+	return &Shared{store: s}
+}
+
+func (s *Shared) Get(key string, now time.Time) (models.RateLimit, error) {
+	entry, _, err := s.current(key, now)
+	return entry, err
+}
+
+// current devolve o estado em now e a versão guardada, que é o que a gravação
+// seguinte precisa informar.
+func (s *Shared) current(key string, now time.Time) (models.RateLimit, int64, error) {
+	stored, err := s.store.GetRateLimit(key)
+	if err == store.ErrNotFound {
+		return models.RateLimit{Key: key}, 0, nil
+	}
+	if err != nil {
+		return models.RateLimit{}, 0, err
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return models.RateLimit{Key: key}, stored.Version, nil
+	}
+	return *stored, stored.Version, nil
+}
+
+func (s *Shared) Update(key string, now time.Time, fn func(e *models.RateLimit)) (models.RateLimit, error) {
+	for attempt := 0; attempt < sharedAttempts; attempt++ {
+		entry, version, err := s.current(key, now)
+		if err != nil {
+			return models.RateLimit{}, err
+		}
+		fn(&entry)
+		err = s.store.PutRateLimit(&entry, version)
+		if err == store.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return models.RateLimit{}, err
+		}
+		return entry, nil
+	}
+	return models.RateLimit{}, fmt.Errorf("ratelimit: too much contention on %q", key)
+}
+
+func (s *Shared) Delete(key string) error {
+	return s.store.DeleteRateLimit(key)
+}
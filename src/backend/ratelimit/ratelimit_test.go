@@ -0,0 +1,237 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"uspshare/store"
+)
+
+// clock é um relógio de teste que só anda quando mandado.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(NewMemory())
+	l.now = c.now
+	return l, c
+}
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("10/1m")
+	if err != nil || l.Requests != 10 || l.Per != time.Minute {
+		t.Errorf("ParseLimit(10/1m) = %+v, %v", l, err)
+	}
+	if l, err := ParseLimit("off"); err != nil || !l.Disabled() {
+		t.Errorf("ParseLimit(off) = %+v, %v", l, err)
+	}
+	for _, bad := range []string{"10", "0/1m", "10/", "dez/1m", "10/-1m"} {
+		if _, err := ParseLimit(bad); err == nil {
+			t.Errorf("ParseLimit(%q) deveria falhar", bad)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l, c := newTestLimiter()
+	limit := Limit{Requests: 3, Per: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if d, err := l.Allow("k", limit); err != nil || !d.Allowed {
+			t.Fatalf("requisição %d: %+v, %v", i+1, d, err)
+		}
+	}
+	d, _ := l.Allow("k", limit)
+	if d.Allowed || d.RetryAfter != 20*time.Second {
+		t.Errorf("quarta requisição = %+v, want negada com espera de 20s", d)
+	}
+	if other, _ := l.Allow("outra", limit); !other.Allowed {
+		t.Error("cada chave deveria ter seu próprio balde")
+	}
+
+	c.advance(20 * time.Second)
+	if d, _ := l.Allow("k", limit); !d.Allowed {
+		t.Error("depois de 20s deveria ter voltado uma ficha")
+	}
+	if d, _ := l.Allow("k", limit); d.Allowed {
+		t.Error("só uma ficha deveria ter voltado")
+	}
+
+	c.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if d, _ := l.Allow("k", limit); !d.Allowed {
+			t.Fatalf("depois de parado, o balde deveria estar cheio (requisição %d)", i+1)
+		}
+	}
+	if d, _ := l.Allow("k", limit); d.Allowed {
+		t.Error("o balde não pode passar da capacidade")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, _ := newTestLimiter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	h := l.Middleware("auth", Limit{Requests: 1, Per: 90 * time.Second}, ByIP)(ok)
+
+	do := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := do("10.0.0.1:1234"); rr.Code != http.StatusNoContent {
+		t.Fatalf("primeira requisição: %d", rr.Code)
+	}
+	rr := do("10.0.0.1:5678")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "90" {
+		t.Errorf("mesmo IP, outra porta: %d, Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := do("10.0.0.2:1234"); rr.Code != http.StatusNoContent {
+		t.Errorf("outro IP: %d", rr.Code)
+	}
+
+	off := l.Middleware("auth", Limit{}, ByIP)(ok)
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		off.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("limite desligado: %d", rr.Code)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	c := &clock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLockout(NewMemory(), LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute, Window: time.Hour})
+	l.now = c.now
+
+	for i := 0; i < 2; i++ {
+		if lock, _ := l.Fail("login:a@usp.br"); lock != 0 {
+			t.Fatalf("falha %d não deveria bloquear", i+1)
+		}
+	}
+	if wait, _ := l.Locked("login:a@usp.br"); wait != 0 {
+		t.Fatal("ainda não deveria estar bloqueado")
+	}
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		lock, err := l.Fail("login:a@usp.br")
+		if err != nil || lock != w {
+			t.Errorf("falha %d: bloqueio de %s, want %s (%v)", i+3, lock, w, err)
+		}
+	}
+	if wait, _ := l.Locked("login:a@usp.br"); wait != 5*time.Minute {
+		t.Errorf("Locked = %s, want 5m", wait)
+	}
+	if wait, _ := l.Locked("login:b@usp.br"); wait != 0 {
+		t.Error("outro e-mail não deveria estar bloqueado")
+	}
+
+	c.advance(5 * time.Minute)
+	if wait, _ := l.Locked("login:a@usp.br"); wait != 0 {
+		t.Errorf("o bloqueio deveria ter acabado, falta %s", wait)
+	}
+
+	l.Reset("login:a@usp.br")
+	if lock, _ := l.Fail("login:a@usp.br"); lock != 0 {
+		t.Error("depois de Reset a contagem deveria recomeçar")
+	}
+
+	c.advance(2 * time.Hour)
+	l.Fail("login:a@usp.br")
+	if lock, _ := l.Fail("login:a@usp.br"); lock != 0 {
+		t.Error("as falhas antigas deveriam ter sido esquecidas depois da janela")
+	}
+}
+
+func TestLockoutManyFailures(t *testing.T) {
+	c := &clock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLockout(NewMemory(), DefaultLockout)
+	l.now = c.now
+
+	// Quem insiste depois de cada bloqueio continua bloqueado por Max, sem estouro.
+	for i := 1; i <= 40; i++ {
+		lock, err := l.Fail("login:a@usp.br")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= DefaultLockout.Threshold && (lock <= 0 || lock > DefaultLockout.Max) {
+			t.Fatalf("falha %d: bloqueio de %s", i, lock)
+		}
+		if wait, _ := l.Locked("login:a@usp.br"); i >= DefaultLockout.Threshold && wait != lock {
+			t.Fatalf("falha %d: Locked = %s, want %s", i, wait, lock)
+		}
+		c.advance(lock)
+	}
+}
+
+func TestLockoutAttempt(t *testing.T) {
+	c := &clock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLockout(NewMemory(), LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute, Window: time.Hour})
+	l.now = c.now
+
+	// Tentativas simultâneas: só as três primeiras passam, a terceira já bloqueia.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	passed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait, _, err := l.Attempt("login:a@usp.br"); err == nil && wait == 0 {
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if passed != 3 {
+		t.Errorf("%d tentativas passaram, want 3", passed)
+	}
+	if wait, _ := l.Locked("login:a@usp.br"); wait != time.Minute {
+		t.Errorf("Locked = %s, want 1m", wait)
+	}
+
+	c.advance(time.Minute)
+	wait, lock, _ := l.Attempt("login:a@usp.br")
+	if wait != 0 || lock != 2*time.Minute {
+		t.Errorf("Attempt = (%s, %s), want (0, 2m)", wait, lock)
+	}
+	l.Reset("login:a@usp.br")
+	if wait, lock, _ := l.Attempt("login:a@usp.br"); wait != 0 || lock != 0 {
+		t.Error("depois de Reset a contagem deveria recomeçar")
+	}
+}
+
+func TestSharedBackend(t *testing.T) {
+	c := &clock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	s := store.NewMemoryStore()
+	// Duas instâncias do servidor, cada uma com seu limitador, sobre o mesmo banco.
+	a, b := NewLimiter(NewShared(s.RateLimits)), NewLimiter(NewShared(s.RateLimits))
+	a.now, b.now = c.now, c.now
+	limit := Limit{Requests: 2, Per: time.Minute}
+
+	if d, err := a.Allow("k", limit); err != nil || !d.Allowed {
+		t.Fatalf("a: %+v, %v", d, err)
+	}
+	if d, err := b.Allow("k", limit); err != nil || !d.Allowed {
+		t.Fatalf("b: %+v, %v", d, err)
+	}
+	if d, _ := a.Allow("k", limit); d.Allowed {
+		t.Error("as instâncias deveriam dividir o mesmo balde")
+	}
+
+	c.advance(2 * time.Minute)
+	if d, _ := b.Allow("k", limit); !d.Allowed {
+		t.Error("uma chave vencida deveria recomeçar com o balde cheio")
+	}
+}
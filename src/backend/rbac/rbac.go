@@ -0,0 +1,141 @@
+// Package rbac define o que cada papel de usuário pode fazer. As permissões vão no
+// token de acesso, então os middlewares decidem sem consultar o banco.
+package rbac
+
+import "uspshare/models"
+
+// Permission é uma ação protegida da API.
+type Permission string
+
+const (
+	// ModerateComments apaga comentários de outras pessoas.
+	ModerateComments Permission = "comments:moderate"
+	// CurateResources edita os metadados de recursos de outras pessoas.
+	CurateResources Permission = "resources:curate"
+	// ReviewReports trabalha na fila de denúncias e lê a auditoria.
+	ReviewReports Permission = "reports:review"
+	// SuspendUsers suspende contas e tira suspensões.
+	SuspendUsers Permission = "users:suspend"
+	// ManageCatalog cria e apaga tags, disciplinas e professores.
+	ManageCatalog Permission = "catalog:manage"
+	// ManageFiles cuida da quarentena e das miniaturas.
+	ManageFiles Permission = "files:manage"
+	// ManageRoles atribui papéis.
+	ManageRoles Permission = "roles:manage"
+)
+
+// Role descreve um papel. Num papel restrito a disciplinas (Scoped), as permissões
+// só valem nos recursos das disciplinas atribuídas ao usuário (User.RoleCourses).
+type Role struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+	Scoped      bool         `json:"scoped"`
+}
+
+// Roles são os papéis existentes, do menos para o mais poderoso.
+var Roles = []Role{
+	{
+		Name:        models.RoleStudent,
+		Description: "Estudante: publica materiais e comenta.",
+		Permissions: []Permission{},
+	},
+	{
+		Name:        models.RoleMonitor,
+		Description: "Monitor: modera os comentários das suas disciplinas.",
+		Permissions: []Permission{ModerateComments},
+		Scoped:      true,
+	},
+	{
+		Name:        models.RoleCurator,
+		Description: "Curador: organiza os materiais e modera os comentários das suas disciplinas.",
+		Permissions: []Permission{CurateResources, ModerateComments},
+		Scoped:      true,
+	},
+	{
+		Name:        models.RoleModerator,
+		Description: "Moderador: cuida da fila de denúncias e pode suspender contas.",
+		Permissions: []Permission{ModerateComments, ReviewReports, SuspendUsers},
+	},
+	{
+		Name:        models.RoleAdmin,
+		Description: "Administrador: pode tudo, inclusive atribuir papéis.",
+		Permissions: []Permission{ModerateComments, CurateResources, ReviewReports, SuspendUsers,
+			ManageCatalog, ManageFiles, ManageRoles},
+	},
+}
+
+// Lookup devolve o papel pelo nome. Contas antigas, com papel vazio ou "user", são
+// estudantes.
+func Lookup(name string) (Role, bool) {
+	if name == "" || name == "user" {
+		name = models.RoleStudent
+	}
+	for _, role := range Roles {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+// Principal é quem faz a requisição, como descrito no token.
+type Principal struct {
+	UserID      string
+	Role        string
+	Permissions []Permission
+	// Courses só é preenchido em papéis restritos a disciplinas.
+	Courses []string
+}
+
+// For monta o Principal de um usuário a partir do papel salvo. Um papel
+// desconhecido não dá permissão nenhuma.
+func For(user *models.User) Principal {
+	p := Principal{UserID: user.ID.Hex(), Role: user.Role, Permissions: []Permission{}}
+	role, ok := Lookup(user.Role)
+	if !ok {
+		return p
+	}
+	p.Role = role.Name
+	p.Permissions = append(p.Permissions, role.Permissions...)
+	if role.Scoped {
+		p.Courses = append([]string{}, user.RoleCourses...)
+	}
+	return p
+}
+
+func (p Principal) has(perm Permission) bool {
+	for _, have := range p.Permissions {
+		if have == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Principal) scoped() bool {
+	role, ok := Lookup(p.Role)
+	return !ok || role.Scoped
+}
+
+// Can informa se o principal tem a permissão em qualquer lugar. Papéis restritos a
+// disciplinas não passam aqui; use CanInCourse.
+func (p Principal) Can(perm Permission) bool {
+	return p.has(perm) && !p.scoped()
+}
+
+// CanInCourse informa se o principal tem a permissão nos recursos da disciplina.
+func (p Principal) CanInCourse(perm Permission, course string) bool {
+	if !p.has(perm) {
+		return false
+	}
+	if !p.scoped() {
+		return true
+	}
+	for _, c := range p.Courses {
+		if c == course {
+			return true
+		}
+	}
+	return false
+}
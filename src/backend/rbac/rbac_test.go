@@ -0,0 +1,63 @@
+package rbac
+
+import (
+	"testing"
+
+	"uspshare/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLegacyRolesAreStudents(t *testing.T) {
+	for _, name := range []string{"", "user"} {
+		role, ok := Lookup(name)
+		if !ok || role.Name != models.RoleStudent {
+			t.Errorf("Lookup(%q) = %q, %v; want student", name, role.Name, ok)
+		}
+	}
+	if _, ok := Lookup("superuser"); ok {
+		t.Error("Lookup aceitou um papel inexistente")
+	}
+}
+
+func TestPrincipalPermissions(t *testing.T) {
+	user := func(role string, courses ...string) Principal {
+		return For(&models.User{ID: primitive.NewObjectID(), Role: role, RoleCourses: courses})
+	}
+
+	tests := []struct {
+		name      string
+		principal Principal
+		perm      Permission
+		course    string
+		can       bool
+		inCourse  bool
+	}{
+		{"estudante não modera", user(models.RoleStudent), ModerateComments, "MAC0110", false, false},
+		{"papel desconhecido não pode nada", user("root"), ManageRoles, "MAC0110", false, false},
+		{"monitor modera a própria disciplina", user(models.RoleMonitor, "MAC0110"), ModerateComments, "MAC0110", false, true},
+		{"monitor não modera outras disciplinas", user(models.RoleMonitor, "MAC0110"), ModerateComments, "MAT0111", false, false},
+		{"monitor não faz curadoria", user(models.RoleMonitor, "MAC0110"), CurateResources, "MAC0110", false, false},
+		{"curador organiza a própria disciplina", user(models.RoleCurator, "MAC0110"), CurateResources, "MAC0110", false, true},
+		{"moderador modera em qualquer disciplina", user(models.RoleModerator), ModerateComments, "MAT0111", true, true},
+		{"moderador não mexe no catálogo", user(models.RoleModerator), ManageCatalog, "", false, false},
+		{"admin pode tudo", user(models.RoleAdmin), ManageRoles, "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.Can(tt.perm); got != tt.can {
+				t.Errorf("Can(%s) = %v, want %v", tt.perm, got, tt.can)
+			}
+			if got := tt.principal.CanInCourse(tt.perm, tt.course); got != tt.inCourse {
+				t.Errorf("CanInCourse(%s, %s) = %v, want %v", tt.perm, tt.course, got, tt.inCourse)
+			}
+		})
+	}
+}
+
+func TestUnscopedRolesDropCourses(t *testing.T) {
+	p := For(&models.User{ID: primitive.NewObjectID(), Role: models.RoleModerator, RoleCourses: []string{"MAC0110"}})
+	if len(p.Courses) != 0 {
+		t.Errorf("Courses = %v, want empty for an unscoped role", p.Courses)
+	}
+}
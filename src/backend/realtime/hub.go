@@ -0,0 +1,250 @@
+// Package realtime entrega eventos aos clientes conectados, por Server-Sent Events
+// ou WebSocket, sem que eles precisem consultar a API de tempos em tempos. O Hub
+// vive no processo: cada instância do servidor só entrega os eventos publicados
+// nela mesma.
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tipos de evento.
+const (
+	// EventNotification leva uma models.Notification nova do usuário.
+	EventNotification = "notification"
+	// EventUnread leva a contagem de notificações não lidas: {"count": 3}.
+	EventUnread = "unread"
+	// EventComment leva um comentário novo no recurso que o usuário está vendo.
+	EventComment = "comment"
+	// EventResync avisa que eventos se perderam durante a desconexão: o cliente
+	// deve buscar de novo as notificações e os comentários.
+	EventResync = "resync"
+)
+
+// DefaultHistory é quantos eventos o Hub guarda para reenviar a quem reconecta.
+const DefaultHistory = 1024
+
+// subscriptionBuffer é quantos eventos podem esperar por um cliente lento. Se ele
+// ficar mais atrasado que isso, a inscrição é encerrada e o cliente, ao reconectar
+// com o Last-Event-ID, recebe o que perdeu pelo histórico.
+const subscriptionBuffer = 64
+
+// Event é um evento publicado. ID é crescente dentro de um mesmo processo e volta
+// do cliente no Last-Event-ID ao reconectar.
+type Event struct {
+	ID   string          `json:"id,omitempty"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+
+	seq      uint64
+	user     primitive.ObjectID
+	resource primitive.ObjectID
+}
+
+// Hub distribui os eventos entre as inscrições: os de um usuário vão para todas as
+// conexões dele, os de um recurso para quem o está vendo.
+type Hub struct {
+	mu sync.Mutex
+	// epoch distingue os IDs deste processo dos de um anterior, para que um
+	// Last-Event-ID de antes de um reinício não seja confundido com um atual.
+	epoch   string
+	seq     uint64
+	history []Event
+	size    int
+
+	byUser     map[primitive.ObjectID]map[*Subscription]struct{}
+	byResource map[primitive.ObjectID]map[*Subscription]struct{}
+}
+
+func NewHub(history int) *Hub {
+	return &Hub{
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:       history,
+		byUser:     make(map[primitive.ObjectID]map[*Subscription]struct{}),
+		byResource: make(map[primitive.ObjectID]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription é uma conexão inscrita no Hub. O canal de Events é fechado quando a
+// inscrição acaba, por Close ou por o cliente ter ficado para trás.
+type Subscription struct {
+	hub      *Hub
+	user     primitive.ObjectID
+	resource primitive.ObjectID
+	events   chan Event
+	closed   bool
+}
+
+// Subscribe inscreve uma conexão do usuário, vendo o recurso (ou nenhum, com
+// primitive.NilObjectID). Com o Last-Event-ID de uma conexão anterior, devolve
+// também os eventos perdidos desde ele; se parte deles já saiu do histórico, ou o ID
+// é de antes de um reinício, devolve só um EventResync.
+func (h *Hub) Subscribe(userID, resourceID primitive.ObjectID, lastEventID string) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{hub: h, user: userID, events: make(chan Event, subscriptionBuffer)}
+	add(h.byUser, userID, sub)
+	sub.watch(resourceID)
+
+	if lastEventID == "" {
+		return sub, nil
+	}
+	return sub, h.replay(sub, lastEventID)
+}
+
+// replay devolve os eventos da inscrição publicados depois de lastEventID.
+func (h *Hub) replay(sub *Subscription, lastEventID string) []Event {
+	last, ok := h.parseID(lastEventID)
+	oldest := h.seq + 1
+	if len(h.history) > 0 {
+		oldest = h.history[0].seq
+	}
+	if !ok || last > h.seq || last+1 < oldest {
+		return []Event{{ID: h.formatID(h.seq), Type: EventResync, Data: json.RawMessage("{}")}}
+	}
+	var missed []Event
+	for _, ev := range h.history {
+		if ev.seq > last && sub.wants(ev) {
+			missed = append(missed, ev)
+		}
+	}
+	return missed
+}
+
+func (h *Hub) formatID(seq uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+func (h *Hub) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// Publish manda um evento para todas as conexões do usuário.
+func (h *Hub) Publish(userID primitive.ObjectID, eventType string, data any) error {
+	return h.publish(Event{Type: eventType, user: userID}, data)
+}
+
+// PublishResource manda um evento para todos que estão vendo o recurso.
+func (h *Hub) PublishResource(resourceID primitive.ObjectID, eventType string, data any) error {
+	return h.publish(Event{Type: eventType, resource: resourceID}, data)
+}
+
+func (h *Hub) publish(ev Event, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("realtime: encoding %s event: %w", ev.Type, err)
+	}
+	ev.Data = raw
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	ev.seq = h.seq
+	ev.ID = h.formatID(h.seq)
+	if h.size > 0 {
+		h.history = append(h.history, ev)
+		if len(h.history) > h.size {
+			h.history = h.history[len(h.history)-h.size:]
+		}
+	}
+
+	targets := h.byUser[ev.user]
+	if !ev.resource.IsZero() {
+		targets = h.byResource[ev.resource]
+	}
+	for sub := range targets {
+		select {
+		case sub.events <- ev:
+		default:
+			sub.close()
+		}
+	}
+	return nil
+}
+
+// Connections conta as conexões abertas do usuário.
+func (h *Hub) Connections(userID primitive.ObjectID) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.byUser[userID])
+}
+
+// Events entrega os eventos da inscrição.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Watch troca o recurso que a conexão está vendo; primitive.NilObjectID para de
+// receber os eventos de recurso.
+func (s *Subscription) Watch(resourceID primitive.ObjectID) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if !s.closed {
+		s.watch(resourceID)
+	}
+}
+
+func (s *Subscription) watch(resourceID primitive.ObjectID) {
+	if !s.resource.IsZero() {
+		remove(s.hub.byResource, s.resource, s)
+	}
+	s.resource = resourceID
+	if !resourceID.IsZero() {
+		add(s.hub.byResource, resourceID, s)
+	}
+}
+
+// wants informa se o evento é para esta inscrição.
+func (s *Subscription) wants(ev Event) bool {
+	if !ev.resource.IsZero() {
+		return ev.resource == s.resource
+	}
+	return ev.user == s.user
+}
+
+// Close encerra a inscrição. Pode ser chamado mais de uma vez.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.close()
+}
+
+func (s *Subscription) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	remove(s.hub.byUser, s.user, s)
+	if !s.resource.IsZero() {
+		remove(s.hub.byResource, s.resource, s)
+	}
+	close(s.events)
+}
+
+func add(m map[primitive.ObjectID]map[*Subscription]struct{}, id primitive.ObjectID, s *Subscription) {
+	if m[id] == nil {
+		m[id] = make(map[*Subscription]struct{})
+	}
+	m[id][s] = struct{}{}
+}
+
+func remove(m map[primitive.ObjectID]map[*Subscription]struct{}, id primitive.ObjectID, s *Subscription) {
+	delete(m[id], s)
+	if len(m[id]) == 0 {
+		delete(m, id)
+	}
+}
@@ -0,0 +1,149 @@
+package realtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// next espera o próximo evento da inscrição.
+func next(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("a inscrição foi encerrada")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("nenhum evento chegou")
+	}
+	return Event{}
+}
+
+func expectNone(t *testing.T, sub *Subscription) {
+	t.Helper()
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("evento inesperado: %s %s", ev.Type, ev.Data)
+	default:
+	}
+}
+
+func TestPublishRouting(t *testing.T) {
+	hub := NewHub(DefaultHistory)
+	ana, bia := primitive.NewObjectID(), primitive.NewObjectID()
+	resource := primitive.NewObjectID()
+
+	anaPhone, _ := hub.Subscribe(ana, primitive.NilObjectID, "")
+	anaLaptop, _ := hub.Subscribe(ana, resource, "")
+	biaSub, _ := hub.Subscribe(bia, primitive.NilObjectID, "")
+	if hub.Connections(ana) != 2 {
+		t.Errorf("Connections = %d, want 2", hub.Connections(ana))
+	}
+
+	hub.Publish(ana, EventUnread, map[string]int{"count": 1})
+	for _, sub := range []*Subscription{anaPhone, anaLaptop} {
+		if ev := next(t, sub); ev.Type != EventUnread || string(ev.Data) != `{"count":1}` {
+			t.Errorf("evento = %s %s", ev.Type, ev.Data)
+		}
+	}
+	expectNone(t, biaSub)
+
+	hub.PublishResource(resource, EventComment, map[string]string{"content": "oi"})
+	if ev := next(t, anaLaptop); ev.Type != EventComment {
+		t.Errorf("evento = %s", ev.Type)
+	}
+	expectNone(t, anaPhone)
+
+	biaSub.Watch(resource)
+	anaLaptop.Watch(primitive.NilObjectID)
+	hub.PublishResource(resource, EventComment, map[string]string{"content": "de novo"})
+	next(t, biaSub)
+	expectNone(t, anaLaptop)
+
+	anaPhone.Close()
+	anaPhone.Close()
+	if _, open := <-anaPhone.Events(); open {
+		t.Error("o canal deveria fechar com Close")
+	}
+	if hub.Connections(ana) != 1 {
+		t.Errorf("Connections = %d, want 1", hub.Connections(ana))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	hub := NewHub(4)
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+	resource := primitive.NewObjectID()
+
+	sub, _ := hub.Subscribe(user, resource, "")
+	hub.Publish(user, EventNotification, 1)
+	last := next(t, sub).ID
+	sub.Close()
+
+	hub.Publish(user, EventNotification, 2)
+	hub.Publish(other, EventNotification, "de outro usuário")
+	hub.PublishResource(resource, EventComment, 3)
+
+	sub, missed := hub.Subscribe(user, resource, last)
+	defer sub.Close()
+	if len(missed) != 2 || string(missed[0].Data) != "2" || string(missed[1].Data) != "3" {
+		t.Fatalf("missed = %+v, want os eventos 2 e 3", missed)
+	}
+	if _, missed := hub.Subscribe(user, resource, missed[1].ID); len(missed) != 0 {
+		t.Errorf("nada foi perdido depois do último evento: %+v", missed)
+	}
+
+	// O histórico guarda 4 eventos: o evento seguinte a last já saiu dele.
+	hub.Publish(user, EventNotification, 4)
+	hub.Publish(user, EventNotification, 5)
+	for _, id := range []string{last, "outro-processo-7", "lixo"} {
+		_, missed := hub.Subscribe(user, resource, id)
+		if len(missed) != 1 || missed[0].Type != EventResync {
+			t.Errorf("Last-Event-ID %q: missed = %+v, want um resync", id, missed)
+		}
+	}
+
+	// O resync aponta para o fim do histórico: reconectar com ele não repete nada.
+	_, missed = hub.Subscribe(user, resource, "lixo")
+	if _, again := hub.Subscribe(user, resource, missed[0].ID); len(again) != 0 {
+		t.Errorf("depois do resync, nada a repetir: %+v", again)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub := NewHub(DefaultHistory)
+	user := primitive.NewObjectID()
+	sub, _ := hub.Subscribe(user, primitive.NilObjectID, "")
+
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		hub.Publish(user, EventNotification, i)
+	}
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+	if received != subscriptionBuffer {
+		t.Errorf("recebidos %d eventos antes de fechar, want %d", received, subscriptionBuffer)
+	}
+	if hub.Connections(user) != 0 {
+		t.Error("a inscrição lenta deveria ter saído do hub")
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	hub := NewHub(DefaultHistory)
+	user := primitive.NewObjectID()
+	sub, _ := hub.Subscribe(user, primitive.NilObjectID, "")
+	hub.Publish(user, EventUnread, map[string]int{"count": 2})
+
+	out, _ := json.Marshal(next(t, sub))
+	var msg map[string]any
+	json.Unmarshal(out, &msg)
+	if msg["type"] != EventUnread || msg["id"] == "" || msg["data"].(map[string]any)["count"] != float64(2) {
+		t.Errorf("JSON = %s", out)
+	}
+}
@@ -0,0 +1,26 @@
+package realtime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteSSE escreve o evento no formato de Server-Sent Events. O JSON não tem quebras
+// de linha, então cabe numa linha data só.
+func WriteSSE(w io.Writer, ev Event) error {
+	var buf bytes.Buffer
+	if ev.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", ev.ID)
+	}
+	fmt.Fprintf(&buf, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteSSEComment escreve uma linha de comentário, ignorada pelo EventSource; serve
+// para manter a conexão viva através de proxies.
+func WriteSSEComment(w io.Writer, text string) error {
+	_, err := fmt.Fprintf(w, ": %s\n\n", text)
+	return err
+}
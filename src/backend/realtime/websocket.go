@@ -0,0 +1,267 @@
+package realtime
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conn é o lado do servidor de uma conexão WebSocket (RFC 6455), só com o que o
+// canal de eventos usa: mensagens de texto nos dois sentidos, ping, pong e close. O
+// servidor não usa extensões nem subprotocolos.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu sync.Mutex
+}
+
+// Opcodes e códigos de fechamento usados.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	ClosePolicy        = 1008
+	CloseTooBig        = 1009
+)
+
+// MaxMessageSize limita as mensagens do cliente, que só manda comandos curtos.
+const MaxMessageSize = 4 << 10
+
+// websocketGUID entra no cálculo do Sec-WebSocket-Accept (RFC 6455, seção 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed é devolvido por ReadText quando o cliente fecha a conexão.
+var ErrClosed = errors.New("realtime: websocket closed")
+
+// IsWebSocketUpgrade informa se a requisição pede a troca para WebSocket.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade faz o handshake e assume a conexão. Se a requisição não é um handshake
+// válido, responde 400 (ou 426, para outra versão do protocolo) e devolve o erro.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsWebSocketUpgrade(r) {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("realtime: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("realtime: unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("realtime: invalid Sec-WebSocket-Key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("realtime: response writer cannot be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("realtime: hijacking connection: %w", err)
+	}
+	// Um handshake que não responde a tempo não pode prender a conexão.
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", AcceptKey(key))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("realtime: writing handshake: %w", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return &Conn{conn: conn, br: rw.Reader}, nil
+}
+
+// AcceptKey calcula o Sec-WebSocket-Accept que responde à chave do cliente.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText manda uma mensagem de texto. Pode ser chamado de várias goroutines.
+func (c *Conn) WriteText(p []byte) error {
+	return c.writeFrame(opText, p)
+}
+
+// Ping manda um ping; o navegador responde sozinho com um pong.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close manda o frame de fechamento com o código e o motivo e fecha a conexão.
+func (c *Conn) Close(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	payload = append(payload, reason...)
+	c.writeFrame(opClose, payload)
+	return c.conn.Close()
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	// O servidor nunca mascara os frames (RFC 6455, seção 5.1).
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadText espera a próxima mensagem de texto do cliente, respondendo aos pings no
+// caminho. Devolve ErrClosed quando o cliente fecha a conexão; em erros de
+// protocolo, fecha a conexão com o código adequado e devolve o erro.
+func (c *Conn) ReadText() ([]byte, error) {
+	var message []byte
+	var opcode byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := uint16(CloseNormal)
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			c.Close(code, "")
+			return nil, ErrClosed
+		case opText, opBinary:
+			if message != nil {
+				return nil, c.fail(CloseProtocolError, "realtime: new message inside a fragmented one")
+			}
+			opcode = op
+			message = payload
+		case opContinuation:
+			if message == nil {
+				return nil, c.fail(CloseProtocolError, "realtime: continuation without a message")
+			}
+			if len(message)+len(payload) > MaxMessageSize {
+				return nil, c.fail(CloseTooBig, "realtime: message too big")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, c.fail(CloseProtocolError, fmt.Sprintf("realtime: unknown opcode %#x", op))
+		}
+		if !fin {
+			continue
+		}
+		if opcode != opText {
+			return nil, c.fail(CloseProtocolError, "realtime: only text messages are accepted")
+		}
+		return message, nil
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "realtime: reserved bits set")
+	}
+	// Todo frame do cliente vem mascarado (RFC 6455, seção 5.3).
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "realtime: unmasked client frame")
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	control := opcode&0x8 != 0
+	if control && (length > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, "realtime: invalid control frame")
+	}
+	if length > MaxMessageSize {
+		return false, 0, nil, c.fail(CloseTooBig, "realtime: message too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// fail fecha a conexão por um erro do cliente e devolve o erro.
+func (c *Conn) fail(code uint16, reason string) error {
+	c.Close(code, "")
+	return errors.New(reason)
+}
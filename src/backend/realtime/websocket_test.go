@@ -0,0 +1,191 @@
+package realtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Exemplo da RFC 6455, seção 1.3.
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey = %q", got)
+	}
+}
+
+// dial abre uma conexão WebSocket crua com o servidor de teste.
+func dial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %d %v", resp.StatusCode, resp.Header)
+	}
+	return conn, br
+}
+
+// writeFrame manda um frame como um navegador, mascarado se masked.
+func writeFrame(conn net.Conn, fin bool, opcode byte, payload []byte, masked bool) {
+	var buf bytes.Buffer
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	buf.WriteByte(first)
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	if len(payload) < 126 {
+		buf.WriteByte(maskBit | byte(len(payload)))
+	} else {
+		buf.WriteByte(maskBit | 126)
+		binary.Write(&buf, binary.BigEndian, uint16(len(payload)))
+	}
+	if masked {
+		mask := []byte{1, 2, 3, 4}
+		buf.Write(mask)
+		for i, b := range payload {
+			buf.WriteByte(b ^ mask[i%4])
+		}
+	} else {
+		buf.Write(payload)
+	}
+	conn.Write(buf.Bytes())
+}
+
+func readFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[1]&0x80 != 0 {
+		t.Fatal("o servidor não pode mascarar os frames")
+	}
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+// echoServer devolve em maiúsculas cada mensagem recebida.
+func echoServer(t *testing.T, errs chan<- error) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		for {
+			msg, err := conn.ReadText()
+			if err != nil {
+				errs <- err
+				return
+			}
+			conn.WriteText(bytes.ToUpper(msg))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	errs := make(chan error, 1)
+	conn, br := dial(t, echoServer(t, errs))
+
+	writeFrame(conn, true, opText, []byte("olá"), true)
+	if op, msg := readFrame(t, br); op != opText || string(msg) != "OLÁ" {
+		t.Errorf("resposta = %#x %q", op, msg)
+	}
+
+	long := strings.Repeat("a", 300)
+	writeFrame(conn, true, opText, []byte(long), true)
+	if _, msg := readFrame(t, br); string(msg) != strings.ToUpper(long) {
+		t.Errorf("mensagem de 300 bytes voltou com %d", len(msg))
+	}
+
+	// Um ping no meio de uma mensagem fragmentada é respondido na hora.
+	writeFrame(conn, false, opText, []byte("meio "), true)
+	writeFrame(conn, true, opPing, []byte("p"), true)
+	if op, msg := readFrame(t, br); op != opPong || string(msg) != "p" {
+		t.Errorf("ping respondido com %#x %q", op, msg)
+	}
+	writeFrame(conn, true, opContinuation, []byte("a meio"), true)
+	if _, msg := readFrame(t, br); string(msg) != "MEIO A MEIO" {
+		t.Errorf("mensagem fragmentada = %q", msg)
+	}
+
+	writeFrame(conn, true, opClose, []byte{0x03, 0xE8}, true)
+	if op, _ := readFrame(t, br); op != opClose {
+		t.Errorf("fechamento respondido com %#x", op)
+	}
+	if err := <-errs; err != ErrClosed {
+		t.Errorf("ReadText = %v, want ErrClosed", err)
+	}
+}
+
+func TestWebSocketRejectsUnmaskedFrames(t *testing.T) {
+	errs := make(chan error, 1)
+	conn, br := dial(t, echoServer(t, errs))
+
+	writeFrame(conn, true, opText, []byte("sem máscara"), false)
+	op, payload := readFrame(t, br)
+	if op != opClose || binary.BigEndian.Uint16(payload) != CloseProtocolError {
+		t.Errorf("resposta = %#x %v, want close 1002", op, payload)
+	}
+	if err := <-errs; err == nil || err == ErrClosed {
+		t.Errorf("ReadText = %v, want erro de protocolo", err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	rr := httptest.NewRecorder()
+	if _, err := Upgrade(rr, httptest.NewRequest(http.MethodGet, "/", nil)); err == nil || rr.Code != http.StatusBadRequest {
+		t.Errorf("Upgrade = %v, status %d", err, rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	rr = httptest.NewRecorder()
+	if _, err := Upgrade(rr, req); err == nil || rr.Code != http.StatusUpgradeRequired {
+		t.Errorf("versão 8: %v, status %d", err, rr.Code)
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	WriteSSE(&buf, Event{ID: "x-1", Type: EventUnread, Data: []byte(`{"count":1}`)})
+	WriteSSE(&buf, Event{Type: EventUnread, Data: []byte(`{"count":2}`)})
+	want := "id: x-1\nevent: unread\ndata: {\"count\":1}\n\nevent: unread\ndata: {\"count\":2}\n\n"
+	if buf.String() != want {
+		t.Errorf("WriteSSE = %q", buf.String())
+	}
+}
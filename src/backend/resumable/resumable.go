@@ -0,0 +1,278 @@
+// Package resumable guarda os uploads retomáveis (no estilo do protocolo tus): o
+// cliente abre uma sessão com o tamanho total, envia o arquivo em pedaços a partir do
+// offset que o servidor já tem e, no fim, o handler transforma o arquivo completo num
+// recurso. Sessões paradas por mais que o TTL são apagadas por Cleanup.
+package resumable
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound       = errors.New("resumable: upload not found")
+	ErrExpired        = errors.New("resumable: upload expired")
+	ErrOffsetMismatch = errors.New("resumable: offset does not match")
+	ErrTooLarge       = errors.New("resumable: chunk goes past the upload length")
+	ErrIncomplete     = errors.New("resumable: upload is not complete")
+)
+
+// Session é o estado de um upload, gravado em <id>.json ao lado de <id>.part.
+type Session struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	FileName string `json:"fileName"`
+	Length   int64  `json:"length"`
+	Offset   int64  `json:"offset"`
+	// Metadata traz os campos do formulário de upload (title, description, tags, ...).
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+func (s *Session) Complete() bool {
+	return s.Offset == s.Length
+}
+
+// Manager guarda as sessões num diretório do disco local. Os pedaços de uma mesma
+// sessão são gravados um de cada vez.
+type Manager struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewManager cria o diretório se preciso. ttl é quanto tempo uma sessão pode ficar
+// sem receber pedaços antes de ser descartada.
+func NewManager(dir string, ttl time.Duration) (*Manager, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Manager{dir: dir, ttl: ttl, now: time.Now, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func (m *Manager) metaPath(id string) string { return filepath.Join(m.dir, id+".json") }
+func (m *Manager) dataPath(id string) string { return filepath.Join(m.dir, id+".part") }
+
+// lock serializa as operações sobre uma sessão.
+func (m *Manager) lock(id string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		m.locks[id] = l
+	}
+	m.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// Create abre uma sessão vazia para um arquivo de length bytes.
+func (m *Manager) Create(userID, fileName string, length int64, metadata map[string]string) (*Session, error) {
+	now := m.now()
+	s := &Session{
+		ID:        strings.ReplaceAll(uuid.New().String(), "-", ""),
+		UserID:    userID,
+		FileName:  fileName,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl),
+	}
+	f, err := os.Create(m.dataPath(s.ID))
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := m.save(s); err != nil {
+		os.Remove(m.dataPath(s.ID))
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get devolve a sessão; ErrExpired se passou do prazo (ela some no próximo Cleanup).
+func (m *Manager) Get(id string) (*Session, error) {
+	s, err := m.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.now().After(s.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	return s, nil
+}
+
+// Append grava o pedaço lido de r a partir de offset, que precisa ser igual ao que o
+// servidor já tem. Se a conexão cair no meio, o que chegou fica salvo e o cliente
+// retoma do novo offset (consultado com Get). O prazo da sessão é renovado.
+func (m *Manager) Append(id string, offset int64, r io.Reader) (*Session, error) {
+	unlock := m.lock(id)
+	defer unlock()
+
+	s, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != s.Offset {
+		return s, ErrOffsetMismatch
+	}
+
+	f, err := os.OpenFile(m.dataPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(s.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Lê um byte além do que falta para detectar pedaços grandes demais.
+	remaining := s.Length - s.Offset
+	n, copyErr := io.Copy(f, io.LimitReader(r, remaining+1))
+	if n > remaining {
+		n = remaining
+		copyErr = ErrTooLarge
+	}
+	if err := f.Truncate(s.Offset + n); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	s.Offset += n
+	s.ExpiresAt = m.now().Add(m.ttl)
+	if err := m.save(s); err != nil {
+		return nil, err
+	}
+	return s, copyErr
+}
+
+// Open abre o arquivo de uma sessão completa para leitura.
+func (m *Manager) Open(id string) (*os.File, error) {
+	s, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Complete() {
+		return nil, ErrIncomplete
+	}
+	return os.Open(m.dataPath(id))
+}
+
+// Remove apaga a sessão e o arquivo parcial.
+func (m *Manager) Remove(id string) error {
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	unlock := m.lock(id)
+	defer unlock()
+
+	m.mu.Lock()
+	delete(m.locks, id)
+	m.mu.Unlock()
+
+	err := os.Remove(m.metaPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if rmErr := os.Remove(m.dataPath(id)); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// Cleanup apaga as sessões vencidas e devolve quantas foram removidas.
+func (m *Manager) Cleanup() (int, error) {
+	matches, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, path := range matches {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		s, err := m.load(id)
+		if err != nil || m.now().After(s.ExpiresAt) {
+			if m.Remove(id) == nil {
+				removed++
+			}
+		}
+	}
+
+	// Arquivos parciais sem metadados sobram quando o servidor cai no meio de Create.
+	parts, err := filepath.Glob(filepath.Join(m.dir, "*.part"))
+	if err != nil {
+		return removed, err
+	}
+	for _, path := range parts {
+		id := strings.TrimSuffix(filepath.Base(path), ".part")
+		if _, err := os.Stat(m.metaPath(id)); errors.Is(err, os.ErrNotExist) {
+			os.Remove(path)
+		}
+	}
+	return removed, nil
+}
+
+// StartCleanup roda Cleanup a cada interval numa goroutine própria.
+func (m *Manager) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := m.Cleanup()
+			if err != nil {
+				log.Printf("Erro ao limpar uploads abandonados: %v", err)
+			} else if removed > 0 {
+				log.Printf("%d uploads abandonados foram apagados", removed)
+			}
+		}
+	}()
+}
+
+func (m *Manager) load(id string) (*Session, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(m.metaPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// save grava os metadados num arquivo temporário e renomeia, para nunca deixar um
+// JSON pela metade.
+func (m *Manager) save(s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := m.metaPath(s.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.metaPath(s.ID))
+}
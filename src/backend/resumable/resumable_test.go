@@ -0,0 +1,115 @@
+package resumable
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenReader entrega alguns bytes e depois falha, como uma conexão que caiu.
+type brokenReader struct {
+	data string
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func TestUploadInChunks(t *testing.T) {
+	m, err := NewManager(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+
+	s, err := m.Create("user1", "gravacao.mp4", 10, map[string]string{"title": "Aula 1"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), s.Offset)
+
+	_, err = m.Open(s.ID)
+	assert.Equal(t, ErrIncomplete, err)
+
+	s, err = m.Append(s.ID, 0, strings.NewReader("0123"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), s.Offset)
+
+	_, err = m.Append(s.ID, 0, strings.NewReader("0123"))
+	assert.Equal(t, ErrOffsetMismatch, err, "Pedaço repetido precisa ser recusado")
+
+	// A conexão cai no meio: o que chegou fica e o cliente retoma do novo offset.
+	s, err = m.Append(s.ID, 4, &brokenReader{data: "45"})
+	assert.Error(t, err)
+	assert.Equal(t, int64(6), s.Offset)
+
+	s, err = m.Get(s.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), s.Offset)
+	assert.Equal(t, "Aula 1", s.Metadata["title"])
+
+	s, err = m.Append(s.ID, 6, strings.NewReader("6789"))
+	assert.NoError(t, err)
+	assert.True(t, s.Complete())
+
+	f, err := m.Open(s.ID)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(f)
+		f.Close()
+		assert.Equal(t, "0123456789", string(data))
+	}
+
+	assert.NoError(t, m.Remove(s.ID))
+	_, err = m.Get(s.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, m.Remove(s.ID))
+}
+
+func TestChunkPastLength(t *testing.T) {
+	m, _ := NewManager(t.TempDir(), time.Hour)
+	s, _ := m.Create("user1", "a.pdf", 4, nil)
+
+	s, err := m.Append(s.ID, 0, strings.NewReader("012345"))
+	assert.Equal(t, ErrTooLarge, err)
+	assert.Equal(t, int64(4), s.Offset, "Só o que cabe no tamanho declarado é guardado")
+	assert.True(t, s.Complete())
+}
+
+func TestExpiryAndCleanup(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(dir, time.Hour)
+	old, _ := m.Create("user1", "a.pdf", 4, nil)
+	m.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+	active, _ := m.Create("user1", "b.pdf", 4, nil)
+	_, err := m.Append(active.ID, 0, strings.NewReader("01"))
+	assert.NoError(t, err)
+
+	// Um arquivo parcial sem metadados, de um Create interrompido.
+	orphan := filepath.Join(dir, "0123456789abcdef0123456789abcdef.part")
+	assert.NoError(t, os.WriteFile(orphan, []byte("x"), 0o644))
+
+	m.now = func() time.Time { return time.Now().Add(80 * time.Minute) }
+	_, err = m.Get(old.ID)
+	assert.Equal(t, ErrExpired, err)
+	_, err = m.Append(old.ID, 0, strings.NewReader("01"))
+	assert.Equal(t, ErrExpired, err)
+
+	removed, err := m.Cleanup()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = m.Get(old.ID)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = m.Get(active.ID)
+	assert.NoError(t, err, "Sessões com pedaços recentes continuam valendo")
+	_, err = os.Stat(orphan)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = m.Get("../../etc/passwd")
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize é o tamanho de cada pedaço enviado ao clamd; precisa ficar abaixo do
+// StreamMaxLength configurado nele.
+const chunkSize = 64 << 10
+
+// ClamdScanner envia o arquivo ao clamd com o comando INSTREAM: cada pedaço vai
+// precedido do tamanho em 4 bytes (big-endian) e um pedaço de tamanho zero encerra o
+// envio. A resposta é "stream: OK" ou "stream: <assinatura> FOUND".
+type ClamdScanner struct {
+	network string
+	address string
+	// Timeout limita a conversa inteira com o clamd, envio e veredito.
+	Timeout time.Duration
+}
+
+func NewClamdScanner(addr string) *ClamdScanner {
+	network, address := "tcp", addr
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		network, address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		address = strings.TrimPrefix(addr, "tcp://")
+	}
+	return &ClamdScanner{network: network, address: address, Timeout: 2 * time.Minute}
+}
+
+func (c *ClamdScanner) Scan(r io.Reader) (Result, error) {
+	conn, err := net.DialTimeout(c.network, c.address, 10*time.Second)
+	if err != nil {
+		return Result{}, fmt.Errorf("scan: connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	// O prefixo "z" pede respostas terminadas em \0 em vez de \n.
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("scan: sending command: %w", err)
+	}
+	if err := sendChunks(conn, r); err != nil {
+		// O clamd fecha a conexão quando o arquivo passa do limite dele; a resposta
+		// explica o motivo melhor que o erro de escrita.
+		if reply, readErr := readReply(conn); readErr == nil {
+			return parseReply(reply)
+		}
+		return Result{}, err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, fmt.Errorf("scan: reading reply: %w", err)
+	}
+	return parseReply(reply)
+}
+
+func sendChunks(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("scan: sending data: %w", werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("scan: reading file: %w", err)
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", err
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+func parseReply(reply string) (Result, error) {
+	// "stream: OK", "stream: Eicar-Test-Signature FOUND" ou "INSTREAM size limit exceeded. ERROR".
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("scan: clamd: %s", reply)
+}
@@ -0,0 +1,94 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd entende o INSTREAM e acusa o arquivo de teste EICAR, como o clamd faria.
+// maxSize imita o StreamMaxLength.
+func fakeClamd(t *testing.T, maxSize int) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxSize)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxSize int) {
+	defer conn.Close()
+	cmd := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, cmd); err != nil || string(cmd) != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	var data bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, conn, int64(size)); err != nil {
+			return
+		}
+		if data.Len() > maxSize {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+	if strings.Contains(data.String(), eicar) {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamdScanner(t *testing.T) {
+	addr := fakeClamd(t, 1<<20)
+	s := NewClamdScanner("tcp://" + addr)
+
+	res, err := s.Scan(strings.NewReader("%PDF-1.4 lista de exercícios"))
+	assert.NoError(t, err)
+	assert.False(t, res.Infected)
+
+	// O arquivo ocupa vários pedaços e a assinatura fica no último.
+	big := strings.Repeat("a", 3*chunkSize+10) + eicar
+	res, err = s.Scan(strings.NewReader(big))
+	assert.NoError(t, err)
+	assert.True(t, res.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", res.Signature)
+}
+
+func TestClamdScannerErrors(t *testing.T) {
+	s := NewClamdScanner(fakeClamd(t, 10))
+	_, err := s.Scan(strings.NewReader(strings.Repeat("a", 100)))
+	assert.ErrorContains(t, err, "size limit exceeded")
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	_, err = NewClamdScanner(addr).Scan(strings.NewReader("x"))
+	assert.Error(t, err, "Sem clamd não há veredito, e o arquivo não pode passar como limpo")
+}
@@ -0,0 +1,40 @@
+// Package scan verifica os arquivos enviados contra um antivírus antes de eles ficarem
+// disponíveis. O driver de produção conversa com o clamd (ClamAV) pelo protocolo
+// INSTREAM; quem usa o pacote só conhece a interface Scanner.
+package scan
+
+import (
+	"io"
+	"log"
+)
+
+// Result é o veredito do antivírus sobre um arquivo.
+type Result struct {
+	Infected bool
+	// Signature é o nome da assinatura encontrada (ex.: "Eicar-Test-Signature").
+	Signature string
+}
+
+// Scanner examina o conteúdo de r. Um erro significa que não foi possível obter um
+// veredito (antivírus fora do ar, arquivo grande demais para ele, ...), e o arquivo
+// não deve ser tratado como limpo.
+type Scanner interface {
+	Scan(r io.Reader) (Result, error)
+}
+
+// Nop considera tudo limpo. É o que main usa quando nenhum antivírus foi configurado.
+type Nop struct{}
+
+func (Nop) Scan(r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// FromAddress devolve um ClamdScanner para addr ("tcp://host:3310",
+// "unix:///run/clamav/clamd.ctl" ou só "host:porta"), ou Nop se addr for vazio.
+func FromAddress(addr string) Scanner {
+	if addr == "" {
+		log.Println("Aviso: CLAMD_ADDRESS não definido; os uploads não passam por antivírus")
+		return Nop{}
+	}
+	return NewClamdScanner(addr)
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// token é uma palavra do texto original: Term é a forma indexada (sem acento e
+// reduzida ao radical) e Start/End marcam os bytes da palavra no texto original,
+// usados para montar os trechos destacados.
+type token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// stopwords são palavras comuns demais em português para ajudar no ranking.
+var stopwords = map[string]bool{
+	"a": true, "o": true, "as": true, "os": true, "e": true, "ou": true,
+	"de": true, "da": true, "do": true, "das": true, "dos": true,
+	"em": true, "na": true, "no": true, "nas": true, "nos": true,
+	"um": true, "uma": true, "uns": true, "umas": true,
+	"para": true, "pra": true, "por": true, "com": true, "sem": true,
+	"que": true, "se": true, "ao": true, "aos": true,
+}
+
+// Fold remove acentos e converte para minúsculas ("Cálculo" -> "calculo").
+func Fold(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+// Analyze transforma um texto na lista de termos indexáveis, na ordem em que aparecem.
+func Analyze(text string) []string {
+	tokens := tokenize(text)
+	terms := make([]string, len(tokens))
+	for i, tok := range tokens {
+		terms[i] = tok.Term
+	}
+	return terms
+}
+
+// tokenize quebra o texto em palavras (letras e dígitos), descarta stopwords e
+// devolve cada palavra já normalizada por Fold e Stem.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := Fold(text[start:end])
+		if !stopwords[word] {
+			tokens = append(tokens, token{Term: Stem(word), Start: start, End: end})
+		}
+		start = -1
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// Stem reduz uma palavra já passada por Fold a um radical aproximado. É uma versão
+// do stemmer "leve" de Savoy para o português: trata plurais, femininos, advérbios
+// em -mente e a vogal temática final. Não tenta ser tão agressivo quanto o RSLP —
+// o objetivo é que "provas" e "prova" ou "cálculos" e "calculo" caiam no mesmo
+// termo sem juntar palavras de sentidos diferentes.
+func Stem(word string) string {
+	if utf8.RuneCountInString(word) < 4 {
+		return word
+	}
+	// Números e códigos de disciplina (ex.: "mac0110") não são palavras.
+	for _, r := range word {
+		if unicode.IsDigit(r) {
+			return word
+		}
+	}
+
+	word = removePlural(word)
+	if len(word) > 3 && strings.HasSuffix(word, "a") {
+		word = normalizeFeminine(word)
+	}
+	if len(word) > 4 {
+		switch word[len(word)-1] {
+		case 'a', 'e', 'o':
+			word = word[:len(word)-1]
+		}
+	}
+	return word
+}
+
+func removePlural(w string) string {
+	n := len(w)
+	switch {
+	case n > 4 && strings.HasSuffix(w, "es") && strings.ContainsRune("rslz", rune(w[n-3])):
+		return w[:n-2]
+	case n > 3 && strings.HasSuffix(w, "ns"):
+		return w[:n-2] + "m"
+	case n > 4 && strings.HasSuffix(w, "eis"):
+		return w[:n-3] + "el"
+	case n > 4 && strings.HasSuffix(w, "ais"):
+		return w[:n-3] + "al"
+	case n > 4 && strings.HasSuffix(w, "ois"):
+		return w[:n-3] + "ol"
+	case n > 4 && strings.HasSuffix(w, "is"):
+		return w[:n-2] + "il"
+	case n > 3 && (strings.HasSuffix(w, "oes") || strings.HasSuffix(w, "aes")):
+		return w[:n-3] + "ao"
+	case n > 6 && strings.HasSuffix(w, "mente"):
+		return w[:n-5]
+	case n > 3 && strings.HasSuffix(w, "s"):
+		return w[:n-1]
+	}
+	return w
+}
+
+func normalizeFeminine(w string) string {
+	n := len(w)
+	if n > 7 {
+		for _, suffix := range []string{"inha", "iaca", "eira"} {
+			if strings.HasSuffix(w, suffix) {
+				return w[:n-1] + "o"
+			}
+		}
+	}
+	if n > 6 {
+		for _, suffix := range []string{"osa", "ica", "ida", "ada", "iva", "ama"} {
+			if strings.HasSuffix(w, suffix) {
+				return w[:n-1] + "o"
+			}
+		}
+		switch {
+		case strings.HasSuffix(w, "ona"):
+			return w[:n-3] + "ao"
+		case strings.HasSuffix(w, "ora"):
+			return w[:n-1]
+		case strings.HasSuffix(w, "esa"):
+			return w[:n-1]
+		case strings.HasSuffix(w, "na"):
+			return w[:n-1] + "o"
+		}
+	}
+	return w
+}
@@ -0,0 +1,121 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetRadius é quantos bytes de contexto entram antes e depois do primeiro
+// termo encontrado nos campos longos (descrição e texto do arquivo).
+const snippetRadius = 80
+
+// Os campos curtos são devolvidos inteiros; os longos viram um trecho em volta do acerto.
+var shortFields = map[string]bool{
+	FieldTitle:     true,
+	FieldTags:      true,
+	FieldCourse:    true,
+	FieldProfessor: true,
+}
+
+const (
+	markOpen  = "<mark>"
+	markClose = "</mark>"
+)
+
+// highlights devolve, para cada campo em que algum termo da busca aparece, o texto
+// (ou um trecho dele) com as palavras encontradas marcadas. O texto original é
+// escapado, então o resultado pode ser inserido como HTML.
+func highlights(fields map[string]string, terms map[string]bool) map[string]string {
+	out := make(map[string]string)
+	for field, text := range fields {
+		var matches []token
+		for _, tok := range tokenize(text) {
+			if terms[tok.Term] {
+				matches = append(matches, tok)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		start, end := 0, len(text)
+		if !shortFields[field] {
+			start, end = snippetBounds(text, matches[0])
+		}
+		out[field] = markSnippet(text, start, end, matches)
+	}
+	return out
+}
+
+// snippetBounds escolhe a janela do trecho em volta do acerto, cortando em espaços
+// para não partir palavras no meio.
+func snippetBounds(text string, match token) (int, int) {
+	start := match.Start - snippetRadius
+	if start <= 0 {
+		start = 0
+	} else if i := strings.IndexAny(text[start:match.Start], " \n\t"); i >= 0 {
+		start += i + 1
+	} else {
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+
+	end := match.End + snippetRadius
+	if end >= len(text) {
+		end = len(text)
+	} else if i := strings.LastIndexAny(text[match.End:end], " \n\t"); i >= 0 {
+		end = match.End + i
+	} else {
+		for end > match.End && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+	return start, end
+}
+
+func markSnippet(text string, start, end int, matches []token) string {
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m.Start < pos || m.End > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(collapseSpaces(text[pos:m.Start])))
+		b.WriteString(markOpen)
+		b.WriteString(html.EscapeString(text[m.Start:m.End]))
+		b.WriteString(markClose)
+		pos = m.End
+	}
+	b.WriteString(html.EscapeString(collapseSpaces(text[pos:end])))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// collapseSpaces junta quebras de linha e espaços repetidos (comuns em texto
+// extraído de PDF) num espaço só.
+func collapseSpaces(s string) string {
+	if !strings.ContainsAny(s, "\n\t\r") && !strings.Contains(s, "  ") {
+		return s
+	}
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\n' || r == '\t' || r == '\r' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,283 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"uspshare/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Campos indexados de um recurso. Os nomes também são as chaves de Hit.Highlights.
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldTags        = "tags"
+	FieldCourse      = "course"
+	FieldProfessor   = "professor"
+	FieldContent     = "content"
+)
+
+// fieldWeights define quanto um acerto em cada campo pesa no ranking: bater no
+// título vale mais do que aparecer perdido no meio do PDF.
+var fieldWeights = map[string]float64{
+	FieldTitle:       3.0,
+	FieldTags:        2.0,
+	FieldCourse:      1.5,
+	FieldProfessor:   1.5,
+	FieldDescription: 1.0,
+	FieldContent:     0.5,
+}
+
+// Parâmetros do BM25.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document é a visão de um recurso que o índice conhece.
+type Document struct {
+	ID          primitive.ObjectID
+	Title       string
+	Description string
+	Tags        []string
+	Course      string
+	CourseCode  string
+	Professor   string
+	// Content é o texto extraído do arquivo enviado (vazio enquanto não houver extração).
+	Content string
+}
+
+// DocumentFromResource monta o Document de um recurso já com os dados de professor.
+func DocumentFromResource(r models.ResourceWithDetails, content string) Document {
+	return Document{
+		ID:          r.ID,
+		Title:       r.Title,
+		Description: r.Description,
+		Tags:        r.Tags,
+		Course:      r.Course,
+		CourseCode:  r.CourseCode,
+		Professor:   r.ProfessorName,
+		Content:     content,
+	}
+}
+
+func (d Document) fields() map[string]string {
+	return map[string]string{
+		FieldTitle:       d.Title,
+		FieldDescription: d.Description,
+		FieldTags:        strings.Join(d.Tags, ", "),
+		FieldCourse:      d.CourseCode + " " + d.Course,
+		FieldProfessor:   d.Professor,
+		FieldContent:     d.Content,
+	}
+}
+
+// Hit é um resultado da busca. Highlights traz, por campo, um trecho do texto
+// original com os termos encontrados envolvidos em <mark>...</mark>.
+type Hit struct {
+	ID         primitive.ObjectID `json:"id"`
+	Score      float64            `json:"score"`
+	Highlights map[string]string  `json:"highlights"`
+}
+
+type indexedDoc struct {
+	fields  map[string]string
+	lengths map[string]int
+}
+
+// Index é um índice invertido em memória com ranking BM25 por campo. É seguro para
+// uso concorrente; main o reconstrói a partir do banco na inicialização e os
+// handlers o mantêm atualizado a cada upload ou remoção.
+type Index struct {
+	mu sync.RWMutex
+	// postings[termo][recurso][campo] = frequência do termo no campo.
+	postings    map[string]map[primitive.ObjectID]map[string]int
+	docs        map[primitive.ObjectID]*indexedDoc
+	totalLength map[string]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings:    make(map[string]map[primitive.ObjectID]map[string]int),
+		docs:        make(map[primitive.ObjectID]*indexedDoc),
+		totalLength: make(map[string]int),
+	}
+}
+
+// Add indexa o documento, substituindo a versão anterior se já existir.
+func (idx *Index) Add(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.add(doc)
+}
+
+func (idx *Index) add(doc Document) {
+	idx.remove(doc.ID)
+
+	indexed := &indexedDoc{fields: doc.fields(), lengths: make(map[string]int)}
+	for field, text := range indexed.fields {
+		terms := Analyze(text)
+		indexed.lengths[field] = len(terms)
+		idx.totalLength[field] += len(terms)
+		for _, term := range terms {
+			byDoc, ok := idx.postings[term]
+			if !ok {
+				byDoc = make(map[primitive.ObjectID]map[string]int)
+				idx.postings[term] = byDoc
+			}
+			byField, ok := byDoc[doc.ID]
+			if !ok {
+				byField = make(map[string]int)
+				byDoc[doc.ID] = byField
+			}
+			byField[field]++
+		}
+	}
+	idx.docs[doc.ID] = indexed
+}
+
+// Remove tira o recurso do índice. Não faz nada se ele não estiver indexado.
+func (idx *Index) Remove(id primitive.ObjectID) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id primitive.ObjectID) {
+	indexed, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for field, text := range indexed.fields {
+		idx.totalLength[field] -= indexed.lengths[field]
+		for _, term := range Analyze(text) {
+			if byDoc, ok := idx.postings[term]; ok {
+				delete(byDoc, id)
+				if len(byDoc) == 0 {
+					delete(idx.postings, term)
+				}
+			}
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// Rebuild descarta o conteúdo atual e indexa os documentos informados.
+func (idx *Index) Rebuild(docs []Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.postings = make(map[string]map[primitive.ObjectID]map[string]int)
+	idx.docs = make(map[primitive.ObjectID]*indexedDoc)
+	idx.totalLength = make(map[string]int)
+	for _, doc := range docs {
+		idx.add(doc)
+	}
+}
+
+// Len devolve quantos recursos estão indexados.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Search devolve os recursos que contêm todos os termos da consulta, do mais para o
+// menos relevante, a partir de offset e com no máximo limit itens, junto com o
+// total de recursos encontrados.
+func (idx *Index) Search(query string, offset, limit int) ([]Hit, int) {
+	terms := uniqueTerms(Analyze(query))
+	if len(terms) == 0 {
+		return []Hit{}, 0
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Começa pelo termo mais raro para a interseção ficar pequena logo de cara.
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.postings[terms[i]]) < len(idx.postings[terms[j]])
+	})
+
+	var candidates []primitive.ObjectID
+	for id := range idx.postings[terms[0]] {
+		matchesAll := true
+		for _, term := range terms[1:] {
+			if _, ok := idx.postings[term][id]; !ok {
+				matchesAll = false
+				break
+			}
+		}
+		if matchesAll {
+			candidates = append(candidates, id)
+		}
+	}
+
+	hits := make([]Hit, 0, len(candidates))
+	for _, id := range candidates {
+		hits = append(hits, Hit{ID: id, Score: idx.score(id, terms)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID.Hex() > hits[j].ID.Hex()
+	})
+
+	total := len(hits)
+	if offset >= total {
+		return []Hit{}, total
+	}
+	hits = hits[offset:]
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	termSet := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		termSet[term] = true
+	}
+	for i := range hits {
+		hits[i].Highlights = highlights(idx.docs[hits[i].ID].fields, termSet)
+	}
+	return hits, total
+}
+
+func (idx *Index) score(id primitive.ObjectID, terms []string) float64 {
+	n := float64(len(idx.docs))
+	doc := idx.docs[id]
+
+	var score float64
+	for _, term := range terms {
+		byDoc := idx.postings[term]
+		df := float64(len(byDoc))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for field, tf := range byDoc[id] {
+			avg := float64(idx.totalLength[field]) / n
+			if avg == 0 {
+				avg = 1
+			}
+			lengthNorm := 1 - bm25B + bm25B*float64(doc.lengths[field])/avg
+			freq := float64(tf)
+			score += fieldWeights[field] * idf * freq * (bm25K1 + 1) / (freq + bm25K1*lengthNorm)
+		}
+	}
+	return score
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var out []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			out = append(out, term)
+		}
+	}
+	return out
+}
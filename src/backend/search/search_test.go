@@ -0,0 +1,112 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Run("Acentos e maiúsculas são ignorados", func(t *testing.T) {
+		assert.Equal(t, Analyze("cálculo"), Analyze("CALCULO"))
+		assert.Equal(t, Analyze("Álgebra Linear"), Analyze("algebra linear"))
+	})
+
+	t.Run("Plurais e femininos caem no mesmo radical", func(t *testing.T) {
+		assert.Equal(t, Analyze("provas"), Analyze("prova"))
+		assert.Equal(t, Analyze("cálculos"), Analyze("calculo"))
+		assert.Equal(t, Analyze("resoluções"), Analyze("resolução"))
+		assert.Equal(t, Analyze("funções"), Analyze("função"))
+	})
+
+	t.Run("Stopwords e pontuação são descartadas", func(t *testing.T) {
+		assert.Equal(t, []string{"list", "exercici"}, Analyze("Lista de exercícios!"))
+	})
+
+	t.Run("Códigos de disciplina ficam intactos", func(t *testing.T) {
+		assert.Equal(t, []string{"mac0110"}, Analyze("MAC0110"))
+	})
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex()
+	titleHit := Document{ID: primitive.NewObjectID(), Title: "Prova de Cálculo I", CourseCode: "MAT2453"}
+	descHit := Document{ID: primitive.NewObjectID(), Title: "Lista 3", Description: "Exercícios de calculo diferencial"}
+	contentHit := Document{
+		ID:      primitive.NewObjectID(),
+		Title:   "Resumo",
+		Content: strings.Repeat("texto qualquer ", 20) + "limites e derivadas no cálculo\n\nde uma variável" + strings.Repeat(" fim", 20),
+	}
+	other := Document{ID: primitive.NewObjectID(), Title: "Física Experimental", Tags: []string{"laboratório"}, Professor: "Ana Souza"}
+	idx.Rebuild([]Document{titleHit, descHit, contentHit, other})
+
+	t.Run("Ordena por relevância e ignora acentos", func(t *testing.T) {
+		hits, total := idx.Search("calculo", 0, 10)
+		assert.Equal(t, 3, total)
+		if assert.Len(t, hits, 3) {
+			assert.Equal(t, titleHit.ID, hits[0].ID, "Acerto no título deve vir primeiro")
+			assert.Equal(t, descHit.ID, hits[1].ID)
+			assert.Equal(t, contentHit.ID, hits[2].ID)
+		}
+	})
+
+	t.Run("Todos os termos precisam aparecer", func(t *testing.T) {
+		hits, total := idx.Search("cálculo diferencial", 0, 10)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, descHit.ID, hits[0].ID)
+
+		_, total = idx.Search("cálculo laboratório", 0, 10)
+		assert.Equal(t, 0, total)
+	})
+
+	t.Run("Busca em tags, professor e código da disciplina", func(t *testing.T) {
+		for _, q := range []string{"laboratorio", "souza", "mat2453"} {
+			_, total := idx.Search(q, 0, 10)
+			assert.Equal(t, 1, total, q)
+		}
+	})
+
+	t.Run("Trechos destacados", func(t *testing.T) {
+		hits, _ := idx.Search("cálculo", 0, 10)
+		assert.Equal(t, "Prova de <mark>Cálculo</mark> I", hits[0].Highlights[FieldTitle])
+		assert.Equal(t, "Exercícios de <mark>calculo</mark> diferencial", hits[1].Highlights[FieldDescription])
+
+		content := hits[2].Highlights[FieldContent]
+		assert.True(t, strings.HasPrefix(content, "…"))
+		assert.True(t, strings.HasSuffix(content, "…"))
+		assert.Contains(t, content, "derivadas no <mark>cálculo</mark> de uma")
+		assert.NotContains(t, hits[2].Highlights, FieldTitle)
+	})
+
+	t.Run("Paginação por offset", func(t *testing.T) {
+		hits, total := idx.Search("calculo", 2, 1)
+		assert.Equal(t, 3, total)
+		if assert.Len(t, hits, 1) {
+			assert.Equal(t, contentHit.ID, hits[0].ID)
+		}
+		hits, _ = idx.Search("calculo", 5, 1)
+		assert.Empty(t, hits)
+	})
+
+	t.Run("Remove e Add atualizam o índice", func(t *testing.T) {
+		idx.Remove(titleHit.ID)
+		_, total := idx.Search("calculo", 0, 10)
+		assert.Equal(t, 2, total)
+
+		updated := descHit
+		updated.Description = "Exercícios de geometria"
+		idx.Add(updated)
+		_, total = idx.Search("calculo", 0, 10)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, 3, idx.Len())
+	})
+
+	t.Run("Texto é escapado nos destaques", func(t *testing.T) {
+		id := primitive.NewObjectID()
+		idx.Add(Document{ID: id, Title: "<script>vetores</script>"})
+		hits, _ := idx.Search("vetores", 0, 10)
+		assert.Equal(t, "&lt;script&gt;<mark>vetores</mark>&lt;/script&gt;", hits[0].Highlights[FieldTitle])
+	})
+}
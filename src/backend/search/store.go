@@ -0,0 +1,60 @@
+package search
+
+import (
+	"strings"
+
+	"uspshare/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resourceContent junta as páginas do texto extraído do arquivo. Recursos ainda não
+// processados (ou sem texto) são indexados só pelos metadados.
+func resourceContent(resources store.ResourceStore, id primitive.ObjectID) (string, error) {
+	pages, err := resources.GetResourceText(id)
+	if err == store.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(pages, "\n"), nil
+}
+
+// IndexResource (re)indexa um recurso com os dados atuais do banco. Recursos ainda em
+// verificação ou em quarentena saem do índice.
+func IndexResource(idx *Index, resources store.ResourceStore, id primitive.ObjectID) error {
+	res, err := resources.GetResourceByID(id)
+	if err != nil {
+		return err
+	}
+	if !res.Visible() {
+		idx.Remove(id)
+		return nil
+	}
+	content, err := resourceContent(resources, id)
+	if err != nil {
+		return err
+	}
+	idx.Add(DocumentFromResource(*res, content))
+	return nil
+}
+
+// RebuildFromStore reindexa todos os recursos do banco. Como o índice vive só em
+// memória, main chama isso na inicialização.
+func RebuildFromStore(idx *Index, resources store.ResourceStore) error {
+	all, err := resources.ListResources()
+	if err != nil {
+		return err
+	}
+	docs := make([]Document, len(all))
+	for i, res := range all {
+		content, err := resourceContent(resources, res.ID)
+		if err != nil {
+			return err
+		}
+		docs[i] = DocumentFromResource(res, content)
+	}
+	idx.Rebuild(docs)
+	return nil
+}
@@ -0,0 +1,2010 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"uspshare/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryStore implementa todos os repositórios em memória. Serve para os testes
+// dos handlers e para rodar o servidor localmente sem banco de dados.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users         []models.User
+	resources     []models.Resource
+	comments      []models.Comment
+	notifications []models.Notification
+	courses       []models.Course
+	professors    []models.Professor
+	tags          []models.Tag
+	likes         []models.Like
+	commentLikes  []models.CommentLike
+	resourceTexts map[primitive.ObjectID][]string
+	blobRefs      map[string]*blobRef
+	quarantine    []models.QuarantinedFile
+	versions      []models.ResourceVersion
+	commentEdits  []models.CommentEdit
+	reports       []models.Report
+	moderation    []models.ModerationAction
+	sessions      []models.Session
+	userTokens    []models.UserToken
+	rateLimits    map[string]models.RateLimit
+	preferences   map[primitive.ObjectID]models.NotificationPreferences
+}
+
+type blobRef struct {
+	key  string
+	refs int64
+}
+
+func NewMemoryStore() *Store {
+	m := &MemoryStore{
+		resourceTexts: make(map[primitive.ObjectID][]string),
+		blobRefs:      make(map[string]*blobRef),
+		rateLimits:    make(map[string]models.RateLimit),
+		preferences:   make(map[primitive.ObjectID]models.NotificationPreferences),
+	}
+	return &Store{
+		Users:         m,
+		Resources:     m,
+		Comments:      m,
+		Likes:         m,
+		Notifications: m,
+		Catalog:       m,
+		BlobRefs:      m,
+		Quarantine:    m,
+		Versions:      m,
+		Reports:       m,
+		Sessions:      m,
+		Tokens:        m,
+		RateLimits:    m,
+		Preferences:   m,
+		Integrity:     m,
+	}
+}
+
+// --- Users ---
+
+func (m *MemoryStore) CreateUser(user *models.User) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			return ErrDuplicateKey
+		}
+	}
+
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = time.Now()
+	user.Role = models.RoleStudent
+	m.users = append(m.users, models.User{
+		ID:           user.ID,
+		Name:         user.Name,
+		Email:        user.Email,
+		Password:     string(hashedPassword),
+		CreatedAt:    user.CreatedAt,
+		Role:         user.Role,
+		EmailPending: user.EmailPending,
+	})
+	return nil
+}
+
+func (m *MemoryStore) findUser(match func(u *models.User) bool) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := range m.users {
+		if match(&m.users[i]) {
+			user := m.users[i]
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetUserByEmail(email string) (*models.User, error) {
+	return m.findUser(func(u *models.User) bool { return u.Email == email })
+}
+
+func (m *MemoryStore) GetUserByID(id primitive.ObjectID) (*models.User, error) {
+	return m.findUser(func(u *models.User) bool { return u.ID == id })
+}
+
+func (m *MemoryStore) updateUser(id primitive.ObjectID, apply func(u *models.User)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == id {
+			apply(&m.users[i])
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserProfile(id primitive.ObjectID, profile ProfileUpdate) error {
+	return m.updateUser(id, func(u *models.User) {
+		u.Name = profile.Name
+		u.Course = profile.Course
+		u.Faculty = profile.Faculty
+		u.Bio = profile.Bio
+	})
+}
+
+func (m *MemoryStore) UpdateUserAvatar(id primitive.ObjectID, avatarURL string) error {
+	return m.updateUser(id, func(u *models.User) { u.AvatarURL = avatarURL })
+}
+
+func (m *MemoryStore) SetUserRole(id primitive.ObjectID, role string, courses []string) error {
+	return m.updateUser(id, func(u *models.User) {
+		u.Role = role
+		u.RoleCourses = append([]string(nil), courses...)
+	})
+}
+
+func (m *MemoryStore) SetUserPassword(id primitive.ObjectID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == id {
+			m.users[i].Password = string(hashedPassword)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) SetUserEmailVerified(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == id {
+			m.users[i].EmailPending = false
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) SetUserSuspended(id primitive.ObjectID, at *time.Time) error {
+	return m.updateUser(id, func(u *models.User) { u.SuspendedAt = at })
+}
+
+func (m *MemoryStore) SearchUsersByNameOrEmail(query string, selfID primitive.ObjectID) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var users []models.User
+	for _, u := range m.users {
+		if u.ID == selfID {
+			continue
+		}
+		if strings.Contains(strings.ToLower(u.Name), query) || strings.Contains(strings.ToLower(u.Email), query) {
+			u.Password = ""
+			users = append(users, u)
+		}
+		if len(users) == 10 {
+			break
+		}
+	}
+	return users, nil
+}
+
+func (m *MemoryStore) CountUsers() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.users)), nil
+}
+
+// --- Resources ---
+
+// resourceDetails reproduz em memória os $lookup feitos pelo MongoStore.
+// Deve ser chamada com o lock já adquirido.
+func (m *MemoryStore) resourceDetails(r models.Resource) models.ResourceWithDetails {
+	details := models.ResourceWithDetails{Resource: r}
+	details.Tags = append([]string(nil), r.Tags...)
+
+	for _, u := range m.users {
+		if u.ID == r.UserID {
+			details.UploaderName = u.Name
+			details.UploaderAvatar = u.AvatarURL
+			break
+		}
+	}
+	if r.ProfessorID != nil {
+		for _, p := range m.professors {
+			if p.ID == *r.ProfessorID {
+				details.ProfessorName = p.Name
+				details.ProfessorAvatar = p.AvatarURL
+				break
+			}
+		}
+	}
+
+	details.Likes = 0
+	for _, l := range m.likes {
+		if l.ResourceID == r.ID {
+			details.Likes++
+		}
+	}
+	for _, c := range m.comments {
+		if c.ResourceID == r.ID {
+			details.Comments++
+		}
+	}
+	return details
+}
+
+func (m *MemoryStore) filterResources(match func(r *models.Resource) bool) []models.ResourceWithDetails {
+	results := []models.ResourceWithDetails{}
+	for i := range m.resources {
+		if match(&m.resources[i]) {
+			results = append(results, m.resourceDetails(m.resources[i]))
+		}
+	}
+	return results
+}
+
+func (m *MemoryStore) CreateResource(resource *models.Resource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.resources = append(m.resources, *resource)
+	return nil
+}
+
+func (m *MemoryStore) ListResources() ([]models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterResources(func(r *models.Resource) bool { return r.Visible() }), nil
+}
+
+func (m *MemoryStore) SearchResources(query ResourceQuery) (*ResourcePage, error) {
+	query.normalize()
+	cursor, err := decodeResourceCursor(query.Cursor, query.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := m.filterResources(func(r *models.Resource) bool { return r.Visible() && matchesResourceQuery(r, &query) })
+	total := int64(len(matches))
+
+	key := func(r *models.ResourceWithDetails) (time.Time, int64) {
+		switch query.Sort {
+		case SortMostLiked:
+			return time.Time{}, int64(r.Likes)
+		case SortMostCommented:
+			return time.Time{}, int64(r.Comments)
+		}
+		return r.UploadDate, 0
+	}
+	// before informa se a vem antes de b na ordem decrescente (chave, ID).
+	before := func(aDate time.Time, aCount int64, aID primitive.ObjectID, bDate time.Time, bCount int64, bID primitive.ObjectID) bool {
+		if !aDate.Equal(bDate) {
+			return aDate.After(bDate)
+		}
+		if aCount != bCount {
+			return aCount > bCount
+		}
+		return aID.Hex() > bID.Hex()
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		iDate, iCount := key(&matches[i])
+		jDate, jCount := key(&matches[j])
+		return before(iDate, iCount, matches[i].ID, jDate, jCount, matches[j].ID)
+	})
+
+	items := []models.ResourceWithDetails{}
+	for i := range matches {
+		date, count := key(&matches[i])
+		if cursor != nil && !before(cursor.Date, cursor.Count, cursor.ID, date, count, matches[i].ID) {
+			continue
+		}
+		items = append(items, matches[i])
+		if len(items) > query.Limit {
+			break
+		}
+	}
+
+	return finishPage(query.Sort, items, query.Limit, total), nil
+}
+
+// matchesResourceQuery aplica em memória os filtros de ResourceQuery (exceto o cursor).
+func matchesResourceQuery(r *models.Resource, q *ResourceQuery) bool {
+	if q.CourseCode != "" && r.CourseCode != q.CourseCode {
+		return false
+	}
+	if q.Type != "" && r.Type != q.Type {
+		return false
+	}
+	if q.Semester != "" && r.Semester != q.Semester {
+		return false
+	}
+	if q.ProfessorID != nil && (r.ProfessorID == nil || *r.ProfessorID != *q.ProfessorID) {
+		return false
+	}
+	if q.UploaderID != nil && (r.UserID != *q.UploaderID || r.IsAnonymous) {
+		return false
+	}
+	if !q.From.IsZero() && r.UploadDate.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !r.UploadDate.Before(q.To) {
+		return false
+	}
+
+	if len(q.Tags) > 0 {
+		found := 0
+		for _, want := range q.Tags {
+			for _, tag := range r.Tags {
+				if tag == want {
+					found++
+					break
+				}
+			}
+		}
+		if found == 0 || (q.MatchAllTags && found < len(q.Tags)) {
+			return false
+		}
+	}
+
+	for _, term := range textTerms(q.Text) {
+		fields := append([]string{r.Title, r.Description, r.Course, r.CourseCode}, r.Tags...)
+		matched := false
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), term) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MemoryStore) GetResourceByID(id primitive.ObjectID) (*models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := m.filterResources(func(r *models.Resource) bool { return r.ID == id })
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &results[0], nil
+}
+
+func (m *MemoryStore) GetResourcesByUserID(userID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := m.filterResources(func(r *models.Resource) bool { return r.UserID == userID && r.DeletedAt == nil })
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].UploadDate.After(results[j].UploadDate)
+	})
+	return results, nil
+}
+
+func (m *MemoryStore) FindRelatedResources(courseCode string, currentResourceID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := m.filterResources(func(r *models.Resource) bool {
+		return r.Visible() && r.CourseCode == courseCode && r.ID != currentResourceID
+	})
+	if len(results) > 4 {
+		results = results[:4]
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) DeleteResourceByID(resourceID, userID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, r := range m.resources {
+		if r.ID == resourceID && r.UserID == userID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrNotFound
+	}
+	m.resources = append(m.resources[:index], m.resources[index+1:]...)
+
+	likes := m.likes[:0]
+	for _, l := range m.likes {
+		if l.ResourceID != resourceID {
+			likes = append(likes, l)
+		}
+	}
+	m.likes = likes
+
+	removedComments := make(map[primitive.ObjectID]bool)
+	comments := m.comments[:0]
+	for _, c := range m.comments {
+		if c.ResourceID != resourceID {
+			comments = append(comments, c)
+		} else {
+			removedComments[c.ID] = true
+		}
+	}
+	m.comments = comments
+
+	commentLikes := m.commentLikes[:0]
+	for _, l := range m.commentLikes {
+		if !removedComments[l.CommentID] {
+			commentLikes = append(commentLikes, l)
+		}
+	}
+	m.commentLikes = commentLikes
+
+	commentEdits := m.commentEdits[:0]
+	for _, e := range m.commentEdits {
+		if !removedComments[e.CommentID] {
+			commentEdits = append(commentEdits, e)
+		}
+	}
+	m.commentEdits = commentEdits
+
+	notifications := m.notifications[:0]
+	for _, n := range m.notifications {
+		if n.ResourceID != resourceID {
+			notifications = append(notifications, n)
+		}
+	}
+	m.notifications = notifications
+
+	delete(m.resourceTexts, resourceID)
+
+	versions := m.versions[:0]
+	for _, v := range m.versions {
+		if v.ResourceID != resourceID {
+			versions = append(versions, v)
+		}
+	}
+	m.versions = versions
+
+	return nil
+}
+
+func (m *MemoryStore) CountUserUploads(userID primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, r := range m.resources {
+		if r.UserID == userID && r.DeletedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) CountResources() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, r := range m.resources {
+		if r.DeletedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) GetDistinctCourses() ([]CourseInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var courses []CourseInfo
+	for _, r := range m.resources {
+		if seen[r.CourseCode] {
+			continue
+		}
+		seen[r.CourseCode] = true
+		courses = append(courses, CourseInfo{Code: r.CourseCode, Name: r.Course})
+	}
+	sort.Slice(courses, func(i, j int) bool { return courses[i].Code < courses[j].Code })
+	return courses, nil
+}
+
+func (m *MemoryStore) GetDistinctFieldValues(fieldName string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var stringValues []string
+	add := func(v string) {
+		if !seen[v] {
+			seen[v] = true
+			stringValues = append(stringValues, v)
+		}
+	}
+	for _, r := range m.resources {
+		switch fieldName {
+		case "tags":
+			for _, t := range r.Tags {
+				add(t)
+			}
+		case "courseCode":
+			add(r.CourseCode)
+		case "course":
+			add(r.Course)
+		case "type":
+			add(r.Type)
+		case "semester":
+			add(r.Semester)
+		}
+	}
+	sort.Strings(stringValues)
+	return stringValues, nil
+}
+
+func (m *MemoryStore) SetResourceProcessing(id primitive.ObjectID, status string, pageCount int, processingError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		if m.resources[i].ID == id {
+			m.resources[i].ProcessingStatus = status
+			m.resources[i].PageCount = pageCount
+			m.resources[i].ProcessingError = processingError
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) SetResourceThumbnail(id primitive.ObjectID, thumbnailURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		if m.resources[i].ID == id {
+			m.resources[i].ThumbnailUrl = thumbnailURL
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) SaveResourceText(id primitive.ObjectID, pages []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.resourceTexts[id] = append([]string(nil), pages...)
+	return nil
+}
+
+func (m *MemoryStore) GetResourceText(id primitive.ObjectID) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pages, ok := m.resourceTexts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]string(nil), pages...), nil
+}
+
+func (m *MemoryStore) FindResourceByContentHash(hash string) (*models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var oldest *models.Resource
+	for i := range m.resources {
+		r := &m.resources[i]
+		if r.ContentHash == hash && r.Visible() && (oldest == nil || r.UploadDate.Before(oldest.UploadDate)) {
+			oldest = r
+		}
+	}
+	if hash == "" || oldest == nil {
+		return nil, ErrNotFound
+	}
+	details := m.resourceDetails(*oldest)
+	return &details, nil
+}
+
+func (m *MemoryStore) SetResourceScan(id primitive.ObjectID, status, fileURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		if m.resources[i].ID == id {
+			m.resources[i].ScanStatus = status
+			m.resources[i].FileUrl = fileURL
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) ListPendingResourceIDs() ([]primitive.ObjectID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []primitive.ObjectID
+	for _, r := range m.resources {
+		if r.ProcessingStatus == models.ProcessingPending {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MemoryStore) UpdateResourceMetadata(id, userID primitive.ObjectID, update ResourceUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		r := &m.resources[i]
+		if r.ID == id && r.UserID == userID {
+			r.Title = update.Title
+			r.Description = update.Description
+			r.CourseCode = update.CourseCode
+			r.Course = update.Course
+			r.Type = update.Type
+			r.Semester = update.Semester
+			r.Tags = append([]string(nil), update.Tags...)
+			r.ProfessorID = update.ProfessorID
+			r.IsAnonymous = update.IsAnonymous
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) SetResourceFile(id primitive.ObjectID, file ResourceFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		r := &m.resources[i]
+		if r.ID == id && r.Version < file.Version {
+			r.Version = file.Version
+			r.FileName = file.FileName
+			r.FileUrl = file.FileUrl
+			r.ContentHash = file.ContentHash
+			r.ThumbnailUrl = ""
+			r.ProcessingStatus = models.ProcessingPending
+			r.ProcessingError = ""
+			r.PageCount = 0
+			delete(m.resourceTexts, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) TrashResource(id, userID primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		r := &m.resources[i]
+		if r.ID == id && r.UserID == userID && r.DeletedAt == nil {
+			r.DeletedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) HideResource(id primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		if m.resources[i].ID == id {
+			m.resources[i].HiddenAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) RestoreResource(id, userID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.resources {
+		r := &m.resources[i]
+		if r.ID == id && r.UserID == userID && r.DeletedAt != nil {
+			r.DeletedAt = nil
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) ListTrashedResources(userID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := m.filterResources(func(r *models.Resource) bool { return r.UserID == userID && r.DeletedAt != nil })
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].DeletedAt.After(*results[j].DeletedAt)
+	})
+	return results, nil
+}
+
+func (m *MemoryStore) ListExpiredTrash(before time.Time) ([]models.ResourceWithDetails, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterResources(func(r *models.Resource) bool { return r.DeletedAt != nil && r.DeletedAt.Before(before) }), nil
+}
+
+// --- Blob refs ---
+
+func (m *MemoryStore) AcquireBlob(hash, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ref, ok := m.blobRefs[hash]
+	if !ok {
+		ref = &blobRef{key: key}
+		m.blobRefs[hash] = ref
+	}
+	ref.refs++
+	return ref.key, nil
+}
+
+func (m *MemoryStore) ReleaseBlob(hash string) (string, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ref, ok := m.blobRefs[hash]
+	if !ok {
+		return "", 0, ErrNotFound
+	}
+	ref.refs--
+	if ref.refs <= 0 {
+		delete(m.blobRefs, hash)
+		return ref.key, 0, nil
+	}
+	return ref.key, ref.refs, nil
+}
+
+// --- Quarantine ---
+
+func (m *MemoryStore) CreateQuarantinedFile(file *models.QuarantinedFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.quarantine = append(m.quarantine, *file)
+	return nil
+}
+
+func (m *MemoryStore) ListQuarantinedFiles() ([]models.QuarantinedFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	files := append([]models.QuarantinedFile{}, m.quarantine...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].DetectedAt.After(files[j].DetectedAt)
+	})
+	return files, nil
+}
+
+func (m *MemoryStore) GetQuarantinedFile(id primitive.ObjectID) (*models.QuarantinedFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, f := range m.quarantine {
+		if f.ID == id {
+			return &f, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) DeleteQuarantinedFile(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, f := range m.quarantine {
+		if f.ID == id {
+			m.quarantine = append(m.quarantine[:i], m.quarantine[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// --- Versions ---
+
+func (m *MemoryStore) CreateResourceVersion(version *models.ResourceVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.versions {
+		if v.ResourceID == version.ResourceID && v.Version == version.Version {
+			return ErrDuplicateKey
+		}
+	}
+	m.versions = append(m.versions, *version)
+	return nil
+}
+
+func (m *MemoryStore) ListResourceVersions(resourceID primitive.ObjectID) ([]models.ResourceVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	versions := []models.ResourceVersion{}
+	for _, v := range m.versions {
+		if v.ResourceID == resourceID {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+func (m *MemoryStore) GetResourceVersion(resourceID primitive.ObjectID, number int) (*models.ResourceVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, v := range m.versions {
+		if v.ResourceID == resourceID && v.Version == number {
+			return &v, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) ListScanningVersions() ([]models.ResourceVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var versions []models.ResourceVersion
+	for _, v := range m.versions {
+		if v.ScanStatus == models.ScanScanning {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (m *MemoryStore) SetResourceVersionScan(resourceID primitive.ObjectID, number int, status, fileURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.versions {
+		v := &m.versions[i]
+		if v.ResourceID == resourceID && v.Version == number {
+			v.ScanStatus = status
+			v.FileUrl = fileURL
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) DeleteResourceVersion(resourceID primitive.ObjectID, number int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, v := range m.versions {
+		if v.ResourceID == resourceID && v.Version == number {
+			m.versions = append(m.versions[:i], m.versions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// --- Comments ---
+
+// commentWithAuthor deve ser chamada com o lock já adquirido. Retorna false quando
+// o autor não existe, espelhando o $unwind do MongoStore.
+func (m *MemoryStore) commentWithAuthor(c models.Comment) (*models.CommentWithAuthor, bool) {
+	var author *models.User
+	for i := range m.users {
+		if m.users[i].ID == c.UserID {
+			author = &m.users[i]
+			break
+		}
+	}
+	if author == nil {
+		return nil, false
+	}
+
+	likes := 0
+	for _, l := range m.commentLikes {
+		if l.CommentID == c.ID {
+			likes++
+		}
+	}
+
+	return &models.CommentWithAuthor{
+		ID:           c.ID,
+		Content:      c.Content,
+		CreatedAt:    c.CreatedAt,
+		AuthorName:   author.Name,
+		AuthorAvatar: author.AvatarURL,
+		ParentID:     c.ParentID,
+		Likes:        likes,
+		EditedAt:     c.EditedAt,
+		DeletedAt:    c.DeletedAt,
+	}, true
+}
+
+func (m *MemoryStore) CreateComment(comment *models.Comment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.comments = append(m.comments, *comment)
+	return nil
+}
+
+func (m *MemoryStore) GetCommentByID(id primitive.ObjectID) (*models.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.comments {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetCommentWithAuthorByID(commentID primitive.ObjectID) (*models.CommentWithAuthor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.comments {
+		if c.ID == commentID {
+			if result, ok := m.commentWithAuthor(c); ok {
+				hideRemovedAuthor(result)
+				return result, nil
+			}
+			break
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) GetCommentsByResourceID(resourceID primitive.ObjectID) ([]*models.CommentWithAuthor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var allComments []*models.CommentWithAuthor
+	for _, c := range m.comments {
+		if c.ResourceID != resourceID {
+			continue
+		}
+		if result, ok := m.commentWithAuthor(c); ok {
+			allComments = append(allComments, result)
+		}
+	}
+	return buildCommentTree(allComments), nil
+}
+
+func (m *MemoryStore) EditComment(id, userID primitive.ObjectID, content string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.comments {
+		c := &m.comments[i]
+		if c.ID != id || c.UserID != userID || c.DeletedAt != nil {
+			continue
+		}
+		m.commentEdits = append(m.commentEdits, models.CommentEdit{
+			ID:        primitive.NewObjectID(),
+			CommentID: id,
+			Content:   c.Content,
+			EditedAt:  at,
+		})
+		c.Content = content
+		c.EditedAt = &at
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) TrashComment(id, userID primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.comments {
+		c := &m.comments[i]
+		if c.ID == id && c.UserID == userID && c.DeletedAt == nil {
+			c.DeletedAt = &at
+			c.Trashed = true
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) RestoreComment(id, userID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.comments {
+		c := &m.comments[i]
+		if c.ID == id && c.UserID == userID && c.Trashed {
+			c.DeletedAt = nil
+			c.Trashed = false
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) ListTrashedComments(userID primitive.ObjectID) ([]models.Comment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := []models.Comment{}
+	for _, c := range m.comments {
+		if c.UserID == userID && c.Trashed {
+			comments = append(comments, c)
+		}
+	}
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].DeletedAt.After(*comments[j].DeletedAt) })
+	return comments, nil
+}
+
+func (m *MemoryStore) PurgeTrashedComments(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := map[primitive.ObjectID]bool{}
+	for i := range m.comments {
+		c := &m.comments[i]
+		if c.Trashed && c.DeletedAt.Before(before) {
+			c.Content = models.CommentRemovedContent
+			c.EditedAt = nil
+			c.Trashed = false
+			purged[c.ID] = true
+		}
+	}
+	edits := m.commentEdits[:0]
+	for _, e := range m.commentEdits {
+		if !purged[e.CommentID] {
+			edits = append(edits, e)
+		}
+	}
+	m.commentEdits = edits
+	return int64(len(purged)), nil
+}
+
+func (m *MemoryStore) ListCommentEdits(id primitive.ObjectID) ([]models.CommentEdit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	edits := []models.CommentEdit{}
+	for _, e := range m.commentEdits {
+		if e.CommentID == id {
+			edits = append(edits, e)
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].EditedAt.Before(edits[j].EditedAt) })
+	return edits, nil
+}
+
+func (m *MemoryStore) RemoveComment(id primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.comments {
+		c := &m.comments[i]
+		if c.ID != id || c.DeletedAt != nil {
+			continue
+		}
+		c.Content = models.CommentRemovedContent
+		c.EditedAt = nil
+		c.DeletedAt = &at
+
+		edits := m.commentEdits[:0]
+		for _, e := range m.commentEdits {
+			if e.CommentID != id {
+				edits = append(edits, e)
+			}
+		}
+		m.commentEdits = edits
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) CountUserComments(userID primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, c := range m.comments {
+		if c.UserID == userID && c.DeletedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// --- Likes ---
+
+func (m *MemoryStore) CreateLike(like *models.Like) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.likes = append(m.likes, *like)
+	return nil
+}
+
+func (m *MemoryStore) LikeResource(like *models.Like, notification *models.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range m.likes {
+		if l.UserID == like.UserID && l.ResourceID == like.ResourceID {
+			return ErrDuplicateKey
+		}
+	}
+	m.likes = append(m.likes, *like)
+	if notification != nil {
+		m.notifications = append(m.notifications, *notification)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteLike(userID, resourceID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, l := range m.likes {
+		if l.UserID == userID && l.ResourceID == resourceID {
+			m.likes = append(m.likes[:i], m.likes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) HasUserLikedResource(userID, resourceID primitive.ObjectID) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, l := range m.likes {
+		if l.UserID == userID && l.ResourceID == resourceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CountLikesForResource(resourceID primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, l := range m.likes {
+		if l.ResourceID == resourceID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) CountLikesReceivedByUser(userID primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	owned := make(map[primitive.ObjectID]bool)
+	for _, r := range m.resources {
+		if r.UserID == userID {
+			owned[r.ID] = true
+		}
+	}
+
+	var count int64
+	for _, l := range m.likes {
+		if owned[l.ResourceID] {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) GetUserLikedResourceIDs(userID primitive.ObjectID) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var likedResourceIDs []string
+	for _, l := range m.likes {
+		if l.UserID == userID {
+			likedResourceIDs = append(likedResourceIDs, l.ResourceID.Hex())
+		}
+	}
+	return likedResourceIDs, nil
+}
+
+func (m *MemoryStore) LikeComment(like *models.CommentLike) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range m.commentLikes {
+		if l.UserID == like.UserID && l.CommentID == like.CommentID {
+			return ErrDuplicateKey
+		}
+	}
+	m.commentLikes = append(m.commentLikes, *like)
+	return nil
+}
+
+func (m *MemoryStore) UnlikeComment(userID, commentID primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, l := range m.commentLikes {
+		if l.UserID == userID && l.CommentID == commentID {
+			m.commentLikes = append(m.commentLikes[:i], m.commentLikes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) HasUserLikedComment(userID, commentID primitive.ObjectID) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, l := range m.commentLikes {
+		if l.UserID == userID && l.CommentID == commentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CountLikesForComment(commentID primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, l := range m.commentLikes {
+		if l.CommentID == commentID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) GetUserLikedCommentIDs(userID primitive.ObjectID) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var likedCommentIDs []string
+	for _, l := range m.commentLikes {
+		if l.UserID == userID {
+			likedCommentIDs = append(likedCommentIDs, l.CommentID.Hex())
+		}
+	}
+	return likedCommentIDs, nil
+}
+
+// --- Notifications ---
+
+func (m *MemoryStore) CreateNotification(notification *models.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.notifications = append(m.notifications, *notification)
+	return nil
+}
+
+func (m *MemoryStore) ListNotifications(userID primitive.ObjectID, query NotificationQuery) (*NotificationPage, error) {
+	query.normalize()
+	cursor, err := decodeNotificationCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// before informa se a vem antes de b na ordem decrescente (CreatedAt, ID).
+	before := func(aDate time.Time, aID primitive.ObjectID, bDate time.Time, bID primitive.ObjectID) bool {
+		if !aDate.Equal(bDate) {
+			return aDate.After(bDate)
+		}
+		return aID.Hex() > bID.Hex()
+	}
+
+	matches := []models.Notification{}
+	for _, n := range m.notifications {
+		if n.UserID == userID && matchesNotificationQuery(&n, &query) {
+			matches = append(matches, n)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return before(matches[i].CreatedAt, matches[i].ID, matches[j].CreatedAt, matches[j].ID)
+	})
+
+	items := []models.Notification{}
+	for _, n := range matches {
+		if cursor != nil && !before(cursor.Date, cursor.ID, n.CreatedAt, n.ID) {
+			continue
+		}
+		items = append(items, n)
+		if len(items) > query.Limit {
+			break
+		}
+	}
+	return finishNotificationPage(items, query.Limit), nil
+}
+
+// matchesNotificationQuery aplica em memória os filtros de NotificationQuery
+// (exceto o cursor).
+func matchesNotificationQuery(n *models.Notification, q *NotificationQuery) bool {
+	if (n.ArchivedAt != nil) != q.Archived {
+		return false
+	}
+	if q.Read != nil && n.IsRead != *q.Read {
+		return false
+	}
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if n.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) MarkNotificationAsRead(notificationID, userID primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.notifications {
+		n := &m.notifications[i]
+		if n.ID == notificationID && n.UserID == userID {
+			markRead(n, at)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) MarkAllNotificationsRead(userID primitive.ObjectID, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var marked int64
+	for i := range m.notifications {
+		n := &m.notifications[i]
+		if n.UserID == userID && !n.IsRead {
+			markRead(n, at)
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// markRead marca a notificação como lida em at, se ainda não estava.
+func markRead(n *models.Notification, at time.Time) {
+	if !n.IsRead {
+		n.IsRead = true
+		n.ReadAt = &at
+	}
+}
+
+func (m *MemoryStore) ArchiveNotifications(userID primitive.ObjectID, ids []primitive.ObjectID, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	selected := objectIDSet(ids)
+	var archived int64
+	for i := range m.notifications {
+		n := &m.notifications[i]
+		if n.UserID == userID && selected[n.ID] {
+			markRead(n, at)
+			if n.ArchivedAt == nil {
+				n.ArchivedAt = &at
+			}
+			archived++
+		}
+	}
+	return archived, nil
+}
+
+func (m *MemoryStore) DeleteNotifications(userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	selected := objectIDSet(ids)
+	var deleted int64
+	notifications := m.notifications[:0]
+	for _, n := range m.notifications {
+		if n.UserID == userID && selected[n.ID] {
+			deleted++
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	m.notifications = notifications
+	return deleted, nil
+}
+
+func objectIDSet(ids []primitive.ObjectID) map[primitive.ObjectID]bool {
+	set := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func (m *MemoryStore) CountUnreadNotifications(userID primitive.ObjectID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, n := range m.notifications {
+		if n.UserID == userID && !n.IsRead {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) DeleteReadNotificationsBefore(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	notifications := m.notifications[:0]
+	for _, n := range m.notifications {
+		readAt := n.CreatedAt
+		if n.ReadAt != nil {
+			readAt = *n.ReadAt
+		}
+		if n.IsRead && readAt.Before(before) {
+			deleted++
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	m.notifications = notifications
+	return deleted, nil
+}
+
+// --- Notification preferences ---
+
+func (m *MemoryStore) GetNotificationPreferences(userID primitive.ObjectID) (*models.NotificationPreferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefs, ok := m.preferences[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyPreferences(prefs), nil
+}
+
+func (m *MemoryStore) SaveNotificationPreferences(prefs *models.NotificationPreferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.preferences[prefs.UserID] = *copyPreferences(*prefs)
+	return nil
+}
+
+func (m *MemoryStore) ListDigestSubscribers() ([]models.NotificationPreferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subscribers := []models.NotificationPreferences{}
+	for _, prefs := range m.preferences {
+		if prefs.Digest != "" && prefs.Digest != models.DigestOff {
+			subscribers = append(subscribers, *copyPreferences(prefs))
+		}
+	}
+	sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].UserID.Hex() < subscribers[j].UserID.Hex() })
+	return subscribers, nil
+}
+
+func (m *MemoryStore) SetLastDigest(userID primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefs, ok := m.preferences[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	prefs.LastDigestAt = &at
+	m.preferences[userID] = prefs
+	return nil
+}
+
+// copyPreferences copia os mapas e listas, para quem recebe não mexer no que está
+// guardado.
+func copyPreferences(prefs models.NotificationPreferences) *models.NotificationPreferences {
+	types := make(map[string]models.NotificationChannels, len(prefs.Types))
+	for k, v := range prefs.Types {
+		types[k] = v
+	}
+	prefs.Types = types
+	prefs.DigestCourses = append([]string{}, prefs.DigestCourses...)
+	if prefs.QuietHours != nil {
+		quiet := *prefs.QuietHours
+		prefs.QuietHours = &quiet
+	}
+	return &prefs
+}
+
+// --- Reports ---
+
+func (m *MemoryStore) CreateReport(report *models.Report) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.reports {
+		if r.TargetType == report.TargetType && r.TargetID == report.TargetID && r.ReporterID == report.ReporterID {
+			return ErrDuplicateKey
+		}
+	}
+	m.reports = append(m.reports, *report)
+	return nil
+}
+
+func (m *MemoryStore) ListReports(filter ReportFilter) ([]models.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	reports := []models.Report{}
+	for _, r := range m.reports {
+		if (filter.Status == "" || r.Status == filter.Status) &&
+			(filter.TargetType == "" || r.TargetType == filter.TargetType) &&
+			(filter.Reason == "" || r.Reason == filter.Reason) {
+			reports = append(reports, r)
+		}
+	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].CreatedAt.Before(reports[j].CreatedAt) })
+	return reports, nil
+}
+
+func (m *MemoryStore) GetReport(id primitive.ObjectID) (*models.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.reports {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) ResolveReports(targetType string, targetID primitive.ObjectID, resolution ReportResolution) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var resolved int64
+	for i := range m.reports {
+		r := &m.reports[i]
+		if r.TargetType != targetType || r.TargetID != targetID || r.Status != models.ReportOpen {
+			continue
+		}
+		at, adminID := resolution.At, resolution.AdminID
+		r.Status = resolution.Status
+		r.Action = resolution.Action
+		r.ResolvedAt = &at
+		r.ResolvedBy = &adminID
+		resolved++
+	}
+	return resolved, nil
+}
+
+func (m *MemoryStore) CreateModerationAction(action *models.ModerationAction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.moderation = append(m.moderation, *action)
+	return nil
+}
+
+func (m *MemoryStore) ListModerationActions(filter ModerationActionFilter) ([]models.ModerationAction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// De trás para frente, para decisões no mesmo instante saírem da mais recente.
+	actions := []models.ModerationAction{}
+	for i := len(m.moderation) - 1; i >= 0; i-- {
+		a := m.moderation[i]
+		if (filter.TargetID == nil || a.TargetID == *filter.TargetID) && (filter.AdminID == nil || a.AdminID == *filter.AdminID) {
+			actions = append(actions, a)
+		}
+	}
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].CreatedAt.After(actions[j].CreatedAt) })
+	return actions, nil
+}
+
+// --- Sessions ---
+
+func (m *MemoryStore) CreateSession(session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Aproveita para esquecer as sessões vencidas do usuário.
+	kept := m.sessions[:0]
+	for _, s := range m.sessions {
+		if s.UserID != session.UserID || session.CreatedAt.Before(s.ExpiresAt) {
+			kept = append(kept, s)
+		}
+	}
+	m.sessions = append(kept, *session)
+	return nil
+}
+
+func (m *MemoryStore) GetSession(id primitive.ObjectID) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, s := range m.sessions {
+		if s.ID == id {
+			return &s, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryStore) RotateSession(id primitive.ObjectID, rotation SessionRotation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.sessions {
+		s := &m.sessions[i]
+		if s.ID == id && s.RefreshHash == rotation.OldHash && s.Active(rotation.At) {
+			s.RotatedHashes = append(s.RotatedHashes, s.RefreshHash)
+			if extra := len(s.RotatedHashes) - MaxRotatedHashes; extra > 0 {
+				s.RotatedHashes = s.RotatedHashes[extra:]
+			}
+			s.RefreshHash = rotation.NewHash
+			s.IP = rotation.IP
+			s.LastSeenAt = rotation.At
+			s.ExpiresAt = rotation.ExpiresAt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) ListUserSessions(userID primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Active(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (m *MemoryStore) RevokeSession(id, userID primitive.ObjectID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.sessions {
+		s := &m.sessions[i]
+		if s.ID == id && s.UserID == userID && s.Active(at) {
+			s.RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryStore) RevokeUserSessions(userID primitive.ObjectID, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var revoked int64
+	for i := range m.sessions {
+		s := &m.sessions[i]
+		if s.UserID == userID && s.Active(at) {
+			s.RevokedAt = &at
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// --- User tokens ---
+
+func (m *MemoryStore) CreateUserToken(token *models.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.userTokens[:0]
+	for _, t := range m.userTokens {
+		if t.UserID != token.UserID || t.Purpose != token.Purpose {
+			kept = append(kept, t)
+		}
+	}
+	m.userTokens = append(kept, *token)
+	return nil
+}
+
+func (m *MemoryStore) ConsumeUserToken(purpose, hash string, now time.Time) (*models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.userTokens {
+		t := &m.userTokens[i]
+		if t.Purpose == purpose && t.Hash == hash && t.UsedAt == nil && now.Before(t.ExpiresAt) {
+			t.UsedAt = &now
+			used := *t
+			return &used, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// --- Rate limits ---
+
+func (m *MemoryStore) GetRateLimit(key string) (*models.RateLimit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.rateLimits[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &entry, nil
+}
+
+func (m *MemoryStore) PutRateLimit(entry *models.RateLimit, prevVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rateLimits[entry.Key].Version != prevVersion {
+		return ErrConflict
+	}
+	entry.Version = prevVersion + 1
+	m.rateLimits[entry.Key] = *entry
+	return nil
+}
+
+func (m *MemoryStore) DeleteRateLimit(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rateLimits, key)
+	return nil
+}
+
+// --- Catalog ---
+
+func (m *MemoryStore) ListCourses() ([]models.Course, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := append([]models.Course(nil), m.courses...)
+	sort.Slice(items, func(i, j int) bool { return items[i].Code < items[j].Code })
+	return items, nil
+}
+
+func (m *MemoryStore) CreateCourse(item *models.Course) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.courses = append(m.courses, *item)
+	return nil
+}
+
+func (m *MemoryStore) DeleteCourseByID(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.courses {
+		if c.ID == id {
+			m.courses = append(m.courses[:i], m.courses[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CountCourses() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	codes := make(map[string]bool)
+	for _, c := range m.courses {
+		codes[c.Code] = true
+	}
+	return int64(len(codes)), nil
+}
+
+func (m *MemoryStore) ListProfessors() ([]models.Professor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := append([]models.Professor(nil), m.professors...)
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+func (m *MemoryStore) CreateProfessor(item *models.Professor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.professors = append(m.professors, *item)
+	return nil
+}
+
+func (m *MemoryStore) DeleteProfessorByID(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, p := range m.professors {
+		if p.ID == id {
+			m.professors = append(m.professors[:i], m.professors[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListTags() ([]models.Tag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := append([]models.Tag(nil), m.tags...)
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+func (m *MemoryStore) CreateTag(item *models.Tag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tags = append(m.tags, *item)
+	return nil
+}
+
+func (m *MemoryStore) DeleteTagByID(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, t := range m.tags {
+		if t.ID == id {
+			m.tags = append(m.tags[:i], m.tags[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// --- Integrity ---
+
+func (m *MemoryStore) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resources := make(map[primitive.ObjectID]bool, len(m.resources))
+	for _, r := range m.resources {
+		resources[r.ID] = true
+	}
+	report := &IntegrityReport{}
+
+	likes := m.likes[:0:0]
+	for _, l := range m.likes {
+		if resources[l.ResourceID] {
+			likes = append(likes, l)
+		} else {
+			report.Likes++
+		}
+	}
+
+	comments := m.comments[:0:0]
+	commentIDs := make(map[primitive.ObjectID]bool, len(m.comments))
+	for _, c := range m.comments {
+		if resources[c.ResourceID] {
+			comments = append(comments, c)
+			commentIDs[c.ID] = true
+		} else {
+			report.Comments++
+		}
+	}
+
+	// Sem repair os comentários órfãos continuam lá, e o que depende deles não conta.
+	if !repair {
+		for _, c := range m.comments {
+			commentIDs[c.ID] = true
+		}
+	}
+	commentLikes := m.commentLikes[:0:0]
+	for _, l := range m.commentLikes {
+		if commentIDs[l.CommentID] {
+			commentLikes = append(commentLikes, l)
+		} else {
+			report.CommentLikes++
+		}
+	}
+
+	commentEdits := m.commentEdits[:0:0]
+	for _, e := range m.commentEdits {
+		if commentIDs[e.CommentID] {
+			commentEdits = append(commentEdits, e)
+		} else {
+			report.CommentEdits++
+		}
+	}
+
+	notifications := m.notifications[:0:0]
+	for _, n := range m.notifications {
+		if resources[n.ResourceID] {
+			notifications = append(notifications, n)
+		} else {
+			report.Notifications++
+		}
+	}
+
+	for id := range m.resourceTexts {
+		if !resources[id] {
+			report.ResourceTexts++
+			if repair {
+				delete(m.resourceTexts, id)
+			}
+		}
+	}
+
+	versions := m.versions[:0:0]
+	for _, v := range m.versions {
+		if resources[v.ResourceID] {
+			versions = append(versions, v)
+		} else {
+			report.Versions++
+		}
+	}
+
+	if repair {
+		m.likes = likes
+		m.comments = comments
+		m.commentLikes = commentLikes
+		m.commentEdits = commentEdits
+		m.notifications = notifications
+		m.versions = versions
+	}
+	return report, nil
+}
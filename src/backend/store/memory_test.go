@@ -0,0 +1,1203 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"uspshare/models"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMemoryStoreResourceDetails(t *testing.T) {
+	testResourceDetails(t, NewMemoryStore())
+}
+
+func TestMemoryStoreCommentTree(t *testing.T) {
+	testCommentTree(t, NewMemoryStore())
+}
+
+func TestMemoryStoreResourceText(t *testing.T) {
+	testResourceText(t, NewMemoryStore())
+}
+
+func TestMemoryStoreBlobRefs(t *testing.T) {
+	testBlobRefs(t, NewMemoryStore())
+}
+
+func TestMemoryStoreScanVisibility(t *testing.T) {
+	testScanVisibility(t, NewMemoryStore())
+}
+
+func TestMemoryStoreQuarantine(t *testing.T) {
+	testQuarantine(t, NewMemoryStore())
+}
+
+func TestMemoryStoreResourceEditing(t *testing.T) {
+	testResourceEditing(t, NewMemoryStore())
+}
+
+func TestMemoryStoreResourceVersions(t *testing.T) {
+	testResourceVersions(t, NewMemoryStore())
+}
+
+func TestMemoryStoreTrash(t *testing.T) {
+	testTrash(t, NewMemoryStore())
+}
+
+func TestMemoryStoreLikeResource(t *testing.T) {
+	testLikeResource(t, NewMemoryStore())
+}
+
+func TestMemoryStoreIntegrity(t *testing.T) {
+	testIntegrity(t, NewMemoryStore())
+}
+
+func TestMemoryStoreCommentModeration(t *testing.T) {
+	testCommentModeration(t, NewMemoryStore())
+}
+
+func TestMemoryStoreCommentTrash(t *testing.T) {
+	testCommentTrash(t, NewMemoryStore())
+}
+
+func TestMemoryStoreReports(t *testing.T) {
+	testReports(t, NewMemoryStore())
+}
+
+func TestMemoryStoreUserRoles(t *testing.T) {
+	testUserRoles(t, NewMemoryStore())
+}
+
+func TestMemoryStoreSessions(t *testing.T) {
+	testSessions(t, NewMemoryStore())
+}
+
+func TestMemoryStoreEmailVerification(t *testing.T) {
+	testEmailVerification(t, NewMemoryStore())
+}
+
+func TestMemoryStoreUserPassword(t *testing.T) {
+	testUserPassword(t, NewMemoryStore())
+}
+
+func TestMemoryStoreRateLimits(t *testing.T) {
+	testRateLimits(t, NewMemoryStore())
+}
+
+func TestMemoryStoreUnreadNotifications(t *testing.T) {
+	testUnreadNotifications(t, NewMemoryStore())
+}
+
+func TestMemoryStoreNotificationInbox(t *testing.T) {
+	testNotificationInbox(t, NewMemoryStore())
+}
+
+func TestMemoryStoreNotificationPreferences(t *testing.T) {
+	testNotificationPreferences(t, NewMemoryStore())
+}
+
+// TestMemoryStoreIntegrityRepair simula o que uma cascata interrompida deixava para
+// trás, o que o PostgreSQL (com chaves estrangeiras) não permite montar.
+func TestMemoryStoreIntegrityRepair(t *testing.T) {
+	s := NewMemoryStore()
+	m := s.Resources.(*MemoryStore)
+	gone := primitive.NewObjectID()
+	alive := &models.Resource{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Title: "Fica", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(alive))
+
+	orphanComment := models.Comment{ID: primitive.NewObjectID(), ResourceID: gone, Content: "Órfão"}
+	keptComment := models.Comment{ID: primitive.NewObjectID(), ResourceID: alive.ID, Content: "Fica"}
+	m.comments = append(m.comments, orphanComment, keptComment)
+	m.commentLikes = append(m.commentLikes,
+		models.CommentLike{ID: primitive.NewObjectID(), CommentID: orphanComment.ID},
+		models.CommentLike{ID: primitive.NewObjectID(), CommentID: keptComment.ID})
+	m.likes = append(m.likes,
+		models.Like{ID: primitive.NewObjectID(), ResourceID: gone},
+		models.Like{ID: primitive.NewObjectID(), ResourceID: alive.ID})
+	m.resourceTexts[gone] = []string{"texto"}
+	m.versions = append(m.versions, models.ResourceVersion{ID: primitive.NewObjectID(), ResourceID: gone, Version: 1})
+
+	report, err := s.Integrity.CheckIntegrity(false)
+	assert.NoError(t, err)
+	assert.Equal(t, &IntegrityReport{Likes: 1, Comments: 1, ResourceTexts: 1, Versions: 1}, report,
+		"Sem repair o comentário órfão continua lá e os likes dele ainda têm dono")
+	assert.Len(t, m.comments, 2, "Sem repair nada é apagado")
+
+	report, err = s.Integrity.CheckIntegrity(true)
+	assert.NoError(t, err)
+	assert.Equal(t, &IntegrityReport{Likes: 1, Comments: 1, CommentLikes: 1, ResourceTexts: 1, Versions: 1}, report)
+	assert.Equal(t, []models.Comment{keptComment}, m.comments)
+	assert.Len(t, m.commentLikes, 1)
+	assert.Len(t, m.likes, 1)
+	assert.Empty(t, m.resourceTexts)
+	assert.Empty(t, m.versions)
+
+	report, _ = s.Integrity.CheckIntegrity(false)
+	assert.Zero(t, report.Total())
+}
+
+// testResourceDetails, testCommentTree, testResourceText, testBlobRefs,
+// testScanVisibility, testQuarantine, testResourceEditing, testResourceVersions,
+// testTrash, testLikeResource, testIntegrity, testCommentModeration, testCommentTrash
+// e testReports
+// descrevem o contrato que todo backend precisa cumprir; postgres_test.go roda os
+// mesmos casos contra um banco real.
+func testResourceDetails(t *testing.T, s *Store) {
+	uploader := &models.User{Name: "Uploader", Email: "up@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(uploader))
+
+	professor := &models.Professor{ID: primitive.NewObjectID(), Name: "Prof. X"}
+	assert.NoError(t, s.Catalog.CreateProfessor(professor))
+
+	resource := &models.Resource{
+		ID:          primitive.NewObjectID(),
+		UserID:      uploader.ID,
+		ProfessorID: &professor.ID,
+		Title:       "Lista 1",
+		CourseCode:  "MAC0110",
+		UploadDate:  time.Now(),
+	}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+	assert.NoError(t, s.Likes.CreateLike(&models.Like{ID: primitive.NewObjectID(), UserID: uploader.ID, ResourceID: resource.ID}))
+	assert.NoError(t, s.Comments.CreateComment(&models.Comment{ID: primitive.NewObjectID(), ResourceID: resource.ID, UserID: uploader.ID, Content: "Oi"}))
+
+	details, err := s.Resources.GetResourceByID(resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Uploader", details.UploaderName)
+	assert.Equal(t, "Prof. X", details.ProfessorName)
+	assert.Equal(t, 1, details.Likes)
+	assert.Equal(t, 1, details.Comments)
+
+	t.Run("Delete remove likes e comentários em cascata", func(t *testing.T) {
+		assert.Equal(t, ErrNotFound, s.Resources.DeleteResourceByID(resource.ID, primitive.NewObjectID()))
+		assert.NoError(t, s.Resources.DeleteResourceByID(resource.ID, uploader.ID))
+
+		likes, _ := s.Likes.CountLikesForResource(resource.ID)
+		assert.Equal(t, int64(0), likes)
+		comments, _ := s.Comments.GetCommentsByResourceID(resource.ID)
+		assert.Empty(t, comments)
+	})
+}
+
+func testCommentTree(t *testing.T, s *Store) {
+	author := &models.User{Name: "Autor", Email: "autor@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(author))
+
+	resourceID := primitive.NewObjectID()
+	assert.NoError(t, s.Resources.CreateResource(&models.Resource{ID: resourceID, UserID: author.ID, UploadDate: time.Now()}))
+	now := time.Now()
+	root := models.Comment{ID: primitive.NewObjectID(), ResourceID: resourceID, UserID: author.ID, Content: "raiz", CreatedAt: now}
+	reply := models.Comment{ID: primitive.NewObjectID(), ResourceID: resourceID, UserID: author.ID, ParentID: &root.ID, Content: "resposta", CreatedAt: now.Add(time.Minute)}
+	orphan := models.Comment{ID: primitive.NewObjectID(), ResourceID: resourceID, UserID: primitive.NewObjectID(), Content: "sem autor", CreatedAt: now}
+	for _, c := range []models.Comment{root, reply, orphan} {
+		c := c
+		assert.NoError(t, s.Comments.CreateComment(&c))
+	}
+
+	tree, err := s.Comments.GetCommentsByResourceID(resourceID)
+	assert.NoError(t, err)
+	if assert.Len(t, tree, 1, "Comentários sem autor não devem aparecer") {
+		assert.Equal(t, "raiz", tree[0].Content)
+		if assert.Len(t, tree[0].Replies, 1) {
+			assert.Equal(t, "resposta", tree[0].Replies[0].Content)
+		}
+	}
+}
+
+func testResourceText(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "dono@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, UploadDate: time.Now(), ProcessingStatus: models.ProcessingPending}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+
+	_, err := s.Resources.GetResourceText(resource.ID)
+	assert.Equal(t, ErrNotFound, err)
+
+	pages := []string{"página um", "página dois"}
+	assert.NoError(t, s.Resources.SaveResourceText(resource.ID, pages))
+	assert.NoError(t, s.Resources.SetResourceProcessing(resource.ID, models.ProcessingDone, len(pages), ""))
+	assert.Equal(t, ErrNotFound, s.Resources.SetResourceProcessing(primitive.NewObjectID(), models.ProcessingDone, 0, ""))
+
+	details, err := s.Resources.GetResourceByID(resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingDone, details.ProcessingStatus)
+	assert.Equal(t, 2, details.PageCount)
+
+	saved, err := s.Resources.GetResourceText(resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, pages, saved)
+
+	assert.NoError(t, s.Resources.DeleteResourceByID(resource.ID, owner.ID))
+	_, err = s.Resources.GetResourceText(resource.ID)
+	assert.Equal(t, ErrNotFound, err, "O texto extraído deve sair junto com o recurso")
+}
+
+func testBlobRefs(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "dono@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+
+	key, err := s.BlobRefs.AcquireBlob("abc", "primeiro.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "primeiro.pdf", key)
+	key, err = s.BlobRefs.AcquireBlob("abc", "segundo.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "primeiro.pdf", key, "O mesmo conteúdo deve reaproveitar o blob já guardado")
+
+	key, remaining, err := s.BlobRefs.ReleaseBlob("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "primeiro.pdf", key)
+	assert.Equal(t, int64(1), remaining)
+	_, remaining, err = s.BlobRefs.ReleaseBlob("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), remaining)
+	_, _, err = s.BlobRefs.ReleaseBlob("abc")
+	assert.Equal(t, ErrNotFound, err)
+
+	key, err = s.BlobRefs.AcquireBlob("abc", "terceiro.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "terceiro.pdf", key, "Depois de liberado, o hash pode apontar para um blob novo")
+
+	_, err = s.Resources.FindResourceByContentHash("abc")
+	assert.Equal(t, ErrNotFound, err)
+	older := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Antigo", UploadDate: time.Now().Add(-time.Hour), ContentHash: "abc"}
+	newer := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Novo", UploadDate: time.Now(), ContentHash: "abc"}
+	assert.NoError(t, s.Resources.CreateResource(newer))
+	assert.NoError(t, s.Resources.CreateResource(older))
+
+	found, err := s.Resources.FindResourceByContentHash("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, older.ID, found.ID)
+	assert.Equal(t, "abc", found.ContentHash)
+	_, err = s.Resources.FindResourceByContentHash("")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func testScanVisibility(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "scan@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+
+	legacy := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Antigo", CourseCode: "MAC0110",
+		UploadDate: time.Now().Add(-time.Hour), ContentHash: "h"}
+	scanning := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Novo", CourseCode: "MAC0110",
+		UploadDate: time.Now(), FileUrl: "/uploads/pending/a.pdf", ContentHash: "h",
+		ScanStatus: models.ScanScanning, ProcessingStatus: models.ProcessingPending}
+	assert.NoError(t, s.Resources.CreateResource(legacy))
+	assert.NoError(t, s.Resources.CreateResource(scanning))
+
+	ids := func(resources []models.ResourceWithDetails) []primitive.ObjectID {
+		var out []primitive.ObjectID
+		for _, r := range resources {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	all, err := s.Resources.ListResources()
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{legacy.ID}, ids(all), "Recurso em verificação não pode aparecer na listagem")
+	page, err := s.Resources.SearchResources(ResourceQuery{CourseCode: "MAC0110"})
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{legacy.ID}, ids(page.Items))
+	assert.Equal(t, int64(1), page.Total)
+	related, err := s.Resources.FindRelatedResources("MAC0110", legacy.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, related)
+	mine, err := s.Resources.GetResourcesByUserID(owner.ID)
+	assert.NoError(t, err)
+	assert.Len(t, mine, 2, "O dono continua vendo o recurso em verificação")
+
+	pending, err := s.Resources.ListPendingResourceIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{scanning.ID}, pending)
+
+	assert.NoError(t, s.Resources.SetResourceScan(scanning.ID, models.ScanClean, "/uploads/a.pdf"))
+	got, err := s.Resources.GetResourceByID(scanning.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScanClean, got.ScanStatus)
+	assert.Equal(t, "/uploads/a.pdf", got.FileUrl)
+	all, _ = s.Resources.ListResources()
+	assert.Len(t, all, 2)
+
+	assert.NoError(t, s.Resources.SetResourceScan(legacy.ID, models.ScanQuarantined, "/uploads/quarantine/b.pdf"))
+	found, err := s.Resources.FindResourceByContentHash("h")
+	assert.NoError(t, err)
+	assert.Equal(t, scanning.ID, found.ID, "Recurso em quarentena não serve de original para duplicatas")
+	assert.Equal(t, ErrNotFound, s.Resources.SetResourceScan(primitive.NewObjectID(), models.ScanClean, ""))
+}
+
+func testQuarantine(t *testing.T, s *Store) {
+	resourceID := primitive.NewObjectID()
+	older := &models.QuarantinedFile{ID: primitive.NewObjectID(), Key: "quarantine/a.pdf", FileName: "a.pdf",
+		Source: models.QuarantineResource, ResourceID: &resourceID, Signature: "Eicar-Test-Signature",
+		DetectedAt: time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)}
+	newer := &models.QuarantinedFile{ID: primitive.NewObjectID(), Key: "quarantine/avatars/b.png", FileName: "b.png",
+		Source: models.QuarantineAvatar, Signature: "Win.Test", DetectedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	assert.NoError(t, s.Quarantine.CreateQuarantinedFile(older))
+	assert.NoError(t, s.Quarantine.CreateQuarantinedFile(newer))
+
+	files, err := s.Quarantine.ListQuarantinedFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, newer.ID, files[0].ID)
+		assert.Nil(t, files[0].ResourceID)
+		assert.Equal(t, resourceID, *files[1].ResourceID)
+	}
+
+	got, err := s.Quarantine.GetQuarantinedFile(older.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Eicar-Test-Signature", got.Signature)
+	assert.Equal(t, "quarantine/a.pdf", got.Key)
+
+	assert.NoError(t, s.Quarantine.DeleteQuarantinedFile(older.ID))
+	_, err = s.Quarantine.GetQuarantinedFile(older.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.Quarantine.DeleteQuarantinedFile(older.ID))
+}
+
+func testResourceEditing(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "edita@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	professorID := primitive.NewObjectID()
+
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Lista 1", CourseCode: "MAC0110",
+		Tags: []string{"listas"}, ProfessorID: &professorID, UploadDate: time.Now(), FileName: "v1.pdf",
+		FileUrl: "/uploads/v1.pdf", ContentHash: "h1", ThumbnailUrl: "/uploads/v1_thumb.jpg", Version: 1,
+		ProcessingStatus: models.ProcessingDone, PageCount: 3}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+	assert.NoError(t, s.Resources.SaveResourceText(resource.ID, []string{"antigo"}))
+
+	update := ResourceUpdate{Title: "Lista 1 (corrigida)", Description: "Com gabarito", CourseCode: "MAC0110",
+		Type: "Lista", Semester: "2024.1", Tags: []string{"listas", "gabarito"}, IsAnonymous: true}
+	assert.Equal(t, ErrNotFound, s.Resources.UpdateResourceMetadata(resource.ID, primitive.NewObjectID(), update),
+		"Só o dono pode editar")
+	assert.NoError(t, s.Resources.UpdateResourceMetadata(resource.ID, owner.ID, update))
+
+	got, err := s.Resources.GetResourceByID(resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Lista 1 (corrigida)", got.Title)
+	assert.Equal(t, "Com gabarito", got.Description)
+	assert.Equal(t, []string{"listas", "gabarito"}, got.Tags)
+	assert.True(t, got.IsAnonymous)
+	assert.Nil(t, got.ProfessorID, "ProfessorID nil desvincula o professor")
+	assert.Equal(t, "v1.pdf", got.FileName, "Editar os metadados não mexe no arquivo")
+
+	file := ResourceFile{Version: 2, FileName: "v2.pdf", FileUrl: "/uploads/v2.pdf", ContentHash: "h2"}
+	assert.NoError(t, s.Resources.SetResourceFile(resource.ID, file))
+	got, err = s.Resources.GetResourceByID(resource.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got.Version)
+	assert.Equal(t, "v2.pdf", got.FileName)
+	assert.Equal(t, "/uploads/v2.pdf", got.FileUrl)
+	assert.Equal(t, "h2", got.ContentHash)
+	assert.Empty(t, got.ThumbnailUrl)
+	assert.Equal(t, models.ProcessingPending, got.ProcessingStatus)
+	assert.Zero(t, got.PageCount)
+	_, err = s.Resources.GetResourceText(resource.ID)
+	assert.Equal(t, ErrNotFound, err, "O texto do arquivo anterior deve ser descartado")
+
+	assert.Equal(t, ErrNotFound, s.Resources.SetResourceFile(resource.ID, file), "Versão igual à atual não troca o arquivo")
+	assert.Equal(t, ErrNotFound, s.Resources.SetResourceFile(primitive.NewObjectID(), ResourceFile{Version: 3}))
+}
+
+func testResourceVersions(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "versoes@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Prova", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	newVersion := func(number int, status string) *models.ResourceVersion {
+		return &models.ResourceVersion{ID: primitive.NewObjectID(), ResourceID: resource.ID, Version: number, UserID: owner.ID,
+			FileName: "prova.pdf", FileUrl: "/uploads/pending/v.pdf", ContentHash: "h", ScanStatus: status,
+			Note: "versão", CreatedAt: now.Add(time.Duration(number) * time.Minute)}
+	}
+	assert.NoError(t, s.Versions.CreateResourceVersion(newVersion(2, models.ScanScanning)))
+	assert.NoError(t, s.Versions.CreateResourceVersion(newVersion(1, models.ScanClean)))
+	assert.Equal(t, ErrDuplicateKey, s.Versions.CreateResourceVersion(newVersion(2, models.ScanScanning)))
+
+	versions, err := s.Versions.ListResourceVersions(resource.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, 2, versions[1].Version)
+		assert.Equal(t, "versão", versions[1].Note)
+		assert.Equal(t, owner.ID, versions[1].UserID)
+	}
+
+	scanning, err := s.Versions.ListScanningVersions()
+	assert.NoError(t, err)
+	if assert.Len(t, scanning, 1) {
+		assert.Equal(t, 2, scanning[0].Version)
+	}
+
+	assert.NoError(t, s.Versions.SetResourceVersionScan(resource.ID, 2, models.ScanClean, "/uploads/v.pdf"))
+	got, err := s.Versions.GetResourceVersion(resource.ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ScanClean, got.ScanStatus)
+	assert.Equal(t, "/uploads/v.pdf", got.FileUrl)
+	assert.Equal(t, ErrNotFound, s.Versions.SetResourceVersionScan(resource.ID, 9, models.ScanClean, ""))
+	_, err = s.Versions.GetResourceVersion(resource.ID, 9)
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, s.Versions.DeleteResourceVersion(resource.ID, 1))
+	assert.Equal(t, ErrNotFound, s.Versions.DeleteResourceVersion(resource.ID, 1))
+
+	assert.NoError(t, s.Resources.DeleteResourceByID(resource.ID, owner.ID))
+	versions, err = s.Versions.ListResourceVersions(resource.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, versions, "As versões devem sair junto com o recurso")
+}
+
+func testTrash(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "lixeira@usp.br", Password: "senha123"}
+	fan := &models.User{Name: "Fã", Email: "fa@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	assert.NoError(t, s.Users.CreateUser(fan))
+
+	kept := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Fica", CourseCode: "MAC0110", UploadDate: time.Now()}
+	older := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Velho", CourseCode: "MAC0110", UploadDate: time.Now()}
+	newer := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "Novo", CourseCode: "MAC0110", UploadDate: time.Now()}
+	for _, r := range []*models.Resource{kept, older, newer} {
+		assert.NoError(t, s.Resources.CreateResource(r))
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	assert.Equal(t, ErrNotFound, s.Resources.TrashResource(older.ID, fan.ID, now), "Só o dono manda para a lixeira")
+	assert.NoError(t, s.Resources.TrashResource(older.ID, owner.ID, now.Add(-48*time.Hour)))
+	assert.NoError(t, s.Resources.TrashResource(newer.ID, owner.ID, now))
+	assert.Equal(t, ErrNotFound, s.Resources.TrashResource(newer.ID, owner.ID, now), "Já está na lixeira")
+
+	ids := func(resources []models.ResourceWithDetails) []primitive.ObjectID {
+		var out []primitive.ObjectID
+		for _, r := range resources {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	all, err := s.Resources.ListResources()
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{kept.ID}, ids(all))
+	page, err := s.Resources.SearchResources(ResourceQuery{CourseCode: "MAC0110"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), page.Total)
+	related, err := s.Resources.FindRelatedResources("MAC0110", kept.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, related)
+	mine, err := s.Resources.GetResourcesByUserID(owner.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{kept.ID}, ids(mine))
+	count, _ := s.Resources.CountUserUploads(owner.ID)
+	assert.Equal(t, int64(1), count)
+	count, _ = s.Resources.CountResources()
+	assert.Equal(t, int64(1), count)
+
+	trashed, err := s.Resources.ListTrashedResources(owner.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{newer.ID, older.ID}, ids(trashed))
+	if assert.Len(t, trashed, 2) && assert.NotNil(t, trashed[0].DeletedAt) {
+		assert.True(t, now.Equal(*trashed[0].DeletedAt))
+	}
+
+	expired, err := s.Resources.ListExpiredTrash(now.Add(-24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{older.ID}, ids(expired))
+
+	assert.Equal(t, ErrNotFound, s.Resources.RestoreResource(kept.ID, owner.ID), "Não está na lixeira")
+	assert.Equal(t, ErrNotFound, s.Resources.RestoreResource(newer.ID, fan.ID))
+	assert.NoError(t, s.Resources.RestoreResource(newer.ID, owner.ID))
+	got, err := s.Resources.GetResourceByID(newer.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got.DeletedAt)
+	assert.True(t, got.Visible())
+
+	// Apagar de vez leva junto tudo o que aponta para o recurso.
+	comment := &models.Comment{ID: primitive.NewObjectID(), ResourceID: older.ID, UserID: fan.ID, Content: "Valeu!", CreatedAt: now}
+	assert.NoError(t, s.Comments.CreateComment(comment))
+	assert.NoError(t, s.Likes.CreateLike(&models.Like{ID: primitive.NewObjectID(), UserID: fan.ID, ResourceID: older.ID, CreatedAt: now}))
+	assert.NoError(t, s.Likes.LikeComment(&models.CommentLike{ID: primitive.NewObjectID(), UserID: owner.ID, CommentID: comment.ID, CreatedAt: now}))
+	assert.NoError(t, s.Notifications.CreateNotification(&models.Notification{ID: primitive.NewObjectID(), UserID: owner.ID,
+		Type: "like", ResourceID: older.ID, CreatedAt: now}))
+
+	assert.NoError(t, s.Resources.DeleteResourceByID(older.ID, owner.ID))
+	_, err = s.Resources.GetResourceByID(older.ID)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Comments.GetCommentByID(comment.ID)
+	assert.Equal(t, ErrNotFound, err)
+	liked, _ := s.Likes.HasUserLikedResource(fan.ID, older.ID)
+	assert.False(t, liked)
+	liked, _ = s.Likes.HasUserLikedComment(owner.ID, comment.ID)
+	assert.False(t, liked, "Os likes dos comentários também saem")
+	notifications := listNotifications(t, s, owner.ID)
+	assert.Empty(t, notifications)
+}
+
+func testLikeResource(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "curtido@usp.br", Password: "senha123"}
+	fan := &models.User{Name: "Fã", Email: "curtidor@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	assert.NoError(t, s.Users.CreateUser(fan))
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "P1", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	like := func() *models.Like {
+		return &models.Like{ID: primitive.NewObjectID(), UserID: fan.ID, ResourceID: resource.ID, CreatedAt: now}
+	}
+	notification := func() *models.Notification {
+		return &models.Notification{ID: primitive.NewObjectID(), UserID: owner.ID, ActorName: fan.Name, Type: "like",
+			ResourceID: resource.ID, CreatedAt: now}
+	}
+
+	assert.NoError(t, s.Likes.LikeResource(like(), notification()))
+	liked, _ := s.Likes.HasUserLikedResource(fan.ID, resource.ID)
+	assert.True(t, liked)
+	notifications := listNotifications(t, s, owner.ID)
+	assert.Len(t, notifications, 1)
+
+	// Um like repetido não grava uma segunda notificação.
+	assert.Equal(t, ErrDuplicateKey, s.Likes.LikeResource(like(), notification()))
+	count, _ := s.Likes.CountLikesForResource(resource.ID)
+	assert.Equal(t, int64(1), count)
+	notifications = listNotifications(t, s, owner.ID)
+	assert.Len(t, notifications, 1)
+
+	// O autor curtindo o próprio material não gera notificação.
+	self := &models.Like{ID: primitive.NewObjectID(), UserID: owner.ID, ResourceID: resource.ID, CreatedAt: now}
+	assert.NoError(t, s.Likes.LikeResource(self, nil))
+	count, _ = s.Likes.CountLikesForResource(resource.ID)
+	assert.Equal(t, int64(2), count)
+
+	comment := &models.Comment{ID: primitive.NewObjectID(), ResourceID: resource.ID, UserID: owner.ID, Content: "Valeu!", CreatedAt: now}
+	assert.NoError(t, s.Comments.CreateComment(comment))
+	commentLike := func() *models.CommentLike {
+		return &models.CommentLike{ID: primitive.NewObjectID(), UserID: fan.ID, CommentID: comment.ID, CreatedAt: now}
+	}
+	assert.NoError(t, s.Likes.LikeComment(commentLike()))
+	assert.Equal(t, ErrDuplicateKey, s.Likes.LikeComment(commentLike()))
+	count, _ = s.Likes.CountLikesForComment(comment.ID)
+	assert.Equal(t, int64(1), count)
+}
+
+func testIntegrity(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "integridade@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "P1", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, s.Notifications.CreateNotification(&models.Notification{ID: primitive.NewObjectID(), UserID: owner.ID,
+		Type: "like", ResourceID: resource.ID, CreatedAt: now}))
+
+	report, err := s.Integrity.CheckIntegrity(false)
+	assert.NoError(t, err)
+	assert.Zero(t, report.Total())
+
+	// Uma notificação de um recurso que já não existe, como as que sobravam quando o
+	// processo caía no meio de DeleteResourceByID.
+	orphan := &models.Notification{ID: primitive.NewObjectID(), UserID: owner.ID, Type: "like",
+		ResourceID: primitive.NewObjectID(), CreatedAt: now}
+	assert.NoError(t, s.Notifications.CreateNotification(orphan))
+
+	report, err = s.Integrity.CheckIntegrity(false)
+	assert.NoError(t, err)
+	assert.Equal(t, &IntegrityReport{Notifications: 1}, report)
+	notifications := listNotifications(t, s, owner.ID)
+	assert.Len(t, notifications, 2, "Sem repair nada é apagado")
+
+	report, err = s.Integrity.CheckIntegrity(true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), report.Notifications)
+	notifications = listNotifications(t, s, owner.ID)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, resource.ID, notifications[0].ResourceID)
+	}
+
+	report, err = s.Integrity.CheckIntegrity(false)
+	assert.NoError(t, err)
+	assert.Zero(t, report.Total())
+}
+
+func testCommentModeration(t *testing.T, s *Store) {
+	author := &models.User{Name: "Autor", Email: "autor@usp.br", Password: "senha123"}
+	reader := &models.User{Name: "Leitor", Email: "leitor@usp.br", Password: "senha123"}
+	for _, u := range []*models.User{author, reader} {
+		assert.NoError(t, s.Users.CreateUser(u))
+	}
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: author.ID, Title: "P1", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	root := &models.Comment{ID: primitive.NewObjectID(), ResourceID: resource.ID, UserID: author.ID, Content: "Primeira versão", CreatedAt: now}
+	reply := &models.Comment{ID: primitive.NewObjectID(), ResourceID: resource.ID, UserID: reader.ID, ParentID: &root.ID,
+		Content: "Resposta", CreatedAt: now.Add(time.Second)}
+	assert.NoError(t, s.Comments.CreateComment(root))
+	assert.NoError(t, s.Comments.CreateComment(reply))
+
+	// Edição: o texto anterior vai para o histórico.
+	assert.Equal(t, ErrNotFound, s.Comments.EditComment(root.ID, reader.ID, "Invasão", now), "Só o autor edita")
+	assert.NoError(t, s.Comments.EditComment(root.ID, author.ID, "Segunda versão", now.Add(time.Minute)))
+	assert.NoError(t, s.Comments.EditComment(root.ID, author.ID, "Terceira versão", now.Add(2*time.Minute)))
+	edited, err := s.Comments.GetCommentWithAuthorByID(root.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Terceira versão", edited.Content)
+	if assert.NotNil(t, edited.EditedAt) {
+		assert.True(t, now.Add(2*time.Minute).Equal(*edited.EditedAt))
+	}
+	edits, err := s.Comments.ListCommentEdits(root.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, edits, 2) {
+		assert.Equal(t, "Primeira versão", edits[0].Content)
+		assert.Equal(t, "Segunda versão", edits[1].Content)
+	}
+
+	// Remoção: o comentário fica na árvore, sem texto, autor nem histórico.
+	assert.NoError(t, s.Comments.RemoveComment(root.ID, now.Add(time.Hour)))
+	assert.Equal(t, ErrNotFound, s.Comments.RemoveComment(root.ID, now.Add(time.Hour)), "Já foi apagado")
+	assert.Equal(t, ErrNotFound, s.Comments.EditComment(root.ID, author.ID, "Volta", now), "Apagado não se edita")
+	tree, err := s.Comments.GetCommentsByResourceID(resource.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, tree, 1) {
+		assert.Equal(t, models.CommentRemovedContent, tree[0].Content)
+		assert.Empty(t, tree[0].AuthorName)
+		assert.NotNil(t, tree[0].DeletedAt)
+		assert.Nil(t, tree[0].EditedAt)
+		if assert.Len(t, tree[0].Replies, 1, "As respostas continuam penduradas no comentário apagado") {
+			assert.Equal(t, "Resposta", tree[0].Replies[0].Content)
+		}
+	}
+	edits, _ = s.Comments.ListCommentEdits(root.ID)
+	assert.Empty(t, edits)
+	count, _ := s.Comments.CountUserComments(author.ID)
+	assert.Zero(t, count)
+}
+
+func testCommentTrash(t *testing.T, s *Store) {
+	author := &models.User{Name: "Autor", Email: "autor@usp.br", Password: "senha123"}
+	reader := &models.User{Name: "Leitor", Email: "leitor@usp.br", Password: "senha123"}
+	for _, u := range []*models.User{author, reader} {
+		assert.NoError(t, s.Users.CreateUser(u))
+	}
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: author.ID, Title: "P1", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	old := &models.Comment{ID: primitive.NewObjectID(), ResourceID: resource.ID, UserID: author.ID, Content: "Antigo", CreatedAt: now}
+	recent := &models.Comment{ID: primitive.NewObjectID(), ResourceID: resource.ID, UserID: author.ID, Content: "Recente", CreatedAt: now}
+	assert.NoError(t, s.Comments.CreateComment(old))
+	assert.NoError(t, s.Comments.CreateComment(recent))
+	assert.NoError(t, s.Comments.EditComment(old.ID, author.ID, "Antigo editado", now.Add(time.Minute)))
+
+	// Na lixeira, o comentário aparece como apagado, mas o texto fica guardado.
+	assert.Equal(t, ErrNotFound, s.Comments.TrashComment(old.ID, reader.ID, now), "Só o autor manda para a lixeira")
+	assert.NoError(t, s.Comments.TrashComment(old.ID, author.ID, now.Add(-10*24*time.Hour)))
+	assert.NoError(t, s.Comments.TrashComment(recent.ID, author.ID, now.Add(-time.Hour)))
+	assert.Equal(t, ErrNotFound, s.Comments.TrashComment(recent.ID, author.ID, now), "Já está na lixeira")
+	assert.Equal(t, ErrNotFound, s.Comments.RemoveComment(recent.ID, now), "Já foi apagado")
+
+	shown, err := s.Comments.GetCommentWithAuthorByID(old.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CommentRemovedContent, shown.Content)
+	assert.Nil(t, shown.EditedAt)
+
+	trashed, err := s.Comments.ListTrashedComments(author.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, trashed, 2) {
+		assert.Equal(t, recent.ID, trashed[0].ID, "Os apagados por último vêm primeiro")
+		assert.Equal(t, "Antigo editado", trashed[1].Content)
+	}
+	trashed, _ = s.Comments.ListTrashedComments(reader.ID)
+	assert.Empty(t, trashed)
+
+	// Restaurar devolve o texto.
+	assert.Equal(t, ErrNotFound, s.Comments.RestoreComment(recent.ID, reader.ID))
+	assert.NoError(t, s.Comments.RestoreComment(recent.ID, author.ID))
+	assert.Equal(t, ErrNotFound, s.Comments.RestoreComment(recent.ID, author.ID), "Não está mais na lixeira")
+	restored, _ := s.Comments.GetCommentWithAuthorByID(recent.ID)
+	assert.Equal(t, "Recente", restored.Content)
+	assert.Nil(t, restored.DeletedAt)
+
+	// Vencido o prazo, o texto e o histórico saem e não há mais o que restaurar.
+	purged, err := s.Comments.PurgeTrashedComments(now.Add(-7 * 24 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.Equal(t, ErrNotFound, s.Comments.RestoreComment(old.ID, author.ID))
+	gone, err := s.Comments.GetCommentByID(old.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CommentRemovedContent, gone.Content)
+	assert.NotNil(t, gone.DeletedAt)
+	edits, _ := s.Comments.ListCommentEdits(old.ID)
+	assert.Empty(t, edits)
+	trashed, _ = s.Comments.ListTrashedComments(author.ID)
+	assert.Empty(t, trashed)
+}
+
+func testReports(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Dono", Email: "denunciado@usp.br", Password: "senha123"}
+	reporter := &models.User{Name: "Denunciante", Email: "denunciante@usp.br", Password: "senha123"}
+	admin := &models.User{Name: "Admin", Email: "moderador@usp.br", Password: "senha123"}
+	for _, u := range []*models.User{owner, reporter, admin} {
+		assert.NoError(t, s.Users.CreateUser(u))
+	}
+	resource := &models.Resource{ID: primitive.NewObjectID(), UserID: owner.ID, Title: "P1", CourseCode: "MAC0110", UploadDate: time.Now()}
+	assert.NoError(t, s.Resources.CreateResource(resource))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	resourceReport := &models.Report{ID: primitive.NewObjectID(), TargetType: models.ReportTargetResource, TargetID: resource.ID,
+		OwnerID: owner.ID, ResourceID: &resource.ID, ReporterID: reporter.ID, Reason: "copyright", Details: "Livro escaneado",
+		Content: "P1", Status: models.ReportOpen, CreatedAt: now}
+	userReport := &models.Report{ID: primitive.NewObjectID(), TargetType: models.ReportTargetUser, TargetID: owner.ID,
+		OwnerID: owner.ID, ReporterID: reporter.ID, Reason: "spam", Content: "Dono", Status: models.ReportOpen, CreatedAt: now.Add(time.Second)}
+	assert.NoError(t, s.Reports.CreateReport(resourceReport))
+	assert.NoError(t, s.Reports.CreateReport(userReport))
+	again := *resourceReport
+	again.ID = primitive.NewObjectID()
+	assert.Equal(t, ErrDuplicateKey, s.Reports.CreateReport(&again), "Uma denúncia por usuário e alvo")
+
+	reports, err := s.Reports.ListReports(ReportFilter{Status: models.ReportOpen})
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, resourceReport.ID, reports[0].ID, "A fila começa pela mais antiga")
+		assert.Equal(t, "Livro escaneado", reports[0].Details)
+		if assert.NotNil(t, reports[0].ResourceID) {
+			assert.Equal(t, resource.ID, *reports[0].ResourceID)
+		}
+	}
+	reports, _ = s.Reports.ListReports(ReportFilter{TargetType: models.ReportTargetUser})
+	assert.Len(t, reports, 1)
+	reports, _ = s.Reports.ListReports(ReportFilter{Reason: "copyright"})
+	assert.Len(t, reports, 1)
+
+	// Esconder o recurso e fechar a denúncia.
+	assert.NoError(t, s.Resources.HideResource(resource.ID, now))
+	assert.Equal(t, ErrNotFound, s.Resources.HideResource(primitive.NewObjectID(), now))
+	got, err := s.Resources.GetResourceByID(resource.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.Visible())
+	all, _ := s.Resources.ListResources()
+	assert.Empty(t, all)
+	mine, _ := s.Resources.GetResourcesByUserID(owner.ID)
+	assert.Len(t, mine, 1, "O dono continua vendo o recurso escondido")
+
+	resolution := ReportResolution{Status: models.ReportActioned, Action: models.ModerationHide, AdminID: admin.ID, At: now}
+	resolved, err := s.Reports.ResolveReports(models.ReportTargetResource, resource.ID, resolution)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resolved)
+	resolved, _ = s.Reports.ResolveReports(models.ReportTargetResource, resource.ID, resolution)
+	assert.Zero(t, resolved, "Só as abertas são fechadas")
+	report, err := s.Reports.GetReport(resourceReport.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ReportActioned, report.Status)
+	assert.Equal(t, models.ModerationHide, report.Action)
+	if assert.NotNil(t, report.ResolvedBy) {
+		assert.Equal(t, admin.ID, *report.ResolvedBy)
+	}
+
+	// Suspensão.
+	assert.NoError(t, s.Users.SetUserSuspended(owner.ID, &now))
+	suspended, _ := s.Users.GetUserByID(owner.ID)
+	if assert.NotNil(t, suspended.SuspendedAt) {
+		assert.True(t, now.Equal(*suspended.SuspendedAt))
+	}
+	assert.NoError(t, s.Users.SetUserSuspended(owner.ID, nil))
+	suspended, _ = s.Users.GetUserByID(owner.ID)
+	assert.Nil(t, suspended.SuspendedAt)
+
+	// Auditoria.
+	for i, a := range []*models.ModerationAction{
+		{ID: primitive.NewObjectID(), AdminID: admin.ID, Action: models.ModerationHide, TargetType: models.ReportTargetResource,
+			TargetID: resource.ID, ReportID: &resourceReport.ID, CreatedAt: now},
+		{ID: primitive.NewObjectID(), AdminID: admin.ID, Action: models.ModerationSuspend, TargetType: models.ReportTargetUser,
+			TargetID: owner.ID, Note: "Reincidente", CreatedAt: now.Add(time.Minute)},
+	} {
+		assert.NoError(t, s.Reports.CreateModerationAction(a), "ação %d", i)
+	}
+	actions, err := s.Reports.ListModerationActions(ModerationActionFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, actions, 2) {
+		assert.Equal(t, models.ModerationSuspend, actions[0].Action, "A auditoria começa pela mais recente")
+		assert.Equal(t, "Reincidente", actions[0].Note)
+		if assert.NotNil(t, actions[1].ReportID) {
+			assert.Equal(t, resourceReport.ID, *actions[1].ReportID)
+		}
+	}
+	actions, _ = s.Reports.ListModerationActions(ModerationActionFilter{TargetID: &resource.ID})
+	assert.Len(t, actions, 1)
+	actions, _ = s.Reports.ListModerationActions(ModerationActionFilter{AdminID: &owner.ID})
+	assert.Empty(t, actions)
+
+	// As denúncias ficam como histórico mesmo depois que o alvo some.
+	assert.NoError(t, s.Resources.DeleteResourceByID(resource.ID, owner.ID))
+	_, err = s.Reports.GetReport(resourceReport.ID)
+	assert.NoError(t, err)
+}
+
+func testUserRoles(t *testing.T, s *Store) {
+	user := &models.User{Name: "Monitora", Email: "monitora@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(user))
+	assert.Equal(t, models.RoleStudent, user.Role)
+
+	stored, err := s.Users.GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleStudent, stored.Role, "Contas novas começam como estudantes")
+	assert.Empty(t, stored.RoleCourses)
+
+	assert.NoError(t, s.Users.SetUserRole(user.ID, models.RoleMonitor, []string{"MAC0110", "MAC0121"}))
+	stored, _ = s.Users.GetUserByID(user.ID)
+	assert.Equal(t, models.RoleMonitor, stored.Role)
+	assert.Equal(t, []string{"MAC0110", "MAC0121"}, stored.RoleCourses)
+
+	assert.NoError(t, s.Users.SetUserRole(user.ID, models.RoleModerator, nil))
+	stored, _ = s.Users.GetUserByID(user.ID)
+	assert.Equal(t, models.RoleModerator, stored.Role)
+	assert.Empty(t, stored.RoleCourses, "Trocar de papel limpa as disciplinas")
+}
+
+func testEmailVerification(t *testing.T, s *Store) {
+	user := &models.User{Name: "Caloura", Email: "caloura@usp.br", Password: "senha123", EmailPending: true}
+	assert.NoError(t, s.Users.CreateUser(user))
+	legacy := &models.User{Name: "Veterana", Email: "veterana@usp.br", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(legacy))
+
+	stored, err := s.Users.GetUserByEmail(user.Email)
+	assert.NoError(t, err)
+	assert.True(t, stored.EmailPending)
+	stored, _ = s.Users.GetUserByID(legacy.ID)
+	assert.False(t, stored.EmailPending)
+
+	now := time.Now().Truncate(time.Millisecond)
+	newToken := func(hash string, expiresAt time.Time) *models.UserToken {
+		token := &models.UserToken{
+			ID: primitive.NewObjectID(), UserID: user.ID, Purpose: models.TokenVerifyEmail, Hash: hash,
+			CreatedAt: now, ExpiresAt: expiresAt,
+		}
+		assert.NoError(t, s.Tokens.CreateUserToken(token))
+		return token
+	}
+	newToken("hash-antigo", now.Add(time.Hour))
+	token := newToken("hash-novo", now.Add(time.Hour))
+
+	_, err = s.Tokens.ConsumeUserToken(models.TokenVerifyEmail, "hash-antigo", now)
+	assert.Equal(t, ErrNotFound, err, "Um link novo invalida o anterior")
+	_, err = s.Tokens.ConsumeUserToken("reset_password", "hash-novo", now)
+	assert.Equal(t, ErrNotFound, err, "O propósito precisa bater")
+	_, err = s.Tokens.ConsumeUserToken(models.TokenVerifyEmail, "hash-novo", now.Add(2*time.Hour))
+	assert.Equal(t, ErrNotFound, err, "Token vencido não vale")
+
+	used, err := s.Tokens.ConsumeUserToken(models.TokenVerifyEmail, "hash-novo", now)
+	assert.NoError(t, err)
+	assert.Equal(t, token.ID, used.ID)
+	assert.Equal(t, user.ID, used.UserID)
+	assert.NotNil(t, used.UsedAt)
+	_, err = s.Tokens.ConsumeUserToken(models.TokenVerifyEmail, "hash-novo", now)
+	assert.Equal(t, ErrNotFound, err, "O token só vale uma vez")
+
+	assert.NoError(t, s.Users.SetUserEmailVerified(user.ID))
+	stored, _ = s.Users.GetUserByID(user.ID)
+	assert.False(t, stored.EmailPending)
+	assert.Equal(t, ErrNotFound, s.Users.SetUserEmailVerified(primitive.NewObjectID()))
+}
+
+func testUserPassword(t *testing.T, s *Store) {
+	user := &models.User{Name: "Esquecida", Email: "esquecida@usp.br", Password: "senha-antiga"}
+	assert.NoError(t, s.Users.CreateUser(user))
+
+	assert.NoError(t, s.Users.SetUserPassword(user.ID, "senha-nova-123"))
+	stored, err := s.Users.GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "senha-nova-123", stored.Password, "A senha não pode ficar em texto")
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("senha-nova-123")))
+	assert.Error(t, bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("senha-antiga")))
+
+	assert.Equal(t, ErrNotFound, s.Users.SetUserPassword(primitive.NewObjectID(), "qualquer"))
+}
+
+func testRateLimits(t *testing.T, s *Store) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	_, err := s.RateLimits.GetRateLimit("ip:10.0.0.1")
+	assert.Equal(t, ErrNotFound, err)
+
+	entry := &models.RateLimit{Key: "ip:10.0.0.1", Tokens: 4.5, UpdatedAt: now, ExpiresAt: now.Add(time.Minute)}
+	assert.NoError(t, s.RateLimits.PutRateLimit(entry, 0))
+	assert.Equal(t, int64(1), entry.Version)
+	assert.Equal(t, ErrConflict, s.RateLimits.PutRateLimit(&models.RateLimit{Key: "ip:10.0.0.1", UpdatedAt: now, ExpiresAt: now}, 0),
+		"Duas instâncias criando a mesma chave: a segunda perde")
+
+	stored, err := s.RateLimits.GetRateLimit("ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 4.5, stored.Tokens)
+	assert.Equal(t, int64(1), stored.Version)
+	assert.True(t, now.Equal(stored.UpdatedAt))
+
+	stored.Failures = 3
+	stored.LockedUntil = now.Add(time.Minute)
+	assert.NoError(t, s.RateLimits.PutRateLimit(stored, 1))
+	assert.Equal(t, int64(2), stored.Version)
+	stale := &models.RateLimit{Key: "ip:10.0.0.1", UpdatedAt: now, ExpiresAt: now}
+	assert.Equal(t, ErrConflict, s.RateLimits.PutRateLimit(stale, 1), "Gravação com versão velha não passa")
+
+	stored, _ = s.RateLimits.GetRateLimit("ip:10.0.0.1")
+	assert.Equal(t, 3, stored.Failures)
+	assert.True(t, now.Add(time.Minute).Equal(stored.LockedUntil))
+
+	assert.NoError(t, s.RateLimits.DeleteRateLimit("ip:10.0.0.1"))
+	_, err = s.RateLimits.GetRateLimit("ip:10.0.0.1")
+	assert.Equal(t, ErrNotFound, err)
+	assert.NoError(t, s.RateLimits.DeleteRateLimit("ip:10.0.0.1"), "Apagar uma chave que não existe não é erro")
+}
+
+// listNotifications devolve a caixa de entrada do usuário.
+func listNotifications(t *testing.T, s *Store, userID primitive.ObjectID) []models.Notification {
+	page, err := s.Notifications.ListNotifications(userID, NotificationQuery{Limit: MaxNotificationLimit})
+	assert.NoError(t, err)
+	return page.Items
+}
+
+func testUnreadNotifications(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Leitora", Email: "leitora@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	other := &models.User{Name: "Outro", Email: "outro-leitor@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(other))
+
+	notify := func(userID primitive.ObjectID) *models.Notification {
+		n := &models.Notification{ID: primitive.NewObjectID(), UserID: userID, ActorName: "Alguém", Type: "share",
+			Message: "compartilhou um material com você.", CreatedAt: time.Now()}
+		assert.NoError(t, s.Notifications.CreateNotification(n))
+		return n
+	}
+	first := notify(owner.ID)
+	notify(owner.ID)
+	notify(other.ID)
+
+	count, err := s.Notifications.CountUnreadNotifications(owner.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	assert.NoError(t, s.Notifications.MarkNotificationAsRead(first.ID, owner.ID, time.Now()))
+	assert.Equal(t, ErrNotFound, s.Notifications.MarkNotificationAsRead(first.ID, other.ID, time.Now()))
+	count, _ = s.Notifications.CountUnreadNotifications(owner.ID)
+	assert.Equal(t, int64(1), count)
+
+	count, _ = s.Notifications.CountUnreadNotifications(primitive.NewObjectID())
+	assert.Equal(t, int64(0), count)
+}
+
+func testNotificationInbox(t *testing.T, s *Store) {
+	owner := &models.User{Name: "Caixa", Email: "caixa@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(owner))
+	other := &models.User{Name: "Vizinho", Email: "vizinho@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(other))
+
+	// Cinco notificações, uma por minuto; as duas primeiras com a mesma data, para o
+	// cursor precisar desempatar pelo ID.
+	base := time.Now().UTC().Truncate(time.Millisecond).Add(-time.Hour)
+	var ids []primitive.ObjectID
+	for i, typ := range []string{models.NotificationLike, models.NotificationLike, models.NotificationReply, models.NotificationShare, models.NotificationLike} {
+		at := base.Add(time.Duration(i) * time.Minute)
+		if i == 1 {
+			at = base
+		}
+		n := &models.Notification{ID: primitive.NewObjectID(), UserID: owner.ID, ActorName: "Alguém", Type: typ,
+			Message: "fez algo.", CreatedAt: at}
+		assert.NoError(t, s.Notifications.CreateNotification(n))
+		ids = append(ids, n.ID)
+	}
+	foreign := &models.Notification{ID: primitive.NewObjectID(), UserID: other.ID, ActorName: "Alguém", Type: models.NotificationLike,
+		Message: "fez algo.", CreatedAt: base}
+	assert.NoError(t, s.Notifications.CreateNotification(foreign))
+
+	// Paginação de duas em duas, das mais recentes para as mais antigas.
+	var seen []primitive.ObjectID
+	query := NotificationQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := s.Notifications.ListNotifications(owner.ID, query)
+		assert.NoError(t, err)
+		for _, n := range page.Items {
+			seen = append(seen, n.ID)
+		}
+		if page.Next == "" || pages > 3 {
+			break
+		}
+		query.Cursor = page.Next
+	}
+	if assert.Len(t, seen, 5) {
+		assert.Equal(t, []primitive.ObjectID{ids[4], ids[3], ids[2]}, seen[:3])
+		assert.ElementsMatch(t, []primitive.ObjectID{ids[0], ids[1]}, seen[3:])
+	}
+	_, err := s.Notifications.ListNotifications(owner.ID, NotificationQuery{Cursor: "não-é-cursor"})
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	page, _ := s.Notifications.ListNotifications(owner.ID, NotificationQuery{Types: []string{models.NotificationReply, models.NotificationShare}})
+	assert.Len(t, page.Items, 2)
+
+	// Ler uma, depois todas.
+	readAt := base.Add(10 * time.Minute)
+	assert.NoError(t, s.Notifications.MarkNotificationAsRead(ids[0], owner.ID, readAt))
+	read := true
+	page, _ = s.Notifications.ListNotifications(owner.ID, NotificationQuery{Read: &read})
+	if assert.Len(t, page.Items, 1) && assert.NotNil(t, page.Items[0].ReadAt) {
+		assert.True(t, readAt.Equal(*page.Items[0].ReadAt))
+	}
+	marked, err := s.Notifications.MarkAllNotificationsRead(owner.ID, base.Add(20*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), marked)
+	count, _ := s.Notifications.CountUnreadNotifications(owner.ID)
+	assert.Equal(t, int64(0), count)
+	count, _ = s.Notifications.CountUnreadNotifications(other.ID)
+	assert.Equal(t, int64(1), count, "As dos outros não mudam")
+
+	// Arquivar e apagar só alcançam as do usuário.
+	archived, err := s.Notifications.ArchiveNotifications(owner.ID, []primitive.ObjectID{ids[1], ids[2], foreign.ID}, base.Add(30*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), archived)
+	assert.Len(t, listNotifications(t, s, owner.ID), 3)
+	page, _ = s.Notifications.ListNotifications(owner.ID, NotificationQuery{Archived: true})
+	assert.Len(t, page.Items, 2)
+
+	deleted, err := s.Notifications.DeleteNotifications(owner.ID, []primitive.ObjectID{ids[3], foreign.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Len(t, listNotifications(t, s, owner.ID), 2)
+	assert.Len(t, listNotifications(t, s, other.ID), 1)
+
+	// A retenção apaga as lidas antes do prazo, arquivadas ou não.
+	expired, err := s.Notifications.DeleteReadNotificationsBefore(base.Add(15 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired, "Só a lida aos 10 minutos")
+	expired, err = s.Notifications.DeleteReadNotificationsBefore(base.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), expired)
+	assert.Len(t, listNotifications(t, s, other.ID), 1, "Não lidas nunca vencem")
+}
+
+func testNotificationPreferences(t *testing.T, s *Store) {
+	user := &models.User{Name: "Preferências", Email: "prefs@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(user))
+	quiet := &models.User{Name: "Quieta", Email: "quieta@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(quiet))
+
+	_, err := s.Preferences.GetNotificationPreferences(user.ID)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, ErrNotFound, s.Preferences.SetLastDigest(user.ID, time.Now()))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	prefs := models.DefaultNotificationPreferences(user.ID)
+	prefs.Types[models.NotificationLike] = models.NotificationChannels{InApp: false, Email: true}
+	prefs.QuietHours = &models.QuietHours{Start: "22:00", End: "07:00", TimeZone: "America/Sao_Paulo"}
+	prefs.Digest = models.DigestWeekly
+	prefs.DigestCourses = []string{"MAC0110", "MAT2453"}
+	prefs.UpdatedAt = now
+	assert.NoError(t, s.Preferences.SaveNotificationPreferences(prefs))
+	assert.NoError(t, s.Preferences.SaveNotificationPreferences(models.DefaultNotificationPreferences(quiet.ID)))
+
+	stored, err := s.Preferences.GetNotificationPreferences(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.NotificationChannels{Email: true}, stored.Types[models.NotificationLike])
+	assert.Equal(t, models.NotificationChannels{InApp: true, Push: true}, stored.Types[models.NotificationShare])
+	assert.Equal(t, "22:00", stored.QuietHours.Start)
+	assert.Equal(t, []string{"MAC0110", "MAT2453"}, stored.DigestCourses)
+	assert.Nil(t, stored.LastDigestAt)
+	assert.True(t, now.Equal(stored.UpdatedAt))
+
+	subscribers, err := s.Preferences.ListDigestSubscribers()
+	assert.NoError(t, err)
+	if assert.Len(t, subscribers, 1, "Só quem assina algum resumo") {
+		assert.Equal(t, user.ID, subscribers[0].UserID)
+	}
+
+	assert.NoError(t, s.Preferences.SetLastDigest(user.ID, now))
+	stored, _ = s.Preferences.GetNotificationPreferences(user.ID)
+	if assert.NotNil(t, stored.LastDigestAt) {
+		assert.True(t, now.Equal(*stored.LastDigestAt))
+	}
+
+	// Salvar de novo substitui tudo.
+	stored.Digest = models.DigestOff
+	stored.QuietHours = nil
+	assert.NoError(t, s.Preferences.SaveNotificationPreferences(stored))
+	stored, _ = s.Preferences.GetNotificationPreferences(user.ID)
+	assert.Nil(t, stored.QuietHours)
+	subscribers, _ = s.Preferences.ListDigestSubscribers()
+	assert.Empty(t, subscribers)
+}
+
+func testSessions(t *testing.T, s *Store) {
+	user := &models.User{Name: "Sessões", Email: "sessions@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(user))
+	other := &models.User{Name: "Outra", Email: "other-sessions@test.com", Password: "senha123"}
+	assert.NoError(t, s.Users.CreateUser(other))
+
+	now := time.Now().Truncate(time.Millisecond)
+	newSession := func(userID primitive.ObjectID, hash string, createdAt time.Time) *models.Session {
+		session := &models.Session{
+			ID: primitive.NewObjectID(), UserID: userID, RefreshHash: hash, UserAgent: "Firefox", IP: "10.0.0.1",
+			CreatedAt: createdAt, LastSeenAt: createdAt, ExpiresAt: createdAt.Add(time.Hour),
+		}
+		assert.NoError(t, s.Sessions.CreateSession(session))
+		return session
+	}
+	laptop := newSession(user.ID, "hash-1", now.Add(-time.Minute))
+	phone := newSession(user.ID, "hash-2", now)
+	otherSession := newSession(other.ID, "hash-3", now)
+
+	got, err := s.Sessions.GetSession(laptop.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hash-1", got.RefreshHash)
+	assert.True(t, got.Active(now))
+	_, err = s.Sessions.GetSession(primitive.NewObjectID())
+	assert.Equal(t, ErrNotFound, err)
+
+	// Renovação: só com o hash atual.
+	rotation := SessionRotation{OldHash: "hash-1", NewHash: "hash-1b", IP: "10.0.0.2", At: now.Add(time.Minute), ExpiresAt: now.Add(2 * time.Hour)}
+	assert.NoError(t, s.Sessions.RotateSession(laptop.ID, rotation))
+	assert.Equal(t, ErrNotFound, s.Sessions.RotateSession(laptop.ID, rotation), "O hash antigo não renova de novo")
+	got, _ = s.Sessions.GetSession(laptop.ID)
+	assert.Equal(t, "hash-1b", got.RefreshHash)
+	assert.Equal(t, []string{"hash-1"}, got.RotatedHashes)
+	assert.Equal(t, "10.0.0.2", got.IP)
+	assert.True(t, now.Add(time.Minute).Equal(got.LastSeenAt))
+
+	// Só os últimos MaxRotatedHashes hashes trocados ficam guardados.
+	current := "hash-1b"
+	for i := 0; i < MaxRotatedHashes; i++ {
+		next := fmt.Sprintf("hash-1-%d", i)
+		assert.NoError(t, s.Sessions.RotateSession(laptop.ID, SessionRotation{OldHash: current, NewHash: next, IP: "10.0.0.2",
+			At: now.Add(time.Minute), ExpiresAt: now.Add(2 * time.Hour)}))
+		current = next
+	}
+	got, _ = s.Sessions.GetSession(laptop.ID)
+	if assert.Len(t, got.RotatedHashes, MaxRotatedHashes) {
+		assert.Equal(t, "hash-1b", got.RotatedHashes[0])
+		assert.Equal(t, fmt.Sprintf("hash-1-%d", MaxRotatedHashes-2), got.RotatedHashes[MaxRotatedHashes-1])
+	}
+
+	sessions, err := s.Sessions.ListUserSessions(user.ID, now.Add(time.Minute))
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 2) {
+		assert.Equal(t, laptop.ID, sessions[0].ID, "A usada mais recentemente vem primeiro")
+	}
+
+	// Revogação de uma sessão só pelo dono.
+	assert.Equal(t, ErrNotFound, s.Sessions.RevokeSession(phone.ID, other.ID, now))
+	assert.NoError(t, s.Sessions.RevokeSession(phone.ID, user.ID, now))
+	assert.Equal(t, ErrNotFound, s.Sessions.RevokeSession(phone.ID, user.ID, now))
+	got, _ = s.Sessions.GetSession(phone.ID)
+	assert.False(t, got.Active(now))
+	assert.Equal(t, ErrNotFound, s.Sessions.RotateSession(phone.ID, SessionRotation{OldHash: "hash-2", NewHash: "x", At: now, ExpiresAt: now.Add(time.Hour)}))
+
+	// Sair de todos os dispositivos não afeta outros usuários.
+	revoked, err := s.Sessions.RevokeUserSessions(user.ID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	sessions, _ = s.Sessions.ListUserSessions(user.ID, now)
+	assert.Empty(t, sessions)
+	sessions, _ = s.Sessions.ListUserSessions(other.ID, now)
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, otherSession.ID, sessions[0].ID)
+	}
+
+	// Sessões vencidas não aparecem.
+	sessions, _ = s.Sessions.ListUserSessions(other.ID, now.Add(2*time.Hour))
+	assert.Empty(t, sessions)
+}
@@ -0,0 +1,1928 @@
+package store
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"uspshare/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MongoStore implementa todos os repositórios sobre as coleções do MongoDB.
+type MongoStore struct {
+	users         *mongo.Collection
+	resources     *mongo.Collection
+	comments      *mongo.Collection
+	notifications *mongo.Collection
+	courses       *mongo.Collection
+	professors    *mongo.Collection
+	tags          *mongo.Collection
+	likes         *mongo.Collection
+	commentLikes  *mongo.Collection
+	resourceTexts *mongo.Collection
+	blobRefs      *mongo.Collection
+	quarantine    *mongo.Collection
+	versions      *mongo.Collection
+	commentEdits  *mongo.Collection
+	reports       *mongo.Collection
+	moderation    *mongo.Collection
+	sessions      *mongo.Collection
+	userTokens    *mongo.Collection
+	rateLimits    *mongo.Collection
+	preferences   *mongo.Collection
+
+	client *mongo.Client
+	// transactions indica se o servidor aceita transações (replica set ou cluster
+	// shardado). Num servidor standalone as cascatas rodam sem transação.
+	transactions bool
+}
+
+func NewMongoStore(db *mongo.Database) *Store {
+	m := &MongoStore{
+		users:         db.Collection("users"),
+		resources:     db.Collection("resources"),
+		comments:      db.Collection("comments"),
+		notifications: db.Collection("notifications"),
+		courses:       db.Collection("courses"),
+		professors:    db.Collection("professors"),
+		tags:          db.Collection("tags"),
+		likes:         db.Collection("likes"),
+		commentLikes:  db.Collection("comment_likes"),
+		resourceTexts: db.Collection("resource_texts"),
+		blobRefs:      db.Collection("blob_refs"),
+		quarantine:    db.Collection("quarantined_files"),
+		versions:      db.Collection("resource_versions"),
+		commentEdits:  db.Collection("comment_edits"),
+		reports:       db.Collection("reports"),
+		moderation:    db.Collection("moderation_actions"),
+		sessions:      db.Collection("sessions"),
+		userTokens:    db.Collection("user_tokens"),
+		rateLimits:    db.Collection("rate_limits"),
+		preferences:   db.Collection("notification_preferences"),
+		client:        db.Client(),
+		transactions:  supportsTransactions(db),
+	}
+	if !m.transactions {
+		log.Println("MongoDB sem replica set: cascatas vão rodar sem transação")
+	}
+	return &Store{
+		Users:         m,
+		Resources:     m,
+		Comments:      m,
+		Likes:         m,
+		Notifications: m,
+		Catalog:       m,
+		BlobRefs:      m,
+		Quarantine:    m,
+		Versions:      m,
+		Reports:       m,
+		Sessions:      m,
+		Tokens:        m,
+		RateLimits:    m,
+		Preferences:   m,
+		Integrity:     m,
+	}
+}
+
+// supportsTransactions pergunta ao servidor se ele é membro de um replica set ou um
+// mongos, os dois casos em que o MongoDB aceita transações com vários documentos.
+func supportsTransactions(db *mongo.Database) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		log.Printf("Erro ao consultar a topologia do MongoDB: %v", err)
+		return false
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
+
+// withTransaction roda fn numa transação, refeita pelo driver em caso de erro
+// transitório. Sem suporte a transações, fn roda direto, uma escrita por vez.
+func (m *MongoStore) withTransaction(fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if !m.transactions {
+		return fn(ctx)
+	}
+	return m.client.UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(tc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(tc)
+		})
+		return err
+	})
+}
+
+func translateMongoError(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateKey
+	}
+	return err
+}
+
+// --- Users ---
+
+func (m *MongoStore) CreateUser(user *models.User) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = time.Now()
+	user.Role = models.RoleStudent
+	doc := bson.M{
+		"_id":       user.ID,
+		"name":      user.Name,
+		"email":     user.Email,
+		"password":  string(hashedPassword),
+		"createdAt": user.CreatedAt,
+		"role":      user.Role,
+	}
+	if user.EmailPending {
+		doc["emailPending"] = true
+	}
+	_, err = m.users.InsertOne(context.TODO(), doc)
+	return translateMongoError(err)
+}
+
+func (m *MongoStore) GetUserByEmail(email string) (*models.User, error) {
+	var user models.User
+	err := m.users.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &user, nil
+}
+
+func (m *MongoStore) GetUserByID(id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	err := m.users.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&user)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &user, nil
+}
+
+func (m *MongoStore) updateUserByID(id primitive.ObjectID, update bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.users.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (m *MongoStore) UpdateUserProfile(id primitive.ObjectID, profile ProfileUpdate) error {
+	return m.updateUserByID(id, bson.M{
+		"$set": bson.M{
+			"name":    profile.Name,
+			"course":  profile.Course,
+			"faculty": profile.Faculty,
+			"bio":     profile.Bio,
+		},
+	})
+}
+
+func (m *MongoStore) UpdateUserAvatar(id primitive.ObjectID, avatarURL string) error {
+	return m.updateUserByID(id, bson.M{"$set": bson.M{"avatarUrl": avatarURL}})
+}
+
+func (m *MongoStore) SetUserRole(id primitive.ObjectID, role string, courses []string) error {
+	if len(courses) == 0 {
+		return m.updateUserByID(id, bson.M{"$set": bson.M{"role": role}, "$unset": bson.M{"roleCourses": ""}})
+	}
+	return m.updateUserByID(id, bson.M{"$set": bson.M{"role": role, "roleCourses": courses}})
+}
+
+func (m *MongoStore) SetUserPassword(id primitive.ObjectID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	result, err := m.users.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"password": string(hashedPassword)}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) SetUserEmailVerified(id primitive.ObjectID) error {
+	result, err := m.users.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$unset": bson.M{"emailPending": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) SetUserSuspended(id primitive.ObjectID, at *time.Time) error {
+	if at == nil {
+		return m.updateUserByID(id, bson.M{"$unset": bson.M{"suspendedAt": ""}})
+	}
+	return m.updateUserByID(id, bson.M{"$set": bson.M{"suspendedAt": *at}})
+}
+
+func (m *MongoStore) SearchUsersByNameOrEmail(query string, selfID primitive.ObjectID) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id": bson.M{"$ne": selfID},
+		"$or": []bson.M{
+			{"name": bson.M{"$regex": query, "$options": "i"}},
+			{"email": bson.M{"$regex": query, "$options": "i"}},
+		},
+	}
+
+	projection := bson.M{"password": 0}
+	opts := options.Find().SetProjection(projection).SetLimit(10)
+
+	cursor, err := m.users.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (m *MongoStore) CountUsers() (int64, error) {
+	return m.users.CountDocuments(context.Background(), bson.M{})
+}
+
+// --- Resources ---
+
+// resourceDetailsStages junta ao recurso o nome/avatar de quem enviou e do professor,
+// além das contagens de likes e comentários.
+func resourceDetailsStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "users"},
+			{Key: "localField", Value: "userId"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "uploaderInfo"},
+		}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "professors"},
+			{Key: "localField", Value: "professorId"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "professorInfo"},
+		}}},
+		{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$uploaderInfo"},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}},
+		{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$professorInfo"},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "uploaderName", Value: "$uploaderInfo.name"},
+			{Key: "uploaderAvatar", Value: "$uploaderInfo.avatarUrl"},
+			{Key: "professorName", Value: "$professorInfo.name"},
+			{Key: "professorAvatar", Value: "$professorInfo.avatarUrl"},
+			{Key: "likes", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$" + likeCountField, 0}}}},
+			{Key: "comments", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$" + commentCountField, 0}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: likeCountField, Value: 0},
+			{Key: commentCountField, Value: 0},
+			{Key: "uploaderInfo", Value: 0},
+			{Key: "professorInfo", Value: 0},
+		}}},
+	}
+}
+
+func (m *MongoStore) aggregateResources(ctx context.Context, pipeline mongo.Pipeline) ([]models.ResourceWithDetails, error) {
+	cursor, err := m.resources.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.ResourceWithDetails{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Contadores de likes e comentários guardados no próprio recurso, para a listagem
+// ordenar por eles com índice em vez de contar tudo com $lookup. São mantidos junto
+// com cada like e comentário e preenchidos para os recursos antigos em
+// database.backfillResourceCounters.
+const (
+	likeCountField    = "likeCount"
+	commentCountField = "commentCount"
+)
+
+func (m *MongoStore) CreateResource(resource *models.Resource) error {
+	doc := struct {
+		models.Resource `bson:",inline"`
+		LikeCount       int64 `bson:"likeCount"`
+		CommentCount    int64 `bson:"commentCount"`
+	}{Resource: *resource}
+	_, err := m.resources.InsertOne(context.TODO(), doc)
+	return err
+}
+
+// incrementCounter soma delta ao contador field do recurso.
+func (m *MongoStore) incrementCounter(ctx context.Context, resourceID primitive.ObjectID, field string, delta int) error {
+	_, err := m.resources.UpdateOne(ctx, bson.M{"_id": resourceID}, bson.M{"$inc": bson.M{field: delta}})
+	return err
+}
+
+// mongoVisible acrescenta ao filtro as condições de models.Resource.Visible; $nin
+// também aceita os documentos antigos, sem o campo scanStatus.
+func mongoVisible(filter bson.M) bson.M {
+	filter["scanStatus"] = bson.M{"$nin": []string{models.ScanScanning, models.ScanQuarantined}}
+	filter["deletedAt"] = bson.M{"$exists": false}
+	filter["hiddenAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+func (m *MongoStore) ListResources() ([]models.ResourceWithDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: mongoVisible(bson.M{})}},
+	}, resourceDetailsStages()...)
+	return m.aggregateResources(ctx, pipeline)
+}
+
+func (m *MongoStore) SearchResources(query ResourceQuery) (*ResourcePage, error) {
+	query.normalize()
+	cursor, err := decodeResourceCursor(query.Cursor, query.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	sortField := "uploadDate"
+	switch query.Sort {
+	case SortMostLiked:
+		sortField = likeCountField
+	case SortMostCommented:
+		sortField = commentCountField
+	}
+
+	var cursorMatch bson.D
+	if cursor != nil {
+		var value any = cursor.Date
+		if query.Sort != SortNewest {
+			value = cursor.Count
+		}
+		cursorMatch = bson.D{{Key: "$match", Value: bson.M{"$or": []bson.M{
+			{sortField: bson.M{"$lt": value}},
+			{sortField: value, "_id": bson.M{"$lt": cursor.ID}},
+		}}}}
+	}
+	sortStage := bson.D{{Key: "$sort", Value: bson.D{{Key: sortField, Value: -1}, {Key: "_id", Value: -1}}}}
+	limitStage := bson.D{{Key: "$limit", Value: query.Limit + 1}}
+
+	// Todas as ordenações usam campos do próprio recurso: os $lookup só rodam para a
+	// página pedida.
+	var items mongo.Pipeline
+	if cursorMatch != nil {
+		items = append(items, cursorMatch)
+	}
+	items = append(items, sortStage, limitStage)
+	items = append(items, resourceDetailsStages()...)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: mongoResourceFilter(&query)}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "items", Value: items},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "n"}}}},
+		}}},
+	}
+
+	result, err := m.resources.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close(ctx)
+
+	var facets []struct {
+		Items []models.ResourceWithDetails `bson:"items"`
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+	}
+	if err := result.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	resources := []models.ResourceWithDetails{}
+	if len(facets) > 0 {
+		if facets[0].Items != nil {
+			resources = facets[0].Items
+		}
+		if len(facets[0].Total) > 0 {
+			total = facets[0].Total[0].N
+		}
+	}
+
+	return finishPage(query.Sort, resources, query.Limit, total), nil
+}
+
+// mongoResourceFilter traduz ResourceQuery (exceto cursor e ordenação) para um filtro $match.
+func mongoResourceFilter(q *ResourceQuery) bson.M {
+	filter := mongoVisible(bson.M{})
+	if q.CourseCode != "" {
+		filter["courseCode"] = q.CourseCode
+	}
+	if q.Type != "" {
+		filter["type"] = q.Type
+	}
+	if q.Semester != "" {
+		filter["semester"] = q.Semester
+	}
+	if q.ProfessorID != nil {
+		filter["professorId"] = *q.ProfessorID
+	}
+	if q.UploaderID != nil {
+		filter["userId"] = *q.UploaderID
+		filter["isAnonymous"] = bson.M{"$ne": true}
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		dateRange := bson.M{}
+		if !q.From.IsZero() {
+			dateRange["$gte"] = q.From
+		}
+		if !q.To.IsZero() {
+			dateRange["$lt"] = q.To
+		}
+		filter["uploadDate"] = dateRange
+	}
+	if len(q.Tags) > 0 {
+		if q.MatchAllTags {
+			filter["tags"] = bson.M{"$all": q.Tags}
+		} else {
+			filter["tags"] = bson.M{"$in": q.Tags}
+		}
+	}
+
+	var terms []bson.M
+	for _, term := range textTerms(q.Text) {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(term), Options: "i"}
+		terms = append(terms, bson.M{"$or": []bson.M{
+			{"title": pattern},
+			{"description": pattern},
+			{"course": pattern},
+			{"courseCode": pattern},
+			{"tags": pattern},
+		}})
+	}
+	if len(terms) > 0 {
+		filter["$and"] = terms
+	}
+	return filter
+}
+
+func (m *MongoStore) GetResourceByID(id primitive.ObjectID) (*models.ResourceWithDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "_id", Value: id}}}},
+	}, resourceDetailsStages()...)
+
+	results, err := m.aggregateResources(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &results[0], nil
+}
+
+func (m *MongoStore) GetResourcesByUserID(userID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID, "deletedAt": bson.M{"$exists": false}}}},
+	}, resourceDetailsStages()...)
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "uploadDate", Value: -1}}}})
+
+	return m.aggregateResources(ctx, pipeline)
+}
+
+func (m *MongoStore) FindRelatedResources(courseCode string, currentResourceID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := mongoVisible(bson.M{
+		"courseCode": courseCode,
+		"_id":        bson.M{"$ne": currentResourceID},
+	})
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$limit", Value: 4}},
+	}, resourceDetailsStages()...)
+
+	return m.aggregateResources(ctx, pipeline)
+}
+
+// DeleteResourceByID apaga primeiro os documentos ligados ao recurso e só no fim o
+// próprio recurso: se algo falhar no meio, o recurso continua lá (na lixeira, no caso
+// do purgador) e a remoção pode ser repetida.
+func (m *MongoStore) DeleteResourceByID(resourceID, userID primitive.ObjectID) error {
+	return m.withTransaction(func(ctx context.Context) error {
+		filter := bson.M{"_id": resourceID, "userId": userID}
+		if err := m.resources.FindOne(ctx, filter).Err(); err != nil {
+			return translateMongoError(err)
+		}
+
+		commentIDs, err := m.comments.Distinct(ctx, "_id", bson.M{"resourceId": resourceID})
+		if err != nil {
+			return err
+		}
+		if len(commentIDs) > 0 {
+			for _, c := range []*mongo.Collection{m.commentLikes, m.commentEdits} {
+				if _, err := c.DeleteMany(ctx, bson.M{"commentId": bson.M{"$in": commentIDs}}); err != nil {
+					return err
+				}
+			}
+		}
+		dependents := []struct {
+			collection *mongo.Collection
+			filter     bson.M
+		}{
+			{m.comments, bson.M{"resourceId": resourceID}},
+			{m.likes, bson.M{"resourceId": resourceID}},
+			{m.notifications, bson.M{"resourceId": resourceID}},
+			{m.resourceTexts, bson.M{"_id": resourceID}},
+			{m.versions, bson.M{"resourceId": resourceID}},
+		}
+		for _, d := range dependents {
+			if _, err := d.collection.DeleteMany(ctx, d.filter); err != nil {
+				return err
+			}
+		}
+
+		result, err := m.resources.DeleteOne(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (m *MongoStore) CountUserUploads(userID primitive.ObjectID) (int64, error) {
+	count, err := m.resources.CountDocuments(context.TODO(), bson.M{"userId": userID, "deletedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (m *MongoStore) CountResources() (int64, error) {
+	return m.resources.CountDocuments(context.Background(), bson.M{"deletedAt": bson.M{"$exists": false}})
+}
+
+func (m *MongoStore) GetDistinctCourses() ([]CourseInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$courseCode"},
+			{Key: "name", Value: bson.D{{Key: "$first", Value: "$course"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := m.resources.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var courses []CourseInfo
+	if err = cursor.All(ctx, &courses); err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
+
+func (m *MongoStore) GetDistinctFieldValues(fieldName string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	values, err := m.resources.Distinct(ctx, fieldName, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var stringValues []string
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			stringValues = append(stringValues, str)
+		}
+	}
+	sort.Strings(stringValues)
+	return stringValues, nil
+}
+
+func (m *MongoStore) SetResourceProcessing(id primitive.ObjectID, status string, pageCount int, processingError string) error {
+	update := bson.M{"$set": bson.M{
+		"processingStatus": status,
+		"pageCount":        pageCount,
+		"processingError":  processingError,
+	}}
+	result, err := m.resources.UpdateOne(context.TODO(), bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) SetResourceThumbnail(id primitive.ObjectID, thumbnailURL string) error {
+	result, err := m.resources.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"thumbnailUrl": thumbnailURL}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// O texto extraído fica numa coleção à parte para não pesar nas agregações de listagem.
+func (m *MongoStore) SaveResourceText(id primitive.ObjectID, pages []string) error {
+	_, err := m.resourceTexts.ReplaceOne(context.TODO(), bson.M{"_id": id},
+		bson.M{"_id": id, "pages": pages}, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) GetResourceText(id primitive.ObjectID) ([]string, error) {
+	var doc struct {
+		Pages []string `bson:"pages"`
+	}
+	if err := m.resourceTexts.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&doc); err != nil {
+		return nil, translateMongoError(err)
+	}
+	return doc.Pages, nil
+}
+
+func (m *MongoStore) FindResourceByContentHash(hash string) (*models.ResourceWithDetails, error) {
+	if hash == "" {
+		return nil, ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: mongoVisible(bson.M{"contentHash": hash})}},
+		{{Key: "$sort", Value: bson.D{{Key: "uploadDate", Value: 1}}}},
+		{{Key: "$limit", Value: 1}},
+	}, resourceDetailsStages()...)
+
+	results, err := m.aggregateResources(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &results[0], nil
+}
+
+func (m *MongoStore) SetResourceScan(id primitive.ObjectID, status, fileURL string) error {
+	update := bson.M{"$set": bson.M{"scanStatus": status, "fileUrl": fileURL}}
+	result, err := m.resources.UpdateOne(context.TODO(), bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) ListPendingResourceIDs() ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cursor, err := m.resources.Find(ctx, bson.M{"processingStatus": models.ProcessingPending},
+		options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.M{"uploadDate": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids, nil
+}
+
+func (m *MongoStore) UpdateResourceMetadata(id, userID primitive.ObjectID, update ResourceUpdate) error {
+	tags := update.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	set := bson.M{
+		"title":       update.Title,
+		"description": update.Description,
+		"courseCode":  update.CourseCode,
+		"course":      update.Course,
+		"type":        update.Type,
+		"semester":    update.Semester,
+		"tags":        tags,
+		"isAnonymous": update.IsAnonymous,
+	}
+	change := bson.M{"$set": set}
+	if update.ProfessorID != nil {
+		set["professorId"] = *update.ProfessorID
+	} else {
+		change["$unset"] = bson.M{"professorId": ""}
+	}
+
+	result, err := m.resources.UpdateOne(context.TODO(), bson.M{"_id": id, "userId": userID}, change)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) SetResourceFile(id primitive.ObjectID, file ResourceFile) error {
+	update := bson.M{
+		"$set": bson.M{
+			"version":          file.Version,
+			"fileName":         file.FileName,
+			"fileUrl":          file.FileUrl,
+			"contentHash":      file.ContentHash,
+			"processingStatus": models.ProcessingPending,
+		},
+		"$unset": bson.M{"thumbnailUrl": "", "processingError": "", "pageCount": ""},
+	}
+	// Recursos sem o campo version estão na versão 1.
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"version": bson.M{"$lt": file.Version}},
+		bson.M{"version": bson.M{"$exists": false}},
+	}}
+	result, err := m.resources.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	if _, err := m.resourceTexts.DeleteOne(context.TODO(), bson.M{"_id": id}); err != nil {
+		log.Printf("Aviso: falha ao deletar o texto extraído do recurso %s: %v", id.Hex(), err)
+	}
+	return nil
+}
+
+func (m *MongoStore) TrashResource(id, userID primitive.ObjectID, at time.Time) error {
+	filter := bson.M{"_id": id, "userId": userID, "deletedAt": bson.M{"$exists": false}}
+	result, err := m.resources.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"deletedAt": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) HideResource(id primitive.ObjectID, at time.Time) error {
+	result, err := m.resources.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"hiddenAt": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) RestoreResource(id, userID primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "userId": userID, "deletedAt": bson.M{"$exists": true}}
+	result, err := m.resources.UpdateOne(context.TODO(), filter, bson.M{"$unset": bson.M{"deletedAt": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) ListTrashedResources(userID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userID, "deletedAt": bson.M{"$exists": true}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "deletedAt", Value: -1}}}},
+	}, resourceDetailsStages()...)
+	return m.aggregateResources(ctx, pipeline)
+}
+
+func (m *MongoStore) ListExpiredTrash(before time.Time) ([]models.ResourceWithDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deletedAt": bson.M{"$lt": before}}}},
+	}
+	return m.aggregateResources(ctx, pipeline)
+}
+
+// --- Blob refs ---
+
+// blob_refs usa o hash como _id: {_id: hash, key, refCount}.
+func (m *MongoStore) AcquireBlob(hash, key string) (string, error) {
+	var doc struct {
+		Key string `bson:"key"`
+	}
+	err := m.blobRefs.FindOneAndUpdate(context.TODO(), bson.M{"_id": hash},
+		bson.M{"$inc": bson.M{"refCount": 1}, "$setOnInsert": bson.M{"key": key}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&doc)
+	if err != nil {
+		return "", translateMongoError(err)
+	}
+	return doc.Key, nil
+}
+
+func (m *MongoStore) ReleaseBlob(hash string) (string, int64, error) {
+	var doc struct {
+		Key      string `bson:"key"`
+		RefCount int64  `bson:"refCount"`
+	}
+	err := m.blobRefs.FindOneAndUpdate(context.TODO(), bson.M{"_id": hash},
+		bson.M{"$inc": bson.M{"refCount": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if err != nil {
+		return "", 0, translateMongoError(err)
+	}
+	if doc.RefCount > 0 {
+		return doc.Key, doc.RefCount, nil
+	}
+	// Se outro upload do mesmo conteúdo chegou nesse meio-tempo, o documento fica e
+	// o blob não pode ser apagado.
+	result, err := m.blobRefs.DeleteOne(context.TODO(), bson.M{"_id": hash, "refCount": bson.M{"$lte": 0}})
+	if err != nil {
+		return "", 0, err
+	}
+	if result.DeletedCount == 0 {
+		return doc.Key, 1, nil
+	}
+	return doc.Key, 0, nil
+}
+
+// --- Quarantine ---
+
+func (m *MongoStore) CreateQuarantinedFile(file *models.QuarantinedFile) error {
+	_, err := m.quarantine.InsertOne(context.TODO(), file)
+	return translateMongoError(err)
+}
+
+func (m *MongoStore) ListQuarantinedFiles() ([]models.QuarantinedFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := m.quarantine.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"detectedAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	files := []models.QuarantinedFile{}
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (m *MongoStore) GetQuarantinedFile(id primitive.ObjectID) (*models.QuarantinedFile, error) {
+	var file models.QuarantinedFile
+	if err := m.quarantine.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&file); err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &file, nil
+}
+
+func (m *MongoStore) DeleteQuarantinedFile(id primitive.ObjectID) error {
+	result, err := m.quarantine.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Versions ---
+
+func (m *MongoStore) findVersions(filter bson.M, sort bson.M) ([]models.ResourceVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := m.versions.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := []models.ResourceVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// O índice único {resourceId, version} garante que duas versões enviadas ao
+// mesmo tempo não recebam o mesmo número.
+func (m *MongoStore) CreateResourceVersion(version *models.ResourceVersion) error {
+	_, err := m.versions.InsertOne(context.TODO(), version)
+	return translateMongoError(err)
+}
+
+func (m *MongoStore) ListResourceVersions(resourceID primitive.ObjectID) ([]models.ResourceVersion, error) {
+	return m.findVersions(bson.M{"resourceId": resourceID}, bson.M{"version": 1})
+}
+
+func (m *MongoStore) GetResourceVersion(resourceID primitive.ObjectID, number int) (*models.ResourceVersion, error) {
+	var version models.ResourceVersion
+	err := m.versions.FindOne(context.TODO(), bson.M{"resourceId": resourceID, "version": number}).Decode(&version)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &version, nil
+}
+
+func (m *MongoStore) ListScanningVersions() ([]models.ResourceVersion, error) {
+	return m.findVersions(bson.M{"scanStatus": models.ScanScanning}, bson.M{"createdAt": 1})
+}
+
+func (m *MongoStore) SetResourceVersionScan(resourceID primitive.ObjectID, number int, status, fileURL string) error {
+	result, err := m.versions.UpdateOne(context.TODO(), bson.M{"resourceId": resourceID, "version": number},
+		bson.M{"$set": bson.M{"scanStatus": status, "fileUrl": fileURL}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) DeleteResourceVersion(resourceID primitive.ObjectID, number int) error {
+	result, err := m.versions.DeleteOne(context.TODO(), bson.M{"resourceId": resourceID, "version": number})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Comments ---
+
+// commentWithAuthorStages junta ao comentário o nome/avatar do autor e a contagem de likes.
+// Comentários cujo autor não existe mais são descartados pelo $unwind.
+func commentWithAuthorStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "users"}, {Key: "localField", Value: "userId"}, {Key: "foreignField", Value: "_id"}, {Key: "as", Value: "authorInfo"}}}},
+		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "comment_likes"}, {Key: "localField", Value: "_id"}, {Key: "foreignField", Value: "commentId"}, {Key: "as", Value: "likeData"}}}},
+		{{Key: "$unwind", Value: "$authorInfo"}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "authorName", Value: "$authorInfo.name"},
+			{Key: "authorAvatar", Value: "$authorInfo.avatarUrl"},
+			{Key: "likes", Value: bson.D{{Key: "$size", Value: "$likeData"}}},
+		}}},
+		{{Key: "$project", Value: bson.D{{Key: "authorInfo", Value: 0}, {Key: "likeData", Value: 0}}}},
+	}
+}
+
+func (m *MongoStore) CreateComment(comment *models.Comment) error {
+	return m.withTransaction(func(ctx context.Context) error {
+		if _, err := m.comments.InsertOne(ctx, comment); err != nil {
+			return err
+		}
+		return m.incrementCounter(ctx, comment.ResourceID, commentCountField, 1)
+	})
+}
+
+func (m *MongoStore) GetCommentByID(id primitive.ObjectID) (*models.Comment, error) {
+	var comment models.Comment
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := m.comments.FindOne(ctx, bson.M{"_id": id}).Decode(&comment)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &comment, nil
+}
+
+func (m *MongoStore) GetCommentWithAuthorByID(commentID primitive.ObjectID) (*models.CommentWithAuthor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "_id", Value: commentID}}}},
+	}, commentWithAuthorStages()...)
+
+	cursor, err := m.comments.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []models.CommentWithAuthor
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+
+	hideRemovedAuthor(&results[0])
+	return &results[0], nil
+}
+
+func (m *MongoStore) GetCommentsByResourceID(resourceID primitive.ObjectID) ([]*models.CommentWithAuthor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "resourceId", Value: resourceID}}}},
+	}, commentWithAuthorStages()...)
+
+	cursor, err := m.comments.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Erro na agregação do MongoDB: %v", err)
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var allComments []*models.CommentWithAuthor
+	if err = cursor.All(ctx, &allComments); err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(allComments), nil
+}
+
+func (m *MongoStore) CountUserComments(userID primitive.ObjectID) (int64, error) {
+	count, err := m.comments.CountDocuments(context.TODO(), bson.M{"userId": userID, "deletedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (m *MongoStore) EditComment(id, userID primitive.ObjectID, content string, at time.Time) error {
+	return m.withTransaction(func(ctx context.Context) error {
+		filter := bson.M{"_id": id, "userId": userID, "deletedAt": bson.M{"$exists": false}}
+		var current models.Comment
+		if err := m.comments.FindOne(ctx, filter).Decode(&current); err != nil {
+			return translateMongoError(err)
+		}
+		edit := models.CommentEdit{ID: primitive.NewObjectID(), CommentID: id, Content: current.Content, EditedAt: at}
+		if _, err := m.commentEdits.InsertOne(ctx, edit); err != nil {
+			return err
+		}
+		// O filtro pelo texto antigo impede que duas edições simultâneas percam uma
+		// entrada do histórico quando não há transação.
+		filter["content"] = current.Content
+		result, err := m.comments.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"content": content, "editedAt": at}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (m *MongoStore) ListCommentEdits(id primitive.ObjectID) ([]models.CommentEdit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "editedAt", Value: 1}})
+	cursor, err := m.commentEdits.Find(ctx, bson.M{"commentId": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	edits := []models.CommentEdit{}
+	if err := cursor.All(ctx, &edits); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+func (m *MongoStore) RemoveComment(id primitive.ObjectID, at time.Time) error {
+	return m.withTransaction(func(ctx context.Context) error {
+		result, err := m.comments.UpdateOne(ctx,
+			bson.M{"_id": id, "deletedAt": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"content": models.CommentRemovedContent, "deletedAt": at}, "$unset": bson.M{"editedAt": ""}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = m.commentEdits.DeleteMany(ctx, bson.M{"commentId": id})
+		return err
+	})
+}
+
+func (m *MongoStore) TrashComment(id, userID primitive.ObjectID, at time.Time) error {
+	result, err := m.comments.UpdateOne(context.TODO(),
+		bson.M{"_id": id, "userId": userID, "deletedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deletedAt": at, "trashed": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) RestoreComment(id, userID primitive.ObjectID) error {
+	result, err := m.comments.UpdateOne(context.TODO(),
+		bson.M{"_id": id, "userId": userID, "trashed": true},
+		bson.M{"$unset": bson.M{"deletedAt": "", "trashed": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) ListTrashedComments(userID primitive.ObjectID) ([]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+	cursor, err := m.comments.Find(ctx, bson.M{"userId": userID, "trashed": true}, opts)
+	if err != nil {
+		return nil, err
+	}
+	comments := []models.Comment{}
+	if err := cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (m *MongoStore) PurgeTrashedComments(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	filter := bson.M{"trashed": true, "deletedAt": bson.M{"$lt": before}}
+	ids, err := m.comments.Distinct(ctx, "_id", filter)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	var purged int64
+	err = m.withTransaction(func(ctx context.Context) error {
+		result, err := m.comments.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "trashed": true},
+			bson.M{"$set": bson.M{"content": models.CommentRemovedContent}, "$unset": bson.M{"editedAt": "", "trashed": ""}})
+		if err != nil {
+			return err
+		}
+		purged = result.ModifiedCount
+		_, err = m.commentEdits.DeleteMany(ctx, bson.M{"commentId": bson.M{"$in": ids}})
+		return err
+	})
+	return purged, err
+}
+
+// --- Likes ---
+
+func (m *MongoStore) CreateLike(like *models.Like) error {
+	return m.LikeResource(like, nil)
+}
+
+func (m *MongoStore) LikeResource(like *models.Like, notification *models.Notification) error {
+	return m.withTransaction(func(ctx context.Context) error {
+		if _, err := m.likes.InsertOne(ctx, like); err != nil {
+			return translateMongoError(err)
+		}
+		if err := m.incrementCounter(ctx, like.ResourceID, likeCountField, 1); err != nil {
+			return err
+		}
+		if notification == nil {
+			return nil
+		}
+		_, err := m.notifications.InsertOne(ctx, notification)
+		return err
+	})
+}
+
+func (m *MongoStore) DeleteLike(userID, resourceID primitive.ObjectID) error {
+	return m.withTransaction(func(ctx context.Context) error {
+		result, err := m.likes.DeleteOne(ctx, bson.M{"userId": userID, "resourceId": resourceID})
+		if err != nil || result.DeletedCount == 0 {
+			return err
+		}
+		return m.incrementCounter(ctx, resourceID, likeCountField, -1)
+	})
+}
+
+func (m *MongoStore) HasUserLikedResource(userID, resourceID primitive.ObjectID) (bool, error) {
+	count, err := m.likes.CountDocuments(context.TODO(), bson.M{"userId": userID, "resourceId": resourceID})
+	return count > 0, err
+}
+
+func (m *MongoStore) CountLikesForResource(resourceID primitive.ObjectID) (int64, error) {
+	return m.likes.CountDocuments(context.TODO(), bson.M{"resourceId": resourceID})
+}
+
+func (m *MongoStore) CountLikesReceivedByUser(userID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "userId", Value: userID}}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "likes"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "resourceId"},
+			{Key: "as", Value: "likesData"},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "totalLikes", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$size", Value: "$likesData"}}}}},
+		}}},
+	}
+
+	cursor, err := m.resources.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		TotalLikes int64 `bson:"totalLikes"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.TotalLikes, nil
+}
+
+func (m *MongoStore) GetUserLikedResourceIDs(userID primitive.ObjectID) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := m.likes.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var likedResourceIDs []string
+	for cursor.Next(ctx) {
+		var like models.Like
+		if err := cursor.Decode(&like); err == nil {
+			likedResourceIDs = append(likedResourceIDs, like.ResourceID.Hex())
+		}
+	}
+	return likedResourceIDs, nil
+}
+
+func (m *MongoStore) LikeComment(like *models.CommentLike) error {
+	_, err := m.commentLikes.InsertOne(context.TODO(), like)
+	return translateMongoError(err)
+}
+
+func (m *MongoStore) UnlikeComment(userID, commentID primitive.ObjectID) error {
+	_, err := m.commentLikes.DeleteOne(context.TODO(), bson.M{"userId": userID, "commentId": commentID})
+	return err
+}
+
+func (m *MongoStore) HasUserLikedComment(userID, commentID primitive.ObjectID) (bool, error) {
+	count, err := m.commentLikes.CountDocuments(context.TODO(), bson.M{"userId": userID, "commentId": commentID})
+	return count > 0, err
+}
+
+func (m *MongoStore) CountLikesForComment(commentID primitive.ObjectID) (int64, error) {
+	return m.commentLikes.CountDocuments(context.TODO(), bson.M{"commentId": commentID})
+}
+
+func (m *MongoStore) GetUserLikedCommentIDs(userID primitive.ObjectID) ([]string, error) {
+	ctx := context.TODO()
+
+	cursor, err := m.commentLikes.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var likedCommentIDs []string
+	for cursor.Next(ctx) {
+		var like models.CommentLike
+		if err := cursor.Decode(&like); err == nil {
+			likedCommentIDs = append(likedCommentIDs, like.CommentID.Hex())
+		}
+	}
+	return likedCommentIDs, nil
+}
+
+// --- Notifications ---
+
+func (m *MongoStore) CreateNotification(notification *models.Notification) error {
+	_, err := m.notifications.InsertOne(context.TODO(), notification)
+	return err
+}
+
+func (m *MongoStore) ListNotifications(userID primitive.ObjectID, query NotificationQuery) (*NotificationPage, error) {
+	query.normalize()
+	cursor, err := decodeNotificationCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"userId": userID, "archivedAt": bson.M{"$exists": query.Archived}}
+	if query.Read != nil {
+		filter["isRead"] = *query.Read
+	}
+	if len(query.Types) > 0 {
+		filter["type"] = bson.M{"$in": query.Types}
+	}
+	if cursor != nil {
+		filter["$or"] = []bson.M{
+			{"createdAt": bson.M{"$lt": cursor.Date}},
+			{"createdAt": cursor.Date, "_id": bson.M{"$lt": cursor.ID}},
+		}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(query.Limit + 1))
+
+	found, err := m.notifications.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	items := []models.Notification{}
+	if err := found.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return finishNotificationPage(items, query.Limit), nil
+}
+
+func (m *MongoStore) MarkNotificationAsRead(notificationID, userID primitive.ObjectID, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := m.notifications.CountDocuments(ctx, bson.M{"_id": notificationID, "userId": userID})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	// Uma notificação já lida mantém o ReadAt original.
+	filter := bson.M{"_id": notificationID, "userId": userID, "isRead": false}
+	_, err = m.notifications.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"isRead": true, "readAt": at}})
+	return err
+}
+
+func (m *MongoStore) MarkAllNotificationsRead(userID primitive.ObjectID, at time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.notifications.UpdateMany(ctx, bson.M{"userId": userID, "isRead": false},
+		bson.M{"$set": bson.M{"isRead": true, "readAt": at}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (m *MongoStore) ArchiveNotifications(userID primitive.ObjectID, ids []primitive.ObjectID, at time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	selected := bson.M{"userId": userID, "_id": bson.M{"$in": ids}}
+	matched, err := m.notifications.CountDocuments(ctx, selected)
+	if err != nil || matched == 0 {
+		return 0, err
+	}
+	// Cada campo só é gravado na primeira vez, para ReadAt e ArchivedAt guardarem a
+	// data original.
+	unread := bson.M{"userId": userID, "_id": bson.M{"$in": ids}, "isRead": false}
+	if _, err := m.notifications.UpdateMany(ctx, unread, bson.M{"$set": bson.M{"isRead": true, "readAt": at}}); err != nil {
+		return 0, err
+	}
+	inbox := bson.M{"userId": userID, "_id": bson.M{"$in": ids}, "archivedAt": bson.M{"$exists": false}}
+	if _, err := m.notifications.UpdateMany(ctx, inbox, bson.M{"$set": bson.M{"archivedAt": at}}); err != nil {
+		return 0, err
+	}
+	return matched, nil
+}
+
+func (m *MongoStore) DeleteNotifications(userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.notifications.DeleteMany(ctx, bson.M{"userId": userID, "_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (m *MongoStore) CountUnreadNotifications(userID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return m.notifications.CountDocuments(ctx, bson.M{"userId": userID, "isRead": false})
+}
+
+func (m *MongoStore) DeleteReadNotificationsBefore(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.notifications.DeleteMany(ctx, bson.M{"isRead": true, "$or": []bson.M{
+		{"readAt": bson.M{"$lt": before}},
+		{"readAt": bson.M{"$exists": false}, "createdAt": bson.M{"$lt": before}},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// --- Reports ---
+
+func (m *MongoStore) CreateReport(report *models.Report) error {
+	_, err := m.reports.InsertOne(context.TODO(), report)
+	return translateMongoError(err)
+}
+
+func (m *MongoStore) ListReports(filter ReportFilter) ([]models.Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.TargetType != "" {
+		query["targetType"] = filter.TargetType
+	}
+	if filter.Reason != "" {
+		query["reason"] = filter.Reason
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := m.reports.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	reports := []models.Report{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (m *MongoStore) GetReport(id primitive.ObjectID) (*models.Report, error) {
+	var report models.Report
+	if err := m.reports.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&report); err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &report, nil
+}
+
+func (m *MongoStore) ResolveReports(targetType string, targetID primitive.ObjectID, resolution ReportResolution) (int64, error) {
+	result, err := m.reports.UpdateMany(context.TODO(),
+		bson.M{"targetType": targetType, "targetId": targetID, "status": models.ReportOpen},
+		bson.M{"$set": bson.M{
+			"status":     resolution.Status,
+			"action":     resolution.Action,
+			"resolvedAt": resolution.At,
+			"resolvedBy": resolution.AdminID,
+		}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (m *MongoStore) CreateModerationAction(action *models.ModerationAction) error {
+	_, err := m.moderation.InsertOne(context.TODO(), action)
+	return err
+}
+
+func (m *MongoStore) ListModerationActions(filter ModerationActionFilter) ([]models.ModerationAction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := bson.M{}
+	if filter.TargetID != nil {
+		query["targetId"] = *filter.TargetID
+	}
+	if filter.AdminID != nil {
+		query["adminId"] = *filter.AdminID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := m.moderation.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	actions := []models.ModerationAction{}
+	if err := cursor.All(ctx, &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// --- Sessions ---
+
+// Sessões vencidas somem sozinhas pelo índice TTL em expiresAt (ver database.createIndexes).
+
+func (m *MongoStore) CreateSession(session *models.Session) error {
+	_, err := m.sessions.InsertOne(context.TODO(), session)
+	return err
+}
+
+func (m *MongoStore) GetSession(id primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	if err := m.sessions.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&session); err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &session, nil
+}
+
+// activeSession é o filtro das sessões que ainda podem ser usadas em now.
+func activeSession(now time.Time) bson.M {
+	return bson.M{"revokedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": now}}
+}
+
+func (m *MongoStore) RotateSession(id primitive.ObjectID, rotation SessionRotation) error {
+	filter := activeSession(rotation.At)
+	filter["_id"] = id
+	filter["refreshHash"] = rotation.OldHash
+	result, err := m.sessions.UpdateOne(context.TODO(), filter, bson.M{
+		"$set": bson.M{
+			"refreshHash": rotation.NewHash,
+			"ip":          rotation.IP,
+			"lastSeenAt":  rotation.At,
+			"expiresAt":   rotation.ExpiresAt,
+		},
+		"$push": bson.M{"rotatedHashes": bson.M{"$each": []string{rotation.OldHash}, "$slice": -MaxRotatedHashes}},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) ListUserSessions(userID primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := activeSession(now)
+	filter["userId"] = userID
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}})
+	cursor, err := m.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m *MongoStore) RevokeSession(id, userID primitive.ObjectID, at time.Time) error {
+	filter := activeSession(at)
+	filter["_id"] = id
+	filter["userId"] = userID
+	result, err := m.sessions.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"revokedAt": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) RevokeUserSessions(userID primitive.ObjectID, at time.Time) (int64, error) {
+	filter := activeSession(at)
+	filter["userId"] = userID
+	result, err := m.sessions.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"revokedAt": at}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// --- User tokens ---
+
+func (m *MongoStore) CreateUserToken(token *models.UserToken) error {
+	if _, err := m.userTokens.DeleteMany(context.TODO(), bson.M{"userId": token.UserID, "purpose": token.Purpose}); err != nil {
+		return err
+	}
+	_, err := m.userTokens.InsertOne(context.TODO(), token)
+	return err
+}
+
+func (m *MongoStore) ConsumeUserToken(purpose, hash string, now time.Time) (*models.UserToken, error) {
+	filter := bson.M{
+		"purpose":   purpose,
+		"hash":      hash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var token models.UserToken
+	err := m.userTokens.FindOneAndUpdate(context.TODO(), filter, bson.M{"$set": bson.M{"usedAt": now}}, opts).Decode(&token)
+	if err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &token, nil
+}
+
+// --- Rate limits ---
+
+func (m *MongoStore) GetRateLimit(key string) (*models.RateLimit, error) {
+	var entry models.RateLimit
+	if err := m.rateLimits.FindOne(context.TODO(), bson.M{"_id": key}).Decode(&entry); err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &entry, nil
+}
+
+func (m *MongoStore) PutRateLimit(entry *models.RateLimit, prevVersion int64) error {
+	next := *entry
+	next.Version = prevVersion + 1
+	if prevVersion == 0 {
+		_, err := m.rateLimits.InsertOne(context.TODO(), next)
+		if err := translateMongoError(err); err == ErrDuplicateKey {
+			return ErrConflict
+		} else if err != nil {
+			return err
+		}
+	} else {
+		result, err := m.rateLimits.ReplaceOne(context.TODO(), bson.M{"_id": entry.Key, "version": prevVersion}, next)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrConflict
+		}
+	}
+	entry.Version = next.Version
+	return nil
+}
+
+func (m *MongoStore) DeleteRateLimit(key string) error {
+	_, err := m.rateLimits.DeleteOne(context.TODO(), bson.M{"_id": key})
+	return err
+}
+
+// --- Notification preferences ---
+
+func (m *MongoStore) GetNotificationPreferences(userID primitive.ObjectID) (*models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	if err := m.preferences.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&prefs); err != nil {
+		return nil, translateMongoError(err)
+	}
+	return &prefs, nil
+}
+
+func (m *MongoStore) SaveNotificationPreferences(prefs *models.NotificationPreferences) error {
+	opts := options.Replace().SetUpsert(true)
+	_, err := m.preferences.ReplaceOne(context.TODO(), bson.M{"_id": prefs.UserID}, prefs, opts)
+	return err
+}
+
+func (m *MongoStore) ListDigestSubscribers() ([]models.NotificationPreferences, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"digest": bson.M{"$in": bson.A{models.DigestDaily, models.DigestWeekly}}}
+	cursor, err := m.preferences.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	subscribers := []models.NotificationPreferences{}
+	if err := cursor.All(ctx, &subscribers); err != nil {
+		return nil, err
+	}
+	return subscribers, nil
+}
+
+func (m *MongoStore) SetLastDigest(userID primitive.ObjectID, at time.Time) error {
+	result, err := m.preferences.UpdateOne(context.TODO(), bson.M{"_id": userID}, bson.M{"$set": bson.M{"lastDigestAt": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Catalog ---
+
+func (m *MongoStore) ListCourses() ([]models.Course, error) {
+	var items []models.Course
+	cursor, err := m.courses.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{Key: "code", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m *MongoStore) CreateCourse(item *models.Course) error {
+	_, err := m.courses.InsertOne(context.TODO(), item)
+	return err
+}
+
+func (m *MongoStore) DeleteCourseByID(id primitive.ObjectID) error {
+	_, err := m.courses.DeleteOne(context.TODO(), bson.M{"_id": id})
+	return err
+}
+
+func (m *MongoStore) CountCourses() (int64, error) {
+	distinctCourses, err := m.courses.Distinct(context.Background(), "code", bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(distinctCourses)), nil
+}
+
+func (m *MongoStore) ListProfessors() ([]models.Professor, error) {
+	var items []models.Professor
+	cursor, err := m.professors.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m *MongoStore) CreateProfessor(item *models.Professor) error {
+	_, err := m.professors.InsertOne(context.TODO(), item)
+	return err
+}
+
+func (m *MongoStore) DeleteProfessorByID(id primitive.ObjectID) error {
+	_, err := m.professors.DeleteOne(context.TODO(), bson.M{"_id": id})
+	return err
+}
+
+func (m *MongoStore) ListTags() ([]models.Tag, error) {
+	var items []models.Tag
+	cursor, err := m.tags.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m *MongoStore) CreateTag(item *models.Tag) error {
+	_, err := m.tags.InsertOne(context.TODO(), item)
+	return err
+}
+
+func (m *MongoStore) DeleteTagByID(id primitive.ObjectID) error {
+	_, err := m.tags.DeleteOne(context.TODO(), bson.M{"_id": id})
+	return err
+}
+
+// --- Integrity ---
+
+func (m *MongoStore) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report := &IntegrityReport{}
+	// Os comentários vêm antes do que depende deles: com repair, os likes e as edições
+	// dos comentários apagados viram órfãos e entram na mesma passada.
+	checks := []struct {
+		count      *int64
+		collection *mongo.Collection
+		field      string
+		parent     *mongo.Collection
+	}{
+		{&report.Likes, m.likes, "resourceId", m.resources},
+		{&report.Comments, m.comments, "resourceId", m.resources},
+		{&report.CommentLikes, m.commentLikes, "commentId", m.comments},
+		{&report.CommentEdits, m.commentEdits, "commentId", m.comments},
+		{&report.Notifications, m.notifications, "resourceId", m.resources},
+		{&report.ResourceTexts, m.resourceTexts, "_id", m.resources},
+		{&report.Versions, m.versions, "resourceId", m.resources},
+	}
+	for _, c := range checks {
+		ids, err := mongoOrphans(ctx, c.collection, c.field, c.parent)
+		if err != nil {
+			return nil, err
+		}
+		*c.count = int64(len(ids))
+		if repair && len(ids) > 0 {
+			if _, err := c.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// mongoOrphans devolve o _id dos documentos de collection cujo field não aponta para
+// nenhum documento de parent.
+func mongoOrphans(ctx context.Context, collection *mongo.Collection, field string, parent *mongo.Collection) ([]primitive.ObjectID, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{"from": parent.Name(), "localField": field, "foreignField": "_id", "as": "parent"}}},
+		{{Key: "$match", Value: bson.M{"parent": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids, nil
+}
@@ -0,0 +1,1865 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"uspshare/models"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PostgresStore implementa todos os repositórios sobre o esquema criado pelas
+// migrações de database/migrations. Os IDs continuam sendo ObjectIDs, guardados em hexadecimal.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *Store {
+	p := &PostgresStore{db: db}
+	return &Store{
+		Users:         p,
+		Resources:     p,
+		Comments:      p,
+		Likes:         p,
+		Notifications: p,
+		Catalog:       p,
+		BlobRefs:      p,
+		Quarantine:    p,
+		Versions:      p,
+		Reports:       p,
+		Sessions:      p,
+		Tokens:        p,
+		RateLimits:    p,
+		Preferences:   p,
+		Integrity:     p,
+	}
+}
+
+func translatePostgresError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicateKey
+	}
+	return err
+}
+
+// nullableHex converte um ObjectID opcional para uma coluna que aceita NULL.
+func nullableHex(id *primitive.ObjectID) sql.NullString {
+	if id == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: id.Hex(), Valid: true}
+}
+
+func objectIDPtr(hex sql.NullString) *primitive.ObjectID {
+	if !hex.Valid {
+		return nil
+	}
+	id, err := primitive.ObjectIDFromHex(hex.String)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+func objectID(hex string) primitive.ObjectID {
+	id, _ := primitive.ObjectIDFromHex(hex)
+	return id
+}
+
+func (p *PostgresStore) count(query string, args ...any) (int64, error) {
+	var count int64
+	err := p.db.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+func (p *PostgresStore) exists(query string, args ...any) (bool, error) {
+	var found bool
+	err := p.db.QueryRow("SELECT EXISTS ("+query+")", args...).Scan(&found)
+	return found, err
+}
+
+func (p *PostgresStore) stringList(query string, args ...any) ([]string, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// --- Users ---
+
+const userColumns = `id, name, email, password, created_at, course, faculty, year_joined, bio, avatar_url, badges, role, role_courses, suspended_at, email_pending`
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var user models.User
+	var id string
+	err := row.Scan(&id, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.Course, &user.Faculty,
+		&user.YearJoined, &user.Bio, &user.AvatarURL, pq.Array(&user.Badges), &user.Role,
+		pq.Array(&user.RoleCourses), &user.SuspendedAt, &user.EmailPending)
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	user.ID = objectID(id)
+	return &user, nil
+}
+
+func (p *PostgresStore) CreateUser(user *models.User) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = time.Now()
+	user.Role = models.RoleStudent
+	_, err = p.db.Exec(`INSERT INTO users (id, name, email, password, created_at, role, email_pending)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		user.ID.Hex(), user.Name, user.Email, string(hashedPassword), user.CreatedAt, user.Role, user.EmailPending)
+	return translatePostgresError(err)
+}
+
+func (p *PostgresStore) GetUserByEmail(email string) (*models.User, error) {
+	return scanUser(p.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+func (p *PostgresStore) GetUserByID(id primitive.ObjectID) (*models.User, error) {
+	return scanUser(p.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id.Hex()))
+}
+
+func (p *PostgresStore) UpdateUserProfile(id primitive.ObjectID, profile ProfileUpdate) error {
+	_, err := p.db.Exec(`UPDATE users SET name = $2, course = $3, faculty = $4, bio = $5 WHERE id = $1`,
+		id.Hex(), profile.Name, profile.Course, profile.Faculty, profile.Bio)
+	return err
+}
+
+func (p *PostgresStore) UpdateUserAvatar(id primitive.ObjectID, avatarURL string) error {
+	_, err := p.db.Exec(`UPDATE users SET avatar_url = $2 WHERE id = $1`, id.Hex(), avatarURL)
+	return err
+}
+
+func (p *PostgresStore) SetUserRole(id primitive.ObjectID, role string, courses []string) error {
+	if courses == nil {
+		courses = []string{}
+	}
+	_, err := p.db.Exec(`UPDATE users SET role = $2, role_courses = $3 WHERE id = $1`, id.Hex(), role, pq.Array(courses))
+	return err
+}
+
+func (p *PostgresStore) SetUserPassword(id primitive.ObjectID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	result, err := p.db.Exec(`UPDATE users SET password = $2 WHERE id = $1`, id.Hex(), string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) SetUserEmailVerified(id primitive.ObjectID) error {
+	result, err := p.db.Exec(`UPDATE users SET email_pending = FALSE WHERE id = $1`, id.Hex())
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) SetUserSuspended(id primitive.ObjectID, at *time.Time) error {
+	_, err := p.db.Exec(`UPDATE users SET suspended_at = $2 WHERE id = $1`, id.Hex(), at)
+	return err
+}
+
+func (p *PostgresStore) SearchUsersByNameOrEmail(query string, selfID primitive.ObjectID) ([]models.User, error) {
+	rows, err := p.db.Query(`SELECT `+userColumns+` FROM users
+		WHERE id <> $1 AND (strpos(lower(name), lower($2)) > 0 OR strpos(lower(email), lower($2)) > 0)
+		ORDER BY created_at LIMIT 10`, selfID.Hex(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = ""
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (p *PostgresStore) CountUsers() (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM users`)
+}
+
+// --- Resources ---
+
+// resourceDetailsQuery é o equivalente SQL dos $lookup do MongoStore: junta quem enviou
+// e o professor. As contagens de likes e comentários vêm dos contadores do recurso.
+const resourceDetailsQuery = `SELECT r.id, r.user_id, r.professor_id, r.course_code, r.course, r.type, r.file_name,
+	r.file_url, r.upload_date, r.title, r.description, r.semester, r.tags, r.is_anonymous,
+	r.processing_status, r.processing_error, r.page_count, r.thumbnail_url, r.content_hash, r.scan_status, r.version, r.deleted_at, r.hidden_at,
+	COALESCE(u.name, '') AS uploader_name, COALESCE(u.avatar_url, '') AS uploader_avatar,
+	COALESCE(pr.name, '') AS professor_name, COALESCE(pr.avatar_url, '') AS professor_avatar,
+	r.like_count AS likes, r.comment_count AS comments
+FROM resources r
+LEFT JOIN users u ON u.id = r.user_id
+LEFT JOIN professors pr ON pr.id = r.professor_id`
+
+func (p *PostgresStore) queryResources(query string, args ...any) ([]models.ResourceWithDetails, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.ResourceWithDetails{}
+	for rows.Next() {
+		var r models.ResourceWithDetails
+		var id, userID string
+		var professorID sql.NullString
+		err := rows.Scan(&id, &userID, &professorID, &r.CourseCode, &r.Course, &r.Type, &r.FileName,
+			&r.FileUrl, &r.UploadDate, &r.Title, &r.Description, &r.Semester, pq.Array(&r.Tags), &r.IsAnonymous,
+			&r.ProcessingStatus, &r.ProcessingError, &r.PageCount, &r.ThumbnailUrl, &r.ContentHash, &r.ScanStatus, &r.Version, &r.DeletedAt, &r.HiddenAt,
+			&r.UploaderName, &r.UploaderAvatar, &r.ProfessorName, &r.ProfessorAvatar, &r.Likes, &r.Comments)
+		if err != nil {
+			return nil, err
+		}
+		r.ID = objectID(id)
+		r.UserID = objectID(userID)
+		r.ProfessorID = objectIDPtr(professorID)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+func (p *PostgresStore) CreateResource(resource *models.Resource) error {
+	tags := resource.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	_, err := p.db.Exec(`INSERT INTO resources (id, user_id, professor_id, course_code, course, type, file_name,
+		file_url, upload_date, title, description, semester, tags, is_anonymous,
+		processing_status, processing_error, page_count, thumbnail_url, content_hash, scan_status, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)`,
+		resource.ID.Hex(), resource.UserID.Hex(), nullableHex(resource.ProfessorID), resource.CourseCode, resource.Course,
+		resource.Type, resource.FileName, resource.FileUrl, resource.UploadDate, resource.Title, resource.Description,
+		resource.Semester, pq.Array(tags), resource.IsAnonymous,
+		resource.ProcessingStatus, resource.ProcessingError, resource.PageCount, resource.ThumbnailUrl, resource.ContentHash,
+		resource.ScanStatus, resource.Version)
+	return err
+}
+
+// postgresVisible é a condição SQL equivalente a models.Resource.Visible.
+const postgresVisible = `r.scan_status IN ('', 'clean') AND r.deleted_at IS NULL AND r.hidden_at IS NULL`
+
+func (p *PostgresStore) ListResources() ([]models.ResourceWithDetails, error) {
+	return p.queryResources(resourceDetailsQuery + ` WHERE ` + postgresVisible + ` ORDER BY r.upload_date`)
+}
+
+func (p *PostgresStore) SearchResources(query ResourceQuery) (*ResourcePage, error) {
+	query.normalize()
+	cursor, err := decodeResourceCursor(query.Cursor, query.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := postgresResourceFilter(&query)
+
+	total, err := p.count(`SELECT COUNT(*) FROM resources r`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	sortColumn := "d.upload_date"
+	switch query.Sort {
+	case SortMostLiked:
+		sortColumn = "d.likes"
+	case SortMostCommented:
+		sortColumn = "d.comments"
+	}
+	// d.likes e d.comments são as colunas like_count e comment_count do recurso; o
+	// Postgres desfaz a subconsulta e usa os índices da migração 0017.
+
+	page := `SELECT * FROM (` + resourceDetailsQuery + where + `) AS d`
+	if cursor != nil {
+		var value any = cursor.Date
+		if query.Sort != SortNewest {
+			value = cursor.Count
+		}
+		args = append(args, value, cursor.ID.Hex())
+		page += fmt.Sprintf(` WHERE (%s, d.id COLLATE "C") < ($%d, $%d COLLATE "C")`, sortColumn, len(args)-1, len(args))
+	}
+	args = append(args, query.Limit+1)
+	page += fmt.Sprintf(` ORDER BY %s DESC, d.id COLLATE "C" DESC LIMIT $%d`, sortColumn, len(args))
+
+	items, err := p.queryResources(page, args...)
+	if err != nil {
+		return nil, err
+	}
+	return finishPage(query.Sort, items, query.Limit, total), nil
+}
+
+// postgresResourceFilter traduz ResourceQuery (exceto cursor e ordenação) para uma
+// cláusula WHERE sobre o alias r de resources.
+func postgresResourceFilter(q *ResourceQuery) (string, []any) {
+	conditions := []string{postgresVisible}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.CourseCode != "" {
+		conditions = append(conditions, "r.course_code = "+arg(q.CourseCode))
+	}
+	if q.Type != "" {
+		conditions = append(conditions, "r.type = "+arg(q.Type))
+	}
+	if q.Semester != "" {
+		conditions = append(conditions, "r.semester = "+arg(q.Semester))
+	}
+	if q.ProfessorID != nil {
+		conditions = append(conditions, "r.professor_id = "+arg(q.ProfessorID.Hex()))
+	}
+	if q.UploaderID != nil {
+		conditions = append(conditions, "r.user_id = "+arg(q.UploaderID.Hex())+" AND NOT r.is_anonymous")
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "r.upload_date >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "r.upload_date < "+arg(q.To))
+	}
+	if len(q.Tags) > 0 {
+		operator := "&&"
+		if q.MatchAllTags {
+			operator = "@>"
+		}
+		conditions = append(conditions, "r.tags "+operator+" "+arg(pq.Array(q.Tags))+"::text[]")
+	}
+	for _, term := range textTerms(q.Text) {
+		t := arg(term)
+		conditions = append(conditions, fmt.Sprintf(`(strpos(lower(r.title), %[1]s) > 0
+			OR strpos(lower(r.description), %[1]s) > 0
+			OR strpos(lower(r.course), %[1]s) > 0
+			OR strpos(lower(r.course_code), %[1]s) > 0
+			OR EXISTS (SELECT 1 FROM unnest(r.tags) AS tag WHERE strpos(lower(tag), %[1]s) > 0))`, t))
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (p *PostgresStore) GetResourceByID(id primitive.ObjectID) (*models.ResourceWithDetails, error) {
+	results, err := p.queryResources(resourceDetailsQuery+` WHERE r.id = $1`, id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &results[0], nil
+}
+
+func (p *PostgresStore) GetResourcesByUserID(userID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	return p.queryResources(resourceDetailsQuery+` WHERE r.user_id = $1 AND r.deleted_at IS NULL ORDER BY r.upload_date DESC`, userID.Hex())
+}
+
+func (p *PostgresStore) FindRelatedResources(courseCode string, currentResourceID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	return p.queryResources(resourceDetailsQuery+` WHERE r.course_code = $1 AND r.id <> $2 AND `+postgresVisible+` LIMIT 4`,
+		courseCode, currentResourceID.Hex())
+}
+
+// DeleteResourceByID apaga o recurso. Comentários (com seus likes), likes, texto e
+// versões saem pelo ON DELETE CASCADE; as notificações, sem chave estrangeira, na
+// mesma transação.
+func (p *PostgresStore) DeleteResourceByID(resourceID, userID primitive.ObjectID) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM resources WHERE id = $1 AND user_id = $2`, resourceID.Hex(), userID.Hex())
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM notifications WHERE resource_id = $1`, resourceID.Hex()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) CountUserUploads(userID primitive.ObjectID) (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM resources WHERE user_id = $1 AND deleted_at IS NULL`, userID.Hex())
+}
+
+func (p *PostgresStore) CountResources() (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM resources WHERE deleted_at IS NULL`)
+}
+
+func (p *PostgresStore) GetDistinctCourses() ([]CourseInfo, error) {
+	rows, err := p.db.Query(`SELECT DISTINCT ON (course_code) course_code, course FROM resources ORDER BY course_code, upload_date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []CourseInfo
+	for rows.Next() {
+		var c CourseInfo
+		if err := rows.Scan(&c.Code, &c.Name); err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	return courses, rows.Err()
+}
+
+// distinctResourceColumns mapeia os nomes de campo usados pela API (os mesmos do bson)
+// para expressões SQL seguras.
+var distinctResourceColumns = map[string]string{
+	"tags":       "unnest(tags)",
+	"courseCode": "course_code",
+	"course":     "course",
+	"type":       "type",
+	"semester":   "semester",
+}
+
+func (p *PostgresStore) GetDistinctFieldValues(fieldName string) ([]string, error) {
+	column, ok := distinctResourceColumns[fieldName]
+	if !ok {
+		return nil, nil
+	}
+	return p.stringList(`SELECT DISTINCT v FROM (SELECT ` + column + ` AS v FROM resources) AS vals ORDER BY v`)
+}
+
+func (p *PostgresStore) SetResourceProcessing(id primitive.ObjectID, status string, pageCount int, processingError string) error {
+	result, err := p.db.Exec(`UPDATE resources SET processing_status = $2, page_count = $3, processing_error = $4 WHERE id = $1`,
+		id.Hex(), status, pageCount, processingError)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) SetResourceThumbnail(id primitive.ObjectID, thumbnailURL string) error {
+	result, err := p.db.Exec(`UPDATE resources SET thumbnail_url = $2 WHERE id = $1`, id.Hex(), thumbnailURL)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) SaveResourceText(id primitive.ObjectID, pages []string) error {
+	_, err := p.db.Exec(`INSERT INTO resource_texts (resource_id, pages) VALUES ($1, $2)
+		ON CONFLICT (resource_id) DO UPDATE SET pages = EXCLUDED.pages`, id.Hex(), pq.Array(pages))
+	return err
+}
+
+func (p *PostgresStore) GetResourceText(id primitive.ObjectID) ([]string, error) {
+	var pages []string
+	err := p.db.QueryRow(`SELECT pages FROM resource_texts WHERE resource_id = $1`, id.Hex()).Scan(pq.Array(&pages))
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	return pages, nil
+}
+
+func (p *PostgresStore) FindResourceByContentHash(hash string) (*models.ResourceWithDetails, error) {
+	if hash == "" {
+		return nil, ErrNotFound
+	}
+	results, err := p.queryResources(resourceDetailsQuery+` WHERE r.content_hash = $1 AND `+postgresVisible+` ORDER BY r.upload_date LIMIT 1`, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &results[0], nil
+}
+
+func (p *PostgresStore) SetResourceScan(id primitive.ObjectID, status, fileURL string) error {
+	result, err := p.db.Exec(`UPDATE resources SET scan_status = $2, file_url = $3 WHERE id = $1`, id.Hex(), status, fileURL)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) ListPendingResourceIDs() ([]primitive.ObjectID, error) {
+	hexIDs, err := p.stringList(`SELECT id FROM resources WHERE processing_status = $1 ORDER BY upload_date`, models.ProcessingPending)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(hexIDs))
+	for i, hex := range hexIDs {
+		ids[i] = objectID(hex)
+	}
+	return ids, nil
+}
+
+func (p *PostgresStore) UpdateResourceMetadata(id, userID primitive.ObjectID, update ResourceUpdate) error {
+	tags := update.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	result, err := p.db.Exec(`UPDATE resources SET title = $3, description = $4, course_code = $5, course = $6,
+		type = $7, semester = $8, tags = $9, professor_id = $10, is_anonymous = $11
+		WHERE id = $1 AND user_id = $2`,
+		id.Hex(), userID.Hex(), update.Title, update.Description, update.CourseCode, update.Course,
+		update.Type, update.Semester, pq.Array(tags), nullableHex(update.ProfessorID), update.IsAnonymous)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) SetResourceFile(id primitive.ObjectID, file ResourceFile) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE resources SET version = $2, file_name = $3, file_url = $4, content_hash = $5,
+		thumbnail_url = '', processing_status = $6, processing_error = '', page_count = 0 WHERE id = $1 AND version < $2`,
+		id.Hex(), file.Version, file.FileName, file.FileUrl, file.ContentHash, models.ProcessingPending)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM resource_texts WHERE resource_id = $1`, id.Hex()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) TrashResource(id, userID primitive.ObjectID, at time.Time) error {
+	result, err := p.db.Exec(`UPDATE resources SET deleted_at = $3 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		id.Hex(), userID.Hex(), at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) HideResource(id primitive.ObjectID, at time.Time) error {
+	result, err := p.db.Exec(`UPDATE resources SET hidden_at = $2 WHERE id = $1`, id.Hex(), at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) RestoreResource(id, userID primitive.ObjectID) error {
+	result, err := p.db.Exec(`UPDATE resources SET deleted_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`,
+		id.Hex(), userID.Hex())
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) ListTrashedResources(userID primitive.ObjectID) ([]models.ResourceWithDetails, error) {
+	return p.queryResources(resourceDetailsQuery+` WHERE r.user_id = $1 AND r.deleted_at IS NOT NULL ORDER BY r.deleted_at DESC`,
+		userID.Hex())
+}
+
+func (p *PostgresStore) ListExpiredTrash(before time.Time) ([]models.ResourceWithDetails, error) {
+	return p.queryResources(resourceDetailsQuery+` WHERE r.deleted_at < $1 ORDER BY r.deleted_at`, before)
+}
+
+// --- Blob refs ---
+
+func (p *PostgresStore) AcquireBlob(hash, key string) (string, error) {
+	var stored string
+	err := p.db.QueryRow(`INSERT INTO blob_refs (hash, blob_key, ref_count) VALUES ($1, $2, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = blob_refs.ref_count + 1
+		RETURNING blob_key`, hash, key).Scan(&stored)
+	return stored, err
+}
+
+func (p *PostgresStore) ReleaseBlob(hash string) (string, int64, error) {
+	var key string
+	var remaining int64
+	err := p.db.QueryRow(`UPDATE blob_refs SET ref_count = ref_count - 1 WHERE hash = $1
+		RETURNING blob_key, ref_count`, hash).Scan(&key, &remaining)
+	if err != nil {
+		return "", 0, translatePostgresError(err)
+	}
+	if remaining > 0 {
+		return key, remaining, nil
+	}
+	// Se outro upload do mesmo conteúdo chegou entre o UPDATE e o DELETE, a linha
+	// fica e o blob não pode ser apagado.
+	result, err := p.db.Exec(`DELETE FROM blob_refs WHERE hash = $1 AND ref_count = 0`, hash)
+	if err != nil {
+		return "", 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return "", 0, err
+	}
+	if deleted == 0 {
+		return key, 1, nil
+	}
+	return key, 0, nil
+}
+
+// --- Quarantine ---
+
+const quarantineColumns = `id, blob_key, file_name, source, resource_id, user_id, signature, detected_at`
+
+func scanQuarantinedFile(row interface{ Scan(...any) error }) (*models.QuarantinedFile, error) {
+	var f models.QuarantinedFile
+	var id string
+	var resourceID, userID sql.NullString
+	err := row.Scan(&id, &f.Key, &f.FileName, &f.Source, &resourceID, &userID, &f.Signature, &f.DetectedAt)
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	f.ID = objectID(id)
+	f.ResourceID = objectIDPtr(resourceID)
+	f.UserID = objectIDPtr(userID)
+	return &f, nil
+}
+
+func (p *PostgresStore) CreateQuarantinedFile(file *models.QuarantinedFile) error {
+	_, err := p.db.Exec(`INSERT INTO quarantined_files (`+quarantineColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		file.ID.Hex(), file.Key, file.FileName, file.Source, nullableHex(file.ResourceID), nullableHex(file.UserID),
+		file.Signature, file.DetectedAt)
+	return translatePostgresError(err)
+}
+
+func (p *PostgresStore) ListQuarantinedFiles() ([]models.QuarantinedFile, error) {
+	rows, err := p.db.Query(`SELECT ` + quarantineColumns + ` FROM quarantined_files ORDER BY detected_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.QuarantinedFile{}
+	for rows.Next() {
+		f, err := scanQuarantinedFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+	return files, rows.Err()
+}
+
+func (p *PostgresStore) GetQuarantinedFile(id primitive.ObjectID) (*models.QuarantinedFile, error) {
+	return scanQuarantinedFile(p.db.QueryRow(`SELECT `+quarantineColumns+` FROM quarantined_files WHERE id = $1`, id.Hex()))
+}
+
+func (p *PostgresStore) DeleteQuarantinedFile(id primitive.ObjectID) error {
+	result, err := p.db.Exec(`DELETE FROM quarantined_files WHERE id = $1`, id.Hex())
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Versions ---
+
+const versionColumns = `id, resource_id, version, user_id, file_name, file_url, content_hash, scan_status, note, created_at`
+
+func (p *PostgresStore) queryVersions(query string, args ...any) ([]models.ResourceVersion, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.ResourceVersion{}
+	for rows.Next() {
+		var v models.ResourceVersion
+		var id, resourceID, userID string
+		err := rows.Scan(&id, &resourceID, &v.Version, &userID, &v.FileName, &v.FileUrl, &v.ContentHash,
+			&v.ScanStatus, &v.Note, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		v.ID = objectID(id)
+		v.ResourceID = objectID(resourceID)
+		v.UserID = objectID(userID)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (p *PostgresStore) CreateResourceVersion(version *models.ResourceVersion) error {
+	_, err := p.db.Exec(`INSERT INTO resource_versions (`+versionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		version.ID.Hex(), version.ResourceID.Hex(), version.Version, version.UserID.Hex(), version.FileName,
+		version.FileUrl, version.ContentHash, version.ScanStatus, version.Note, version.CreatedAt)
+	return translatePostgresError(err)
+}
+
+func (p *PostgresStore) ListResourceVersions(resourceID primitive.ObjectID) ([]models.ResourceVersion, error) {
+	return p.queryVersions(`SELECT `+versionColumns+` FROM resource_versions WHERE resource_id = $1 ORDER BY version`, resourceID.Hex())
+}
+
+func (p *PostgresStore) GetResourceVersion(resourceID primitive.ObjectID, number int) (*models.ResourceVersion, error) {
+	versions, err := p.queryVersions(`SELECT `+versionColumns+` FROM resource_versions WHERE resource_id = $1 AND version = $2`,
+		resourceID.Hex(), number)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return &versions[0], nil
+}
+
+func (p *PostgresStore) ListScanningVersions() ([]models.ResourceVersion, error) {
+	return p.queryVersions(`SELECT `+versionColumns+` FROM resource_versions WHERE scan_status = $1 ORDER BY created_at`, models.ScanScanning)
+}
+
+func (p *PostgresStore) SetResourceVersionScan(resourceID primitive.ObjectID, number int, status, fileURL string) error {
+	result, err := p.db.Exec(`UPDATE resource_versions SET scan_status = $3, file_url = $4 WHERE resource_id = $1 AND version = $2`,
+		resourceID.Hex(), number, status, fileURL)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) DeleteResourceVersion(resourceID primitive.ObjectID, number int) error {
+	result, err := p.db.Exec(`DELETE FROM resource_versions WHERE resource_id = $1 AND version = $2`, resourceID.Hex(), number)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Comments ---
+
+const commentWithAuthorQuery = `SELECT c.id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, u.name, u.avatar_url,
+	(SELECT COUNT(*) FROM comment_likes cl WHERE cl.comment_id = c.id)
+FROM comments c
+JOIN users u ON u.id = c.user_id`
+
+func (p *PostgresStore) queryCommentsWithAuthor(query string, args ...any) ([]*models.CommentWithAuthor, error) {
+	rows, err := p.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*models.CommentWithAuthor
+	for rows.Next() {
+		var c models.CommentWithAuthor
+		var id string
+		var parentID sql.NullString
+		if err := rows.Scan(&id, &parentID, &c.Content, &c.CreatedAt, &c.EditedAt, &c.DeletedAt, &c.AuthorName, &c.AuthorAvatar, &c.Likes); err != nil {
+			return nil, err
+		}
+		c.ID = objectID(id)
+		c.ParentID = objectIDPtr(parentID)
+		comments = append(comments, &c)
+	}
+	return comments, rows.Err()
+}
+
+func (p *PostgresStore) CreateComment(comment *models.Comment) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO comments (id, resource_id, user_id, parent_id, content, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		comment.ID.Hex(), comment.ResourceID.Hex(), comment.UserID.Hex(), nullableHex(comment.ParentID),
+		comment.Content, comment.CreatedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE resources SET comment_count = comment_count + 1 WHERE id = $1`, comment.ResourceID.Hex()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) GetCommentByID(id primitive.ObjectID) (*models.Comment, error) {
+	var comment models.Comment
+	var commentID, resourceID, userID string
+	var parentID sql.NullString
+	err := p.db.QueryRow(`SELECT id, resource_id, user_id, parent_id, content, created_at, edited_at, deleted_at
+		FROM comments WHERE id = $1`, id.Hex()).
+		Scan(&commentID, &resourceID, &userID, &parentID, &comment.Content, &comment.CreatedAt, &comment.EditedAt, &comment.DeletedAt)
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	comment.ID = objectID(commentID)
+	comment.ResourceID = objectID(resourceID)
+	comment.UserID = objectID(userID)
+	comment.ParentID = objectIDPtr(parentID)
+	return &comment, nil
+}
+
+func (p *PostgresStore) GetCommentWithAuthorByID(commentID primitive.ObjectID) (*models.CommentWithAuthor, error) {
+	comments, err := p.queryCommentsWithAuthor(commentWithAuthorQuery+` WHERE c.id = $1`, commentID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, ErrNotFound
+	}
+	hideRemovedAuthor(comments[0])
+	return comments[0], nil
+}
+
+func (p *PostgresStore) GetCommentsByResourceID(resourceID primitive.ObjectID) ([]*models.CommentWithAuthor, error) {
+	comments, err := p.queryCommentsWithAuthor(commentWithAuthorQuery+` WHERE c.resource_id = $1`, resourceID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return buildCommentTree(comments), nil
+}
+
+func (p *PostgresStore) CountUserComments(userID primitive.ObjectID) (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM comments WHERE user_id = $1 AND deleted_at IS NULL`, userID.Hex())
+}
+
+func (p *PostgresStore) EditComment(id, userID primitive.ObjectID, content string, at time.Time) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow(`SELECT content FROM comments WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE`,
+		id.Hex(), userID.Hex()).Scan(&previous)
+	if err != nil {
+		return translatePostgresError(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO comment_edits (id, comment_id, content, edited_at) VALUES ($1, $2, $3, $4)`,
+		primitive.NewObjectID().Hex(), id.Hex(), previous, at); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE comments SET content = $2, edited_at = $3 WHERE id = $1`, id.Hex(), content, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) ListCommentEdits(id primitive.ObjectID) ([]models.CommentEdit, error) {
+	rows, err := p.db.Query(`SELECT id, content, edited_at FROM comment_edits WHERE comment_id = $1 ORDER BY edited_at`, id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []models.CommentEdit{}
+	for rows.Next() {
+		e := models.CommentEdit{CommentID: id}
+		var editID string
+		if err := rows.Scan(&editID, &e.Content, &e.EditedAt); err != nil {
+			return nil, err
+		}
+		e.ID = objectID(editID)
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
+}
+
+func (p *PostgresStore) RemoveComment(id primitive.ObjectID, at time.Time) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE comments SET content = $2, edited_at = NULL, deleted_at = $3 WHERE id = $1 AND deleted_at IS NULL`,
+		id.Hex(), models.CommentRemovedContent, at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM comment_edits WHERE comment_id = $1`, id.Hex()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) TrashComment(id, userID primitive.ObjectID, at time.Time) error {
+	result, err := p.db.Exec(`UPDATE comments SET deleted_at = $3, trashed = TRUE
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, id.Hex(), userID.Hex(), at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) RestoreComment(id, userID primitive.ObjectID) error {
+	result, err := p.db.Exec(`UPDATE comments SET deleted_at = NULL, trashed = FALSE
+		WHERE id = $1 AND user_id = $2 AND trashed`, id.Hex(), userID.Hex())
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) ListTrashedComments(userID primitive.ObjectID) ([]models.Comment, error) {
+	rows, err := p.db.Query(`SELECT id, resource_id, user_id, parent_id, content, created_at, edited_at, deleted_at
+		FROM comments WHERE user_id = $1 AND trashed ORDER BY deleted_at DESC`, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		var c models.Comment
+		var commentID, resourceID, authorID string
+		var parentID sql.NullString
+		if err := rows.Scan(&commentID, &resourceID, &authorID, &parentID, &c.Content, &c.CreatedAt, &c.EditedAt, &c.DeletedAt); err != nil {
+			return nil, err
+		}
+		c.ID = objectID(commentID)
+		c.ResourceID = objectID(resourceID)
+		c.UserID = objectID(authorID)
+		c.ParentID = objectIDPtr(parentID)
+		c.Trashed = true
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (p *PostgresStore) PurgeTrashedComments(before time.Time) (int64, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`UPDATE comments SET content = $2, edited_at = NULL, trashed = FALSE
+		WHERE trashed AND deleted_at < $1 RETURNING id`, before, models.CommentRemovedContent)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if _, err := tx.Exec(`DELETE FROM comment_edits WHERE comment_id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), tx.Commit()
+}
+
+// --- Likes ---
+
+func (p *PostgresStore) CreateLike(like *models.Like) error {
+	return p.LikeResource(like, nil)
+}
+
+func (p *PostgresStore) LikeResource(like *models.Like, notification *models.Notification) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO likes (id, user_id, resource_id, created_at) VALUES ($1, $2, $3, $4)`,
+		like.ID.Hex(), like.UserID.Hex(), like.ResourceID.Hex(), like.CreatedAt); err != nil {
+		return translatePostgresError(err)
+	}
+	if _, err := tx.Exec(`UPDATE resources SET like_count = like_count + 1 WHERE id = $1`, like.ResourceID.Hex()); err != nil {
+		return err
+	}
+	if notification != nil {
+		if err := insertNotification(tx, notification); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) DeleteLike(userID, resourceID primitive.ObjectID) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM likes WHERE user_id = $1 AND resource_id = $2`, userID.Hex(), resourceID.Hex())
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE resources SET like_count = like_count - 1 WHERE id = $1`, resourceID.Hex()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) HasUserLikedResource(userID, resourceID primitive.ObjectID) (bool, error) {
+	return p.exists(`SELECT 1 FROM likes WHERE user_id = $1 AND resource_id = $2`, userID.Hex(), resourceID.Hex())
+}
+
+func (p *PostgresStore) CountLikesForResource(resourceID primitive.ObjectID) (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM likes WHERE resource_id = $1`, resourceID.Hex())
+}
+
+func (p *PostgresStore) CountLikesReceivedByUser(userID primitive.ObjectID) (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM likes l JOIN resources r ON r.id = l.resource_id WHERE r.user_id = $1`, userID.Hex())
+}
+
+func (p *PostgresStore) GetUserLikedResourceIDs(userID primitive.ObjectID) ([]string, error) {
+	return p.stringList(`SELECT resource_id FROM likes WHERE user_id = $1 ORDER BY created_at`, userID.Hex())
+}
+
+func (p *PostgresStore) LikeComment(like *models.CommentLike) error {
+	_, err := p.db.Exec(`INSERT INTO comment_likes (id, user_id, comment_id, created_at) VALUES ($1, $2, $3, $4)`,
+		like.ID.Hex(), like.UserID.Hex(), like.CommentID.Hex(), like.CreatedAt)
+	return translatePostgresError(err)
+}
+
+func (p *PostgresStore) UnlikeComment(userID, commentID primitive.ObjectID) error {
+	_, err := p.db.Exec(`DELETE FROM comment_likes WHERE user_id = $1 AND comment_id = $2`, userID.Hex(), commentID.Hex())
+	return err
+}
+
+func (p *PostgresStore) HasUserLikedComment(userID, commentID primitive.ObjectID) (bool, error) {
+	return p.exists(`SELECT 1 FROM comment_likes WHERE user_id = $1 AND comment_id = $2`, userID.Hex(), commentID.Hex())
+}
+
+func (p *PostgresStore) CountLikesForComment(commentID primitive.ObjectID) (int64, error) {
+	return p.count(`SELECT COUNT(*) FROM comment_likes WHERE comment_id = $1`, commentID.Hex())
+}
+
+func (p *PostgresStore) GetUserLikedCommentIDs(userID primitive.ObjectID) ([]string, error) {
+	return p.stringList(`SELECT comment_id FROM comment_likes WHERE user_id = $1 ORDER BY created_at`, userID.Hex())
+}
+
+// --- Notifications ---
+
+func (p *PostgresStore) CreateNotification(notification *models.Notification) error {
+	return insertNotification(p.db, notification)
+}
+
+// insertNotification grava a notificação direto no banco ou dentro de uma transação.
+func insertNotification(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, notification *models.Notification) error {
+	_, err := db.Exec(`INSERT INTO notifications (id, user_id, actor_name, type, message, resource_id, comment_id, is_read, created_at,
+			read_at, archived_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		notification.ID.Hex(), notification.UserID.Hex(), notification.ActorName, notification.Type, notification.Message,
+		notification.ResourceID.Hex(), notification.CommentID.Hex(), notification.IsRead, notification.CreatedAt,
+		notification.ReadAt, notification.ArchivedAt)
+	return err
+}
+
+func (p *PostgresStore) ListNotifications(userID primitive.ObjectID, query NotificationQuery) (*NotificationPage, error) {
+	query.normalize()
+	cursor, err := decodeNotificationCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{userID.Hex()}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conditions := []string{"user_id = $1"}
+	if query.Archived {
+		conditions = append(conditions, "archived_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "archived_at IS NULL")
+	}
+	if query.Read != nil {
+		conditions = append(conditions, "is_read = "+arg(*query.Read))
+	}
+	if len(query.Types) > 0 {
+		conditions = append(conditions, "type = ANY("+arg(pq.Array(query.Types))+"::text[])")
+	}
+	if cursor != nil {
+		conditions = append(conditions, fmt.Sprintf(`(created_at, id COLLATE "C") < (%s, %s COLLATE "C")`,
+			arg(cursor.Date), arg(cursor.ID.Hex())))
+	}
+
+	rows, err := p.db.Query(`SELECT id, user_id, actor_name, type, message, resource_id, comment_id, is_read, created_at,
+			read_at, archived_at
+		FROM notifications WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC, id COLLATE "C" DESC LIMIT `+arg(query.Limit+1), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var id, ownerID, resourceID, commentID string
+		if err := rows.Scan(&id, &ownerID, &n.ActorName, &n.Type, &n.Message, &resourceID, &commentID, &n.IsRead, &n.CreatedAt,
+			&n.ReadAt, &n.ArchivedAt); err != nil {
+			return nil, err
+		}
+		n.ID = objectID(id)
+		n.UserID = objectID(ownerID)
+		n.ResourceID = objectID(resourceID)
+		n.CommentID = objectID(commentID)
+		items = append(items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return finishNotificationPage(items, query.Limit), nil
+}
+
+func (p *PostgresStore) MarkNotificationAsRead(notificationID, userID primitive.ObjectID, at time.Time) error {
+	// Uma notificação já lida mantém o read_at original.
+	result, err := p.db.Exec(`UPDATE notifications SET is_read = TRUE, read_at = COALESCE(read_at, $3)
+		WHERE id = $1 AND user_id = $2`, notificationID.Hex(), userID.Hex(), at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) MarkAllNotificationsRead(userID primitive.ObjectID, at time.Time) (int64, error) {
+	result, err := p.db.Exec(`UPDATE notifications SET is_read = TRUE, read_at = $2 WHERE user_id = $1 AND NOT is_read`,
+		userID.Hex(), at)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (p *PostgresStore) ArchiveNotifications(userID primitive.ObjectID, ids []primitive.ObjectID, at time.Time) (int64, error) {
+	result, err := p.db.Exec(`UPDATE notifications
+		SET is_read = TRUE, read_at = COALESCE(read_at, $3), archived_at = COALESCE(archived_at, $3)
+		WHERE user_id = $1 AND id = ANY($2::text[])`, userID.Hex(), pq.Array(hexIDs(ids)), at)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (p *PostgresStore) DeleteNotifications(userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	result, err := p.db.Exec(`DELETE FROM notifications WHERE user_id = $1 AND id = ANY($2::text[])`,
+		userID.Hex(), pq.Array(hexIDs(ids)))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func hexIDs(ids []primitive.ObjectID) []string {
+	hexes := make([]string, len(ids))
+	for i, id := range ids {
+		hexes[i] = id.Hex()
+	}
+	return hexes
+}
+
+func (p *PostgresStore) CountUnreadNotifications(userID primitive.ObjectID) (int64, error) {
+	var count int64
+	err := p.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND NOT is_read`, userID.Hex()).Scan(&count)
+	return count, err
+}
+
+func (p *PostgresStore) DeleteReadNotificationsBefore(before time.Time) (int64, error) {
+	result, err := p.db.Exec(`DELETE FROM notifications WHERE is_read AND read_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// --- Reports ---
+
+const reportColumns = `id, target_type, target_id, owner_id, resource_id, reporter_id, reason, details, content,
+	status, action, created_at, resolved_at, resolved_by`
+
+func scanReport(row interface{ Scan(...any) error }) (*models.Report, error) {
+	var r models.Report
+	var id, targetID, ownerID, reporterID string
+	var resourceID, resolvedBy sql.NullString
+	err := row.Scan(&id, &r.TargetType, &targetID, &ownerID, &resourceID, &reporterID, &r.Reason, &r.Details, &r.Content,
+		&r.Status, &r.Action, &r.CreatedAt, &r.ResolvedAt, &resolvedBy)
+	if err != nil {
+		return nil, err
+	}
+	r.ID = objectID(id)
+	r.TargetID = objectID(targetID)
+	r.OwnerID = objectID(ownerID)
+	r.ResourceID = objectIDPtr(resourceID)
+	r.ReporterID = objectID(reporterID)
+	r.ResolvedBy = objectIDPtr(resolvedBy)
+	return &r, nil
+}
+
+func (p *PostgresStore) CreateReport(report *models.Report) error {
+	_, err := p.db.Exec(`INSERT INTO reports (`+reportColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		report.ID.Hex(), report.TargetType, report.TargetID.Hex(), report.OwnerID.Hex(), nullableHex(report.ResourceID),
+		report.ReporterID.Hex(), report.Reason, report.Details, report.Content, report.Status, report.Action,
+		report.CreatedAt, report.ResolvedAt, nullableHex(report.ResolvedBy))
+	return translatePostgresError(err)
+}
+
+func (p *PostgresStore) ListReports(filter ReportFilter) ([]models.Report, error) {
+	rows, err := p.db.Query(`SELECT `+reportColumns+` FROM reports
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR target_type = $2) AND ($3 = '' OR reason = $3)
+		ORDER BY created_at`, filter.Status, filter.TargetType, filter.Reason)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *r)
+	}
+	return reports, rows.Err()
+}
+
+func (p *PostgresStore) GetReport(id primitive.ObjectID) (*models.Report, error) {
+	report, err := scanReport(p.db.QueryRow(`SELECT `+reportColumns+` FROM reports WHERE id = $1`, id.Hex()))
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	return report, nil
+}
+
+func (p *PostgresStore) ResolveReports(targetType string, targetID primitive.ObjectID, resolution ReportResolution) (int64, error) {
+	result, err := p.db.Exec(`UPDATE reports SET status = $3, action = $4, resolved_at = $5, resolved_by = $6
+		WHERE target_type = $1 AND target_id = $2 AND status = $7`,
+		targetType, targetID.Hex(), resolution.Status, resolution.Action, resolution.At, resolution.AdminID.Hex(), models.ReportOpen)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (p *PostgresStore) CreateModerationAction(action *models.ModerationAction) error {
+	_, err := p.db.Exec(`INSERT INTO moderation_actions (id, admin_id, action, target_type, target_id, report_id, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		action.ID.Hex(), action.AdminID.Hex(), action.Action, action.TargetType, action.TargetID.Hex(),
+		nullableHex(action.ReportID), action.Note, action.CreatedAt)
+	return err
+}
+
+func (p *PostgresStore) ListModerationActions(filter ModerationActionFilter) ([]models.ModerationAction, error) {
+	rows, err := p.db.Query(`SELECT id, admin_id, action, target_type, target_id, report_id, note, created_at
+		FROM moderation_actions
+		WHERE ($1::text IS NULL OR target_id = $1) AND ($2::text IS NULL OR admin_id = $2)
+		ORDER BY created_at DESC`, nullableHex(filter.TargetID), nullableHex(filter.AdminID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []models.ModerationAction{}
+	for rows.Next() {
+		var a models.ModerationAction
+		var id, adminID, targetID string
+		var reportID sql.NullString
+		if err := rows.Scan(&id, &adminID, &a.Action, &a.TargetType, &targetID, &reportID, &a.Note, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.ID = objectID(id)
+		a.AdminID = objectID(adminID)
+		a.TargetID = objectID(targetID)
+		a.ReportID = objectIDPtr(reportID)
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+// --- Sessions ---
+
+const sessionColumns = `id, user_id, refresh_hash, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, rotated_hashes`
+
+func scanSession(row interface{ Scan(...any) error }) (*models.Session, error) {
+	var s models.Session
+	var id, userID string
+	err := row.Scan(&id, &userID, &s.RefreshHash, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt,
+		pq.Array(&s.RotatedHashes))
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	s.ID = objectID(id)
+	s.UserID = objectID(userID)
+	return &s, nil
+}
+
+func (p *PostgresStore) CreateSession(session *models.Session) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Aproveita para esquecer as sessões vencidas do usuário.
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = $1 AND expires_at <= $2`,
+		session.UserID.Hex(), session.CreatedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO sessions (`+sessionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		session.ID.Hex(), session.UserID.Hex(), session.RefreshHash, session.UserAgent, session.IP,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt, session.RevokedAt, pq.Array(session.RotatedHashes)); err != nil {
+		return translatePostgresError(err)
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) GetSession(id primitive.ObjectID) (*models.Session, error) {
+	return scanSession(p.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id.Hex()))
+}
+
+func (p *PostgresStore) RotateSession(id primitive.ObjectID, rotation SessionRotation) error {
+	// Guarda só os MaxRotatedHashes hashes trocados mais recentes.
+	result, err := p.db.Exec(`UPDATE sessions SET refresh_hash = $3, ip = $4, last_seen_at = $5, expires_at = $6,
+			rotated_hashes = (array_append(rotated_hashes, refresh_hash))[greatest(1, cardinality(rotated_hashes) + 2 - $7):]
+		WHERE id = $1 AND refresh_hash = $2 AND revoked_at IS NULL AND expires_at > $5`,
+		id.Hex(), rotation.OldHash, rotation.NewHash, rotation.IP, rotation.At, rotation.ExpiresAt, MaxRotatedHashes)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) ListUserSessions(userID primitive.ObjectID, now time.Time) ([]models.Session, error) {
+	rows, err := p.db.Query(`SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC`, userID.Hex(), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+func (p *PostgresStore) RevokeSession(id, userID primitive.ObjectID, at time.Time) error {
+	result, err := p.db.Exec(`UPDATE sessions SET revoked_at = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3`, id.Hex(), userID.Hex(), at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) RevokeUserSessions(userID primitive.ObjectID, at time.Time) (int64, error) {
+	result, err := p.db.Exec(`UPDATE sessions SET revoked_at = $2
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2`, userID.Hex(), at)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// --- User tokens ---
+
+func (p *PostgresStore) CreateUserToken(token *models.UserToken) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`,
+		token.UserID.Hex(), token.Purpose); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO user_tokens (id, user_id, purpose, hash, created_at, expires_at, used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID.Hex(), token.UserID.Hex(), token.Purpose, token.Hash, token.CreatedAt, token.ExpiresAt, token.UsedAt); err != nil {
+		return translatePostgresError(err)
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) ConsumeUserToken(purpose, hash string, now time.Time) (*models.UserToken, error) {
+	var t models.UserToken
+	var id, userID string
+	err := p.db.QueryRow(`UPDATE user_tokens SET used_at = $3
+		WHERE purpose = $1 AND hash = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING id, user_id, purpose, hash, created_at, expires_at, used_at`, purpose, hash, now).
+		Scan(&id, &userID, &t.Purpose, &t.Hash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	t.ID = objectID(id)
+	t.UserID = objectID(userID)
+	return &t, nil
+}
+
+// --- Rate limits ---
+
+func (p *PostgresStore) GetRateLimit(key string) (*models.RateLimit, error) {
+	var entry models.RateLimit
+	err := p.db.QueryRow(`SELECT key, tokens, updated_at, failures, locked_until, expires_at, version
+		FROM rate_limits WHERE key = $1`, key).
+		Scan(&entry.Key, &entry.Tokens, &entry.UpdatedAt, &entry.Failures, &entry.LockedUntil, &entry.ExpiresAt, &entry.Version)
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	return &entry, nil
+}
+
+func (p *PostgresStore) PutRateLimit(entry *models.RateLimit, prevVersion int64) error {
+	var result sql.Result
+	var err error
+	if prevVersion == 0 {
+		// Aproveita para esquecer as chaves vencidas, que ninguém mais vai ler.
+		if _, err := p.db.Exec(`DELETE FROM rate_limits WHERE expires_at < $1`, time.Now()); err != nil {
+			return err
+		}
+		result, err = p.db.Exec(`INSERT INTO rate_limits (key, tokens, updated_at, failures, locked_until, expires_at, version)
+			VALUES ($1, $2, $3, $4, $5, $6, 1) ON CONFLICT (key) DO NOTHING`,
+			entry.Key, entry.Tokens, entry.UpdatedAt, entry.Failures, entry.LockedUntil, entry.ExpiresAt)
+	} else {
+		result, err = p.db.Exec(`UPDATE rate_limits SET tokens = $2, updated_at = $3, failures = $4, locked_until = $5,
+			expires_at = $6, version = version + 1 WHERE key = $1 AND version = $7`,
+			entry.Key, entry.Tokens, entry.UpdatedAt, entry.Failures, entry.LockedUntil, entry.ExpiresAt, prevVersion)
+	}
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrConflict
+	}
+	entry.Version = prevVersion + 1
+	return nil
+}
+
+func (p *PostgresStore) DeleteRateLimit(key string) error {
+	_, err := p.db.Exec(`DELETE FROM rate_limits WHERE key = $1`, key)
+	return err
+}
+
+// --- Notification preferences ---
+
+func (p *PostgresStore) GetNotificationPreferences(userID primitive.ObjectID) (*models.NotificationPreferences, error) {
+	row := p.db.QueryRow(`SELECT user_id, types, quiet_hours, digest, digest_courses, last_digest_at, updated_at
+		FROM notification_preferences WHERE user_id = $1`, userID.Hex())
+	prefs, err := scanPreferences(row)
+	if err != nil {
+		return nil, translatePostgresError(err)
+	}
+	return prefs, nil
+}
+
+func scanPreferences(row interface{ Scan(...any) error }) (*models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	var userID string
+	var types []byte
+	var quiet []byte
+	err := row.Scan(&userID, &types, &quiet, &prefs.Digest, pq.Array(&prefs.DigestCourses), &prefs.LastDigestAt, &prefs.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	prefs.UserID = objectID(userID)
+	if err := json.Unmarshal(types, &prefs.Types); err != nil {
+		return nil, err
+	}
+	if quiet != nil {
+		if err := json.Unmarshal(quiet, &prefs.QuietHours); err != nil {
+			return nil, err
+		}
+	}
+	if prefs.DigestCourses == nil {
+		prefs.DigestCourses = []string{}
+	}
+	return &prefs, nil
+}
+
+func (p *PostgresStore) SaveNotificationPreferences(prefs *models.NotificationPreferences) error {
+	types, err := json.Marshal(prefs.Types)
+	if err != nil {
+		return err
+	}
+	// O lib/pq manda []byte como bytea; o JSONB precisa chegar como texto.
+	var quiet sql.NullString
+	if prefs.QuietHours != nil {
+		b, err := json.Marshal(prefs.QuietHours)
+		if err != nil {
+			return err
+		}
+		quiet = sql.NullString{String: string(b), Valid: true}
+	}
+	courses := prefs.DigestCourses
+	if courses == nil {
+		courses = []string{}
+	}
+	_, err = p.db.Exec(`INSERT INTO notification_preferences
+			(user_id, types, quiet_hours, digest, digest_courses, last_digest_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET types = EXCLUDED.types, quiet_hours = EXCLUDED.quiet_hours,
+			digest = EXCLUDED.digest, digest_courses = EXCLUDED.digest_courses,
+			last_digest_at = EXCLUDED.last_digest_at, updated_at = EXCLUDED.updated_at`,
+		prefs.UserID.Hex(), string(types), quiet, prefs.Digest, pq.Array(courses), prefs.LastDigestAt, prefs.UpdatedAt)
+	return translatePostgresError(err)
+}
+
+func (p *PostgresStore) ListDigestSubscribers() ([]models.NotificationPreferences, error) {
+	rows, err := p.db.Query(`SELECT user_id, types, quiet_hours, digest, digest_courses, last_digest_at, updated_at
+		FROM notification_preferences WHERE digest IN ($1, $2) ORDER BY user_id`, models.DigestDaily, models.DigestWeekly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscribers := []models.NotificationPreferences{}
+	for rows.Next() {
+		prefs, err := scanPreferences(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, *prefs)
+	}
+	return subscribers, rows.Err()
+}
+
+func (p *PostgresStore) SetLastDigest(userID primitive.ObjectID, at time.Time) error {
+	result, err := p.db.Exec(`UPDATE notification_preferences SET last_digest_at = $2 WHERE user_id = $1`, userID.Hex(), at)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Catalog ---
+
+func (p *PostgresStore) ListCourses() ([]models.Course, error) {
+	rows, err := p.db.Query(`SELECT id, code, name FROM courses ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.Course{}
+	for rows.Next() {
+		var item models.Course
+		var id string
+		if err := rows.Scan(&id, &item.Code, &item.Name); err != nil {
+			return nil, err
+		}
+		item.ID = objectID(id)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (p *PostgresStore) CreateCourse(item *models.Course) error {
+	_, err := p.db.Exec(`INSERT INTO courses (id, code, name) VALUES ($1, $2, $3)`, item.ID.Hex(), item.Code, item.Name)
+	return err
+}
+
+func (p *PostgresStore) DeleteCourseByID(id primitive.ObjectID) error {
+	_, err := p.db.Exec(`DELETE FROM courses WHERE id = $1`, id.Hex())
+	return err
+}
+
+func (p *PostgresStore) CountCourses() (int64, error) {
+	return p.count(`SELECT COUNT(DISTINCT code) FROM courses`)
+}
+
+func (p *PostgresStore) ListProfessors() ([]models.Professor, error) {
+	rows, err := p.db.Query(`SELECT id, name, avatar_url FROM professors ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.Professor{}
+	for rows.Next() {
+		var item models.Professor
+		var id string
+		if err := rows.Scan(&id, &item.Name, &item.AvatarURL); err != nil {
+			return nil, err
+		}
+		item.ID = objectID(id)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (p *PostgresStore) CreateProfessor(item *models.Professor) error {
+	_, err := p.db.Exec(`INSERT INTO professors (id, name, avatar_url) VALUES ($1, $2, $3)`, item.ID.Hex(), item.Name, item.AvatarURL)
+	return err
+}
+
+func (p *PostgresStore) DeleteProfessorByID(id primitive.ObjectID) error {
+	_, err := p.db.Exec(`DELETE FROM professors WHERE id = $1`, id.Hex())
+	return err
+}
+
+func (p *PostgresStore) ListTags() ([]models.Tag, error) {
+	rows, err := p.db.Query(`SELECT id, name FROM tags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.Tag{}
+	for rows.Next() {
+		var item models.Tag
+		var id string
+		if err := rows.Scan(&id, &item.Name); err != nil {
+			return nil, err
+		}
+		item.ID = objectID(id)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (p *PostgresStore) CreateTag(item *models.Tag) error {
+	_, err := p.db.Exec(`INSERT INTO tags (id, name) VALUES ($1, $2)`, item.ID.Hex(), item.Name)
+	return err
+}
+
+func (p *PostgresStore) DeleteTagByID(id primitive.ObjectID) error {
+	_, err := p.db.Exec(`DELETE FROM tags WHERE id = $1`, id.Hex())
+	return err
+}
+
+// --- Integrity ---
+
+// As chaves estrangeiras já apagam em cascata quase tudo que depende de um recurso;
+// as notificações não têm chave estrangeira e são as que costumam sobrar. As outras
+// tabelas são conferidas mesmo assim, para bancos criados antes das migrações.
+func (p *PostgresStore) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{}
+	checks := []struct {
+		count *int64
+		table string
+		where string
+	}{
+		{&report.Likes, "likes t", "NOT EXISTS (SELECT 1 FROM resources r WHERE r.id = t.resource_id)"},
+		{&report.Comments, "comments t", "NOT EXISTS (SELECT 1 FROM resources r WHERE r.id = t.resource_id)"},
+		{&report.CommentLikes, "comment_likes t", "NOT EXISTS (SELECT 1 FROM comments c WHERE c.id = t.comment_id)"},
+		{&report.CommentEdits, "comment_edits t", "NOT EXISTS (SELECT 1 FROM comments c WHERE c.id = t.comment_id)"},
+		{&report.Notifications, "notifications t", "NOT EXISTS (SELECT 1 FROM resources r WHERE r.id = t.resource_id)"},
+		{&report.ResourceTexts, "resource_texts t", "NOT EXISTS (SELECT 1 FROM resources r WHERE r.id = t.resource_id)"},
+		{&report.Versions, "resource_versions t", "NOT EXISTS (SELECT 1 FROM resources r WHERE r.id = t.resource_id)"},
+	}
+	for _, c := range checks {
+		if !repair {
+			n, err := p.count(`SELECT COUNT(*) FROM ` + c.table + ` WHERE ` + c.where)
+			if err != nil {
+				return nil, err
+			}
+			*c.count = n
+			continue
+		}
+		result, err := p.db.Exec(`DELETE FROM ` + c.table + ` WHERE ` + c.where)
+		if err != nil {
+			return nil, err
+		}
+		if *c.count, err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"uspshare/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SortNewest        = "newest"
+	SortMostLiked     = "likes"
+	SortMostCommented = "comments"
+)
+
+const (
+	DefaultResourceLimit = 20
+	MaxResourceLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("store: invalid cursor")
+
+// ResourceQuery descreve os filtros aceitos por GET /api/resources. Campos vazios
+// (ou zero) não filtram nada.
+type ResourceQuery struct {
+	Text         string
+	CourseCode   string
+	Type         string
+	Semester     string
+	ProfessorID  *primitive.ObjectID
+	UploaderID   *primitive.ObjectID
+	Tags         []string
+	MatchAllTags bool
+	From         time.Time
+	To           time.Time
+
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+// ResourcePage é uma página de resultados. Next fica vazio na última página.
+type ResourcePage struct {
+	Items []models.ResourceWithDetails `json:"items"`
+	Total int64                        `json:"total"`
+	Next  string                       `json:"next,omitempty"`
+}
+
+// sortDescending é a única direção da listagem; entra no cursor junto com a ordenação.
+const sortDescending = "desc"
+
+// resourceCursor guarda a chave de ordenação do último item entregue. A paginação é
+// por keyset: a próxima página começa logo depois de (Date|Count, ID) na ordem decrescente.
+// Sort e Order registram a ordenação que gerou o cursor, que não vale para outra.
+type resourceCursor struct {
+	Sort  string             `json:"s"`
+	Order string             `json:"o"`
+	Date  time.Time          `json:"d,omitempty"`
+	Count int64              `json:"c,omitempty"`
+	ID    primitive.ObjectID `json:"id"`
+}
+
+func encodeResourceCursor(sortBy string, last models.ResourceWithDetails) string {
+	c := resourceCursor{Sort: sortBy, Order: sortDescending, ID: last.ID}
+	switch sortBy {
+	case SortMostLiked:
+		c.Count = int64(last.Likes)
+	case SortMostCommented:
+		c.Count = int64(last.Comments)
+	default:
+		c.Date = last.UploadDate
+	}
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeResourceCursor(cursor, sortBy string) (*resourceCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c resourceCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sortBy || c.Order != sortDescending {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalize preenche os valores padrão de ordenação e limite.
+func (q *ResourceQuery) normalize() {
+	switch q.Sort {
+	case SortMostLiked, SortMostCommented:
+	default:
+		q.Sort = SortNewest
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultResourceLimit
+	}
+	if q.Limit > MaxResourceLimit {
+		q.Limit = MaxResourceLimit
+	}
+}
+
+// textTerms quebra a busca livre em palavras; cada uma precisa aparecer em algum
+// dos campos de texto do recurso.
+func textTerms(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+// finishPage corta o item extra buscado para saber se existe próxima página.
+func finishPage(sortBy string, items []models.ResourceWithDetails, limit int, total int64) *ResourcePage {
+	page := &ResourcePage{Items: items, Total: total}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.Next = encodeResourceCursor(sortBy, page.Items[limit-1])
+	}
+	return page
+}
+
+const (
+	DefaultNotificationLimit = 20
+	MaxNotificationLimit     = 100
+)
+
+// NotificationQuery filtra a caixa de notificações de um usuário. Sem filtros vêm as
+// que não foram arquivadas, lidas ou não.
+type NotificationQuery struct {
+	// Types restringe aos tipos listados (models.NotificationReply, ...).
+	Types []string
+	// Read traz só as lidas (true) ou só as não lidas (false); nil traz as duas.
+	Read *bool
+	// Archived traz as arquivadas em vez das da caixa de entrada.
+	Archived bool
+
+	Cursor string
+	Limit  int
+}
+
+// NotificationPage é uma página da caixa, das mais recentes para as mais antigas.
+// Next fica vazio na última página.
+type NotificationPage struct {
+	Items []models.Notification `json:"items"`
+	Next  string                `json:"next,omitempty"`
+}
+
+// notificationCursor guarda (CreatedAt, ID) da última notificação entregue; a
+// próxima página começa logo depois dela na ordem decrescente.
+type notificationCursor struct {
+	Date time.Time          `json:"d"`
+	ID   primitive.ObjectID `json:"id"`
+}
+
+func decodeNotificationCursor(cursor string) (*notificationCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c notificationCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// normalize preenche o limite padrão.
+func (q *NotificationQuery) normalize() {
+	if q.Limit <= 0 {
+		q.Limit = DefaultNotificationLimit
+	}
+	if q.Limit > MaxNotificationLimit {
+		q.Limit = MaxNotificationLimit
+	}
+}
+
+// finishNotificationPage corta o item extra buscado para saber se existe próxima
+// página.
+func finishNotificationPage(items []models.Notification, limit int) *NotificationPage {
+	page := &NotificationPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		last := page.Items[limit-1]
+		raw, _ := json.Marshal(notificationCursor{Date: last.CreatedAt, ID: last.ID})
+		page.Next = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	return page
+}
@@ -1,323 +1,446 @@
 package store
 
 import (
-	"context"
-	"log"
+	"errors"
 	"sort"
 	"time"
 
-	"uspshare/database"
 	"uspshare/models"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
-
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CreateUser(user *models.User) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return err
-	}
-
-	user.ID = primitive.NewObjectID()
-	user.CreatedAt = time.Now()
-	_, err = database.UserCollection.InsertOne(context.TODO(), bson.M{
-		"_id":       user.ID,
-		"name":      user.Name,
-		"email":     user.Email,
-		"password":  string(hashedPassword),
-		"createdAt": user.CreatedAt,
-	})
-	return err
-}
-
-func GetUserByEmail(email string) (*models.User, error) {
-	var user models.User
-	err := database.UserCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+// ErrNotFound é retornado por qualquer backend quando o documento pedido não existe
+// (ou, no caso de DeleteResourceByID, não pertence ao usuário).
+var ErrNotFound = errors.New("store: not found")
+
+// ErrConflict é retornado por gravações condicionais quando outra gravação chegou
+// antes (ver RateLimitStore.PutRateLimit).
+var ErrConflict = errors.New("store: conflict")
+
+// ErrDuplicateKey é retornado quando uma restrição de unicidade é violada (ex.: e-mail repetido).
+var ErrDuplicateKey = errors.New("store: duplicate key")
+
+type UserStore interface {
+	CreateUser(user *models.User) error
+	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id primitive.ObjectID) (*models.User, error)
+	UpdateUserProfile(id primitive.ObjectID, profile ProfileUpdate) error
+	UpdateUserAvatar(id primitive.ObjectID, avatarURL string) error
+	// SetUserRole troca o papel do usuário e as disciplinas em que ele atua.
+	SetUserRole(id primitive.ObjectID, role string, courses []string) error
+	// SetUserPassword troca a senha do usuário; password chega em texto e é guardada
+	// com bcrypt, como em CreateUser. ErrNotFound se o usuário não existe.
+	SetUserPassword(id primitive.ObjectID, password string) error
+	// SetUserEmailVerified confirma o e-mail de uma conta pendente. ErrNotFound se o
+	// usuário não existe.
+	SetUserEmailVerified(id primitive.ObjectID) error
+	// SetUserSuspended suspende a conta a partir de at; com nil, tira a suspensão.
+	SetUserSuspended(id primitive.ObjectID, at *time.Time) error
+	SearchUsersByNameOrEmail(query string, selfID primitive.ObjectID) ([]models.User, error)
+	CountUsers() (int64, error)
+}
+
+// ResourceStore guarda os materiais. ListResources, SearchResources,
+// FindRelatedResources e FindResourceByContentHash só devolvem recursos visíveis (ver
+// models.Resource.Visible); GetResourcesByUserID devolve também os que estão em
+// verificação ou quarentena, para o dono acompanhar, mas não os da lixeira, que saem
+// em ListTrashedResources. GetResourceByID devolve qualquer um.
+type ResourceStore interface {
+	CreateResource(resource *models.Resource) error
+	ListResources() ([]models.ResourceWithDetails, error)
+	SearchResources(query ResourceQuery) (*ResourcePage, error)
+	GetResourceByID(id primitive.ObjectID) (*models.ResourceWithDetails, error)
+	GetResourcesByUserID(userID primitive.ObjectID) ([]models.ResourceWithDetails, error)
+	FindRelatedResources(courseCode string, currentResourceID primitive.ObjectID) ([]models.ResourceWithDetails, error)
+	// DeleteResourceByID apaga o recurso de vez, junto com likes, comentários (e os
+	// likes e edições deles), notificações, texto extraído e versões. Os arquivos
+	// ficam para quem chamou liberar.
+	DeleteResourceByID(resourceID, userID primitive.ObjectID) error
+	// CountUserUploads e CountResources não contam os recursos na lixeira.
+	CountUserUploads(userID primitive.ObjectID) (int64, error)
+	CountResources() (int64, error)
+	GetDistinctCourses() ([]CourseInfo, error)
+	GetDistinctFieldValues(fieldName string) ([]string, error)
+
+	// SetResourceProcessing grava o estado do processamento assíncrono do recurso.
+	SetResourceProcessing(id primitive.ObjectID, status string, pageCount int, processingError string) error
+	SetResourceThumbnail(id primitive.ObjectID, thumbnailURL string) error
+	// SaveResourceText guarda o texto extraído do arquivo, uma string por página.
+	SaveResourceText(id primitive.ObjectID, pages []string) error
+	// GetResourceText devolve ErrNotFound se nada foi extraído para o recurso.
+	GetResourceText(id primitive.ObjectID) ([]string, error)
+	// FindResourceByContentHash devolve o recurso mais antigo com esse conteúdo, ou
+	// ErrNotFound.
+	FindResourceByContentHash(hash string) (*models.ResourceWithDetails, error)
+	// SetResourceScan grava o resultado da verificação de malware e para onde o
+	// arquivo foi movido depois dela.
+	SetResourceScan(id primitive.ObjectID, status, fileURL string) error
+	// ListPendingResourceIDs devolve os recursos com processamento pendente, inclusive
+	// os que ainda estão em verificação e não aparecem em ListResources.
+	ListPendingResourceIDs() ([]primitive.ObjectID, error)
+	// UpdateResourceMetadata troca os campos editáveis do recurso. ErrNotFound se o
+	// recurso não existe ou não pertence ao usuário.
+	UpdateResourceMetadata(id, userID primitive.ObjectID, update ResourceUpdate) error
+	// SetResourceFile troca o arquivo atual do recurso por uma nova versão. O
+	// thumbnail e o texto extraído do arquivo anterior são descartados e o recurso
+	// volta para o processamento. Devolve ErrNotFound se o recurso não existe ou já
+	// está numa versão igual ou mais nova.
+	SetResourceFile(id primitive.ObjectID, file ResourceFile) error
+
+	// TrashResource manda o recurso para a lixeira. ErrNotFound se ele não existe,
+	// não pertence ao usuário ou já está na lixeira.
+	TrashResource(id, userID primitive.ObjectID, at time.Time) error
+	// RestoreResource tira o recurso da lixeira. ErrNotFound se ele não está na
+	// lixeira do usuário.
+	RestoreResource(id, userID primitive.ObjectID) error
+	// ListTrashedResources devolve a lixeira do usuário, do mais recente para o mais antigo.
+	ListTrashedResources(userID primitive.ObjectID) ([]models.ResourceWithDetails, error)
+	// ListExpiredTrash devolve os recursos que foram para a lixeira antes de before.
+	ListExpiredTrash(before time.Time) ([]models.ResourceWithDetails, error)
+	// HideResource esconde o recurso por decisão da moderação. ErrNotFound se ele não
+	// existe.
+	HideResource(id primitive.ObjectID, at time.Time) error
+}
+
+// VersionStore guarda o histórico de arquivos dos recursos. As versões saem junto
+// com o recurso em DeleteResourceByID.
+type VersionStore interface {
+	// CreateResourceVersion devolve ErrDuplicateKey se o número já existe no recurso.
+	CreateResourceVersion(version *models.ResourceVersion) error
+	// ListResourceVersions devolve o histórico em ordem crescente de versão.
+	ListResourceVersions(resourceID primitive.ObjectID) ([]models.ResourceVersion, error)
+	GetResourceVersion(resourceID primitive.ObjectID, number int) (*models.ResourceVersion, error)
+	// ListScanningVersions devolve as versões que ainda esperam o antivírus.
+	ListScanningVersions() ([]models.ResourceVersion, error)
+	SetResourceVersionScan(resourceID primitive.ObjectID, number int, status, fileURL string) error
+	DeleteResourceVersion(resourceID primitive.ObjectID, number int) error
+}
+
+// QuarantineStore registra os arquivos barrados pelo antivírus.
+type QuarantineStore interface {
+	CreateQuarantinedFile(file *models.QuarantinedFile) error
+	// ListQuarantinedFiles devolve os registros, do mais recente para o mais antigo.
+	ListQuarantinedFiles() ([]models.QuarantinedFile, error)
+	GetQuarantinedFile(id primitive.ObjectID) (*models.QuarantinedFile, error)
+	DeleteQuarantinedFile(id primitive.ObjectID) error
+}
+
+// BlobRefStore conta quantos recursos apontam para cada arquivo guardado, indexado
+// pelo SHA-256 do conteúdo, para que cópias idênticas usem um único blob.
+type BlobRefStore interface {
+	// AcquireBlob registra mais uma referência ao conteúdo. Se o hash ainda não existe,
+	// key passa a ser a chave do blob; senão devolve a chave já registrada.
+	AcquireBlob(hash, key string) (string, error)
+	// ReleaseBlob remove uma referência e devolve a chave do blob e quantas ainda
+	// restam; com zero o blob pode ser apagado. ErrNotFound se o hash não existe.
+	ReleaseBlob(hash string) (string, int64, error)
+}
+
+// CommentStore guarda os comentários. Os apagados continuam na árvore de
+// GetCommentsByResourceID com models.CommentRemovedContent e sem autor, mas não contam
+// em CountUserComments.
+type CommentStore interface {
+	CreateComment(comment *models.Comment) error
+	GetCommentByID(id primitive.ObjectID) (*models.Comment, error)
+	GetCommentWithAuthorByID(commentID primitive.ObjectID) (*models.CommentWithAuthor, error)
+	GetCommentsByResourceID(resourceID primitive.ObjectID) ([]*models.CommentWithAuthor, error)
+	CountUserComments(userID primitive.ObjectID) (int64, error)
+
+	// EditComment troca o texto do comentário e guarda o anterior no histórico.
+	// ErrNotFound se o comentário não existe, não é do usuário ou foi apagado.
+	EditComment(id, userID primitive.ObjectID, content string, at time.Time) error
+	// ListCommentEdits devolve os textos anteriores do comentário, do mais antigo para
+	// o mais recente.
+	ListCommentEdits(id primitive.ObjectID) ([]models.CommentEdit, error)
+	// RemoveComment apaga o texto e o histórico do comentário, que fica na árvore como
+	// models.CommentRemovedContent. ErrNotFound se ele não existe ou já foi apagado.
+	RemoveComment(id primitive.ObjectID, at time.Time) error
+	// TrashComment manda o comentário do autor para a lixeira. Na árvore ele aparece
+	// como apagado, mas o texto e o histórico ficam guardados. ErrNotFound se ele não
+	// existe, é de outra pessoa ou já foi apagado.
+	TrashComment(id, userID primitive.ObjectID, at time.Time) error
+	// RestoreComment tira o comentário da lixeira do autor. ErrNotFound se ele não
+	// está lá.
+	RestoreComment(id, userID primitive.ObjectID) error
+	// ListTrashedComments devolve a lixeira de comentários do usuário, dos apagados
+	// mais recentemente para os mais antigos.
+	ListTrashedComments(userID primitive.ObjectID) ([]models.Comment, error)
+	// PurgeTrashedComments apaga o texto e o histórico dos comentários que estão na
+	// lixeira desde antes de before, como RemoveComment, e devolve quantos eram.
+	PurgeTrashedComments(before time.Time) (int64, error)
+}
+
+// ReportStore guarda as denúncias de recursos, comentários e usuários (a fila de
+// moderação) e o registro das decisões dos admins. As denúncias sobrevivem ao alvo:
+// elas são o histórico do que foi decidido.
+type ReportStore interface {
+	// CreateReport devolve ErrDuplicateKey se o usuário já denunciou o alvo.
+	CreateReport(report *models.Report) error
+	// ListReports devolve as denúncias que passam no filtro, da mais antiga para a mais
+	// recente.
+	ListReports(filter ReportFilter) ([]models.Report, error)
+	GetReport(id primitive.ObjectID) (*models.Report, error)
+	// ResolveReports fecha com status e action todas as denúncias abertas do alvo e
+	// devolve quantas foram fechadas.
+	ResolveReports(targetType string, targetID primitive.ObjectID, resolution ReportResolution) (int64, error)
+
+	CreateModerationAction(action *models.ModerationAction) error
+	// ListModerationActions devolve as decisões, da mais recente para a mais antiga.
+	ListModerationActions(filter ModerationActionFilter) ([]models.ModerationAction, error)
+}
+
+type LikeStore interface {
+	CreateLike(like *models.Like) error
+	// LikeResource grava o like e, se notification não for nil, a notificação para o
+	// dono do recurso: ou as duas gravações acontecem, ou nenhuma. ErrDuplicateKey se
+	// o usuário já curtiu o recurso.
+	LikeResource(like *models.Like, notification *models.Notification) error
+	DeleteLike(userID, resourceID primitive.ObjectID) error
+	HasUserLikedResource(userID, resourceID primitive.ObjectID) (bool, error)
+	CountLikesForResource(resourceID primitive.ObjectID) (int64, error)
+	CountLikesReceivedByUser(userID primitive.ObjectID) (int64, error)
+	GetUserLikedResourceIDs(userID primitive.ObjectID) ([]string, error)
+
+	// LikeComment devolve ErrDuplicateKey se o usuário já curtiu o comentário.
+	LikeComment(like *models.CommentLike) error
+	UnlikeComment(userID, commentID primitive.ObjectID) error
+	HasUserLikedComment(userID, commentID primitive.ObjectID) (bool, error)
+	CountLikesForComment(commentID primitive.ObjectID) (int64, error)
+	GetUserLikedCommentIDs(userID primitive.ObjectID) ([]string, error)
+}
+
+// NotificationStore guarda a caixa de notificações de cada usuário. As arquivadas
+// saem da caixa de entrada e contam como lidas.
+type NotificationStore interface {
+	CreateNotification(notification *models.Notification) error
+	// ListNotifications devolve uma página da caixa do usuário. ErrInvalidCursor se o
+	// cursor não veio de uma página anterior.
+	ListNotifications(userID primitive.ObjectID, query NotificationQuery) (*NotificationPage, error)
+	// MarkNotificationAsRead marca a notificação como lida em at, se ainda não
+	// estava. ErrNotFound se ela não existe ou não é do usuário.
+	MarkNotificationAsRead(notificationID, userID primitive.ObjectID, at time.Time) error
+	// MarkAllNotificationsRead marca como lidas todas as não lidas do usuário e
+	// devolve quantas mudaram.
+	MarkAllNotificationsRead(userID primitive.ObjectID, at time.Time) (int64, error)
+	// ArchiveNotifications arquiva as notificações de ids que são do usuário,
+	// marcando-as como lidas, e devolve quantas eram dele.
+	ArchiveNotifications(userID primitive.ObjectID, ids []primitive.ObjectID, at time.Time) (int64, error)
+	// DeleteNotifications apaga as notificações de ids que são do usuário e devolve
+	// quantas saíram.
+	DeleteNotifications(userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error)
+	// CountUnreadNotifications conta as notificações do usuário ainda não lidas.
+	CountUnreadNotifications(userID primitive.ObjectID) (int64, error)
+	// DeleteReadNotificationsBefore apaga as notificações lidas antes de before e
+	// devolve quantas saíram. As lidas antes de ReadAt existir valem pela data de
+	// criação.
+	DeleteReadNotificationsBefore(before time.Time) (int64, error)
+}
+
+// CatalogStore guarda as listas administradas (disciplinas, professores e tags).
+type CatalogStore interface {
+	ListCourses() ([]models.Course, error)
+	CreateCourse(item *models.Course) error
+	DeleteCourseByID(id primitive.ObjectID) error
+	CountCourses() (int64, error)
+
+	ListProfessors() ([]models.Professor, error)
+	CreateProfessor(item *models.Professor) error
+	DeleteProfessorByID(id primitive.ObjectID) error
+
+	ListTags() ([]models.Tag, error)
+	CreateTag(item *models.Tag) error
+	DeleteTagByID(id primitive.ObjectID) error
+}
+
+// SessionStore guarda as sessões de login, uma por dispositivo.
+type SessionStore interface {
+	CreateSession(session *models.Session) error
+	// GetSession devolve a sessão mesmo revogada ou expirada; quem chama confere
+	// Session.Active.
+	GetSession(id primitive.ObjectID) (*models.Session, error)
+	// RotateSession troca o hash do refresh token, guardando o anterior entre os
+	// MaxRotatedHashes mais recentes, se o atual ainda for
+	// rotation.OldHash e a sessão estiver ativa. ErrNotFound caso contrário.
+	RotateSession(id primitive.ObjectID, rotation SessionRotation) error
+	// ListUserSessions devolve as sessões ativas do usuário, da usada mais
+	// recentemente para a mais antiga.
+	ListUserSessions(userID primitive.ObjectID, now time.Time) ([]models.Session, error)
+	// RevokeSession revoga uma sessão ativa do usuário. ErrNotFound se não houver.
+	RevokeSession(id, userID primitive.ObjectID, at time.Time) error
+	// RevokeUserSessions revoga todas as sessões ativas do usuário e diz quantas eram.
+	RevokeUserSessions(userID primitive.ObjectID, at time.Time) (int64, error)
+}
+
+// UserTokenStore guarda os tokens de uso único mandados por e-mail (confirmação de
+// cadastro e troca de senha).
+type UserTokenStore interface {
+	// CreateUserToken guarda o token. Os tokens anteriores do usuário com o mesmo
+	// propósito são apagados: só o último link enviado vale.
+	CreateUserToken(token *models.UserToken) error
+	// ConsumeUserToken marca como usado o token com esse propósito e hash, se ele
+	// ainda valer em now, e o devolve. ErrNotFound se não houver, se já foi usado ou
+	// se expirou; dois usos simultâneos não passam os dois.
+	ConsumeUserToken(purpose, hash string, now time.Time) (*models.UserToken, error)
+}
+
+// RateLimitStore guarda o estado do limitador de requisições quando ele precisa ser
+// compartilhado entre várias instâncias do servidor.
+type RateLimitStore interface {
+	// GetRateLimit devolve o estado da chave, mesmo vencido, ou ErrNotFound.
+	GetRateLimit(key string) (*models.RateLimit, error)
+	// PutRateLimit grava o estado se a versão guardada ainda for prevVersion (0 para
+	// uma chave nova) e avança entry.Version. ErrConflict se outra gravação veio antes.
+	PutRateLimit(entry *models.RateLimit, prevVersion int64) error
+	DeleteRateLimit(key string) error
+}
+
+// NotificationPreferenceStore guarda as preferências de notificação de cada usuário.
+type NotificationPreferenceStore interface {
+	// GetNotificationPreferences devolve ErrNotFound para quem nunca mudou as
+	// preferências.
+	GetNotificationPreferences(userID primitive.ObjectID) (*models.NotificationPreferences, error)
+	// SaveNotificationPreferences cria ou substitui as preferências do usuário.
+	SaveNotificationPreferences(prefs *models.NotificationPreferences) error
+	// ListDigestSubscribers devolve as preferências de quem assina algum resumo por
+	// e-mail (Digest diferente de DigestOff).
+	ListDigestSubscribers() ([]models.NotificationPreferences, error)
+	// SetLastDigest grava até quando foi o último resumo do usuário; ErrNotFound se
+	// ele não tem preferências guardadas.
+	SetLastDigest(userID primitive.ObjectID, at time.Time) error
+}
+
+// IntegrityStore procura documentos órfãos, que apontam para recursos ou comentários
+// que não existem mais. Eles sobraram de cascatas interrompidas no meio, de antes de
+// DeleteResourceByID rodar numa transação.
+type IntegrityStore interface {
+	// CheckIntegrity conta os órfãos e, com repair, apaga todos eles.
+	CheckIntegrity(repair bool) (*IntegrityReport, error)
+}
+
+// IntegrityReport é quantos órfãos CheckIntegrity achou em cada coleção.
+type IntegrityReport struct {
+	Likes         int64 `json:"likes"`
+	Comments      int64 `json:"comments"`
+	CommentLikes  int64 `json:"commentLikes"`
+	CommentEdits  int64 `json:"commentEdits"`
+	Notifications int64 `json:"notifications"`
+	ResourceTexts int64 `json:"resourceTexts"`
+	Versions      int64 `json:"versions"`
+}
+
+// Total soma os órfãos de todas as coleções.
+func (r *IntegrityReport) Total() int64 {
+	return r.Likes + r.Comments + r.CommentLikes + r.CommentEdits + r.Notifications + r.ResourceTexts + r.Versions
+}
+
+// Store agrupa os repositórios usados pelos handlers. Cada backend (MongoDB, PostgreSQL, memória)
+// devolve um Store com todos os campos preenchidos.
+type Store struct {
+	Users         UserStore
+	Resources     ResourceStore
+	Comments      CommentStore
+	Likes         LikeStore
+	Notifications NotificationStore
+	Catalog       CatalogStore
+	BlobRefs      BlobRefStore
+	Quarantine    QuarantineStore
+	Versions      VersionStore
+	Reports       ReportStore
+	Sessions      SessionStore
+	Tokens        UserTokenStore
+	RateLimits    RateLimitStore
+	Preferences   NotificationPreferenceStore
+	Integrity     IntegrityStore
+}
+
+type ProfileUpdate struct {
+	Name    string
+	Course  string
+	Faculty string
+	Bio     string
+}
+
+// ResourceUpdate são os campos do recurso que o dono pode editar.
+type ResourceUpdate struct {
+	Title       string
+	Description string
+	CourseCode  string
+	Course      string
+	Type        string
+	Semester    string
+	Tags        []string
+	ProfessorID *primitive.ObjectID
+	IsAnonymous bool
+}
+
+// ReportFilter escolhe as denúncias de ListReports; campos vazios não filtram.
+type ReportFilter struct {
+	Status     string
+	TargetType string
+	Reason     string
+}
+
+// ReportResolution é a decisão que fecha as denúncias de um alvo.
+type ReportResolution struct {
+	Status  string
+	Action  string
+	AdminID primitive.ObjectID
+	At      time.Time
+}
+
+// MaxRotatedHashes é quantos hashes de refresh tokens já trocados cada sessão guarda
+// para reconhecer uma reutilização.
+const MaxRotatedHashes = 20
+
+// SessionRotation é uma renovação de sessão: o novo hash do refresh token e o novo
+// prazo, a partir de At. OldHash passa para Session.RotatedHashes.
+type SessionRotation struct {
+	OldHash   string
+	NewHash   string
+	IP        string
+	At        time.Time
+	ExpiresAt time.Time
+}
+
+// ModerationActionFilter escolhe as decisões de ListModerationActions; nil não filtra.
+type ModerationActionFilter struct {
+	TargetID *primitive.ObjectID
+	AdminID  *primitive.ObjectID
+}
+
+// ResourceFile é o arquivo que passa a ser o atual do recurso.
+type ResourceFile struct {
+	Version     int
+	FileName    string
+	FileUrl     string
+	ContentHash string
 }
 
-func ListResources() ([]bson.M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "likes"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "resourceId"},
-			{Key: "as", Value: "likeData"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "users"},
-			{Key: "localField", Value: "userId"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "uploaderInfo"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "professors"},
-			{Key: "localField", Value: "professorId"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "professorInfo"},
-		}}},
-
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "comments"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "resourceId"},
-			{Key: "as", Value: "commentData"},
-		}}},
-
-		{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$uploaderInfo"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
-		{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$professorInfo"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
-
-		{{Key: "$addFields", Value: bson.D{
-			{Key: "id", Value: "$_id"},
-			{Key: "uploaderName", Value: "$uploaderInfo.name"},
-			{Key: "uploaderAvatar", Value: "$uploaderInfo.avatarUrl"},
-			{Key: "professorName", Value: "$professorInfo.name"},
-			{Key: "professorAvatar", Value: "$professorInfo.avatarUrl"},
-			{Key: "likes", Value: bson.D{{Key: "$size", Value: "$likeData"}}},
-			{Key: "comments", Value: bson.D{{Key: "$size", Value: "$commentData"}}},
-		}}},
-		{{Key: "$project", Value: bson.D{{Key: "likeData", Value: 0}}}},
-	}
-
-	cursor, err := database.ResourceCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, err
-	}
-
-	return results, nil
-}
-
-func GetUserByID(id primitive.ObjectID) (*models.User, error) {
-	var user models.User
-	err := database.UserCollection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&user)
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
-}
-
-func GetResourcesByUserID(userID primitive.ObjectID) ([]bson.M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.D{{Key: "userId", Value: userID}}}},
-
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "likes"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "resourceId"},
-			{Key: "as", Value: "likeData"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "comments"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "resourceId"},
-			{Key: "as", Value: "commentData"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "users"},
-			{Key: "localField", Value: "userId"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "uploaderInfo"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "professors"},
-			{Key: "localField", Value: "professorId"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "professorInfo"},
-		}}},
-		{{Key: "$unwind", Value: bson.D{
-			{Key: "path", Value: "$uploaderInfo"},
-			{Key: "preserveNullAndEmptyArrays", Value: true},
-		}}},
-		{{Key: "$unwind", Value: bson.D{
-			{Key: "path", Value: "$professorInfo"},
-			{Key: "preserveNullAndEmptyArrays", Value: true},
-		}}},
-		{{Key: "$addFields", Value: bson.D{
-			{Key: "id", Value: "$_id"},
-			{Key: "likes", Value: bson.D{{Key: "$size", Value: "$likeData"}}},
-			{Key: "comments", Value: bson.D{{Key: "$size", Value: "$commentData"}}},
-			{Key: "uploaderName", Value: "$uploaderInfo.name"},
-			{Key: "uploaderAvatar", Value: "$uploaderInfo.avatarUrl"},
-			{Key: "professorName", Value: "$professorInfo.name"},
-			{Key: "professorAvatar", Value: "$professorInfo.avatarUrl"},
-		}}},
-		{{Key: "$sort", Value: bson.D{{Key: "uploadDate", Value: -1}}}},
-		{{Key: "$project", Value: bson.D{
-			{Key: "_id", Value: 0},
-			{Key: "likeData", Value: 0},
-			{Key: "commentData", Value: 0},
-			{Key: "uploaderInfo", Value: 0},
-			{Key: "professorInfo", Value: 0},
-		}}},
-	}
-
-	cursor, err := database.ResourceCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, err
-	}
-
-	return results, nil
-}
-
-func CountUserUploads(userID primitive.ObjectID) (int64, error) {
-	count, err := database.ResourceCollection.CountDocuments(context.TODO(), bson.M{"userId": userID})
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-func CreateResource(resource *models.Resource) error {
-	_, err := database.ResourceCollection.InsertOne(context.TODO(), resource)
-	return err
+type CourseInfo struct {
+	Code string `json:"code" bson:"_id"`
+	Name string `json:"name" bson:"name"`
 }
 
-func GetResourceByID(id primitive.ObjectID) (bson.M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.D{{Key: "_id", Value: id}}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "users"},
-			{Key: "localField", Value: "userId"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "uploaderInfo"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "professors"},
-			{Key: "localField", Value: "professorId"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "professorInfo"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "likes"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "resourceId"},
-			{Key: "as", Value: "likeData"},
-		}}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "comments"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "resourceId"},
-			{Key: "as", Value: "commentData"},
-		}}},
-		{{Key: "$unwind", Value: bson.D{
-			{Key: "path", Value: "$uploaderInfo"},
-			{Key: "preserveNullAndEmptyArrays", Value: true},
-		}}},
-		{{Key: "$unwind", Value: bson.D{
-			{Key: "path", Value: "$professorInfo"},
-			{Key: "preserveNullAndEmptyArrays", Value: true},
-		}}},
-		{{Key: "$addFields", Value: bson.D{
-			{Key: "uploaderName", Value: "$uploaderInfo.name"},
-			{Key: "uploaderAvatar", Value: "$uploaderInfo.avatarUrl"},
-			{Key: "professorName", Value: "$professorInfo.name"},
-			{Key: "professorAvatar", Value: "$professorInfo.avatarUrl"},
-			{Key: "likes", Value: bson.D{{Key: "$size", Value: "$likeData"}}},
-			{Key: "comments", Value: bson.D{{Key: "$size", Value: "$commentData"}}},
-		}}},
-	}
-	cursor, err := database.ResourceCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, err
+// hideRemovedAuthor tira o autor de um comentário apagado: só sobra o lugar dele na
+// árvore.
+func hideRemovedAuthor(c *models.CommentWithAuthor) {
+	if c.DeletedAt != nil {
+		c.Content = models.CommentRemovedContent
+		c.EditedAt = nil
+		c.AuthorName = ""
+		c.AuthorAvatar = ""
 	}
-	if len(results) == 0 {
-		return nil, mongo.ErrNoDocuments
-	}
-	return results[0], nil
-}
-
-func CreateComment(comment *models.Comment) error {
-	_, err := database.CommentCollection.InsertOne(context.TODO(), comment)
-	return err
 }
 
-func GetCommentsByResourceID(resourceID primitive.ObjectID) ([]*models.CommentWithAuthor, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{"$match", bson.D{{"resourceId", resourceID}}}},
-		{{"$lookup", bson.D{{"from", "users"}, {"localField", "userId"}, {"foreignField", "_id"}, {"as", "authorInfo"}}}},
-		{{"$lookup", bson.D{{"from", "comment_likes"}, {"localField", "_id"}, {"foreignField", "commentId"}, {"as", "likeData"}}}},
-		{{"$unwind", "$authorInfo"}},
-		{{"$addFields", bson.D{
-			{"authorName", "$authorInfo.name"},
-			{"authorAvatar", "$authorInfo.avatarUrl"},
-			{"likes", bson.D{{"$size", "$likeData"}}},
-		}}},
-		{{"$project", bson.D{{"authorInfo", 0}, {"likeData", 0}}}},
-	}
-
-	cursor, err := database.CommentCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		log.Printf("Erro na agregação do MongoDB: %v", err)
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	type tempComment struct {
-		ID           primitive.ObjectID  `bson:"_id"`
-		ParentID     *primitive.ObjectID `bson:"parentId"`
-		Content      string              `bson:"content"`
-		CreatedAt    time.Time           `bson:"createdAt"`
-		AuthorName   string              `bson:"authorName"`
-		AuthorAvatar string              `bson:"authorAvatar"`
-		Replies      []tempComment       `bson:"replies,omitempty"`
-		Likes        int                 `bson:"likes"`
-	}
-
-	var allComments []tempComment
-	if err = cursor.All(ctx, &allComments); err != nil {
-		return nil, err
-	}
-
+// buildCommentTree monta a árvore de respostas a partir da lista plana de comentários
+// de um recurso. Respostas cujo pai não está na lista são descartadas.
+func buildCommentTree(allComments []*models.CommentWithAuthor) []*models.CommentWithAuthor {
 	commentMap := make(map[primitive.ObjectID]*models.CommentWithAuthor)
-
 	for _, c := range allComments {
-		commentMap[c.ID] = &models.CommentWithAuthor{
-			ID:           c.ID,
-			ParentID:     c.ParentID,
-			Content:      c.Content,
-			CreatedAt:    c.CreatedAt,
-			AuthorName:   c.AuthorName,
-			AuthorAvatar: c.AuthorAvatar,
-			Replies:      []*models.CommentWithAuthor{},
-			Likes:        c.Likes,
-		}
+		hideRemovedAuthor(c)
+		c.Replies = []*models.CommentWithAuthor{}
+		commentMap[c.ID] = c
 	}
 
 	var rootComments []*models.CommentWithAuthor
@@ -333,7 +456,7 @@ func GetCommentsByResourceID(resourceID primitive.ObjectID) ([]*models.CommentWi
 
 	sortCommentsRecursive(rootComments)
 
-	return rootComments, nil
+	return rootComments
 }
 
 func sortCommentsRecursive(comments []*models.CommentWithAuthor) {
@@ -347,448 +470,3 @@ func sortCommentsRecursive(comments []*models.CommentWithAuthor) {
 		}
 	}
 }
-
-func CreateNotification(notification *models.Notification) error {
-	_, err := database.NotificationCollection.InsertOne(context.TODO(), notification)
-	return err
-}
-
-func GetNotificationsByUserID(userID primitive.ObjectID) ([]models.Notification, error) {
-	var notifications []models.Notification
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(50)
-
-	cursor, err := database.NotificationCollection.Find(ctx, bson.M{"userId": userID}, opts)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	if err = cursor.All(ctx, &notifications); err != nil {
-		return nil, err
-	}
-
-	if notifications == nil {
-		return []models.Notification{}, nil
-	}
-
-	return notifications, nil
-}
-
-func MarkNotificationAsRead(notificationID, userID primitive.ObjectID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{
-		"_id":    notificationID,
-		"userId": userID,
-	}
-
-	update := bson.M{
-		"$set": bson.M{"isRead": true},
-	}
-
-	_, err := database.NotificationCollection.UpdateOne(ctx, filter, update)
-	return err
-}
-
-func GetCommentByID(id primitive.ObjectID) (*models.Comment, error) {
-	var comment models.Comment
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	err := database.CommentCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&comment)
-	if err != nil {
-		return nil, err
-	}
-	return &comment, nil
-}
-
-func GetCommentWithAuthorByID(commentID primitive.ObjectID) (*models.CommentWithAuthor, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.D{{Key: "_id", Value: commentID}}}},
-		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "users"}, {Key: "localField", Value: "userId"}, {Key: "foreignField", Value: "_id"}, {Key: "as", Value: "authorInfo"}}}},
-		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "comment_likes"}, {Key: "localField", Value: "_id"}, {Key: "foreignField", Value: "commentId"}, {Key: "as", Value: "likeData"}}}},
-		{{Key: "$unwind", Value: "$authorInfo"}},
-		{{Key: "$addFields", Value: bson.D{
-			{Key: "authorName", Value: "$authorInfo.name"},
-			{Key: "authorAvatar", Value: "$authorInfo.avatarUrl"},
-			{Key: "likes", Value: bson.D{{Key: "$size", Value: "$likeData"}}},
-		}}},
-		{{Key: "$project", Value: bson.D{{Key: "authorInfo", Value: 0}, {Key: "likeData", Value: 0}}}},
-	}
-
-	cursor, err := database.CommentCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var results []models.CommentWithAuthor
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, err
-	}
-
-	if len(results) == 0 {
-		return nil, mongo.ErrNoDocuments
-	}
-
-	return &results[0], nil
-}
-
-func CountUserComments(userID primitive.ObjectID) (int64, error) {
-	count, err := database.CommentCollection.CountDocuments(context.TODO(), bson.M{"userId": userID})
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-func UpdateUserByID(id primitive.ObjectID, update bson.M) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{"_id": id}
-
-	_, err := database.UserCollection.UpdateOne(ctx, filter, update)
-
-	return err
-}
-
-type CourseInfo struct {
-	Code string `json:"code" bson:"_id"`
-	Name string `json:"name" bson:"name"`
-}
-
-func GetDistinctCourses() ([]CourseInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{"$group", bson.D{
-			{"_id", "$courseCode"},
-			{"name", bson.D{{"$first", "$course"}}},
-		}}},
-		{{"$sort", bson.D{{"_id", 1}}}},
-	}
-
-	cursor, err := database.ResourceCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var courses []CourseInfo
-	if err = cursor.All(ctx, &courses); err != nil {
-		return nil, err
-	}
-	return courses, nil
-}
-
-func GetDistinctFieldValues(fieldName string) ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	values, err := database.ResourceCollection.Distinct(ctx, fieldName, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-
-	var stringValues []string
-	for _, v := range values {
-		if str, ok := v.(string); ok {
-			stringValues = append(stringValues, str)
-		}
-	}
-	sort.Strings(stringValues)
-	return stringValues, nil
-}
-
-func ListCourses() ([]models.Course, error) {
-	var items []models.Course
-	cursor, err := database.CourseCollection.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{"code", 1}}))
-	if err != nil {
-		return nil, err
-	}
-	if err = cursor.All(context.TODO(), &items); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-func CreateCourse(item *models.Course) error {
-	_, err := database.CourseCollection.InsertOne(context.TODO(), item)
-	return err
-}
-func DeleteCourseByID(id primitive.ObjectID) error {
-	_, err := database.CourseCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
-	return err
-}
-
-func ListProfessors() ([]models.Professor, error) {
-	var items []models.Professor
-	cursor, err := database.ProfessorCollection.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{"name", 1}}))
-	if err != nil {
-		return nil, err
-	}
-	if err = cursor.All(context.TODO(), &items); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-func CreateProfessor(item *models.Professor) error {
-	_, err := database.ProfessorCollection.InsertOne(context.TODO(), item)
-	return err
-}
-func DeleteProfessorByID(id primitive.ObjectID) error {
-	_, err := database.ProfessorCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
-	return err
-}
-
-func ListTags() ([]models.Tag, error) {
-	var items []models.Tag
-	cursor, err := database.TagCollection.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.D{{"name", 1}}))
-	if err != nil {
-		return nil, err
-	}
-	if err = cursor.All(context.TODO(), &items); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-func CreateTag(item *models.Tag) error {
-	_, err := database.TagCollection.InsertOne(context.TODO(), item)
-	return err
-}
-func DeleteTagByID(id primitive.ObjectID) error {
-	_, err := database.TagCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
-	return err
-}
-
-func SearchUsersByNameOrEmail(query string, selfID primitive.ObjectID) ([]models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{
-		"_id": bson.M{"$ne": selfID},
-		"$or": []bson.M{
-			{"name": bson.M{"$regex": query, "$options": "i"}},
-			{"email": bson.M{"$regex": query, "$options": "i"}},
-		},
-	}
-
-	projection := bson.M{"password": 0}
-	opts := options.Find().SetProjection(projection).SetLimit(10)
-
-	cursor, err := database.UserCollection.Find(ctx, filter, opts)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var users []models.User
-	if err = cursor.All(ctx, &users); err != nil {
-		return nil, err
-	}
-
-	return users, nil
-}
-
-func CreateLike(like *models.Like) error {
-	_, err := database.LikeCollection.InsertOne(context.TODO(), like)
-	return err
-}
-
-func DeleteLike(userID, resourceID primitive.ObjectID) error {
-	_, err := database.LikeCollection.DeleteOne(context.TODO(), bson.M{"userId": userID, "resourceId": resourceID})
-	return err
-}
-
-func HasUserLikedResource(userID, resourceID primitive.ObjectID) (bool, error) {
-	count, err := database.LikeCollection.CountDocuments(context.TODO(), bson.M{"userId": userID, "resourceId": resourceID})
-	return count > 0, err
-}
-
-func CountLikesForResource(resourceID primitive.ObjectID) (int64, error) {
-	return database.LikeCollection.CountDocuments(context.TODO(), bson.M{"resourceId": resourceID})
-}
-
-func CountLikesReceivedByUser(userID primitive.ObjectID) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	pipeline := mongo.Pipeline{
-		{{"$match", bson.D{{"userId", userID}}}},
-		{{"$lookup", bson.D{
-			{"from", "likes"},
-			{"localField", "_id"},
-			{"foreignField", "resourceId"},
-			{"as", "likesData"},
-		}}},
-		{{"$addFields", bson.D{
-			{"likeCount", bson.D{{"$size", "$likesData"}}},
-		}}},
-		{{"$group", bson.D{
-			{"_id", nil},
-			{"totalLikes", bson.D{{"$sum", "$likeCount"}}},
-		}}},
-	}
-
-	cursor, err := database.ResourceCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var results []struct {
-		TotalLikes int64 `bson:"totalLikes"`
-	}
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&results); err != nil {
-			var result struct {
-				TotalLikes int64 `bson:"totalLikes"`
-			}
-			if err := cursor.Decode(&result); err == nil {
-				return result.TotalLikes, nil
-			}
-		}
-		if len(results) > 0 {
-			return results[0].TotalLikes, nil
-		}
-	}
-	return 0, nil
-}
-
-func GetUserLikedResourceIDs(userID primitive.ObjectID) ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	filter := bson.M{"userId": userID}
-	cursor, err := database.LikeCollection.Find(ctx, filter)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var likedResourceIDs []string
-	for cursor.Next(ctx) {
-		var like models.Like
-		if err := cursor.Decode(&like); err == nil {
-			likedResourceIDs = append(likedResourceIDs, like.ResourceID.Hex())
-		}
-	}
-	return likedResourceIDs, nil
-}
-
-func LikeComment(like *models.CommentLike) error {
-	_, err := database.CommentLikeCollection.InsertOne(context.TODO(), like)
-	return err
-}
-
-func UnlikeComment(userID, commentID primitive.ObjectID) error {
-	_, err := database.CommentLikeCollection.DeleteOne(context.TODO(), bson.M{"userId": userID, "commentId": commentID})
-	return err
-}
-
-func HasUserLikedComment(userID, commentID primitive.ObjectID) (bool, error) {
-	count, err := database.CommentLikeCollection.CountDocuments(context.TODO(), bson.M{"userId": userID, "commentId": commentID})
-	return count > 0, err
-}
-
-func CountLikesForComment(commentID primitive.ObjectID) (int64, error) {
-	return database.CommentLikeCollection.CountDocuments(context.TODO(), bson.M{"commentId": commentID})
-}
-
-func GetUserLikedCommentIDs(userID primitive.ObjectID) ([]string, error) {
-	var likedCommentIDs []string
-	cursor, err := database.CommentLikeCollection.Find(context.TODO(), bson.M{"userId": userID})
-	if err != nil {
-		return nil, err
-	}
-	for cursor.Next(context.TODO()) {
-		var like models.CommentLike
-		if err := cursor.Decode(&like); err == nil {
-			likedCommentIDs = append(likedCommentIDs, like.CommentID.Hex())
-		}
-	}
-	return likedCommentIDs, nil
-}
-
-func FindRelatedResources(courseCode string, currentResourceID primitive.ObjectID) ([]bson.M, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	filter := bson.M{
-		"courseCode": courseCode,
-		"_id":        bson.M{"$ne": currentResourceID},
-	}
-
-	pipeline := mongo.Pipeline{
-		{{"$match", filter}},
-		{{"$limit", 4}},
-
-		{{"$lookup", bson.D{
-			{"from", "professors"},
-			{"localField", "professorId"},
-			{"foreignField", "_id"},
-			{"as", "professorInfo"},
-		}}},
-		{{"$unwind", bson.D{{"path", "$professorInfo"}, {"preserveNullAndEmptyArrays", true}}}},
-
-		{{"$addFields", bson.D{
-			{"id", "$_id"},
-			{"professorName", "$professorInfo.name"},
-			{"professorAvatar", "$professorInfo.avatarUrl"},
-		}}},
-
-		{{"$project", bson.D{
-			{"title", 1},
-			{"type", 1},
-			{"id", 1},
-			{"professorName", 1},
-			{"professorAvatar", 1},
-		}}},
-	}
-
-	cursor, err := database.ResourceCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
-		return nil, err
-	}
-
-	return results, nil
-}
-
-func DeleteResourceByID(resourceID, userID primitive.ObjectID) error {
-	ctx := context.TODO()
-
-	filter := bson.M{"_id": resourceID, "userId": userID}
-
-	result, err := database.ResourceCollection.DeleteOne(ctx, filter)
-	if err != nil {
-		return err
-	}
-	if result.DeletedCount == 0 {
-		return mongo.ErrNoDocuments
-	}
-
-	_, err = database.LikeCollection.DeleteMany(ctx, bson.M{"resourceId": resourceID})
-	if err != nil {
-		log.Printf("Aviso: falha ao deletar likes do recurso %s: %v", resourceID.Hex(), err)
-	}
-
-	_, err = database.CommentCollection.DeleteMany(ctx, bson.M{"resourceId": resourceID})
-	if err != nil {
-		log.Printf("Aviso: falha ao deletar comentários do recurso %s: %v", resourceID.Hex(), err)
-	}
-
-	return nil
-}
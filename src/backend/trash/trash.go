@@ -0,0 +1,138 @@
+// Package trash apaga de vez os recursos que ficaram na lixeira além do prazo de
+// retenção, junto com tudo o que depende deles e os arquivos no armazenamento, e o
+// texto dos comentários apagados pelo autor.
+package trash
+
+import (
+	"log"
+	"time"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/processing"
+	"uspshare/store"
+)
+
+// DefaultRetention é quanto tempo um recurso ou comentário fica na lixeira antes de
+// ser apagado.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Purger apaga os recursos vencidos da lixeira.
+type Purger struct {
+	store     *store.Store
+	blobs     blob.Store
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewPurger(s *store.Store, blobs blob.Store, retention time.Duration) *Purger {
+	return &Purger{store: s, blobs: blobs, retention: retention, now: time.Now}
+}
+
+// Purge apaga os recursos que estão na lixeira há mais que o prazo de retenção e
+// devolve quantos foram removidos. Um recurso que falhar continua na lixeira e é
+// tentado de novo na próxima rodada. Os comentários vencidos ficam na árvore como
+// removidos, sem texto nem histórico.
+func (p *Purger) Purge() (int, error) {
+	cutoff := p.now().Add(-p.retention)
+	if comments, err := p.store.Comments.PurgeTrashedComments(cutoff); err != nil {
+		log.Printf("Erro ao esvaziar a lixeira de comentários: %v", err)
+	} else if comments > 0 {
+		log.Printf("%d comentários foram apagados da lixeira", comments)
+	}
+
+	expired, err := p.store.Resources.ListExpiredTrash(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, res := range expired {
+		// O histórico é lido antes porque sai junto com o recurso.
+		versions, err := p.store.Versions.ListResourceVersions(res.ID)
+		if err != nil {
+			log.Printf("Erro ao carregar as versões do recurso %s: %v", res.ID.Hex(), err)
+			continue
+		}
+		if err := p.store.Resources.DeleteResourceByID(res.ID, res.UserID); err != nil {
+			if err != store.ErrNotFound {
+				log.Printf("Erro ao apagar o recurso %s da lixeira: %v", res.ID.Hex(), err)
+			}
+			continue
+		}
+		ReleaseFiles(p.store.BlobRefs, p.blobs, res.Resource, versions)
+		purged++
+	}
+	return purged, nil
+}
+
+// Start roda Purge a cada interval numa goroutine própria.
+func (p *Purger) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := p.Purge()
+			if err != nil {
+				log.Printf("Erro ao esvaziar a lixeira: %v", err)
+			} else if purged > 0 {
+				log.Printf("%d recursos foram apagados da lixeira", purged)
+			}
+		}
+	}()
+}
+
+// ReleaseFiles libera os arquivos de um recurso apagado. Com histórico, os arquivos
+// são os das versões, cada uma com sua referência ao blob (o arquivo atual é uma
+// delas); sem, é o do próprio recurso.
+func ReleaseFiles(refs store.BlobRefStore, blobs blob.Store, resource models.Resource, versions []models.ResourceVersion) {
+	if len(versions) == 0 {
+		releaseFile(refs, blobs, resource.ScanStatus, resource.ContentHash, resource.FileUrl, resource.ThumbnailUrl)
+		return
+	}
+	for _, v := range versions {
+		thumbnailURL := ""
+		if key := blob.KeyFromURL(v.FileUrl); key != "" {
+			thumbnailURL = blob.PublicURL(processing.ThumbnailKey(key))
+		}
+		releaseFile(refs, blobs, v.ScanStatus, v.ContentHash, v.FileUrl, thumbnailURL)
+	}
+}
+
+// releaseFile libera um arquivo e seu thumbnail. Arquivos com ContentHash podem ser
+// compartilhados por vários recursos e só são apagados quando sai a última
+// referência; os antigos, sem hash, são apagados direto. Um arquivo ainda em
+// verificação não tem referência, e um em quarentena fica até um admin apagá-lo.
+func releaseFile(refs store.BlobRefStore, blobs blob.Store, scanStatus, contentHash, fileURL, thumbnailURL string) {
+	switch scanStatus {
+	case models.ScanScanning:
+		deleteBlobs(blobs, fileURL)
+		return
+	case models.ScanQuarantined:
+		return
+	}
+	if contentHash != "" {
+		_, remaining, err := refs.ReleaseBlob(contentHash)
+		if err != nil && err != store.ErrNotFound {
+			log.Printf("Erro ao liberar o blob %s: %v", contentHash, err)
+			return
+		}
+		if remaining > 0 {
+			return
+		}
+	}
+	deleteBlobs(blobs, fileURL, thumbnailURL)
+}
+
+// deleteBlobs apaga os arquivos pela URL pública. Falhas só são logadas: o recurso
+// já saiu do banco e o arquivo órfão não é visível para ninguém.
+func deleteBlobs(blobs blob.Store, urls ...string) {
+	for _, url := range urls {
+		key := blob.KeyFromURL(url)
+		if key == "" {
+			continue
+		}
+		if err := blobs.Delete(key); err != nil {
+			log.Printf("Erro ao apagar arquivo %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package trash
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"uspshare/blob"
+	"uspshare/models"
+	"uspshare/store"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPurger(t *testing.T) {
+	s := store.NewMemoryStore()
+	blobs := blob.NewLocalStore(t.TempDir(), []byte("segredo"))
+	p := NewPurger(s, blobs, 7*24*time.Hour)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	exists := func(key string) bool {
+		rc, err := blobs.Open(key)
+		if err == nil {
+			rc.Close()
+		}
+		return err == nil
+	}
+	// newResource cria um recurso limpo cujo arquivo é compartilhado pelo hash.
+	newResource := func(key, hash string) *models.Resource {
+		assert.NoError(t, blobs.Put(key, strings.NewReader("%PDF"), 4, ""))
+		_, err := s.BlobRefs.AcquireBlob(hash, key)
+		assert.NoError(t, err)
+		res := &models.Resource{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), FileUrl: blob.PublicURL(key),
+			ContentHash: hash, ScanStatus: models.ScanClean, UploadDate: now}
+		assert.NoError(t, s.Resources.CreateResource(res))
+		return res
+	}
+
+	expired := newResource("a.pdf", "hash-a")
+	recent := newResource("b.pdf", "hash-b")
+	shared := newResource("a.pdf", "hash-a")
+	assert.NoError(t, s.Resources.TrashResource(expired.ID, expired.UserID, now.Add(-8*24*time.Hour)))
+	assert.NoError(t, s.Resources.TrashResource(recent.ID, recent.UserID, now.Add(-time.Hour)))
+
+	purged, err := p.Purge()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = s.Resources.GetResourceByID(expired.ID)
+	assert.Equal(t, store.ErrNotFound, err)
+	_, err = s.Resources.GetResourceByID(recent.ID)
+	assert.NoError(t, err, "Ainda dentro do prazo de retenção")
+	assert.True(t, exists("a.pdf"), "O blob ainda é usado por outro recurso")
+
+	assert.NoError(t, s.Resources.TrashResource(shared.ID, shared.UserID, now.Add(-30*24*time.Hour)))
+	purged, err = p.Purge()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.False(t, exists("a.pdf"), "Sem referências, o blob deveria ser apagado")
+	assert.True(t, exists("b.pdf"))
+
+	// Comentários vencidos perdem o texto e saem da lixeira do autor.
+	comment := &models.Comment{ID: primitive.NewObjectID(), ResourceID: recent.ID, UserID: recent.UserID, Content: "Oi", CreatedAt: now}
+	assert.NoError(t, s.Comments.CreateComment(comment))
+	assert.NoError(t, s.Comments.TrashComment(comment.ID, comment.UserID, now.Add(-8*24*time.Hour)))
+	_, err = p.Purge()
+	assert.NoError(t, err)
+	stored, _ := s.Comments.GetCommentByID(comment.ID)
+	assert.Equal(t, models.CommentRemovedContent, stored.Content)
+	trashed, _ := s.Comments.ListTrashedComments(comment.UserID)
+	assert.Empty(t, trashed)
+}
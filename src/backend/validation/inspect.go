@@ -0,0 +1,167 @@
+package validation
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimePPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// executableMagic são os cabeçalhos de executáveis nativos e scripts.
+var executableMagic = []struct {
+	magic []byte
+	kind  string
+}{
+	{[]byte("MZ"), "Windows PE"},
+	{[]byte("\x7fELF"), "ELF"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "Mach-O"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "Mach-O"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "Mach-O"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "Mach-O"},
+	{[]byte{0xca, 0xfe, 0xba, 0xbe}, "Mach-O universal binary"},
+	{[]byte("#!"), "script"},
+}
+
+func executableKind(head []byte) string {
+	for _, e := range executableMagic {
+		if bytes.HasPrefix(head, e.magic) {
+			return e.kind
+		}
+	}
+	return ""
+}
+
+// executableExtensions são recusadas dentro de arquivos ZIP. Scripts de código-fonte
+// (.py, .sh, ...) continuam aceitos: o ZIP de código é um caso de uso comum.
+var executableExtensions = map[string]bool{
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".msi": true, ".com": true,
+	".scr": true, ".bat": true, ".cmd": true, ".ps1": true, ".vbs": true, ".jar": true,
+	".apk": true, ".app": true, ".lnk": true,
+}
+
+type archiveInfo struct {
+	mime string
+	// executable é o nome da primeira entrada executável encontrada.
+	executable string
+}
+
+// inspectArchive distingue os formatos do Office (que são ZIPs) de um ZIP comum e
+// procura executáveis entre as entradas, pela extensão e pelo cabeçalho.
+func inspectArchive(r io.ReaderAt, size int64) (*archiveInfo, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &archiveInfo{mime: "application/zip"}
+	var contentTypes bool
+	prefixes := map[string]bool{}
+	for _, f := range zr.File {
+		name := f.Name
+		if name == "[Content_Types].xml" {
+			contentTypes = true
+		}
+		if i := strings.IndexByte(name, '/'); i > 0 {
+			prefixes[name[:i]] = true
+		}
+		if info.executable != "" || f.FileInfo().IsDir() {
+			continue
+		}
+		if executableExtensions[strings.ToLower(path.Ext(name))] {
+			info.executable = name
+			continue
+		}
+		isExec, err := entryIsExecutable(f)
+		if err != nil {
+			return nil, err
+		}
+		if isExec {
+			info.executable = name
+		}
+	}
+
+	if contentTypes {
+		switch {
+		case prefixes["word"]:
+			info.mime = mimeDOCX
+		case prefixes["ppt"]:
+			info.mime = mimePPTX
+		case prefixes["xl"]:
+			info.mime = mimeXLSX
+		}
+	}
+	return info, nil
+}
+
+func entryIsExecutable(f *zip.File) (bool, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	head := make([]byte, 4)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	// Um script com #! dentro de um ZIP de código é normal; só binários contam aqui.
+	kind := executableKind(head[:n])
+	return kind != "" && kind != "script", nil
+}
+
+// zipEndMagic é a assinatura do "end of central directory", que fica nos últimos
+// bytes de todo ZIP; a busca cobre o comentário de até 64KB que pode vir depois.
+var zipEndMagic = []byte("PK\x05\x06")
+
+const zipTailLen = 22 + 65535
+
+// markupMarkers indicam HTML/script/PHP escondido no início de uma imagem ou PDF,
+// a técnica clássica dos GIFAR e afins.
+var markupMarkers = [][]byte{[]byte("<script"), []byte("<html"), []byte("<?php"), []byte("<svg")}
+
+// polyglotReason procura sinais de que o arquivo também é válido como outro formato.
+// Devolve "" quando não achou nada.
+func polyglotReason(mime string, head []byte, r io.ReaderAt, size int64) (string, error) {
+	if mime != "application/pdf" && bytes.Contains(head, pdfMagic) {
+		return "also contains a PDF document", nil
+	}
+
+	if mime == "application/pdf" || strings.HasPrefix(mime, "image/") {
+		lower := bytes.ToLower(head)
+		for _, marker := range markupMarkers {
+			if bytes.Contains(lower, marker) {
+				return "contains embedded markup or script (" + string(marker) + ")", nil
+			}
+		}
+	}
+
+	if !isZipBased(mime) {
+		tailLen := int64(zipTailLen)
+		if tailLen > size {
+			tailLen = size
+		}
+		tail := make([]byte, tailLen)
+		n, err := r.ReadAt(tail, size-tailLen)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if bytes.Contains(tail[:n], zipEndMagic) {
+			return "also contains a ZIP archive", nil
+		}
+	}
+	return "", nil
+}
+
+var pdfMagic = []byte("%PDF-")
+
+func isZipBased(mime string) bool {
+	return mime == "application/zip" || mime == mimeDOCX || mime == mimePPTX || mime == mimeXLSX
+}
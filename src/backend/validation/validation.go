@@ -0,0 +1,266 @@
+// Package validation confere os arquivos enviados pelos usuários antes de gravá-los:
+// o tipo é descoberto pelo conteúdo (não pela extensão) e comparado com uma lista de
+// tipos permitidos, cada um com seu limite de tamanho.
+package validation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Regras que podem falhar; aparecem no campo "rule" de cada Violation.
+const (
+	RuleEmpty          = "empty"
+	RuleContentType    = "content-type"
+	RuleExtension      = "extension"
+	RuleSize           = "size"
+	RuleExecutable     = "executable"
+	RulePolyglot       = "polyglot"
+	RuleArchiveContent = "archive-content"
+	// RuleMalware não é conferida por Check: é usada por quem passa o arquivo pelo antivírus.
+	RuleMalware = "malware"
+)
+
+// FileType é uma família de arquivos aceita no upload.
+type FileType struct {
+	Name       string
+	MIMETypes  []string
+	Extensions []string
+	MaxSize    int64
+}
+
+func (t *FileType) hasMIME(mime string) bool {
+	for _, m := range t.MIMETypes {
+		if m == mime {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *FileType) hasExtension(ext string) bool {
+	for _, e := range t.Extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+const mb = 1 << 20
+
+// Tipos conhecidos. DefaultPolicy aceita todos; a configuração pode restringir a lista
+// com Only e mudar os limites com WithMaxSize.
+var knownTypes = []FileType{
+	{Name: "pdf", MIMETypes: []string{"application/pdf"}, Extensions: []string{".pdf"}, MaxSize: 100 * mb},
+	{Name: "image", MIMETypes: []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+		Extensions: []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}, MaxSize: 5 * mb},
+	{Name: "docx", MIMETypes: []string{mimeDOCX}, Extensions: []string{".docx"}, MaxSize: 10 * mb},
+	{Name: "pptx", MIMETypes: []string{mimePPTX}, Extensions: []string{".pptx"}, MaxSize: 20 * mb},
+	{Name: "xlsx", MIMETypes: []string{mimeXLSX}, Extensions: []string{".xlsx"}, MaxSize: 10 * mb},
+	{Name: "zip", MIMETypes: []string{"application/zip"}, Extensions: []string{".zip"}, MaxSize: 20 * mb},
+	{Name: "text", MIMETypes: []string{"text/plain"}, Extensions: []string{".txt", ".md"}, MaxSize: 1 * mb},
+	{Name: "video", MIMETypes: []string{"video/mp4", "video/webm"}, Extensions: []string{".mp4", ".webm"}, MaxSize: 500 * mb},
+}
+
+// Policy é a lista de tipos aceitos num ponto de upload.
+type Policy struct {
+	Types []FileType
+}
+
+// DefaultPolicy aceita todos os tipos conhecidos para os materiais.
+func DefaultPolicy() Policy {
+	return Policy{Types: append([]FileType(nil), knownTypes...)}
+}
+
+// AvatarPolicy aceita só imagens de até 2MB.
+func AvatarPolicy() Policy {
+	p, _ := DefaultPolicy().Only("image")
+	p, _ = p.WithMaxSize("image", 2*mb)
+	return p
+}
+
+// Only mantém apenas os tipos com os nomes dados (ex.: "pdf", "image").
+func (p Policy) Only(names ...string) (Policy, error) {
+	var types []FileType
+	for _, name := range names {
+		t := p.find(name)
+		if t == nil {
+			return Policy{}, fmt.Errorf("validation: unknown file type %q", name)
+		}
+		types = append(types, *t)
+	}
+	return Policy{Types: types}, nil
+}
+
+// WithMaxSize troca o limite de tamanho de um tipo.
+func (p Policy) WithMaxSize(name string, max int64) (Policy, error) {
+	types := append([]FileType(nil), p.Types...)
+	out := Policy{Types: types}
+	t := out.find(name)
+	if t == nil {
+		return Policy{}, fmt.Errorf("validation: unknown file type %q", name)
+	}
+	t.MaxSize = max
+	return out, nil
+}
+
+// MaxSize é o maior limite entre os tipos aceitos; serve de teto para o corpo da requisição.
+func (p Policy) MaxSize() int64 {
+	var max int64
+	for _, t := range p.Types {
+		if t.MaxSize > max {
+			max = t.MaxSize
+		}
+	}
+	return max
+}
+
+func (p Policy) find(name string) *FileType {
+	for i := range p.Types {
+		if p.Types[i].Name == name {
+			return &p.Types[i]
+		}
+	}
+	return nil
+}
+
+func (p Policy) typeForMIME(mime string) *FileType {
+	for i := range p.Types {
+		if p.Types[i].hasMIME(mime) {
+			return &p.Types[i]
+		}
+	}
+	return nil
+}
+
+// Violation descreve uma regra que o arquivo não cumpriu.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lista todas as regras que falharam.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Rule + ": " + v.Message
+	}
+	return "validation: " + strings.Join(messages, "; ")
+}
+
+// Result é o que se descobriu de um arquivo aceito.
+type Result struct {
+	Type string
+	MIME string
+	// Extension vem do nome enviado, em minúsculas e já conferida contra o conteúdo.
+	Extension string
+}
+
+// Check confere o arquivo contra a política. Devolve *Error quando alguma regra
+// falha; outros erros são de leitura.
+func (p Policy) Check(fileName string, r io.ReaderAt, size int64) (*Result, error) {
+	if size <= 0 {
+		return nil, &Error{Violations: []Violation{{Rule: RuleEmpty, Message: "The file is empty"}}}
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	// Executáveis são recusados sem olhar mais nada.
+	if kind := executableKind(head); kind != "" {
+		return nil, &Error{Violations: []Violation{{Rule: RuleExecutable, Message: "Executable files are not allowed (" + kind + ")"}}}
+	}
+
+	var violations []Violation
+	mime := sniff(head)
+	var archive *archiveInfo
+	if mime == "application/zip" {
+		archive, err = inspectArchive(r, size)
+		if err != nil {
+			violations = append(violations, Violation{Rule: RuleArchiveContent, Message: "The archive is corrupted"})
+		} else {
+			mime = archive.mime
+			if archive.executable != "" {
+				violations = append(violations, Violation{Rule: RuleArchiveContent,
+					Message: fmt.Sprintf("The archive contains an executable file (%s)", archive.executable)})
+			}
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	t := p.typeForMIME(mime)
+	if t == nil {
+		violations = append(violations, Violation{Rule: RuleContentType,
+			Message: fmt.Sprintf("Files of type %s are not allowed", mime)})
+	} else {
+		if !t.hasExtension(ext) {
+			violations = append(violations, Violation{Rule: RuleExtension,
+				Message: fmt.Sprintf("Extension %q does not match the file content (%s, expected one of %s)",
+					ext, mime, strings.Join(t.Extensions, ", "))})
+		}
+		if size > t.MaxSize {
+			violations = append(violations, Violation{Rule: RuleSize,
+				Message: fmt.Sprintf("File is larger than the %s limit of %d MB", t.Name, t.MaxSize/mb)})
+		}
+	}
+
+	reason, err := polyglotReason(mime, head, r, size)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		violations = append(violations, Violation{Rule: RulePolyglot, Message: "The file " + reason})
+	}
+
+	if len(violations) > 0 {
+		return nil, &Error{Violations: violations}
+	}
+	return &Result{Type: t.Name, MIME: mime, Extension: ext}, nil
+}
+
+// CheckName faz, só com o nome e o tamanho declarado, a parte da verificação que dá
+// para adiantar antes de receber o arquivo (usada ao abrir um upload retomável). O
+// conteúdo ainda passa por Check no fim.
+func (p Policy) CheckName(fileName string, size int64) error {
+	if size <= 0 {
+		return &Error{Violations: []Violation{{Rule: RuleEmpty, Message: "The file is empty"}}}
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, t := range p.Types {
+		if !t.hasExtension(ext) {
+			continue
+		}
+		if size > t.MaxSize {
+			return &Error{Violations: []Violation{{Rule: RuleSize,
+				Message: fmt.Sprintf("File is larger than the %s limit of %d MB", t.Name, t.MaxSize/mb)}}}
+		}
+		return nil
+	}
+	return &Error{Violations: []Violation{{Rule: RuleExtension,
+		Message: fmt.Sprintf("Extension %q is not allowed", ext)}}}
+}
+
+// sniffLen cobre o que http.DetectContentType olha (512 bytes) e a janela em que os
+// leitores de PDF aceitam o cabeçalho %PDF- (1024 bytes).
+const sniffLen = 1024
+
+// sniff devolve o tipo MIME sem parâmetros (ex.: "text/plain").
+func sniff(head []byte) string {
+	mime := http.DetectContentType(head)
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	return strings.TrimSpace(mime)
+}
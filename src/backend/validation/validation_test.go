@@ -0,0 +1,131 @@
+package validation
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pngBytes(t *testing.T) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func check(p Policy, name string, data []byte) (*Result, error) {
+	return p.Check(name, bytes.NewReader(data), int64(len(data)))
+}
+
+// rules devolve as regras que falharam, na ordem em que foram reportadas.
+func rules(t *testing.T, err error) []string {
+	verr, ok := err.(*Error)
+	if !assert.True(t, ok, "esperava *Error, veio %v", err) {
+		return nil
+	}
+	var out []string
+	for _, v := range verr.Violations {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestCheckAccepted(t *testing.T) {
+	p := DefaultPolicy()
+	cases := []struct {
+		name, fileName string
+		data           []byte
+		wantType       string
+	}{
+		{"PDF", "prova.PDF", []byte("%PDF-1.4\n1 0 obj\n"), "pdf"},
+		{"PNG", "foto.png", pngBytes(t), "image"},
+		{"ZIP de código", "ep1.zip", zipBytes(t, map[string]string{"main.py": "print(1)", "run.sh": "#!/bin/sh\necho"}), "zip"},
+		{"DOCX", "resumo.docx", zipBytes(t, map[string]string{"[Content_Types].xml": "<Types/>", "word/document.xml": "<w/>"}), "docx"},
+		{"Texto", "notas.md", []byte("# Notas de aula\n"), "text"},
+		{"Vídeo", "aula.mp4", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), "video"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := check(p, c.fileName, c.data)
+			if assert.NoError(t, err) {
+				assert.Equal(t, c.wantType, res.Type)
+			}
+		})
+	}
+
+	res, _ := check(p, "prova.PDF", []byte("%PDF-1.4"))
+	assert.Equal(t, ".pdf", res.Extension, "A extensão deve ser normalizada")
+}
+
+func TestCheckRejected(t *testing.T) {
+	p, _ := DefaultPolicy().WithMaxSize("pdf", 20*mb)
+	png := pngBytes(t)
+	cases := []struct {
+		name, fileName string
+		data           []byte
+		want           []string
+	}{
+		{"Vazio", "a.pdf", nil, []string{RuleEmpty}},
+		{"Executável do Windows", "prova.pdf", append([]byte("MZ\x90\x00"), make([]byte, 64)...), []string{RuleExecutable}},
+		{"ELF", "notas.txt", []byte("\x7fELF\x02\x01\x01"), []string{RuleExecutable}},
+		{"Extensão não bate com o conteúdo", "foto.pdf", png, []string{RuleExtension}},
+		{"Tipo fora da lista", "audio.mp3", []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), []string{RuleContentType}},
+		{"Executável dentro do ZIP", "ep.zip", zipBytes(t, map[string]string{"setup.exe": "MZ"}), []string{RuleArchiveContent}},
+		{"Binário com nome inocente no ZIP", "ep.zip", zipBytes(t, map[string]string{"dados.bin": "\x7fELF...."}), []string{RuleArchiveContent}},
+		{"Imagem com ZIP anexado", "foto.png", append(append([]byte(nil), png...), zipBytes(t, map[string]string{"a.txt": "x"})...), []string{RulePolyglot}},
+		{"Imagem com script", "foto.gif", []byte("GIF89a<script>alert(1)</script>"), []string{RulePolyglot}},
+		{"Texto com PDF escondido", "notas.txt", []byte("olá\n%PDF-1.4\n"), []string{RulePolyglot}},
+		{"Várias regras de uma vez", "foto.jpg", append([]byte("%PDF-1.4\n"), make([]byte, 21*mb)...), []string{RuleExtension, RuleSize}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := check(p, c.fileName, c.data)
+			assert.Nil(t, res)
+			assert.Equal(t, c.want, rules(t, err))
+		})
+	}
+}
+
+func TestPolicyConfiguration(t *testing.T) {
+	p, err := DefaultPolicy().Only("pdf", "image")
+	assert.NoError(t, err)
+	_, err = check(p, "ep.zip", zipBytes(t, map[string]string{"a.c": "int main;"}))
+	assert.Equal(t, []string{RuleContentType}, rules(t, err))
+
+	p, err = p.WithMaxSize("pdf", 10)
+	assert.NoError(t, err)
+	_, err = check(p, "prova.pdf", []byte("%PDF-1.4 maior que dez bytes"))
+	assert.Equal(t, []string{RuleSize}, rules(t, err))
+	assert.Equal(t, int64(100*mb), DefaultPolicy().find("pdf").MaxSize, "WithMaxSize não pode alterar a política original")
+
+	_, err = DefaultPolicy().Only("exe")
+	assert.Error(t, err)
+
+	_, err = check(AvatarPolicy(), "avatar.pdf", []byte("%PDF-1.4"))
+	assert.Equal(t, []string{RuleContentType}, rules(t, err))
+	_, err = check(AvatarPolicy(), "avatar.png", pngBytes(t))
+	assert.NoError(t, err)
+}
+
+func TestCheckName(t *testing.T) {
+	p := DefaultPolicy()
+	assert.NoError(t, p.CheckName("Prova.PDF", 1024))
+	assert.Equal(t, []string{RuleExtension}, rules(t, p.CheckName("setup.exe", 1024)))
+	assert.Equal(t, []string{RuleSize}, rules(t, p.CheckName("foto.png", 6*mb)))
+	assert.Equal(t, []string{RuleEmpty}, rules(t, p.CheckName("prova.pdf", 0)))
+}
@@ -31,7 +31,7 @@ describe('ExplorePage', () => {
 
   beforeEach(() => {
     mockedApiClient.get.mockImplementation((url) => {
-      if (url.endsWith('/resources')) return Promise.resolve({ data: mockApiResponse.resources });
+      if (url.endsWith('/resources')) return Promise.resolve({ data: { items: mockApiResponse.resources, total: mockApiResponse.resources.length } });
       if (url.endsWith('/tags')) return Promise.resolve({ data: mockApiResponse.tags });
       if (url.endsWith('/professors')) return Promise.resolve({ data: mockApiResponse.professors });
       return Promise.resolve({ data: [] });
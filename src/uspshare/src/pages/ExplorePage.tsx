@@ -152,12 +152,12 @@ export default function ExplorePage() {
               tagsRes, 
               profsRes, 
             ] = await Promise.all([
-              apiClient.get('/api/resources'),
+              apiClient.get('/api/resources', { params: { limit: 100 } }),
               apiClient.get('/api/data/tags'),
               apiClient.get('/api/data/professors'),
             ]);
 
-            setAllResources(resourcesRes.data || []);
+            setAllResources(resourcesRes.data?.items || []);
             setFilterOptions({
               tags: tagsRes.data || [],
               professors: profsRes.data || [],
@@ -38,7 +38,6 @@ const mockData = {
     title: 'Prova de Cálculo I',
     type: 'prova',
     tags: ['P1'],
-    fileUrl: '/uploads/calculo_p1.pdf',
     likes: 42,
     fileName: 'calculo_p1.pdf',
     description: 'Primeira prova de Cálculo I de 2024.',
@@ -48,10 +48,10 @@ import { useLikes } from "../context/LikesContext"
 pdfjs.GlobalWorkerOptions.workerSrc = `/pdf.worker.min.mjs`;
 
 interface FileData {
+  id: string;
   title: string;
   type: string;
   tags?: string[];
-  fileUrl: string;
   likes: number;
   fileName: string;
   description?: string;
@@ -92,7 +92,7 @@ interface RelatedFileData {
 
 const FilePreviewer = ({ file, backendUrl }: FilePreviewerProps) => {
   const fileExtension = file.fileName.split('.').pop()?.toLowerCase() || '';
-  const fileFullUrl = `${backendUrl}${file.fileUrl}`;
+  const fileFullUrl = `${backendUrl}/api/resource/${file.id}/download?view=true`;
 
   const [imageOpen, setImageOpen] = useState(false);
   
@@ -348,7 +348,7 @@ export default function FilePage() {
             </Button>
             <Button 
               component="a" 
-              href={backendUrl + file.fileUrl} 
+              href={`${backendUrl}/api/resource/${file.id}/download`} 
               download={file.title} 
               variant="outlined" 
               startIcon={<DownloadIcon />}
@@ -75,7 +75,7 @@ describe('Navbar', () => {
         logout: mockLogout,
       });
 
-      mockedApiClient.get.mockResolvedValue({ data: mockNotifications });
+      mockedApiClient.get.mockResolvedValue({ data: { items: mockNotifications } });
     });
 
     afterEach(() => {
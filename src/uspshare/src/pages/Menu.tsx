@@ -89,8 +89,8 @@ export default function Navbar() {
     const fetchNotifications = async () => {
       if (isAuthenticated) {
         try {
-          const response = await apiClient.get<Notification[]>('/api/notifications');
-          setNotifications(response.data || []);
+          const response = await apiClient.get<{ items: Notification[]; next?: string }>('/api/notifications');
+          setNotifications(response.data?.items || []);
         } catch (error) {
           console.error("Failed to fetch notifications:", error);
         }